@@ -21,7 +21,6 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/cloud-provider/app"
 	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
-	"k8s.io/cloud-provider/names"
 	"k8s.io/cloud-provider/options"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/logs"
@@ -30,6 +29,9 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// onmetalCloud is the cloud provider once initialized.
+var onmetalCloud cloudprovider.Interface
+
 func main() {
 	logs.InitLogs()
 	defer logs.FlushLogs()
@@ -39,14 +41,26 @@ func main() {
 		klog.Fatalf("unable to initialize command options: %v", err)
 	}
 
-	controllerInitializers := app.DefaultInitFuncConstructors
 	namedFlagSets := cliflag.NamedFlagSets{}
 
 	onmetal.AddExtraFlags(pflag.CommandLine)
 
-	controllerAliases := names.CCMControllerAliases()
+	// the Service webhook is served once enabled by --webhooks and the CloudControllerManagerWebhook feature gate
+	app.WebhooksDisabledByDefault.Insert(onmetal.ServiceWebhookName)
+
+	builder := app.NewBuilder()
+	builder.SetOptions(opts)
+	builder.SetCloudInitializer(cloudInitializer)
+	builder.RegisterDefaultControllers()
+	builder.RegisterWebhook(onmetal.ServiceWebhookName, onmetal.NewServiceWebhookConfig(func() cloudprovider.Interface {
+		return onmetalCloud
+	}))
+	builder.AddFlags(namedFlagSets)
+	builder.SetStopChannel(wait.NeverStop)
 
-	command := app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, controllerAliases, namedFlagSets, wait.NeverStop)
+	command := builder.BuildCommand()
+	command.AddCommand(onmetal.NewSmokeTestCommand())
+	command.AddCommand(onmetal.NewMultiClusterCommand())
 
 	if err := command.Execute(); err != nil {
 		klog.Fatalf("unable to execute command: %v", err)
@@ -78,5 +92,6 @@ func cloudInitializer(config *cloudcontrollerconfig.CompletedConfig) cloudprovid
 		}
 	}
 
+	onmetalCloud = cloud
 	return cloud
 }
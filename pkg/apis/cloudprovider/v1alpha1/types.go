@@ -0,0 +1,94 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CloudProviderReportStatus summarizes the resources managed by the onmetal cloud provider.
+type CloudProviderReportStatus struct {
+	// ClusterName is the name of the cluster the cloud provider manages resources for.
+	ClusterName string `json:"clusterName,omitempty"`
+	// Namespace is the onmetal namespace the cloud provider manages resources in.
+	Namespace string `json:"namespace,omitempty"`
+	// LoadBalancers is the number of LoadBalancers managed for the cluster.
+	LoadBalancers int32 `json:"loadBalancers"`
+	// PendingLoadBalancers is the number of managed LoadBalancers whose IPs are not allocated yet.
+	PendingLoadBalancers int32 `json:"pendingLoadBalancers"`
+	// OrphanCandidates is the number of managed LoadBalancers whose Service does not exist anymore.
+	OrphanCandidates int32 `json:"orphanCandidates"`
+	// Features are the optional features enabled in the cloud config.
+	Features []string `json:"features,omitempty"`
+	// LastUpdateTime is the time the report was last updated.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="LoadBalancers",type=integer,JSONPath=`.status.loadBalancers`
+// +kubebuilder:printcolumn:name="Pending",type=integer,JSONPath=`.status.pendingLoadBalancers`
+// +kubebuilder:printcolumn:name="Orphans",type=integer,JSONPath=`.status.orphanCandidates`
+// +kubebuilder:printcolumn:name="Updated",type=date,JSONPath=`.status.lastUpdateTime`
+
+// CloudProviderReport reports the resources managed by the onmetal cloud provider. It is updated periodically by the
+// cloud provider and has no spec.
+type CloudProviderReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status CloudProviderReportStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CloudProviderReportList is a list of CloudProviderReports.
+type CloudProviderReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudProviderReport `json:"items"`
+}
+
+// DNSRecordSpec is the desired state of a DNSRecord.
+type DNSRecordSpec struct {
+	// Hostname is the fully qualified domain name of the record.
+	Hostname string `json:"hostname"`
+	// Addresses are the IPs the hostname resolves to, published as A and AAAA records.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Hostname",type=string,JSONPath=`.spec.hostname`
+// +kubebuilder:printcolumn:name="Addresses",type=string,JSONPath=`.spec.addresses`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DNSRecord requests a DNS record for the ingress IPs of a LoadBalancer Service. It is managed by the onmetal cloud
+// provider next to the Service and published by an external DNS controller.
+type DNSRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DNSRecordSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSRecordList is a list of DNSRecords.
+type DNSRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSRecord `json:"items"`
+}
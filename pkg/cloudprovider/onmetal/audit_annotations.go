@@ -0,0 +1,53 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The objects written by the cloud provider are stamped with the version of the writing cloud provider and the Service
+// they are derived from, so that writes of several cloud providers can be traced back. The resource version of the
+// Service is deliberately not recorded, as every change of the Service would rewrite the objects.
+
+// ccmVersion is the version of the cloud provider as set by the build, see k8s.io/component-base/version.
+var ccmVersion = version.Get().GitVersion
+
+// getAuditAnnotations returns the annotations recording the version of the cloud provider, the cluster and the
+// Service an object is derived from. Without a Service, only the version and the cluster are recorded.
+func getAuditAnnotations(clusterName string, service *corev1.Service) map[string]string {
+	annotations := map[string]string{
+		AnnotationKeyCCMVersion:  ccmVersion,
+		AnnotationKeyClusterName: clusterName,
+	}
+	if service != nil {
+		annotations[AnnotationKeyServiceUID] = string(service.UID)
+	}
+	return annotations
+}
+
+// setAuditAnnotations adds the audit annotations to the object, see getAuditAnnotations.
+func setAuditAnnotations(obj client.Object, clusterName string, service *corev1.Service) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for key, value := range getAuditAnnotations(clusterName, service) {
+		annotations[key] = value
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Audit annotations", func() {
+	var service *corev1.Service
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", UID: "service-uid", ResourceVersion: "42"},
+		}
+	})
+
+	It("should record the cloud provider version, the cluster and the Service", func() {
+		Expect(getAuditAnnotations("cluster", service)).To(Equal(map[string]string{
+			AnnotationKeyCCMVersion:  ccmVersion,
+			AnnotationKeyClusterName: "cluster",
+			AnnotationKeyServiceUID:  "service-uid",
+		}))
+	})
+
+	It("should only record the cloud provider version and the cluster without a Service", func() {
+		Expect(getAuditAnnotations("cluster", nil)).To(Equal(map[string]string{
+			AnnotationKeyCCMVersion:  ccmVersion,
+			AnnotationKeyClusterName: "cluster",
+		}))
+	})
+
+	It("should keep the other annotations of the object", func() {
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"foo": "bar", AnnotationKeyCCMVersion: "v0.0.1"}},
+		}
+		setAuditAnnotations(loadBalancerRouting, "cluster", service)
+		Expect(loadBalancerRouting.Annotations).To(HaveKeyWithValue("foo", "bar"))
+		Expect(loadBalancerRouting.Annotations).To(HaveKeyWithValue(AnnotationKeyServiceUID, "service-uid"))
+		Expect(loadBalancerRouting.Annotations).To(HaveKeyWithValue(AnnotationKeyCCMVersion, ccmVersion))
+	})
+
+	It("should annotate objects without annotations", func() {
+		machine := &computev1alpha1.Machine{}
+		setAuditAnnotations(machine, "cluster", nil)
+		Expect(machine.Annotations).To(HaveKeyWithValue(AnnotationKeyClusterName, "cluster"))
+		Expect(machine.Annotations).NotTo(HaveKey(AnnotationKeyServiceUID))
+	})
+})
@@ -0,0 +1,661 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	retryInitDelay = 200 * time.Millisecond
+	retryFactor    = 2.0
+	retryJitter    = 0.1
+
+	// maxRetryAfterDelay caps the delay the onmetal API may ask for in a throttling response.
+	maxRetryAfterDelay = time.Minute
+)
+
+// transientWebhookRejections counts writes rejected because an admission webhook of the onmetal API could not be
+// called, e.g. while it is being upgraded.
+var transientWebhookRejections = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Subsystem:      "cloud_provider_onmetal",
+		Name:           "transient_webhook_rejections_total",
+		Help:           "Number of onmetal API operations rejected because an admission webhook could not be called.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"operation"},
+)
+
+func init() {
+	legacyregistry.MustRegister(transientWebhookRejections)
+}
+
+// transientWebhookErrorMessages are parts of the messages of errors calling an admission webhook which indicate that
+// the webhook is temporarily unavailable rather than rejecting the request.
+var transientWebhookErrorMessages = []string{
+	"connection refused",
+	"connection reset by peer",
+	"no endpoints available for service",
+	"service unavailable",
+	"i/o timeout",
+	"context deadline exceeded",
+	"EOF",
+}
+
+// isTransientWebhookRejection returns whether the error was returned because an admission webhook of the onmetal API
+// could not be called. Such requests are rejected before they are persisted and are safe to retry. Requests denied by
+// a webhook are not transient.
+func isTransientWebhookRejection(err error) bool {
+	if !apierrors.IsInternalError(err) {
+		return false
+	}
+	message := err.Error()
+	if !strings.Contains(message, "failed calling webhook") {
+		return false
+	}
+	for _, transientMessage := range transientWebhookErrorMessages {
+		if strings.Contains(message, transientMessage) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrOnmetalAPIThrottled is returned if requests to the onmetal API are throttled and the retry budget of an
+// operation is exhausted or the circuit breaker is open.
+var ErrOnmetalAPIThrottled = errors.New("onmetal API throttled")
+
+// ClientOptions configures the client used to talk to the onmetal API.
+type ClientOptions struct {
+	// QPS is the maximum number of queries per second to the onmetal API. Zero keeps the client-go default.
+	QPS float32
+	// Burst is the maximum burst of queries to the onmetal API. Zero keeps the client-go default.
+	Burst int
+	// MaxRetries is the number of retries of a single operation that got throttled by the onmetal API.
+	MaxRetries int
+	// CircuitBreakerThreshold is the number of consecutive throttled operations after which all operations fail
+	// immediately for CircuitBreakerCooldown. Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is the duration the circuit breaker stays open.
+	CircuitBreakerCooldown time.Duration
+}
+
+// applyToRestConfig applies the rate limits of the options to the given rest config.
+func (o ClientOptions) applyToRestConfig(cfg *rest.Config) {
+	if o.QPS > 0 {
+		cfg.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		cfg.Burst = o.Burst
+	}
+}
+
+// newClientFunc returns a client.NewClientFunc wrapping the created client with the retry and circuit breaker
+// behavior of the options.
+func (o ClientOptions) newClientFunc() client.NewClientFunc {
+	return func(config *rest.Config, options client.Options) (client.Client, error) {
+		c, err := client.New(config, options)
+		if err != nil {
+			return nil, err
+		}
+		return newThrottlingAwareClient(c, o, clock.RealClock{}), nil
+	}
+}
+
+// throttlingAwareClient retries write and read operations which got throttled by the onmetal API and opens a
+// circuit breaker if the onmetal API keeps throttling. Operations transiently rejected by an admission webhook are
+// retried as well but do not count towards the circuit breaker.
+type throttlingAwareClient struct {
+	client.Client
+
+	backoff                 wait.Backoff
+	sleep                   func(ctx context.Context, d time.Duration) error
+	circuitBreakerThreshold int
+	circuitBreakerCooldown  time.Duration
+	clock                   clock.Clock
+
+	mu                   sync.Mutex
+	consecutiveThrottled int
+	openUntil            time.Time
+}
+
+func newThrottlingAwareClient(c client.Client, opts ClientOptions, clk clock.Clock) *throttlingAwareClient {
+	return &throttlingAwareClient{
+		Client: c,
+		backoff: wait.Backoff{
+			Duration: retryInitDelay,
+			Factor:   retryFactor,
+			Jitter:   retryJitter,
+			Steps:    opts.MaxRetries + 1,
+		},
+		sleep:                   sleepWithContext,
+		circuitBreakerThreshold: opts.CircuitBreakerThreshold,
+		circuitBreakerCooldown:  opts.CircuitBreakerCooldown,
+		clock:                   clk,
+	}
+}
+
+func (c *throttlingAwareClient) do(ctx context.Context, operation string, fn func() error) error {
+	if c.isOpen() {
+		return fmt.Errorf("%s: %w: circuit breaker is open", operation, ErrOnmetalAPIThrottled)
+	}
+
+	backoff := c.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if !c.isRetriable(operation, err) || attempt >= c.backoff.Steps {
+			break
+		}
+		delay := backoff.Step()
+		if retryAfter, ok := retryAfterDelay(err); ok && retryAfter > delay {
+			// the onmetal API asked to back off for longer than the next step of the backoff
+			delay = retryAfter
+		}
+		if c.sleep(ctx, delay) != nil {
+			break
+		}
+	}
+	if apierrors.IsTooManyRequests(err) {
+		c.recordThrottled()
+		return fmt.Errorf("%s: %w: %w", operation, ErrOnmetalAPIThrottled, err)
+	}
+	c.recordNotThrottled()
+	return err
+}
+
+func (c *throttlingAwareClient) isRetriable(operation string, err error) bool {
+	if isTransientWebhookRejection(err) {
+		klog.V(2).InfoS("Retrying operation transiently rejected by an onmetal admission webhook", "Operation", operation, "Error", err)
+		transientWebhookRejections.WithLabelValues(operation).Inc()
+		return true
+	}
+	return apierrors.IsTooManyRequests(err)
+}
+
+// retryAfterDelay returns the jittered delay the onmetal API asked for with the Retry-After header of a throttling
+// response, capped to maxRetryAfterDelay. It returns false if the error is no throttling response or asks for no
+// delay.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	if !apierrors.IsTooManyRequests(err) {
+		return 0, false
+	}
+	seconds, ok := apierrors.SuggestsClientDelay(err)
+	if !ok || seconds <= 0 {
+		return 0, false
+	}
+	delay := time.Duration(seconds) * time.Second
+	if delay > maxRetryAfterDelay {
+		delay = maxRetryAfterDelay
+	}
+	// the jitter spreads the retries of all operations throttled at the same time
+	return wait.Jitter(delay, retryJitter), true
+}
+
+// sleepWithContext sleeps for the given duration or until the context is done.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *throttlingAwareClient) isOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock.Now().Before(c.openUntil)
+}
+
+func (c *throttlingAwareClient) recordThrottled() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consecutiveThrottled++
+	if c.circuitBreakerThreshold > 0 && c.consecutiveThrottled >= c.circuitBreakerThreshold {
+		klog.Warningf("onmetal API throttled %d consecutive operations, failing operations for %s", c.consecutiveThrottled, c.circuitBreakerCooldown)
+		c.openUntil = c.clock.Now().Add(c.circuitBreakerCooldown)
+		c.consecutiveThrottled = 0
+	}
+}
+
+func (c *throttlingAwareClient) recordNotThrottled() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consecutiveThrottled = 0
+}
+
+func (c *throttlingAwareClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.do(ctx, "get", func() error {
+		return c.Client.Get(ctx, key, obj, opts...)
+	})
+}
+
+func (c *throttlingAwareClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.do(ctx, "list", func() error {
+		return c.Client.List(ctx, list, opts...)
+	})
+}
+
+func (c *throttlingAwareClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.do(ctx, "create", func() error {
+		return c.Client.Create(ctx, obj, opts...)
+	})
+}
+
+func (c *throttlingAwareClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return c.do(ctx, "delete", func() error {
+		return c.Client.Delete(ctx, obj, opts...)
+	})
+}
+
+func (c *throttlingAwareClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.do(ctx, "update", func() error {
+		return c.Client.Update(ctx, obj, opts...)
+	})
+}
+
+func (c *throttlingAwareClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.do(ctx, "patch", func() error {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+// dryRunClient performs all writes as server-side dry-run and logs the written objects.
+type dryRunClient struct {
+	client.Client
+}
+
+func newDryRunClient(c client.Client) client.Client {
+	return &dryRunClient{Client: client.NewDryRunClient(c)}
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	klog.InfoS("Dry-run: creating object", "Type", fmt.Sprintf("%T", obj), "Object", client.ObjectKeyFromObject(obj))
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	klog.InfoS("Dry-run: deleting object", "Type", fmt.Sprintf("%T", obj), "Object", client.ObjectKeyFromObject(obj))
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	klog.InfoS("Dry-run: updating object", "Type", fmt.Sprintf("%T", obj), "Object", client.ObjectKeyFromObject(obj))
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return fmt.Errorf("failed to compute patch of %s: %w", client.ObjectKeyFromObject(obj), err)
+	}
+	klog.InfoS("Dry-run: patching object", "Type", fmt.Sprintf("%T", obj), "Object", client.ObjectKeyFromObject(obj), "PatchType", patch.Type(), "Patch", string(data))
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// observedDrift counts the writes to the onmetal API computed in observer mode which would change the onmetal API.
+var observedDrift = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Subsystem:      "cloud_provider_onmetal",
+		Name:           "observed_drift_total",
+		Help:           "Number of writes computed in observer mode which would change the state of the onmetal API.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"kind", "operation"},
+)
+
+func init() {
+	legacyregistry.MustRegister(observedDrift)
+}
+
+// observerClient never writes to the onmetal API. Instead, it compares every write to the current state of the
+// written object and reports the drift.
+type observerClient struct {
+	client.Client
+}
+
+func newObserverClient(c client.Client) client.Client {
+	return &observerClient{Client: c}
+}
+
+func (c *observerClient) reportDrift(operation string, obj client.Object, drift bool, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to compute drift of %s: %w", client.ObjectKeyFromObject(obj), err)
+	}
+	if !drift {
+		return nil
+	}
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	klog.InfoS("Observer: onmetal API drifted from the desired state", "Kind", kind, "Object", client.ObjectKeyFromObject(obj), "Operation", operation)
+	observedDrift.WithLabelValues(kind, operation).Inc()
+	return nil
+}
+
+func (c *observerClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	drift, err := hasDrift(ctx, c.Client, obj)
+	return c.reportDrift("create", obj, drift, err)
+}
+
+func (c *observerClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	current := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+	return c.reportDrift("delete", obj, true, nil)
+}
+
+func (c *observerClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	drift, err := hasDrift(ctx, c.Client, obj)
+	return c.reportDrift("update", obj, drift, err)
+}
+
+func (c *observerClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() == types.ApplyPatchType {
+		drift, err := hasDrift(ctx, c.Client, obj)
+		return c.reportDrift("apply", obj, drift, err)
+	}
+	data, err := patch.Data(obj)
+	return c.reportDrift("patch", obj, err == nil && string(data) != "{}", err)
+}
+
+func (c *observerClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return c.reportDrift("deleteallof", obj, true, nil)
+}
+
+func (c *observerClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *observerClient) SubResource(subResource string) client.SubResourceClient {
+	return &observerSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), observer: c}
+}
+
+// observerSubResourceClient never writes subresources to the onmetal API and reports the drift instead.
+type observerSubResourceClient struct {
+	client.SubResourceClient
+	observer *observerClient
+}
+
+func (c *observerSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return c.observer.reportDrift("create", obj, true, nil)
+}
+
+func (c *observerSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return c.observer.reportDrift("update", obj, true, nil)
+}
+
+func (c *observerSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	data, err := patch.Data(obj)
+	return c.observer.reportDrift("patch", obj, err == nil && string(data) != "{}", err)
+}
+
+// readOnlyClient rejects all writes to the onmetal API with ErrReadOnly, so features not supported with readOnly fail
+// instead of requiring write permissions.
+type readOnlyClient struct {
+	client.Client
+}
+
+func newReadOnlyClient(c client.Client) client.Client {
+	return &readOnlyClient{Client: c}
+}
+
+func (c *readOnlyClient) reject(operation string, obj client.Object) error {
+	return fmt.Errorf("failed to %s %T %s: %w", operation, obj, client.ObjectKeyFromObject(obj), ErrReadOnly)
+}
+
+func (c *readOnlyClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.reject("create", obj)
+}
+
+func (c *readOnlyClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return c.reject("delete", obj)
+}
+
+func (c *readOnlyClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.reject("update", obj)
+}
+
+func (c *readOnlyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.reject("patch", obj)
+}
+
+func (c *readOnlyClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return c.reject("delete all of", obj)
+}
+
+func (c *readOnlyClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *readOnlyClient) SubResource(subResource string) client.SubResourceClient {
+	return &readOnlySubResourceClient{SubResourceClient: c.Client.SubResource(subResource), readOnly: c}
+}
+
+// readOnlySubResourceClient rejects all writes of subresources to the onmetal API with ErrReadOnly.
+type readOnlySubResourceClient struct {
+	client.SubResourceClient
+	readOnly *readOnlyClient
+}
+
+func (c *readOnlySubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return c.readOnly.reject("create", obj)
+}
+
+func (c *readOnlySubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return c.readOnly.reject("update", obj)
+}
+
+func (c *readOnlySubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return c.readOnly.reject("patch", obj)
+}
+
+// hasDrift returns whether the current state of the object differs from the desired object, i.e. whether the object
+// is missing or any of the labels, annotations or other fields but the status set in the desired object differ.
+func hasDrift(ctx context.Context, c client.Reader, desired client.Object) (bool, error) {
+	current := desired.DeepCopyObject().(client.Object)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	desiredFields, err := getDriftRelevantFields(desired)
+	if err != nil {
+		return false, err
+	}
+	currentFields, err := getDriftRelevantFields(current)
+	if err != nil {
+		return false, err
+	}
+	return !isSubset(desiredFields, currentFields), nil
+}
+
+// getDriftedFields returns the fields of the current object which differ from the ones set in the desired object, see
+// hasDrift. Drifted fields of the spec are returned as spec.<field>, the other fields by their top-level name.
+func getDriftedFields(desired, current client.Object) ([]string, error) {
+	desiredFields, err := getDriftRelevantFields(desired)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := getDriftRelevantFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifted []string
+	for _, key := range sets.List(sets.KeySet(desiredFields)) {
+		desiredSpec, ok := desiredFields[key].(map[string]interface{})
+		if key != "spec" || !ok {
+			if !isSubset(desiredFields[key], currentFields[key]) {
+				drifted = append(drifted, key)
+			}
+			continue
+		}
+		currentSpec, _ := currentFields[key].(map[string]interface{})
+		for _, specKey := range sets.List(sets.KeySet(desiredSpec)) {
+			if !isSubset(desiredSpec[specKey], currentSpec[specKey]) {
+				drifted = append(drifted, key+"."+specKey)
+			}
+		}
+	}
+	return drifted, nil
+}
+
+// setDriftedFields sets the drifted fields of the object, see getDriftedFields, to the ones of the desired object. The
+// labels and annotations of the desired object are added to the ones of the object.
+func setDriftedFields(desired, obj client.Object, drifted []string) error {
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	for _, field := range drifted {
+		if field == "labels" || field == "annotations" {
+			continue
+		}
+		path := strings.Split(field, ".")
+		value, _, err := unstructured.NestedFieldCopy(desiredContent, path...)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(content, value, path...); err != nil {
+			return err
+		}
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj); err != nil {
+		return err
+	}
+
+	if slices.Contains(drifted, "labels") {
+		obj.SetLabels(mergeStringMaps(obj.GetLabels(), desired.GetLabels()))
+	}
+	if slices.Contains(drifted, "annotations") {
+		obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), desired.GetAnnotations()))
+	}
+	return nil
+}
+
+// mergeStringMaps returns a map with the entries of current overridden by the ones of desired.
+func mergeStringMaps(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range desired {
+		merged[key] = value
+	}
+	return merged
+}
+
+// getDriftRelevantFields returns the labels, annotations and all top-level fields but the metadata and the status of
+// the object, e.g. the spec of LoadBalancers and the network and destinations of LoadBalancerRoutings. The version of
+// the cloud provider which wrote the object is left out, so cloud providers of different versions do not report each
+// other's writes as drift.
+func getDriftRelevantFields(obj client.Object) (map[string]interface{}, error) {
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	delete(fields, "metadata")
+	delete(fields, "status")
+
+	var annotations map[string]string
+	for key, value := range obj.GetAnnotations() {
+		if key == AnnotationKeyCCMVersion {
+			continue
+		}
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[key] = value
+	}
+	fields["labels"] = obj.GetLabels()
+	fields["annotations"] = annotations
+	return fields, nil
+}
+
+// isSubset returns whether all values set in desired are equal to the values in current. Maps are compared by the keys
+// of desired, lists item by item, all other values have to be equal.
+func isSubset(desired, current interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		currentMap, ok := current.(map[string]interface{})
+		if !ok {
+			return len(desired) == 0
+		}
+		for key, value := range desired {
+			if !isSubset(value, currentMap[key]) {
+				return false
+			}
+		}
+		return true
+	case map[string]string:
+		currentMap, _ := current.(map[string]string)
+		for key, value := range desired {
+			if currentValue, ok := currentMap[key]; !ok || currentValue != value {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		currentList, _ := current.([]interface{})
+		if len(desired) != len(currentList) {
+			return false
+		}
+		for i := range desired {
+			if !isSubset(desired[i], currentList[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
+	default:
+		return equality.Semantic.DeepEqual(desired, current)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		calls      int
+		throttled  int
+		retryAfter int
+		clk        *clocktesting.FakeClock
+		delays     []time.Duration
+		c          client.Client
+	)
+
+	BeforeEach(func() {
+		calls = 0
+		throttled = 0
+		retryAfter = 1
+		delays = nil
+		clk = clocktesting.NewFakeClock(time.Now())
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				calls++
+				if calls <= throttled {
+					return apierrors.NewTooManyRequests("throttled", retryAfter)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+		throttlingAwareClient := newThrottlingAwareClient(fakeClient, ClientOptions{
+			MaxRetries:              1,
+			CircuitBreakerThreshold: 1,
+			CircuitBreakerCooldown:  time.Minute,
+		}, clk)
+		throttlingAwareClient.sleep = func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+		c = throttlingAwareClient
+	})
+
+	It("should retry a throttled operation within the retry budget", func(ctx SpecContext) {
+		throttled = 1
+		err := c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(calls).To(Equal(2))
+
+		By("waiting the jittered delay the onmetal API asked for")
+		Expect(delays).To(ConsistOf(BeNumerically("~", time.Second, 100*time.Millisecond)))
+	})
+
+	It("should cap the delay the onmetal API asked for", func(ctx SpecContext) {
+		throttled = 1
+		retryAfter = 3600
+		err := c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(delays).To(ConsistOf(BeNumerically("~", maxRetryAfterDelay, maxRetryAfterDelay/10)))
+	})
+
+	It("should fall back to the backoff if the onmetal API asked for no delay", func(ctx SpecContext) {
+		throttled = 1
+		retryAfter = 0
+		err := c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(delays).To(ConsistOf(BeNumerically("~", retryInitDelay, retryInitDelay/10)))
+	})
+
+	It("should open the circuit breaker once the retry budget is exhausted", func(ctx SpecContext) {
+		throttled = 2
+		err := c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(err).To(MatchError(ErrOnmetalAPIThrottled))
+		Expect(calls).To(Equal(2))
+
+		By("failing immediately while the circuit breaker is open")
+		err = c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(err).To(MatchError(ErrOnmetalAPIThrottled))
+		Expect(calls).To(Equal(2))
+
+		By("closing the circuit breaker after the cooldown")
+		clk.Step(time.Minute)
+		err = c.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "bar"}, &networkingv1alpha1.LoadBalancer{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(calls).To(Equal(3))
+	})
+})
+
+var _ = Describe("Client webhook rejections", func() {
+	var (
+		calls    int
+		rejected int
+		err      error
+		c        client.Client
+	)
+
+	BeforeEach(func() {
+		calls = 0
+		rejected = 0
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				calls++
+				if calls <= rejected {
+					return err
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).Build()
+		c = newThrottlingAwareClient(fakeClient, ClientOptions{MaxRetries: 1}, clocktesting.NewFakeClock(time.Now()))
+	})
+
+	It("should retry a write transiently rejected by a webhook", func(ctx SpecContext) {
+		rejected = 1
+		err = apierrors.NewInternalError(errors.New(`failed calling webhook "validation.networking.api.onmetal.de": failed to call webhook: Post "https://onmetal-webhook.onmetal-system.svc:443/validate": dial tcp 10.0.0.1:443: connect: connection refused`))
+		Expect(c.Create(ctx, &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"}})).To(Succeed())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("should not retry a write denied by a webhook", func(ctx SpecContext) {
+		rejected = 1
+		err = apierrors.NewForbidden(networkingv1alpha1.Resource("loadbalancers"), "bar", errors.New(`admission webhook "validation.networking.api.onmetal.de" denied the request`))
+		Expect(c.Create(ctx, &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"}})).To(MatchError(err))
+		Expect(calls).To(Equal(1))
+	})
+})
+
+var _ = Describe("DryRunClient", func() {
+	It("should not persist any writes", func(ctx SpecContext) {
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).Build()
+		c := newDryRunClient(fakeClient)
+
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"},
+		}
+		Expect(c.Create(ctx, loadBalancer)).To(Succeed())
+		err := fakeClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), &networkingv1alpha1.LoadBalancer{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ObserverClient", func() {
+	It("should never write to the onmetal API", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar", Labels: map[string]string{"foo": "bar"}},
+			Spec:       networkingv1alpha1.LoadBalancerSpec{Type: networkingv1alpha1.LoadBalancerTypePublic},
+		}
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer.DeepCopy()).Build()
+		c := newObserverClient(fakeClient)
+
+		desired := loadBalancer.DeepCopy()
+		desired.Spec.Type = networkingv1alpha1.LoadBalancerTypeInternal
+		Expect(c.Patch(ctx, desired, client.Apply, client.FieldOwner("test"))).To(Succeed())
+		Expect(c.Delete(ctx, desired)).To(Succeed())
+
+		current := &networkingv1alpha1.LoadBalancer{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), current)).To(Succeed())
+		Expect(current.Spec.Type).To(Equal(networkingv1alpha1.LoadBalancerTypePublic))
+
+		missing := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "missing"}}
+		Expect(c.Create(ctx, missing)).To(Succeed())
+		Expect(apierrors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(missing), missing))).To(BeTrue())
+		Expect(apierrors.IsNotFound(c.Delete(ctx, missing))).To(BeTrue())
+	})
+
+	It("should detect drift of the labels, annotations and spec set in the desired object", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				Labels:    map[string]string{"foo": "bar", "other": "label"},
+			},
+			Spec: networkingv1alpha1.LoadBalancerSpec{Type: networkingv1alpha1.LoadBalancerTypePublic},
+		}
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer.DeepCopy()).Build()
+
+		desired := loadBalancer.DeepCopy()
+		desired.Labels = map[string]string{"foo": "bar"}
+		Expect(hasDrift(ctx, fakeClient, desired)).To(BeFalse())
+
+		desired.Labels["foo"] = "baz"
+		Expect(hasDrift(ctx, fakeClient, desired)).To(BeTrue())
+
+		desired = loadBalancer.DeepCopy()
+		desired.Spec.Type = networkingv1alpha1.LoadBalancerTypeInternal
+		Expect(hasDrift(ctx, fakeClient, desired)).To(BeTrue())
+
+		By("detecting drift of top-level fields besides the spec")
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta:   metav1.ObjectMeta{Namespace: "foo", Name: "bar"},
+			NetworkRef:   commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{{IP: commonv1alpha1.MustParseIP("10.0.0.1")}},
+		}
+		Expect(fakeClient.Create(ctx, loadBalancerRouting.DeepCopy())).To(Succeed())
+		Expect(hasDrift(ctx, fakeClient, loadBalancerRouting.DeepCopy())).To(BeFalse())
+		desiredRouting := loadBalancerRouting.DeepCopy()
+		desiredRouting.Destinations[0].IP = commonv1alpha1.MustParseIP("10.0.0.2")
+		Expect(hasDrift(ctx, fakeClient, desiredRouting)).To(BeTrue())
+
+		By("ignoring the version of the cloud provider writing the object")
+		desired = loadBalancer.DeepCopy()
+		desired.Annotations = map[string]string{AnnotationKeyCCMVersion: "v0.0.0-other"}
+		Expect(hasDrift(ctx, fakeClient, desired)).To(BeFalse())
+	})
+})
+
+var _ = Describe("ReadOnlyClient", func() {
+	It("should reject all writes to the onmetal API", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"}}
+		fakeClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer.DeepCopy()).Build()
+		c := newReadOnlyClient(fakeClient)
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+		Expect(c.Create(ctx, &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "new"}})).To(MatchError(ErrReadOnly))
+		Expect(c.Patch(ctx, loadBalancer, client.MergeFrom(loadBalancer.DeepCopy()))).To(MatchError(ErrReadOnly))
+		Expect(c.Status().Patch(ctx, loadBalancer, client.MergeFrom(loadBalancer.DeepCopy()))).To(MatchError(ErrReadOnly))
+		Expect(c.Delete(ctx, loadBalancer)).To(MatchError(ErrReadOnly))
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+})
@@ -16,76 +16,123 @@ package onmetal
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/featuregate"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
 
 	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	corev1alpha1 "github.com/onmetal/onmetal-api/api/core/v1alpha1"
 	ipamv1alpha1 "github.com/onmetal/onmetal-api/api/ipam/v1alpha1"
 	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
 	storagev1alpha1 "github.com/onmetal/onmetal-api/api/storage/v1alpha1"
+
+	cloudproviderv1alpha1 "github.com/onmetal/cloud-provider-onmetal/pkg/apis/cloudprovider/v1alpha1"
 )
 
 const (
 	ProviderName                            = "onmetal"
 	machineMetadataUIDField                 = ".metadata.uid"
 	networkInterfaceSpecNetworkRefNameField = "spec.networkRef.name"
+	eventSourceName                         = "onmetal-cloud-controller-manager"
 )
 
-var onmetalScheme = runtime.NewScheme()
+var (
+	onmetalScheme = runtime.NewScheme()
+	targetScheme  = runtime.NewScheme()
+)
 
 func init() {
 	utilruntime.Must(computev1alpha1.AddToScheme(onmetalScheme))
+	utilruntime.Must(corev1alpha1.AddToScheme(onmetalScheme))
 	utilruntime.Must(storagev1alpha1.AddToScheme(onmetalScheme))
 	utilruntime.Must(ipamv1alpha1.AddToScheme(onmetalScheme))
 	utilruntime.Must(networkingv1alpha1.AddToScheme(onmetalScheme))
+	utilruntime.Must(authorizationv1.AddToScheme(onmetalScheme))
+
+	utilruntime.Must(clientgoscheme.AddToScheme(targetScheme))
+	utilruntime.Must(cloudproviderv1alpha1.AddToScheme(targetScheme))
 
 	cloudprovider.RegisterCloudProvider(ProviderName, func(config io.Reader) (cloudprovider.Interface, error) {
 		cfg, err := LoadCloudProviderConfig(config)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to decode config")
 		}
-
-		onmetalCluster, err := cluster.New(cfg.RestConfig, func(o *cluster.Options) {
-			o.Scheme = onmetalScheme
-			o.Cache.DefaultNamespaces = map[string]cache.Config{
-				cfg.Namespace: {},
-			}
-		})
-		if err != nil {
-			return nil, fmt.Errorf("unable to create onmetal cluster: %w", err)
-		}
-
-		return &cloud{
-			onmetalCluster:   onmetalCluster,
-			onmetalNamespace: cfg.Namespace,
-			cloudConfig:      cfg.cloudConfig,
-		}, nil
+		return newCloud(cfg), nil
 	})
 }
 
+func newCloud(cfg *cloudProviderConfig) *cloud {
+	return &cloud{
+		onmetalRestConfig: cfg.RestConfig,
+		onmetalNamespace:  cfg.Namespace,
+		cloudConfig:       cfg.cloudConfig,
+		featureGates:      cfg.featureGates,
+	}
+}
+
+// cloud is the onmetal cloud provider. The clients, caches and background loops are constructed by Initialize with
+// the client builder and the stop channel of the cloud controller manager. Until then the provider interfaces report
+// not being supported.
 type cloud struct {
-	targetCluster    cluster.Cluster
-	onmetalCluster   cluster.Cluster
-	onmetalNamespace string
-	cloudConfig      CloudConfig
-	loadBalancer     cloudprovider.LoadBalancer
-	instancesV2      cloudprovider.InstancesV2
-	routes           cloudprovider.Routes
+	onmetalRestConfig *rest.Config
+	onmetalNamespace  string
+	cloudConfig       CloudConfig
+	featureGates      featuregate.FeatureGate
+
+	// initMu serializes the initializations of the cloud provider.
+	initMu sync.Mutex
+	// initStop is the stop channel of the current initialization.
+	initStop <-chan struct{}
+	// debugServerStopped is closed once the debug server of the previous initialization shut down.
+	debugServerStopped <-chan struct{}
+	// providers are the provider interfaces of the current initialization, nil until it completed.
+	providers atomic.Pointer[cloudProviders]
 }
 
+// cloudProviders are the provider interfaces of an initialized cloud provider.
+type cloudProviders struct {
+	loadBalancer cloudprovider.LoadBalancer
+	instances    cloudprovider.Instances
+	instancesV2  cloudprovider.InstancesV2
+	routes       cloudprovider.Routes
+	clusters     cloudprovider.Clusters
+}
+
+// Initialize constructs the clients, caches and background loops of the cloud provider, running until the stop
+// channel is closed. Initializing again while the previous stop channel is open is a no-op, while initializing after
+// it was closed, e.g. when the leadership was lost and acquired again, constructs everything anew.
 func (o *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	o.initMu.Lock()
+	defer o.initMu.Unlock()
+	if o.initStop != nil {
+		select {
+		case <-o.initStop:
+		default:
+			klog.V(2).Infof("Cloud provider %s is already initialized", ProviderName)
+			return
+		}
+	}
+	o.initStop = stop
+	o.providers.Store(nil)
+
 	klog.V(2).Infof("Initializing cloud provider: %s", ProviderName)
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -93,66 +140,237 @@ func (o *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 		<-stop
 	}()
 
+	if OnmetalTracingEndpoint != "" {
+		shutdownTracing, err := setupTracing(ctx, OnmetalTracingEndpoint)
+		if err != nil {
+			log.Fatalf("Failed to setup tracing: %v", err)
+		}
+		go func() {
+			<-ctx.Done()
+			if err := shutdownTracing(context.Background()); err != nil {
+				klog.ErrorS(err, "Failed to shutdown tracing")
+			}
+		}()
+	}
+
+	onmetalCluster, err := cluster.New(o.onmetalRestConfig, func(co *cluster.Options) {
+		co.Scheme = onmetalScheme
+		co.NewClient = OnmetalClientOptions.newClientFunc()
+		co.Cache.DefaultNamespaces = map[string]cache.Config{
+			o.onmetalNamespace: {},
+		}
+		for _, namespace := range o.cloudConfig.AdditionalNamespaces {
+			co.Cache.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to create onmetal cluster: %v", err)
+	}
+	validationClient, err := client.New(o.onmetalRestConfig, client.Options{Scheme: onmetalScheme})
+	if err != nil {
+		log.Fatalf("Failed to create onmetal client: %v", err)
+	}
+	if err := validateCloudConfigAgainstOnmetal(ctx, validationClient, o.onmetalNamespace, o.cloudConfig); err != nil {
+		log.Fatalf("Invalid cloud config: %v", err)
+	}
+
 	cfg, err := clientBuilder.Config("cloud-controller-manager")
 	if err != nil {
 		log.Fatalf("Failed to get config: %v", err)
 	}
-	o.targetCluster, err = cluster.New(cfg)
+	targetCluster, err := cluster.New(cfg, func(co *cluster.Options) {
+		co.Scheme = targetScheme
+	})
 	if err != nil {
 		log.Fatalf("Failed to create new cluster: %v", err)
 	}
+	onmetalClient := onmetalCluster.GetClient()
+	if o.cloudConfig.DryRun {
+		klog.Warning("Running in dry-run mode, writes to the onmetal API are not persisted")
+		onmetalClient = newDryRunClient(onmetalClient)
+	}
+	if o.cloudConfig.Observer {
+		klog.Warning("Running in observer mode, nothing is written to the onmetal API")
+		onmetalClient = newObserverClient(onmetalClient)
+	}
+	if o.cloudConfig.ReadOnly {
+		klog.Warning("Running in read-only mode, LoadBalancers and Routes are not supported")
+		onmetalClient = newReadOnlyClient(onmetalClient)
+	}
 
-	o.instancesV2 = newOnmetalInstancesV2(o.targetCluster.GetClient(), o.onmetalCluster.GetClient(), o.onmetalNamespace, o.cloudConfig.ClusterName)
-	o.loadBalancer = newOnmetalLoadBalancer(o.targetCluster.GetClient(), o.onmetalCluster.GetClient(), o.onmetalNamespace, o.cloudConfig)
-	o.routes = newOnmetalRoutes(o.targetCluster.GetClient(), o.onmetalCluster.GetClient(), o.onmetalNamespace, o.cloudConfig)
-
-	if err := o.onmetalCluster.GetFieldIndexer().IndexField(ctx, &computev1alpha1.Machine{}, machineMetadataUIDField, func(object client.Object) []string {
+	if err := onmetalCluster.GetFieldIndexer().IndexField(ctx, &computev1alpha1.Machine{}, machineMetadataUIDField, func(object client.Object) []string {
 		machine := object.(*computev1alpha1.Machine)
 		return []string{string(machine.UID)}
 	}); err != nil {
 		log.Fatalf("Failed to setup field indexer for machine: %v", err)
 	}
 
-	if err := o.onmetalCluster.GetFieldIndexer().IndexField(ctx, &networkingv1alpha1.NetworkInterface{}, networkInterfaceSpecNetworkRefNameField, func(object client.Object) []string {
+	if err := onmetalCluster.GetFieldIndexer().IndexField(ctx, &networkingv1alpha1.NetworkInterface{}, networkInterfaceSpecNetworkRefNameField, func(object client.Object) []string {
 		nic := object.(*networkingv1alpha1.NetworkInterface)
 		return []string{nic.Spec.NetworkRef.Name}
 	}); err != nil {
 		log.Fatalf("Failed to setup field indexer for network interface: %v", err)
 	}
 
-	if _, err := o.targetCluster.GetCache().GetInformer(ctx, &corev1.Node{}); err != nil {
+	if _, err := targetCluster.GetCache().GetInformer(ctx, &corev1.Node{}); err != nil {
 		log.Fatalf("Failed to setup Node informer: %v", err)
 	}
-	// TODO: setup informer for Services
+
+	machineNodeIndex := newMachineNodeIndex(o.onmetalNamespace)
+	if err := machineNodeIndex.SetupWithCaches(ctx, onmetalCluster.GetCache(), targetCluster.GetCache()); err != nil {
+		log.Fatalf("Failed to setup machine node index: %v", err)
+	}
+
+	loadBalancerWaiter := newLoadBalancerWaiter()
+	if err := loadBalancerWaiter.SetupWithCache(ctx, onmetalCluster.GetCache()); err != nil {
+		log.Fatalf("Failed to setup load balancer waiter: %v", err)
+	}
+
+	recorder := targetCluster.GetEventRecorderFor(eventSourceName)
+	loadBalancer := newOnmetalLoadBalancer(targetCluster.GetClient(), onmetalClient, onmetalCluster.GetAPIReader(), o.onmetalNamespace, o.cloudConfig, o.featureGates, recorder, machineNodeIndex, loadBalancerWaiter)
+	providers := &cloudProviders{
+		loadBalancer: loadBalancer,
+		instancesV2:  newOnmetalInstancesV2(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig, o.featureGates, recorder, machineNodeIndex),
+		routes:       newOnmetalRoutes(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig),
+		clusters:     newOnmetalClusters(onmetalClient, o.onmetalNamespace, o.cloudConfig),
+	}
+
+	if o.cloudConfig.LegacyInstances {
+		providers.instances = newOnmetalInstances(targetCluster.GetClient(), providers.instancesV2)
+	}
+
+	if o.cloudConfig.ReadOnly {
+		providers.loadBalancer = readOnlyLoadBalancer{}
+		providers.routes = nil
+	}
+
+	if OnmetalDebugBindAddress != "" {
+		if o.debugServerStopped != nil {
+			<-o.debugServerStopped
+		}
+		mux := http.NewServeMux()
+		mux.Handle(machineNodeIndexPath, machineNodeIndex)
+		o.debugServerStopped = serveDebugEndpoints(ctx, OnmetalDebugBindAddress, mux)
+	}
+
+	if o.cloudConfig.TaintShutdownMachines {
+		machineShutdownReconciler := newMachineShutdownReconciler(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig, machineNodeIndex)
+		if err := machineShutdownReconciler.SetupWithCache(ctx, onmetalCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup machine shutdown reconciler: %v", err)
+		}
+		go machineShutdownReconciler.Start(ctx)
+	}
+
+	if o.cloudConfig.ReportMachineFailures || o.cloudConfig.TaintFailedMachines {
+		machineFailureReconciler := newMachineFailureReconciler(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig, recorder, machineNodeIndex)
+		if err := machineFailureReconciler.SetupWithCache(ctx, onmetalCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup machine failure reconciler: %v", err)
+		}
+		go machineFailureReconciler.Start(ctx)
+	}
+
+	if o.cloudConfig.NotifyMachineShutdown {
+		machineShutdownNotifier := newMachineShutdownNotifier(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig, machineNodeIndex)
+		if err := machineShutdownNotifier.SetupWithCaches(ctx, onmetalCluster.GetCache(), targetCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup machine shutdown notifier: %v", err)
+		}
+		go machineShutdownNotifier.Start(ctx)
+	}
+
+	if (o.cloudConfig.AsyncLoadBalancerStatus || o.cloudConfig.isAsyncLoadBalancerProvisioningEnabled(o.featureGates)) && !o.cloudConfig.DryRun && !o.cloudConfig.Observer && !o.cloudConfig.ReadOnly {
+		loadBalancerStatusReconciler := newLoadBalancerStatusReconciler(targetCluster.GetClient(), onmetalClient, o.cloudConfig.ClusterName, loadBalancer.(*onmetalLoadBalancer).dnsRecords)
+		if err := loadBalancerStatusReconciler.SetupWithCache(ctx, onmetalCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup load balancer status reconciler: %v", err)
+		}
+		go loadBalancerStatusReconciler.Start(ctx)
+	}
+
+	if o.cloudConfig.isEndpointDestinationsEnabled(o.featureGates) && !o.cloudConfig.DryRun && !o.cloudConfig.Observer && !o.cloudConfig.ReadOnly {
+		endpointDestinationsReconciler := newEndpointDestinationsReconciler(targetCluster.GetClient(), loadBalancer.(*onmetalLoadBalancer), o.cloudConfig.ClusterName)
+		if err := endpointDestinationsReconciler.SetupWithCache(ctx, targetCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup endpoint destinations reconciler: %v", err)
+		}
+		go endpointDestinationsReconciler.Start(ctx)
+	}
+
+	if o.cloudConfig.CleanupConvertedServices && !o.cloudConfig.DryRun && !o.cloudConfig.Observer && !o.cloudConfig.ReadOnly {
+		convertedServiceReconciler := newConvertedServiceReconciler(targetCluster.GetClient(), loadBalancer.(*onmetalLoadBalancer), o.cloudConfig.ClusterName)
+		if err := convertedServiceReconciler.SetupWithCache(ctx, targetCluster.GetCache()); err != nil {
+			log.Fatalf("Failed to setup converted service reconciler: %v", err)
+		}
+		go convertedServiceReconciler.Start(ctx)
+	}
+
+	if o.cloudConfig.SyncMachinePoolLabels || o.cloudConfig.PublishAutoscalerNodeGroups || o.cloudConfig.SyncMachinePlatformLabels || len(o.cloudConfig.NodeLabelKeys) > 0 {
+		machinePoolLabelReconciler := newMachinePoolLabelReconciler(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig)
+		go machinePoolLabelReconciler.Start(ctx)
+	}
+	if o.cloudConfig.CleanupClusterLabels && !o.cloudConfig.DryRun && !o.cloudConfig.Observer {
+		clusterLabelCleanupReconciler := newClusterLabelCleanupReconciler(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig)
+		go clusterLabelCleanupReconciler.Start(ctx)
+	}
+	if o.cloudConfig.CorrectLoadBalancerDrift && !o.cloudConfig.DryRun && !o.cloudConfig.Observer && !o.cloudConfig.ReadOnly {
+		loadBalancerDriftReconciler := newLoadBalancerDriftReconciler(targetCluster.GetClient(), loadBalancer.(*onmetalLoadBalancer), o.cloudConfig.ClusterName)
+		go loadBalancerDriftReconciler.Start(ctx)
+	}
+	if o.cloudConfig.ReportManagedResources {
+		cloudProviderReporter := newCloudProviderReporter(targetCluster.GetClient(), onmetalClient, o.onmetalNamespace, o.cloudConfig)
+		go cloudProviderReporter.Start(ctx)
+	}
 
 	go func() {
-		if err := o.onmetalCluster.Start(ctx); err != nil {
+		if err := onmetalCluster.Start(ctx); err != nil {
 			log.Fatalf("Failed to start onmetal cluster: %v", err)
 		}
 	}()
 
 	go func() {
-		if err := o.targetCluster.Start(ctx); err != nil {
+		if err := targetCluster.Start(ctx); err != nil {
 			log.Fatalf("Failed to start target cluster: %v", err)
 		}
 	}()
 
-	if !o.onmetalCluster.GetCache().WaitForCacheSync(ctx) {
+	if !onmetalCluster.GetCache().WaitForCacheSync(ctx) {
 		log.Fatal("Failed to wait for onmetal cluster cache to sync")
 	}
-	if !o.targetCluster.GetCache().WaitForCacheSync(ctx) {
+	if !targetCluster.GetCache().WaitForCacheSync(ctx) {
 		log.Fatal("Failed to wait for target cluster cache to sync")
 	}
+
+	// LoadBalancers created by previous releases are labeled once, so they are found independent of their name. The
+	// repair sweep relies on the labels and runs afterwards.
+	if !o.cloudConfig.ReadOnly {
+		go func() {
+			if err := loadBalancer.(*onmetalLoadBalancer).backfillLoadBalancerLabels(ctx, o.cloudConfig.ClusterName); err != nil {
+				klog.ErrorS(err, "Failed to backfill labels of LoadBalancers")
+			}
+			if o.cloudConfig.RepairLoadBalancers && !o.cloudConfig.DryRun && !o.cloudConfig.Observer {
+				if err := loadBalancer.(*onmetalLoadBalancer).repairLoadBalancers(ctx, o.cloudConfig.ClusterName, time.Now()); err != nil {
+					klog.ErrorS(err, "Failed to repair LoadBalancers")
+				}
+			}
+		}()
+	}
+	o.providers.Store(providers)
 	klog.V(2).Infof("Successfully initialized cloud provider: %s", ProviderName)
 }
 
 func (o *cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
-	return o.loadBalancer, true
+	providers := o.providers.Load()
+	if providers == nil {
+		return nil, false
+	}
+	return providers.loadBalancer, true
 }
 
-// Instances returns an implementation of Instances for onmetal
+// Instances returns an implementation of Instances for onmetal if LegacyInstances is set. The cloud controllers use
+// InstancesV2 regardless.
 func (o *cloud) Instances() (cloudprovider.Instances, bool) {
-	return nil, false
+	providers := o.providers.Load()
+	if providers == nil || providers.instances == nil {
+		return nil, false
+	}
+	return providers.instances, true
 }
 
 // InstancesV2 is an implementation for instances and should only be implemented by external cloud providers.
@@ -160,7 +378,11 @@ func (o *cloud) Instances() (cloudprovider.Instances, bool) {
 // API calls to the cloud provider when registering and syncing nodes.
 // Also returns true if the interface is supported, false otherwise.
 func (o *cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
-	return o.instancesV2, true
+	providers := o.providers.Load()
+	if providers == nil {
+		return nil, false
+	}
+	return providers.instancesV2, true
 }
 
 // Zones returns an implementation of Zones for onmetal
@@ -168,14 +390,22 @@ func (o *cloud) Zones() (cloudprovider.Zones, bool) {
 	return nil, false
 }
 
-// Clusters returns the list of clusters
+// Clusters returns an implementation of Clusters for onmetal
 func (o *cloud) Clusters() (cloudprovider.Clusters, bool) {
-	return nil, false
+	providers := o.providers.Load()
+	if providers == nil {
+		return nil, false
+	}
+	return providers.clusters, true
 }
 
 // Routes returns an implementation of Routes for onmetal
 func (o *cloud) Routes() (cloudprovider.Routes, bool) {
-	return o.routes, true
+	providers := o.providers.Load()
+	if providers == nil || providers.routes == nil {
+		return nil, false
+	}
+	return providers.routes, true
 }
 
 // ProviderName returns the cloud provider ID
@@ -187,3 +417,24 @@ func (o *cloud) ProviderName() string {
 func (o *cloud) HasClusterID() bool {
 	return true
 }
+
+// serveDebugEndpoints serves the debug endpoints on the address until the context is done. The returned channel is
+// closed once the server shut down and released the address.
+func serveDebugEndpoints(ctx context.Context, address string, handler http.Handler) <-chan struct{} {
+	server := &http.Server{Addr: address, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.ErrorS(err, "Failed to serve debug endpoint", "Address", address)
+		}
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			klog.ErrorS(err, "Failed to shutdown debug endpoint", "Address", address)
+		}
+	}()
+	return stopped
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+
+	cloudproviderv1alpha1 "github.com/onmetal/cloud-provider-onmetal/pkg/apis/cloudprovider/v1alpha1"
+)
+
+const (
+	cloudProviderReportInterval = 1 * time.Minute
+	// cloudProviderReportName is the name of the CloudProviderReport in the target cluster.
+	cloudProviderReportName = "onmetal"
+)
+
+// cloudProviderReporter periodically summarizes the resources managed by the cloud provider in a
+// CloudProviderReport in the target cluster.
+type cloudProviderReporter struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	clock            clock.PassiveClock
+}
+
+func newCloudProviderReporter(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig) *cloudProviderReporter {
+	return &cloudProviderReporter{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+		clock:            clock.RealClock{},
+	}
+}
+
+// Start periodically updates the CloudProviderReport until the context is done.
+func (r *cloudProviderReporter) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.report(ctx); err != nil {
+			klog.ErrorS(err, "Failed to update CloudProviderReport")
+		}
+	}, cloudProviderReportInterval)
+}
+
+func (r *cloudProviderReporter) report(ctx context.Context) error {
+	status, err := r.getStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	report := &cloudproviderv1alpha1.CloudProviderReport{}
+	if err := r.targetClient.Get(ctx, client.ObjectKey{Name: cloudProviderReportName}, report); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get CloudProviderReport %s: %w", cloudProviderReportName, err)
+		}
+		report = &cloudproviderv1alpha1.CloudProviderReport{ObjectMeta: metav1.ObjectMeta{Name: cloudProviderReportName}}
+		if err := r.targetClient.Create(ctx, report); err != nil {
+			return fmt.Errorf("failed to create CloudProviderReport %s: %w", cloudProviderReportName, err)
+		}
+	}
+
+	reportBase := report.DeepCopy()
+	report.Status = *status
+	klog.V(4).InfoS("Updating CloudProviderReport", "CloudProviderReport", cloudProviderReportName, "LoadBalancers", status.LoadBalancers, "Pending", status.PendingLoadBalancers, "OrphanCandidates", status.OrphanCandidates)
+	if err := r.targetClient.Status().Patch(ctx, report, client.MergeFrom(reportBase)); err != nil {
+		return fmt.Errorf("failed to patch status of CloudProviderReport %s: %w", cloudProviderReportName, err)
+	}
+	return nil
+}
+
+func (r *cloudProviderReporter) getStatus(ctx context.Context) (*cloudproviderv1alpha1.CloudProviderReportStatus, error) {
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := r.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(r.onmetalNamespace),
+		client.MatchingLabels{LabelKeyClusterName: r.cloudConfig.ClusterName},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+
+	status := &cloudproviderv1alpha1.CloudProviderReportStatus{
+		ClusterName:    r.cloudConfig.ClusterName,
+		Namespace:      r.onmetalNamespace,
+		Features:       getEnabledFeatures(r.cloudConfig),
+		LastUpdateTime: metav1.NewTime(r.clock.Now()),
+	}
+	for i := range loadBalancerList.Items {
+		loadBalancer := &loadBalancerList.Items[i]
+		status.LoadBalancers++
+		if len(loadBalancer.Status.IPs) == 0 {
+			status.PendingLoadBalancers++
+		}
+
+		orphan, err := r.isOrphanCandidate(ctx, loadBalancer)
+		if err != nil {
+			return nil, err
+		}
+		if orphan {
+			status.OrphanCandidates++
+		}
+	}
+	return status, nil
+}
+
+// isOrphanCandidate reports whether the Service of the LoadBalancer does not exist anymore.
+func (r *cloudProviderReporter) isOrphanCandidate(ctx context.Context, loadBalancer *networkingv1alpha1.LoadBalancer) (bool, error) {
+	service := &corev1.Service{}
+	serviceKey := client.ObjectKey{Namespace: loadBalancer.Annotations[AnnotationKeyServiceNamespace], Name: loadBalancer.Annotations[AnnotationKeyServiceName]}
+	if err := r.targetClient.Get(ctx, serviceKey, service); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get Service %s of LoadBalancer %s: %w", serviceKey, client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	return string(service.UID) != loadBalancer.Annotations[AnnotationKeyServiceUID], nil
+}
+
+// getEnabledFeatures returns the names of the optional features enabled in the cloud config.
+func getEnabledFeatures(cloudConfig CloudConfig) []string {
+	var features []string
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"taintShutdownMachines", cloudConfig.TaintShutdownMachines},
+		{"notifyMachineShutdown", cloudConfig.NotifyMachineShutdown},
+		{"reportMachineFailures", cloudConfig.ReportMachineFailures},
+		{"taintFailedMachines", cloudConfig.TaintFailedMachines},
+		{"syncMachinePoolLabels", cloudConfig.SyncMachinePoolLabels},
+		{"publishAutoscalerNodeGroups", cloudConfig.PublishAutoscalerNodeGroups},
+		{"syncMachinePlatformLabels", cloudConfig.SyncMachinePlatformLabels},
+		{"reportHostName", cloudConfig.ReportHostName},
+		{"asyncLoadBalancerStatus", cloudConfig.AsyncLoadBalancerStatus},
+		{"asyncLoadBalancerProvisioning", cloudConfig.AsyncLoadBalancerProvisioning},
+		{"cachedLoadBalancerLookup", cloudConfig.CachedLoadBalancerLookup},
+		{"reportAllNetworkInterfaceAddresses", cloudConfig.ReportAllNetworkInterfaceAddresses},
+		{"failStatic", cloudConfig.FailStaticDuration.Duration > 0},
+		{"instanceMetadataSnapshot", cloudConfig.InstanceMetadataResyncWindow.Duration > 0},
+		{"verifyNodePorts", cloudConfig.VerifyNodePorts},
+		{"endpointDestinations", cloudConfig.EndpointDestinations},
+		{"dnsRecords", cloudConfig.DNSRecords},
+		{"cleanupClusterLabels", cloudConfig.CleanupClusterLabels},
+		{"cleanupConvertedServices", cloudConfig.CleanupConvertedServices},
+		{"repairLoadBalancers", cloudConfig.RepairLoadBalancers},
+		{"correctLoadBalancerDrift", cloudConfig.CorrectLoadBalancerDrift},
+		{"legacyInstances", cloudConfig.LegacyInstances},
+		{"excludeVirtualIPAddresses", cloudConfig.ExcludeVirtualIPAddresses},
+		{"loadBalancerAnnotationPassThrough", len(cloudConfig.LoadBalancerAnnotationKeys) > 0},
+		{"dryRun", cloudConfig.DryRun},
+		{"observer", cloudConfig.Observer},
+		{"readOnly", cloudConfig.ReadOnly},
+	} {
+		if feature.enabled {
+			features = append(features, feature.name)
+		}
+	}
+	return features
+}
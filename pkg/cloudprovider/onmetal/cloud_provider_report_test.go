@@ -0,0 +1,84 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testingclock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+
+	cloudproviderv1alpha1 "github.com/onmetal/cloud-provider-onmetal/pkg/apis/cloudprovider/v1alpha1"
+)
+
+var _ = Describe("CloudProviderReporter", func() {
+	newLoadBalancer := func(name, clusterName, serviceName, serviceUID string, ips ...commonv1alpha1.IP) *networkingv1alpha1.LoadBalancer {
+		return &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      name,
+				Labels:    map[string]string{LabelKeyClusterName: clusterName},
+				Annotations: map[string]string{
+					AnnotationKeyClusterName:      clusterName,
+					AnnotationKeyServiceNamespace: "default",
+					AnnotationKeyServiceName:      serviceName,
+					AnnotationKeyServiceUID:       serviceUID,
+				},
+			},
+			Status: networkingv1alpha1.LoadBalancerStatus{IPs: ips},
+		}
+	}
+
+	It("should summarize the load balancers of the cluster", func(ctx SpecContext) {
+		now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.Local)
+		targetClient := fake.NewClientBuilder().
+			WithScheme(targetScheme).
+			WithObjects(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ready", UID: "ready-uid"}}).
+			WithStatusSubresource(&cloudproviderv1alpha1.CloudProviderReport{}).
+			Build()
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			newLoadBalancer("ready", "test", "ready", "ready-uid", commonv1alpha1.MustParseIP("10.0.0.1")),
+			newLoadBalancer("pending", "test", "ready", "other-uid"),
+			newLoadBalancer("other-cluster", "other", "gone", "gone-uid"),
+		).Build()
+		reporter := newCloudProviderReporter(targetClient, onmetalClient, "onmetal", CloudConfig{ClusterName: "test", AsyncLoadBalancerStatus: true})
+		reporter.clock = testingclock.NewFakePassiveClock(now)
+
+		Expect(reporter.report(ctx)).To(Succeed())
+
+		report := &cloudproviderv1alpha1.CloudProviderReport{}
+		Expect(targetClient.Get(ctx, client.ObjectKey{Name: cloudProviderReportName}, report)).To(Succeed())
+		Expect(report.Status).To(Equal(cloudproviderv1alpha1.CloudProviderReportStatus{
+			ClusterName:          "test",
+			Namespace:            "onmetal",
+			LoadBalancers:        2,
+			PendingLoadBalancers: 1,
+			OrphanCandidates:     1,
+			Features:             []string{"asyncLoadBalancerStatus"},
+			LastUpdateTime:       metav1.NewTime(now),
+		}))
+
+		By("updating the existing report")
+		Expect(reporter.report(ctx)).To(Succeed())
+	})
+})
@@ -15,8 +15,16 @@
 package onmetal
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
 )
 
 var _ = Describe("Cloud", func() {
@@ -28,8 +36,8 @@ var _ = Describe("Cloud", func() {
 		Expect((*cp).ProviderName()).To(Equal("onmetal"))
 
 		clusters, ok := (*cp).Clusters()
-		Expect(clusters).To(BeNil())
-		Expect(ok).To(BeFalse())
+		Expect(clusters).NotTo(BeNil())
+		Expect(ok).To(BeTrue())
 
 		instances, ok := (*cp).Instances()
 		Expect(instances).To(BeNil())
@@ -40,3 +48,74 @@ var _ = Describe("Cloud", func() {
 		Expect(ok).To(BeFalse())
 	})
 })
+
+var _ = Describe("Uninitialized cloud", func() {
+	It("should not support any provider interface until it is initialized", func() {
+		cp := &cloud{}
+
+		loadBalancer, ok := cp.LoadBalancer()
+		Expect(loadBalancer).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		instancesV2, ok := cp.InstancesV2()
+		Expect(instancesV2).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		instances, ok := cp.Instances()
+		Expect(instances).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		routes, ok := cp.Routes()
+		Expect(routes).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		clusters, ok := cp.Clusters()
+		Expect(clusters).To(BeNil())
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Debug endpoints", func() {
+	It("should serve the machine node index of the current initialization after re-initializing", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address := listener.Addr().String()
+		Expect(listener.Close()).To(Succeed())
+
+		getMachineNodeIndex := func() (string, error) {
+			res, err := http.Get("http://" + address + machineNodeIndexPath)
+			if err != nil {
+				return "", err
+			}
+			defer func() {
+				_ = res.Body.Close()
+			}()
+			data, err := io.ReadAll(res.Body)
+			return string(data), err
+		}
+		serve := func(ctx context.Context, machineName string) <-chan struct{} {
+			index := newMachineNodeIndex("foo")
+			index.setMachine(&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: machineName, UID: "machine-uid"}})
+			mux := http.NewServeMux()
+			mux.Handle(machineNodeIndexPath, index)
+			return serveDebugEndpoints(ctx, address, mux)
+		}
+
+		By("serving the index of the first initialization")
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := serve(ctx, "old")
+		Eventually(getMachineNodeIndex).Should(MatchJSON(`{"machine-uid": "old"}`))
+
+		By("shutting down the debug server once the initialization is stopped")
+		cancel()
+		Eventually(stopped).Should(BeClosed())
+		_, err = getMachineNodeIndex()
+		Expect(err).To(HaveOccurred())
+
+		By("serving the index of the re-initialization on the same address")
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		serve(ctx, "new")
+		Eventually(getMachineNodeIndex).Should(MatchJSON(`{"machine-uid": "new"}`))
+	})
+})
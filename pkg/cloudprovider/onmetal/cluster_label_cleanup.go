@@ -0,0 +1,148 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	clusterLabelCleanupInterval = 5 * time.Minute
+)
+
+// clusterLabelCleanupReconciler removes the cluster name label added by InstanceMetadata from Machines and
+// NetworkInterfaces which no longer back a Node of the cluster, e.g. after the Node was deleted.
+type clusterLabelCleanupReconciler struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+}
+
+func newClusterLabelCleanupReconciler(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig) *clusterLabelCleanupReconciler {
+	return &clusterLabelCleanupReconciler{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+	}
+}
+
+// Start periodically removes stale cluster name labels until the context is done.
+func (r *clusterLabelCleanupReconciler) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.sync(ctx); err != nil {
+			klog.ErrorS(err, "Failed to clean up cluster name labels")
+		}
+	}, clusterLabelCleanupInterval)
+}
+
+func (r *clusterLabelCleanupReconciler) sync(ctx context.Context) error {
+	nodeList := &corev1.NodeList{}
+	if err := r.targetClient.List(ctx, nodeList); err != nil {
+		return fmt.Errorf("failed to list Nodes: %w", err)
+	}
+	if len(nodeList.Items) == 0 {
+		// an empty Node list is more likely a broken target cluster than a cluster without any Node
+		klog.V(2).InfoS("Not cleaning up cluster name labels of a cluster without Nodes")
+		return nil
+	}
+
+	namespaces := getMachineNamespaces(r.onmetalNamespace, r.cloudConfig)
+	backingMachines := sets.New[client.ObjectKey]()
+	for _, node := range nodeList.Items {
+		if namespace, name, ok := parseProviderID(node.Spec.ProviderID); ok && slices.Contains(namespaces, namespace) {
+			backingMachines.Insert(client.ObjectKey{Namespace: namespace, Name: name})
+			continue
+		}
+		for _, namespace := range namespaces {
+			backingMachines.Insert(client.ObjectKey{Namespace: namespace, Name: node.Name})
+		}
+	}
+
+	var errs []error
+	for _, namespace := range namespaces {
+		if err := r.cleanupMachines(ctx, namespace, backingMachines); err != nil {
+			errs = append(errs, err)
+		}
+		if err := r.cleanupNetworkInterfaces(ctx, namespace, backingMachines); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *clusterLabelCleanupReconciler) cleanupMachines(ctx context.Context, namespace string, backingMachines sets.Set[client.ObjectKey]) error {
+	machineList := &computev1alpha1.MachineList{}
+	if err := r.onmetalClient.List(ctx, machineList,
+		client.InNamespace(namespace),
+		client.MatchingLabels{LabelKeyClusterName: r.cloudConfig.ClusterName},
+	); err != nil {
+		return fmt.Errorf("failed to list Machines in namespace %s: %w", namespace, err)
+	}
+
+	var errs []error
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		if backingMachines.Has(client.ObjectKeyFromObject(machine)) {
+			continue
+		}
+		machineBase := machine.DeepCopy()
+		delete(machine.Labels, LabelKeyClusterName)
+		klog.V(2).InfoS("Removing cluster name label from Machine not backing a Node", "Machine", client.ObjectKeyFromObject(machine))
+		if err := r.onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase), r.cloudConfig.fieldOwnerForInstances()); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to patch Machine %s: %w", client.ObjectKeyFromObject(machine), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *clusterLabelCleanupReconciler) cleanupNetworkInterfaces(ctx context.Context, namespace string, backingMachines sets.Set[client.ObjectKey]) error {
+	nicList := &networkingv1alpha1.NetworkInterfaceList{}
+	if err := r.onmetalClient.List(ctx, nicList,
+		client.InNamespace(namespace),
+		client.MatchingLabels{LabelKeyClusterName: r.cloudConfig.ClusterName},
+	); err != nil {
+		return fmt.Errorf("failed to list NetworkInterfaces in namespace %s: %w", namespace, err)
+	}
+
+	var errs []error
+	for i := range nicList.Items {
+		nic := &nicList.Items[i]
+		if nic.Spec.MachineRef != nil && backingMachines.Has(client.ObjectKey{Namespace: nic.Namespace, Name: nic.Spec.MachineRef.Name}) {
+			continue
+		}
+		nicBase := nic.DeepCopy()
+		delete(nic.Labels, LabelKeyClusterName)
+		klog.V(2).InfoS("Removing cluster name label from NetworkInterface not backing a Node", "NetworkInterface", client.ObjectKeyFromObject(nic))
+		if err := r.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase), r.cloudConfig.fieldOwnerForInstances()); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to patch NetworkInterface %s: %w", client.ObjectKeyFromObject(nic), err))
+		}
+	}
+	return errors.Join(errs...)
+}
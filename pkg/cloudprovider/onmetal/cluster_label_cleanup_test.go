@@ -0,0 +1,92 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("ClusterLabelCleanupReconciler", func() {
+	clusterLabels := map[string]string{LabelKeyClusterName: "test"}
+
+	newMachine := func(name string) *computev1alpha1.Machine {
+		return &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name, Labels: map[string]string{LabelKeyClusterName: "test", "foo": "bar"}},
+		}
+	}
+	newNetworkInterface := func(machineName string) *networkingv1alpha1.NetworkInterface {
+		return &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: machineName + "-primary", Labels: map[string]string{LabelKeyClusterName: "test"}},
+			Spec: networkingv1alpha1.NetworkInterfaceSpec{
+				MachineRef: &commonv1alpha1.LocalUIDReference{Name: machineName},
+			},
+		}
+	}
+
+	It("should remove the cluster name label from machines and network interfaces not backing a node", func(ctx SpecContext) {
+		byProviderID := newMachine("by-provider-id")
+		byName := newMachine("node")
+		stale := newMachine("stale")
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			byProviderID, byName, stale,
+			newNetworkInterface("by-provider-id"), newNetworkInterface("node"), newNetworkInterface("stale"),
+		).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(
+			&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "renamed"},
+				Spec:       corev1.NodeSpec{ProviderID: getProviderID("foo", "by-provider-id")},
+			},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		).Build()
+
+		reconciler := newClusterLabelCleanupReconciler(targetClient, onmetalClient, "foo", CloudConfig{ClusterName: "test"})
+		Expect(reconciler.sync(ctx)).To(Succeed())
+
+		machineList := &computev1alpha1.MachineList{}
+		Expect(onmetalClient.List(ctx, machineList, client.MatchingLabels(clusterLabels))).To(Succeed())
+		Expect(machineList.Items).To(ConsistOf(
+			HaveField("Name", "by-provider-id"),
+			HaveField("Name", "node"),
+		))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(stale), stale)).To(Succeed())
+		Expect(stale.Labels).To(Equal(map[string]string{"foo": "bar"}))
+
+		nicList := &networkingv1alpha1.NetworkInterfaceList{}
+		Expect(onmetalClient.List(ctx, nicList, client.MatchingLabels(clusterLabels))).To(Succeed())
+		Expect(nicList.Items).To(ConsistOf(
+			HaveField("Name", "by-provider-id-primary"),
+			HaveField("Name", "node-primary"),
+		))
+	})
+
+	It("should not remove any label of a cluster without nodes", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newMachine("machine")).Build()
+		reconciler := newClusterLabelCleanupReconciler(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{ClusterName: "test"})
+		Expect(reconciler.sync(ctx)).To(Succeed())
+
+		machineList := &computev1alpha1.MachineList{}
+		Expect(onmetalClient.List(ctx, machineList, client.MatchingLabels(clusterLabels))).To(Succeed())
+		Expect(machineList.Items).To(HaveLen(1))
+	})
+})
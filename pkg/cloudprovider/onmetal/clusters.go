@@ -0,0 +1,80 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+type onmetalClusters struct {
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+}
+
+func newOnmetalClusters(onmetalClient client.Client, namespace string, cloudConfig CloudConfig) cloudprovider.Clusters {
+	return &onmetalClusters{
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+	}
+}
+
+// ListClusters returns the names of all clusters owning Machines, NetworkInterfaces or LoadBalancers in the onmetal
+// namespace, identified by their cluster name label.
+func (o *onmetalClusters) ListClusters(ctx context.Context) ([]string, error) {
+	klog.V(2).InfoS("List Clusters", "Namespace", o.onmetalNamespace)
+
+	clusterNames := sets.New[string]()
+	for _, list := range []client.ObjectList{
+		&computev1alpha1.MachineList{},
+		&networkingv1alpha1.NetworkInterfaceList{},
+		&networkingv1alpha1.LoadBalancerList{},
+	} {
+		if err := o.onmetalClient.List(ctx, list, client.InNamespace(o.onmetalNamespace), client.HasLabels{LabelKeyClusterName}); err != nil {
+			return nil, fmt.Errorf("failed to list %T: %w", list, err)
+		}
+		if err := meta.EachListItem(list, func(obj runtime.Object) error {
+			clusterNames.Insert(obj.(client.Object).GetLabels()[LabelKeyClusterName])
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return sets.List(clusterNames), nil
+}
+
+// Master returns the address of the API server of the given cluster. Only the address of the current cluster is
+// known.
+func (o *onmetalClusters) Master(ctx context.Context, clusterName string) (string, error) {
+	if clusterName != o.cloudConfig.ClusterName {
+		return "", fmt.Errorf("master address of cluster %s is unknown, only the address of cluster %s is known", clusterName, o.cloudConfig.ClusterName)
+	}
+	if o.cloudConfig.MasterAddress == "" {
+		return "", fmt.Errorf("masterAddress is not defined in config")
+	}
+	return o.cloudConfig.MasterAddress, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Clusters", func() {
+	newObjectMeta := func(namespace, name, clusterName string) metav1.ObjectMeta {
+		objectMeta := metav1.ObjectMeta{Namespace: namespace, Name: name}
+		if clusterName != "" {
+			objectMeta.Labels = map[string]string{LabelKeyClusterName: clusterName}
+		}
+		return objectMeta
+	}
+
+	It("should list the distinct clusters of the onmetal namespace", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			&computev1alpha1.Machine{ObjectMeta: newObjectMeta("foo", "machine1", "cluster1")},
+			&computev1alpha1.Machine{ObjectMeta: newObjectMeta("foo", "machine2", "")},
+			&networkingv1alpha1.NetworkInterface{ObjectMeta: newObjectMeta("foo", "nic1", "cluster1")},
+			&networkingv1alpha1.LoadBalancer{ObjectMeta: newObjectMeta("foo", "lb1", "cluster2")},
+			&networkingv1alpha1.LoadBalancer{ObjectMeta: newObjectMeta("bar", "lb2", "cluster3")},
+		).Build()
+		clustersProvider := newOnmetalClusters(onmetalClient, "foo", CloudConfig{ClusterName: "cluster1"})
+
+		Expect(clustersProvider.ListClusters(ctx)).To(Equal([]string{"cluster1", "cluster2"}))
+	})
+
+	It("should only return the master address of the current cluster", func(ctx SpecContext) {
+		clustersProvider := newOnmetalClusters(fake.NewClientBuilder().WithScheme(onmetalScheme).Build(), "foo", CloudConfig{
+			ClusterName:   "cluster1",
+			MasterAddress: "https://api.cluster1.example.org",
+		})
+
+		Expect(clustersProvider.Master(ctx, "cluster1")).To(Equal("https://api.cluster1.example.org"))
+		_, err := clustersProvider.Master(ctx, "cluster2")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -15,78 +15,425 @@
 package onmetal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/featuregate"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	ipamv1alpha1 "github.com/onmetal/onmetal-api/api/ipam/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
 )
 
 type cloudProviderConfig struct {
-	RestConfig  *rest.Config
-	Namespace   string
-	cloudConfig CloudConfig
+	RestConfig   *rest.Config
+	Namespace    string
+	cloudConfig  CloudConfig
+	featureGates featuregate.FeatureGate
 }
 
 type CloudConfig struct {
 	NetworkName string `json:"networkName"`
 	PrefixName  string `json:"prefixName,omitempty"`
 	ClusterName string `json:"clusterName"`
+	// IPv6PrefixName is the parent Prefix of the IPv6 IPs of internal LoadBalancers. If empty, the IPv6 IPs are
+	// allocated from the Prefix of PrefixName as well, which only works for a Prefix of IP family IPv6.
+	IPv6PrefixName string `json:"ipv6PrefixName,omitempty"`
+	// NetworkIPFamilies are the IP families supported by the Network. LoadBalancers of PreferDualStack Services are
+	// provisioned with the supported IP families only, while Services requiring unsupported IP families are rejected.
+	// If empty, all IP families are considered supported.
+	NetworkIPFamilies []corev1.IPFamily `json:"networkIPFamilies,omitempty"`
+	// MasterAddress is the address of the API server of the cluster reported by the Clusters interface.
+	MasterAddress string `json:"masterAddress,omitempty"`
+	// PreviousClusterName is the name of a cluster whose LoadBalancers should be taken over by this cluster
+	// during a migration. LoadBalancers are matched by the namespace and name of their Service.
+	PreviousClusterName string `json:"previousClusterName,omitempty"`
+	// TaintShutdownMachines enables tainting Nodes of shut down Machines and removing them from all
+	// LoadBalancer destinations as soon as the Machine is shut down.
+	TaintShutdownMachines bool `json:"taintShutdownMachines,omitempty"`
+	// ShutdownMachineStates are additional states of Machines treated as shut down, e.g. intermediate states of power
+	// transitions. Machines in state Shutdown and pending Machines requested to be powered off are always treated as
+	// shut down.
+	ShutdownMachineStates []computev1alpha1.MachineState `json:"shutdownMachineStates,omitempty"`
+	// NotifyMachineShutdown enables tainting NotReady Nodes of shut down Machines with the shutdown taint of the node
+	// lifecycle controller as soon as the state of the Machine changes instead of on the next poll of the controller.
+	NotifyMachineShutdown bool `json:"notifyMachineShutdown,omitempty"`
+	// ReportMachineFailures enables recording a Warning event on the Node of a Machine as soon as the Machine fails,
+	// i.e. is terminated, so infrastructure failures are visible in the cluster.
+	ReportMachineFailures bool `json:"reportMachineFailures,omitempty"`
+	// TaintFailedMachines enables tainting the Nodes of failed Machines with TaintKeyMachineFailed in addition to
+	// reporting their failures. The taint is removed once the Machine recovers.
+	TaintFailedMachines bool `json:"taintFailedMachines,omitempty"`
+	// SyncMachinePoolLabels enables mirroring the MachinePool and its capacity into labels and annotations of Nodes.
+	SyncMachinePoolLabels bool `json:"syncMachinePoolLabels,omitempty"`
+	// PublishAutoscalerNodeGroups enables labeling Nodes with their node group for the node group auto-discovery of
+	// the cluster-autoscaler. The minimum and maximum size of the node group are mirrored from annotations of the
+	// MachinePool if present.
+	PublishAutoscalerNodeGroups bool `json:"publishAutoscalerNodeGroups,omitempty"`
+	// NodeLabelKeys is an allow-list of label keys copied from the Machine and its MachinePool to the Node, e.g. to
+	// expose hardware attributes. Labels of the Machine take precedence over labels of the MachinePool. Copied labels
+	// are removed from the Node once they are removed from the Machine and its MachinePool or from the allow-list.
+	NodeLabelKeys []string `json:"nodeLabelKeys,omitempty"`
+	// SyncMachinePlatformLabels enables labeling every Node with the architecture and operating system of its Machine,
+	// taken from the kubernetes.io/arch and kubernetes.io/os labels of the Machine or else of its MachineClass, e.g. to
+	// tell the Nodes of heterogeneous amd64 and arm64 pools apart by the platform their Machines were provisioned for.
+	SyncMachinePlatformLabels bool `json:"syncMachinePlatformLabels,omitempty"`
+	// MachinePoolTopology maps the names of MachinePools to the zone and region of their Machines. It is used for
+	// MachinePools not carrying any topology information. By default, the zone is the name of the MachinePool and the
+	// region is empty.
+	MachinePoolTopology map[string]MachinePoolTopology `json:"machinePoolTopology,omitempty"`
+	// DestinationResolutionConcurrency is the maximum number of Nodes whose LoadBalancer destinations are resolved
+	// concurrently. Zero uses a default of 10.
+	DestinationResolutionConcurrency int `json:"destinationResolutionConcurrency,omitempty"`
+	// MaxDestinations is the maximum number of destinations of a LoadBalancer. Zero does not limit the destinations.
+	// It can be overridden per Service by annotation. Regardless of the limit, destinations exceeding the capacity of
+	// a LoadBalancerRouting of 4096 destinations are truncated.
+	MaxDestinations int `json:"maxDestinations,omitempty"`
+	// DestinationOverflowPolicy is the policy applied if a LoadBalancer exceeds its maximum number of destinations.
+	// Defaults to DestinationOverflowPolicyError. It can be overridden per Service by annotation.
+	DestinationOverflowPolicy DestinationOverflowPolicy `json:"destinationOverflowPolicy,omitempty"`
+	// LoadBalancerNaming is the scheme the names of new LoadBalancers are derived with. Existing LoadBalancers keep
+	// their names. Defaults to LoadBalancerNamingUID.
+	LoadBalancerNaming LoadBalancerNaming `json:"loadBalancerNaming,omitempty"`
+	// LoadBalancerNameTemplate is the Go template the names of new LoadBalancers are rendered with if
+	// LoadBalancerNaming is LoadBalancerNamingTemplate, e.g. "{{ .ClusterName }}-{{ .Namespace }}-{{ .Name }}". The
+	// template has the fields ClusterName, Namespace, Name, UID and UIDPrefix and the function hash. Rendered names are
+	// lowercased, invalid characters are replaced by dashes and names exceeding 63 characters are truncated and suffixed
+	// with a hash of the full name.
+	LoadBalancerNameTemplate string `json:"loadBalancerNameTemplate,omitempty"`
+	// EndpointDestinations enables routing the LoadBalancers of Services without selector to the addresses of their
+	// EndpointSlices if they are annotated with the endpoint destinations annotation. The EndpointSlices of the
+	// cluster are watched to update the LoadBalancerRoutings.
+	EndpointDestinations bool `json:"endpointDestinations,omitempty"`
+	// AdditionalNamespaces are onmetal namespaces besides the namespace of the onmetal kubeconfig containing Machines
+	// of the cluster, e.g. if Machines are split by MachinePool into different namespaces.
+	AdditionalNamespaces []string `json:"additionalNamespaces,omitempty"`
+	// SharedNamespace enables sharing the onmetal namespace with other clusters. Machines are only considered if they
+	// are labeled with the cluster name and LoadBalancers only if they are annotated with it.
+	SharedNamespace bool `json:"sharedNamespace,omitempty"`
+	// CleanupClusterLabels enables periodically removing the cluster name label from Machines and NetworkInterfaces
+	// which no longer back a Node of the cluster. It is not supported together with SharedNamespace, where the label
+	// is set by the owner of the Machines before their Nodes join the cluster.
+	CleanupClusterLabels bool `json:"cleanupClusterLabels,omitempty"`
+	// CleanupConvertedServices enables watching the Services of the cluster and deleting the LoadBalancers of Services
+	// converted from type LoadBalancer to another type, in case the service controller missed the conversion.
+	CleanupConvertedServices bool `json:"cleanupConvertedServices,omitempty"`
+	// RepairLoadBalancers enables a sweep over the LoadBalancers of the cluster on startup, recovering from crashes
+	// in the middle of provisioning: missing LoadBalancerRoutings are recreated, diverged ports are reset to the ports
+	// of the Service and LoadBalancers whose Service is gone are deleted.
+	RepairLoadBalancers bool `json:"repairLoadBalancers,omitempty"`
+	// LegacyInstances enables the legacy Instances interface on top of InstancesV2, for tooling still consuming it.
+	LegacyInstances bool `json:"legacyInstances,omitempty"`
+	// CorrectLoadBalancerDrift enables periodically comparing the type and ports of the LoadBalancers of the cluster
+	// with their Services and re-applying the LoadBalancers changed out-of-band, instead of waiting for the next sync
+	// of their Services.
+	CorrectLoadBalancerDrift bool `json:"correctLoadBalancerDrift,omitempty"`
+	// AsyncLoadBalancerStatus enables returning from EnsureLoadBalancer right after applying the LoadBalancer instead
+	// of waiting for its IPs. The status of the Service is updated in the background once the IPs are allocated.
+	AsyncLoadBalancerStatus bool `json:"asyncLoadBalancerStatus,omitempty"`
+	// AsyncLoadBalancerProvisioning enables failing EnsureLoadBalancer with a retryable error right after applying a
+	// LoadBalancer whose IPs are not allocated yet, instead of blocking a worker of the service controller until they
+	// are. The service controller retries the Service after a fixed delay, while the status of the Service is updated
+	// in the background once the IPs are allocated. It is mutually exclusive with AsyncLoadBalancerStatus.
+	AsyncLoadBalancerProvisioning bool `json:"asyncLoadBalancerProvisioning,omitempty"`
+	// FeatureGates enables or disables experimental behaviors of the cloud provider by the name of their feature gate,
+	// e.g. DirectPodRouting. The --onmetal-feature-gates flag takes precedence.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// InternalDNSSuffix enables reporting the internal DNS name <node>.<zone>.<cluster>.<suffix> of every Node as
+	// NodeInternalDNS address. The DNS records are not managed by the cloud provider.
+	InternalDNSSuffix string `json:"internalDNSSuffix,omitempty"`
+	// ReportHostName enables reporting the name of the Machine of every Node as NodeHostName address.
+	ReportHostName bool `json:"reportHostName,omitempty"`
+	// ReportAllNetworkInterfaceAddresses enables reporting the addresses of all network interfaces of a Machine as
+	// Node addresses. By default, only the addresses of network interfaces in the cluster network are reported.
+	ReportAllNetworkInterfaceAddresses bool `json:"reportAllNetworkInterfaceAddresses,omitempty"`
+	// ExcludeVirtualIPAddresses disables reporting the VirtualIPs of network interfaces as NodeExternalIP, e.g. if
+	// they are only used as load balancer VIPs. Machines can override it with the exclude virtual IP addresses
+	// annotation.
+	ExcludeVirtualIPAddresses bool `json:"excludeVirtualIPAddresses,omitempty"`
+	// CachedLoadBalancerLookup enables querying the onmetal API in GetLoadBalancer for LoadBalancers of Services not
+	// found in the local cache, e.g. as the cache has not observed their creation yet.
+	CachedLoadBalancerLookup bool `json:"cachedLoadBalancerLookup,omitempty"`
+	// DryRun enables performing all writes to the onmetal API as server-side dry-run. The objects which would be
+	// written are logged instead.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Observer enables computing the desired state without ever writing to the onmetal API. Writes which would change
+	// the onmetal API are reported as drift via metrics, logs and events instead. It is meant for shadow-running a
+	// cloud provider next to the active one and must not be combined with DryRun.
+	Observer bool `json:"observer,omitempty"`
+	// ReadOnly enables running with read-only credentials for the onmetal namespace. InstancesV2 is fully served, but
+	// Machines and NetworkInterfaces are not labeled with the cluster name, all LoadBalancer methods return
+	// cloudprovider.NotImplemented, Routes are not supported and nothing is written to the onmetal API.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// VerifyNodePorts enables verifying that the TCP node ports of a Service are reachable on at least one
+	// LoadBalancer destination before the LoadBalancer is reported as ready.
+	VerifyNodePorts bool `json:"verifyNodePorts,omitempty"`
+	// FailStaticDuration enables serving the last known state of instances for this duration if the onmetal API
+	// fails, e.g. during an outage. Zero disables serving stale instance states.
+	FailStaticDuration metav1.Duration `json:"failStaticDuration,omitempty"`
+	// InstanceMetadataResyncWindow enables resolving InstanceMetadata from a snapshot of all Machines and
+	// NetworkInterfaces of the cluster, listed at most once per window, instead of getting them per Node. This serves
+	// the full resyncs of the node controller efficiently. Zero disables the snapshot.
+	InstanceMetadataResyncWindow metav1.Duration `json:"instanceMetadataResyncWindow,omitempty"`
+	// ReportManagedResources enables periodically summarizing the resources managed by the cloud provider in the
+	// CloudProviderReport "onmetal" in the target cluster. The CloudProviderReport CRD has to be installed.
+	ReportManagedResources bool `json:"reportManagedResources,omitempty"`
+	// DNSRecords enables managing a DNSRecord next to every LoadBalancer Service with the hostname annotation,
+	// resolving the hostname to the IPs of its load balancer. The DNSRecord CRD has to be installed and the records
+	// are published by an external DNS controller.
+	DNSRecords bool `json:"dnsRecords,omitempty"`
+	// ApplyConflictPolicies maps the kinds of the objects applied to the onmetal API, i.e. LoadBalancer and
+	// LoadBalancerRouting, to the policy for conflicts with field managers of other controllers. The policy applies to
+	// merge patches of the objects as well. Kinds without a policy use ApplyConflictPolicyForce.
+	ApplyConflictPolicies map[string]ApplyConflictPolicy `json:"applyConflictPolicies,omitempty"`
+	// FieldOwner is the field manager of the objects applied to the onmetal API. Defaults to
+	// "cloud-provider.onmetal.de/loadbalancer". Fields owned by a previous field owner are only taken over with
+	// ApplyConflictPolicyForce. FieldOwners take precedence.
+	FieldOwner string `json:"fieldOwner,omitempty"`
+	// FieldOwners are the field managers of the writes of the individual features to the onmetal API, so the managed
+	// fields of an object attribute which feature wrote which field.
+	FieldOwners FieldOwners `json:"fieldOwners,omitempty"`
+	// ServiceAnnotationDefaults are onmetal annotations set by the Service webhook on LoadBalancer Services not setting
+	// them, e.g. to enable the PROXY protocol for all Services of the cluster.
+	ServiceAnnotationDefaults map[string]string `json:"serviceAnnotationDefaults,omitempty"`
+	// LoadBalancerAnnotationKeys is an allow-list of Service annotation keys with the prefix
+	// PassThroughAnnotationPrefix copied verbatim onto the LoadBalancer, e.g. to expose new tuning options of the load
+	// balancer data plane without changes to the cloud provider.
+	LoadBalancerAnnotationKeys []string `json:"loadBalancerAnnotationKeys,omitempty"`
 }
 
-var (
-	OnmetalKubeconfigPath string
+// DestinationOverflowPolicy is the policy applied if a LoadBalancer exceeds its maximum number of destinations.
+type DestinationOverflowPolicy string
+
+const (
+	// DestinationOverflowPolicyError fails reconciling LoadBalancers exceeding their maximum number of destinations.
+	DestinationOverflowPolicyError DestinationOverflowPolicy = "Error"
+	// DestinationOverflowPolicyTruncate drops the destinations exceeding the maximum, spreading the remaining
+	// destinations evenly across the zones of their Nodes.
+	DestinationOverflowPolicyTruncate DestinationOverflowPolicy = "Truncate"
 )
 
-func AddExtraFlags(fs *pflag.FlagSet) {
-	fs.StringVar(&OnmetalKubeconfigPath, "onmetal-kubeconfig", "", "Path to the onmetal kubeconfig.")
+// validateDestinationOverflowPolicy returns an error if the policy is neither empty nor supported.
+func validateDestinationOverflowPolicy(policy DestinationOverflowPolicy) error {
+	switch policy {
+	case "", DestinationOverflowPolicyError, DestinationOverflowPolicyTruncate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported destination overflow policy %q, supported policies: %s, %s", policy, DestinationOverflowPolicyError, DestinationOverflowPolicyTruncate)
+	}
 }
 
-func LoadCloudProviderConfig(f io.Reader) (*cloudProviderConfig, error) {
-	klog.V(2).Infof("Reading configuration for cloud provider: %s", ProviderName)
-	configBytes, err := io.ReadAll(f)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read in config")
+// LoadBalancerNaming is the scheme the names of LoadBalancers are derived from their Service with.
+type LoadBalancerNaming string
+
+const (
+	// LoadBalancerNamingUID names LoadBalancers <cluster>-<service-name>-<first segment of the Service UID>.
+	LoadBalancerNamingUID LoadBalancerNaming = "UID"
+	// LoadBalancerNamingDeterministic names LoadBalancers <cluster>-<service-name>-<hash>, where the hash is derived
+	// from the cluster name and the namespace and name of the Service only. The names are predictable before the
+	// Service is created, e.g. for GitOps tooling or Terraform imports.
+	LoadBalancerNamingDeterministic LoadBalancerNaming = "Deterministic"
+	// LoadBalancerNamingTemplate names LoadBalancers by rendering the loadBalancerNameTemplate of the cloud config.
+	LoadBalancerNamingTemplate LoadBalancerNaming = "Template"
+)
+
+// validateLoadBalancerNaming returns an error if the naming scheme is neither empty nor supported.
+func validateLoadBalancerNaming(naming LoadBalancerNaming) error {
+	switch naming {
+	case "", LoadBalancerNamingUID, LoadBalancerNamingDeterministic, LoadBalancerNamingTemplate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported load balancer naming %q, supported namings: %s, %s, %s", naming, LoadBalancerNamingUID, LoadBalancerNamingDeterministic, LoadBalancerNamingTemplate)
+	}
+}
+
+// configurableShutdownMachineStates are the states of Machines which can be configured to be treated as shut down.
+var configurableShutdownMachineStates = sets.New(computev1alpha1.MachineStatePending, computev1alpha1.MachineStateShutdown, computev1alpha1.MachineStateTerminated)
+
+// isMachineShutdown reports whether the Machine is shut down. Besides Machines in state Shutdown, pending Machines
+// requested to be powered off and Machines in one of the ShutdownMachineStates are considered shut down.
+func (c CloudConfig) isMachineShutdown(machine *computev1alpha1.Machine) bool {
+	switch {
+	case machine.Status.State == computev1alpha1.MachineStateShutdown:
+		return true
+	case machine.Status.State == computev1alpha1.MachineStatePending && machine.Spec.Power == computev1alpha1.PowerOff:
+		return true
+	default:
+		return slices.Contains(c.ShutdownMachineStates, machine.Status.State)
+	}
+}
+
+// isMachineFailed reports whether the Machine failed. Terminated Machines cannot be started again and are considered
+// failed.
+func isMachineFailed(machine *computev1alpha1.Machine) bool {
+	return machine.Status.State == computev1alpha1.MachineStateTerminated
+}
+
+// ApplyConflictPolicy is the policy for conflicts of server-side applies with field managers of other controllers.
+type ApplyConflictPolicy string
+
+const (
+	// ApplyConflictPolicyForce takes over the ownership of conflicting fields.
+	ApplyConflictPolicyForce ApplyConflictPolicy = "Force"
+	// ApplyConflictPolicyFail fails applies changing fields owned by other field managers.
+	ApplyConflictPolicyFail ApplyConflictPolicy = "Fail"
+)
+
+// applyConflictPolicyKinds are the kinds of objects an ApplyConflictPolicy can be configured for.
+var applyConflictPolicyKinds = sets.New("LoadBalancer", "LoadBalancerRouting")
+
+// maxFieldOwnerLength is the maximum length of a field manager accepted by the API server.
+const maxFieldOwnerLength = 128
+
+// FieldOwners are the field managers of the writes of the individual features to the onmetal API.
+type FieldOwners struct {
+	// Instances is the field manager of the cluster labels of Machines and NetworkInterfaces. Defaults to
+	// "cloud-provider.onmetal.de/instances".
+	Instances string `json:"instances,omitempty"`
+	// Routes is the field manager of the prefixes of NetworkInterfaces. Defaults to "cloud-provider.onmetal.de/routes".
+	Routes string `json:"routes,omitempty"`
+	// LoadBalancers is the field manager of LoadBalancers. Defaults to FieldOwner.
+	LoadBalancers string `json:"loadBalancers,omitempty"`
+	// LoadBalancerRoutings is the field manager of LoadBalancerRoutings. Defaults to FieldOwner if set, otherwise to
+	// "cloud-provider.onmetal.de/loadbalancerrouting".
+	LoadBalancerRoutings string `json:"loadBalancerRoutings,omitempty"`
+}
+
+// fieldOwnerFor returns the field manager of the writes of objects of the given kind, i.e. LoadBalancer or
+// LoadBalancerRouting.
+func (c CloudConfig) fieldOwnerFor(kind string) client.FieldOwner {
+	owner, defaultOwner := c.FieldOwners.LoadBalancers, loadBalancerFieldOwner
+	if kind == "LoadBalancerRouting" {
+		owner, defaultOwner = c.FieldOwners.LoadBalancerRoutings, loadBalancerRoutingFieldOwner
+	}
+	switch {
+	case owner != "":
+		return client.FieldOwner(owner)
+	case c.FieldOwner != "":
+		return client.FieldOwner(c.FieldOwner)
+	default:
+		return defaultOwner
 	}
+}
 
-	cloudConfig := &CloudConfig{}
-	if err := yaml.Unmarshal(configBytes, cloudConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cloud config: %w", err)
+// fieldOwnerForInstances returns the field manager of the cluster labels of Machines and NetworkInterfaces.
+func (c CloudConfig) fieldOwnerForInstances() client.FieldOwner {
+	if c.FieldOwners.Instances != "" {
+		return client.FieldOwner(c.FieldOwners.Instances)
 	}
+	return instancesFieldOwner
+}
 
-	if cloudConfig.NetworkName == "" {
-		return nil, fmt.Errorf("networkName missing in cloud config")
+// fieldOwnerForRoutes returns the field manager of the prefixes of NetworkInterfaces.
+func (c CloudConfig) fieldOwnerForRoutes() client.FieldOwner {
+	if c.FieldOwners.Routes != "" {
+		return client.FieldOwner(c.FieldOwners.Routes)
 	}
+	return routesFieldOwner
+}
 
-	if cloudConfig.ClusterName == "" {
-		return nil, fmt.Errorf("clusterName missing in cloud config")
+// applyOptionsFor returns the patch options for applying an object of the given kind.
+func (c CloudConfig) applyOptionsFor(kind string) []client.PatchOption {
+	if c.ApplyConflictPolicies[kind] == ApplyConflictPolicyFail {
+		return []client.PatchOption{c.fieldOwnerFor(kind)}
 	}
+	return []client.PatchOption{c.fieldOwnerFor(kind), client.ForceOwnership}
+}
 
-	onmetalKubeconfigData, err := os.ReadFile(OnmetalKubeconfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read onmetal kubeconfig %s: %w", OnmetalKubeconfigPath, err)
+// checkPatchConflictsFor returns the conflicts of the merge patch of an object of the given kind from base to obj with
+// fields of other field managers if the ApplyConflictPolicy of the kind is ApplyConflictPolicyFail.
+func (c CloudConfig) checkPatchConflictsFor(kind string, obj, base client.Object) error {
+	if c.ApplyConflictPolicies[kind] != ApplyConflictPolicyFail {
+		return nil
+	}
+	return checkPatchConflicts(obj, base, c.fieldOwnerFor(kind))
+}
+
+// MachinePoolTopology is the zone and region of the Machines of a MachinePool.
+type MachinePoolTopology struct {
+	Zone   string `json:"zone,omitempty"`
+	Region string `json:"region,omitempty"`
+}
+
+// zoneForMachinePool returns the zone of the Machines of the MachinePool, the configured topology zone or the name of
+// the MachinePool.
+func (c CloudConfig) zoneForMachinePool(machinePoolName string) string {
+	if topology, ok := c.MachinePoolTopology[machinePoolName]; ok && topology.Zone != "" {
+		return topology.Zone
+	}
+	return machinePoolName
+}
+
+var (
+	OnmetalKubeconfigPath           string
+	OnmetalKubeconfigReloadInterval time.Duration
+	OnmetalDebugBindAddress         string
+	OnmetalTracingEndpoint          string
+	OnmetalFeatureGates             map[string]bool
+	OnmetalLogVerbosity             map[string]int
+	OnmetalLogSamplingInterval      time.Duration
+	OnmetalClientOptions            = ClientOptions{
+		MaxRetries:             3,
+		CircuitBreakerCooldown: 30 * time.Second,
 	}
+)
+
+func AddExtraFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&OnmetalKubeconfigPath, "onmetal-kubeconfig", "", "Path to the onmetal kubeconfig.")
+	fs.DurationVar(&OnmetalKubeconfigReloadInterval, "onmetal-kubeconfig-reload-interval", 0, "Interval the onmetal kubeconfig is re-read in to pick up rotated credentials without a restart. Zero disables reloading.")
+	fs.StringVar(&OnmetalDebugBindAddress, "onmetal-debug-bind-address", "", "Address to serve the debug endpoints of the onmetal cloud provider on. Empty disables the debug endpoints.")
+	fs.StringVar(&OnmetalTracingEndpoint, "onmetal-tracing-endpoint", "", "OTLP gRPC endpoint to export the traces of the onmetal cloud provider to. Empty disables tracing.")
+	fs.Var(cliflag.NewMapStringBool(&OnmetalFeatureGates), "onmetal-feature-gates", "Comma-separated list of key=value pairs enabling or disabling experimental behaviors of the onmetal cloud provider, e.g. DirectPodRouting=true,AsyncProvisioning=true. Takes precedence over the featureGates of the cloud config.")
+	fs.Var(newLogVerbosityFlag(&OnmetalLogVerbosity), "onmetal-log-verbosity", "Comma-separated list of module=level pairs setting the log verbosity of modules of the onmetal cloud provider independently of -v, e.g. load-balancer=4,instances=0. Supported modules are instances, load-balancer and routes.")
+	fs.DurationVar(&OnmetalLogSamplingInterval, "onmetal-log-sampling-interval", 0, "Interval in which the verbose logs of only one InstanceMetadata call per Node are kept, the number of dropped calls is logged with the next kept one. Zero disables sampling.")
+	fs.Float32Var(&OnmetalClientOptions.QPS, "onmetal-api-qps", OnmetalClientOptions.QPS, "Maximum queries per second to the onmetal API. Zero uses the client default.")
+	fs.IntVar(&OnmetalClientOptions.Burst, "onmetal-api-burst", OnmetalClientOptions.Burst, "Maximum burst of queries to the onmetal API. Zero uses the client default.")
+	fs.IntVar(&OnmetalClientOptions.MaxRetries, "onmetal-api-max-retries", OnmetalClientOptions.MaxRetries, "Number of retries of an operation throttled by the onmetal API.")
+	fs.IntVar(&OnmetalClientOptions.CircuitBreakerThreshold, "onmetal-api-circuit-breaker-threshold", OnmetalClientOptions.CircuitBreakerThreshold, "Number of consecutive throttled operations after which operations fail immediately. Zero disables the circuit breaker.")
+	fs.DurationVar(&OnmetalClientOptions.CircuitBreakerCooldown, "onmetal-api-circuit-breaker-cooldown", OnmetalClientOptions.CircuitBreakerCooldown, "Duration operations fail immediately once the circuit breaker is open.")
+}
 
-	onmetalKubeconfig, err := clientcmd.Load(onmetalKubeconfigData)
+func LoadCloudProviderConfig(f io.Reader) (*cloudProviderConfig, error) {
+	klog.V(2).Infof("Reading configuration for cloud provider: %s", ProviderName)
+	configBytes, err := io.ReadAll(f)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read onmetal cluster kubeconfig: %w", err)
+		return nil, fmt.Errorf("unable to read in config: %w", err)
 	}
-	clientConfig := clientcmd.NewDefaultClientConfig(*onmetalKubeconfig, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloudConfigSourceTimeout)
+	defer cancel()
+	cloudConfig, err := decodeCloudConfig(ctx, configBytes)
 	if err != nil {
-		return nil, fmt.Errorf("unable to serialize onmetal cluster kubeconfig: %w", err)
+		return nil, err
 	}
-	restConfig, err := clientConfig.ClientConfig()
+
+	if err := cloudConfig.Validate(); err != nil {
+		return nil, err
+	}
+	featureGates, err := newFeatureGates(*cloudConfig, OnmetalFeatureGates)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get onmetal cluster rest config: %w", err)
+		return nil, err
 	}
-	namespace, _, err := clientConfig.Namespace()
+
+	restConfig, namespace, err := loadOnmetalRestConfig(OnmetalKubeconfigPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get namespace from onmetal kubeconfig: %w", err)
+		return nil, err
 	}
 	// TODO: empty or unset namespace will be defaulted to the 'default' namespace. We might want to handle this
 	// as an error.
@@ -96,8 +443,251 @@ func LoadCloudProviderConfig(f io.Reader) (*cloudProviderConfig, error) {
 	klog.V(2).Infof("Successfully read configuration for cloud provider: %s", ProviderName)
 
 	return &cloudProviderConfig{
-		RestConfig:  restConfig,
-		Namespace:   namespace,
-		cloudConfig: *cloudConfig,
+		RestConfig:   restConfig,
+		Namespace:    namespace,
+		cloudConfig:  *cloudConfig,
+		featureGates: featureGates,
 	}, nil
 }
+
+// loadOnmetalRestConfig returns the rest config and the namespace of the onmetal kubeconfig at the given path,
+// reloading its credentials if OnmetalKubeconfigReloadInterval is set.
+func loadOnmetalRestConfig(path string) (*rest.Config, string, error) {
+	onmetalKubeconfigData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read onmetal kubeconfig %s: %w", path, err)
+	}
+
+	restConfig, namespace, err := loadOnmetalKubeconfig(path, onmetalKubeconfigData)
+	if err != nil {
+		return nil, "", err
+	}
+	if OnmetalKubeconfigReloadInterval > 0 {
+		if restConfig, err = newReloadingRestConfig(path, onmetalKubeconfigData, restConfig, OnmetalKubeconfigReloadInterval); err != nil {
+			return nil, "", err
+		}
+	}
+	OnmetalClientOptions.applyToRestConfig(restConfig)
+	if OnmetalTracingEndpoint != "" {
+		wrapRestConfigWithTracing(restConfig)
+	}
+	return restConfig, namespace, nil
+}
+
+// Validate validates the CloudConfig and returns all errors found.
+func (c CloudConfig) Validate() error {
+	var errs []error
+	if c.NetworkName == "" {
+		errs = append(errs, fmt.Errorf("networkName missing in cloud config"))
+	}
+	if c.ClusterName == "" {
+		errs = append(errs, fmt.Errorf("clusterName missing in cloud config"))
+	}
+	if c.DestinationResolutionConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("destinationResolutionConcurrency must not be negative"))
+	}
+	if c.InternalDNSSuffix != "" {
+		if msgs := validation.IsDNS1123Subdomain(strings.TrimPrefix(c.InternalDNSSuffix, ".")); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("internalDNSSuffix is invalid: %s", strings.Join(msgs, ", ")))
+		}
+	}
+	if c.MaxDestinations < 0 {
+		errs = append(errs, fmt.Errorf("maxDestinations must not be negative"))
+	}
+	if err := validateDestinationOverflowPolicy(c.DestinationOverflowPolicy); err != nil {
+		errs = append(errs, fmt.Errorf("invalid destinationOverflowPolicy: %w", err))
+	}
+	if err := validateLoadBalancerNaming(c.LoadBalancerNaming); err != nil {
+		errs = append(errs, fmt.Errorf("invalid loadBalancerNaming: %w", err))
+	}
+	switch {
+	case c.LoadBalancerNaming == LoadBalancerNamingTemplate && c.LoadBalancerNameTemplate == "":
+		errs = append(errs, fmt.Errorf("loadBalancerNameTemplate is required for loadBalancerNaming %s", LoadBalancerNamingTemplate))
+	case c.LoadBalancerNaming != LoadBalancerNamingTemplate && c.LoadBalancerNameTemplate != "":
+		errs = append(errs, fmt.Errorf("loadBalancerNameTemplate is only supported for loadBalancerNaming %s", LoadBalancerNamingTemplate))
+	case c.LoadBalancerNameTemplate != "":
+		if _, err := parseLoadBalancerNameTemplate(c.LoadBalancerNameTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("invalid loadBalancerNameTemplate: %w", err))
+		}
+	}
+	for _, ipFamily := range c.NetworkIPFamilies {
+		if ipFamily != corev1.IPv4Protocol && ipFamily != corev1.IPv6Protocol {
+			errs = append(errs, fmt.Errorf("networkIPFamilies contains unsupported IP family %q", ipFamily))
+		}
+	}
+	for _, state := range c.ShutdownMachineStates {
+		if !configurableShutdownMachineStates.Has(state) {
+			errs = append(errs, fmt.Errorf("shutdownMachineStates contains unsupported state %q", state))
+		}
+	}
+	if c.DryRun && c.Observer {
+		errs = append(errs, fmt.Errorf("dryRun and observer are mutually exclusive"))
+	}
+	if c.ReadOnly && (c.DryRun || c.Observer) {
+		errs = append(errs, fmt.Errorf("readOnly is mutually exclusive with dryRun and observer"))
+	}
+	if c.ReadOnly && c.CleanupClusterLabels {
+		errs = append(errs, fmt.Errorf("cleanupClusterLabels is not supported with readOnly"))
+	}
+	if c.CleanupClusterLabels && c.SharedNamespace {
+		errs = append(errs, fmt.Errorf("cleanupClusterLabels is not supported with sharedNamespace"))
+	}
+	if c.AsyncLoadBalancerStatus && c.AsyncLoadBalancerProvisioning {
+		errs = append(errs, fmt.Errorf("asyncLoadBalancerStatus and asyncLoadBalancerProvisioning are mutually exclusive"))
+	}
+	if c.FailStaticDuration.Duration < 0 {
+		errs = append(errs, fmt.Errorf("failStaticDuration must not be negative"))
+	}
+	if c.InstanceMetadataResyncWindow.Duration < 0 {
+		errs = append(errs, fmt.Errorf("instanceMetadataResyncWindow must not be negative"))
+	}
+	if len(c.FieldOwner) > maxFieldOwnerLength {
+		errs = append(errs, fmt.Errorf("fieldOwner must not be longer than %d characters", maxFieldOwnerLength))
+	}
+	for field, owner := range map[string]string{
+		"instances":            c.FieldOwners.Instances,
+		"routes":               c.FieldOwners.Routes,
+		"loadBalancers":        c.FieldOwners.LoadBalancers,
+		"loadBalancerRoutings": c.FieldOwners.LoadBalancerRoutings,
+	} {
+		if len(owner) > maxFieldOwnerLength {
+			errs = append(errs, fmt.Errorf("fieldOwners.%s must not be longer than %d characters", field, maxFieldOwnerLength))
+		}
+	}
+	for key := range c.ServiceAnnotationDefaults {
+		if !serviceAnnotations.Has(key) {
+			errs = append(errs, fmt.Errorf("serviceAnnotationDefaults contains unsupported annotation %q", key))
+		}
+	}
+	for _, key := range c.LoadBalancerAnnotationKeys {
+		if !strings.HasPrefix(key, PassThroughAnnotationPrefix) {
+			errs = append(errs, fmt.Errorf("loadBalancerAnnotationKeys contains annotation %q without prefix %s", key, PassThroughAnnotationPrefix))
+			continue
+		}
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("loadBalancerAnnotationKeys contains invalid annotation %q: %s", key, strings.Join(msgs, ", ")))
+		}
+	}
+	for kind, policy := range c.ApplyConflictPolicies {
+		if !applyConflictPolicyKinds.Has(kind) {
+			errs = append(errs, fmt.Errorf("applyConflictPolicies contains unsupported kind %q", kind))
+		}
+		if policy != ApplyConflictPolicyForce && policy != ApplyConflictPolicyFail {
+			errs = append(errs, fmt.Errorf("applyConflictPolicies contains unsupported policy %q for kind %q", policy, kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// requiredOnmetalPermissions are the permissions the cloud provider needs in the onmetal namespace.
+var requiredOnmetalPermissions = []authorizationv1.ResourceAttributes{
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networks", Verb: "get"},
+	{Group: ipamv1alpha1.SchemeGroupVersion.Group, Resource: "prefixes", Verb: "get"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "get"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "list"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "watch"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "patch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "get"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "list"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "watch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "patch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancers", Verb: "get"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancers", Verb: "list"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancers", Verb: "watch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancers", Verb: "patch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancers", Verb: "delete"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancerroutings", Verb: "get"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancerroutings", Verb: "list"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancerroutings", Verb: "watch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "loadbalancerroutings", Verb: "patch"},
+}
+
+// requiredAdditionalNamespacePermissions are the permissions the cloud provider needs in additional namespaces
+// containing Machines.
+var requiredAdditionalNamespacePermissions = []authorizationv1.ResourceAttributes{
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "get"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "list"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "watch"},
+	{Group: computev1alpha1.SchemeGroupVersion.Group, Resource: "machines", Verb: "patch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "get"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "list"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "watch"},
+	{Group: networkingv1alpha1.SchemeGroupVersion.Group, Resource: "networkinterfaces", Verb: "patch"},
+}
+
+// getRequiredOnmetalPermissions returns the permissions the cloud provider needs in the onmetal namespace with the
+// given CloudConfig. With readOnly or observer, only the permissions to read are required.
+func getRequiredOnmetalPermissions(cloudConfig CloudConfig) []authorizationv1.ResourceAttributes {
+	return filterRequiredPermissions(cloudConfig, requiredOnmetalPermissions)
+}
+
+// getRequiredAdditionalNamespacePermissions returns the permissions the cloud provider needs in additional namespaces
+// with the given CloudConfig. With readOnly or observer, only the permissions to read are required.
+func getRequiredAdditionalNamespacePermissions(cloudConfig CloudConfig) []authorizationv1.ResourceAttributes {
+	return filterRequiredPermissions(cloudConfig, requiredAdditionalNamespacePermissions)
+}
+
+// filterRequiredPermissions returns the permissions to read of the given permissions with readOnly or observer and all
+// of them otherwise.
+func filterRequiredPermissions(cloudConfig CloudConfig, required []authorizationv1.ResourceAttributes) []authorizationv1.ResourceAttributes {
+	if !cloudConfig.ReadOnly && !cloudConfig.Observer {
+		return required
+	}
+	var permissions []authorizationv1.ResourceAttributes
+	for _, permission := range required {
+		if permission.Verb == "get" || permission.Verb == "list" || permission.Verb == "watch" {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// validateCloudConfigAgainstOnmetal checks that the objects referenced by the CloudConfig exist in the onmetal
+// namespace and that the onmetal credentials have all required permissions. All errors found are returned.
+func validateCloudConfigAgainstOnmetal(ctx context.Context, onmetalClient client.Client, namespace string, cloudConfig CloudConfig) error {
+	var errs []error
+	network := &networkingv1alpha1.Network{}
+	if err := onmetalClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cloudConfig.NetworkName}, network); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get Network %s referenced by networkName: %w", cloudConfig.NetworkName, err))
+	}
+
+	if cloudConfig.PrefixName != "" {
+		prefix := &ipamv1alpha1.Prefix{}
+		if err := onmetalClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cloudConfig.PrefixName}, prefix); err != nil {
+			errs = append(errs, fmt.Errorf("failed to get Prefix %s referenced by prefixName: %w", cloudConfig.PrefixName, err))
+		}
+	}
+	if cloudConfig.IPv6PrefixName != "" {
+		prefix := &ipamv1alpha1.Prefix{}
+		if err := onmetalClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cloudConfig.IPv6PrefixName}, prefix); err != nil {
+			errs = append(errs, fmt.Errorf("failed to get Prefix %s referenced by ipv6PrefixName: %w", cloudConfig.IPv6PrefixName, err))
+		}
+	}
+
+	errs = append(errs, reviewOnmetalPermissions(ctx, onmetalClient, namespace, getRequiredOnmetalPermissions(cloudConfig))...)
+	for _, additionalNamespace := range cloudConfig.AdditionalNamespaces {
+		errs = append(errs, reviewOnmetalPermissions(ctx, onmetalClient, additionalNamespace, getRequiredAdditionalNamespacePermissions(cloudConfig))...)
+	}
+	return errors.Join(errs...)
+}
+
+// reviewOnmetalPermissions returns an error for every permission the onmetal credentials lack in the namespace.
+func reviewOnmetalPermissions(ctx context.Context, onmetalClient client.Client, namespace string, permissions []authorizationv1.ResourceAttributes) []error {
+	var errs []error
+	for _, permission := range permissions {
+		permission.Namespace = namespace
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &permission,
+			},
+		}
+		if err := onmetalClient.Create(ctx, review); err != nil {
+			errs = append(errs, fmt.Errorf("failed to review permission to %s %s: %w", permission.Verb, permission.Resource, err))
+			continue
+		}
+		if !review.Status.Allowed {
+			errs = append(errs, fmt.Errorf("missing permission to %s %s.%s in namespace %s", permission.Verb, permission.Resource, permission.Group, namespace))
+		}
+	}
+	return errs
+}
@@ -15,14 +15,24 @@
 package onmetal
 
 import (
+	"context"
 	"os"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/yaml"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
 )
 
 var _ = Describe("Config", func() {
@@ -131,7 +141,8 @@ var _ = Describe("Config", func() {
 
 		configReader := strings.NewReader(string(configData))
 		config, err := LoadCloudProviderConfig(configReader)
-		Expect(err.Error()).To(Equal("networkName missing in cloud config"))
+		Expect(err).To(MatchError(ContainSubstring("networkName missing in cloud config")))
+		Expect(err).To(MatchError(ContainSubstring("clusterName missing in cloud config")))
 		Expect(config).To(BeNil())
 	})
 
@@ -145,4 +156,181 @@ var _ = Describe("Config", func() {
 		Expect(err.Error()).To(Equal("clusterName missing in cloud config"))
 		Expect(config).To(BeNil())
 	})
+
+	It("should reject unsupported apply conflict policies", func() {
+		cloudConfig := CloudConfig{
+			NetworkName: "my-network",
+			ClusterName: "my-cluster",
+			ApplyConflictPolicies: map[string]ApplyConflictPolicy{
+				"LoadBalancerRouting": ApplyConflictPolicyFail,
+				"Machine":             ApplyConflictPolicyFail,
+				"LoadBalancer":        "Ignore",
+			},
+		}
+		err := cloudConfig.Validate()
+		Expect(err).To(MatchError(ContainSubstring(`unsupported kind "Machine"`)))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported policy "Ignore" for kind "LoadBalancer"`)))
+	})
+
+	It("should reject cleaning up cluster labels in a shared namespace", func() {
+		cloudConfig := CloudConfig{
+			NetworkName:          "my-network",
+			ClusterName:          "my-cluster",
+			SharedNamespace:      true,
+			CleanupClusterLabels: true,
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring("cleanupClusterLabels is not supported with sharedNamespace")))
+	})
+
+	It("should reject unsupported network IP families", func() {
+		cloudConfig := CloudConfig{
+			NetworkName:       "my-network",
+			ClusterName:       "my-cluster",
+			NetworkIPFamilies: []corev1.IPFamily{corev1.IPv4Protocol, "IPv5"},
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring(`networkIPFamilies contains unsupported IP family "IPv5"`)))
+	})
+
+	It("should reject asynchronous load balancer status and provisioning together", func() {
+		cloudConfig := CloudConfig{
+			NetworkName:                   "my-network",
+			ClusterName:                   "my-cluster",
+			AsyncLoadBalancerStatus:       true,
+			AsyncLoadBalancerProvisioning: true,
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring("asyncLoadBalancerStatus and asyncLoadBalancerProvisioning are mutually exclusive")))
+	})
+
+	It("should reject read-only mode together with features writing to the onmetal API", func() {
+		cloudConfig := CloudConfig{
+			NetworkName:          "my-network",
+			ClusterName:          "my-cluster",
+			ReadOnly:             true,
+			Observer:             true,
+			CleanupClusterLabels: true,
+		}
+		err := cloudConfig.Validate()
+		Expect(err).To(MatchError(ContainSubstring("readOnly is mutually exclusive with dryRun and observer")))
+		Expect(err).To(MatchError(ContainSubstring("cleanupClusterLabels is not supported with readOnly")))
+	})
+
+	It("should only require read permissions in read-only and observer mode", func() {
+		Expect(getRequiredOnmetalPermissions(CloudConfig{})).To(ContainElement(HaveField("Verb", "patch")))
+		Expect(getRequiredOnmetalPermissions(CloudConfig{ReadOnly: true})).To(SatisfyAll(
+			Not(BeEmpty()),
+			HaveEach(HaveField("Verb", BeElementOf("get", "list", "watch"))),
+		))
+		Expect(getRequiredOnmetalPermissions(CloudConfig{Observer: true})).To(SatisfyAll(
+			Not(BeEmpty()),
+			HaveEach(HaveField("Verb", BeElementOf("get", "list", "watch"))),
+		))
+
+		Expect(getRequiredAdditionalNamespacePermissions(CloudConfig{})).To(ContainElement(HaveField("Verb", "patch")))
+		Expect(getRequiredAdditionalNamespacePermissions(CloudConfig{ReadOnly: true})).To(SatisfyAll(
+			Not(BeEmpty()),
+			HaveEach(HaveField("Verb", BeElementOf("get", "list", "watch"))),
+		))
+		Expect(getRequiredAdditionalNamespacePermissions(CloudConfig{Observer: true})).To(SatisfyAll(
+			Not(BeEmpty()),
+			HaveEach(HaveField("Verb", BeElementOf("get", "list", "watch"))),
+		))
+	})
+
+	It("should only force ownership for kinds without the fail apply conflict policy", func() {
+		cloudConfig := CloudConfig{
+			ApplyConflictPolicies: map[string]ApplyConflictPolicy{"LoadBalancerRouting": ApplyConflictPolicyFail},
+		}
+		Expect(cloudConfig.applyOptionsFor("LoadBalancer")).To(ContainElement(client.ForceOwnership))
+		Expect(cloudConfig.applyOptionsFor("LoadBalancerRouting")).To(ConsistOf(loadBalancerRoutingFieldOwner))
+	})
+
+	It("should apply with the configured field owner", func() {
+		cloudConfig := CloudConfig{FieldOwner: "my-cloud-provider"}
+		Expect(cloudConfig.applyOptionsFor("LoadBalancer")).To(ConsistOf(client.FieldOwner("my-cloud-provider"), client.ForceOwnership))
+
+		cloudConfig.FieldOwner = strings.Repeat("a", maxFieldOwnerLength+1)
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring("fieldOwner")))
+	})
+
+	It("should write with the field owners configured per feature", func() {
+		cloudConfig := CloudConfig{
+			FieldOwner:  "my-cloud-provider",
+			FieldOwners: FieldOwners{LoadBalancerRoutings: "my-routing", Routes: "my-routes"},
+		}
+		Expect(cloudConfig.fieldOwnerFor("LoadBalancer")).To(Equal(client.FieldOwner("my-cloud-provider")))
+		Expect(cloudConfig.fieldOwnerFor("LoadBalancerRouting")).To(Equal(client.FieldOwner("my-routing")))
+		Expect(cloudConfig.fieldOwnerForRoutes()).To(Equal(client.FieldOwner("my-routes")))
+		Expect(cloudConfig.fieldOwnerForInstances()).To(Equal(instancesFieldOwner))
+
+		cloudConfig.FieldOwners.Instances = strings.Repeat("a", maxFieldOwnerLength+1)
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring("fieldOwners.instances")))
+	})
+
+	It("should treat pending machines requested to be powered off and configured states as shut down", func() {
+		newMachine := func(power computev1alpha1.Power, state computev1alpha1.MachineState) *computev1alpha1.Machine {
+			return &computev1alpha1.Machine{
+				Spec:   computev1alpha1.MachineSpec{Power: power},
+				Status: computev1alpha1.MachineStatus{State: state},
+			}
+		}
+		cloudConfig := CloudConfig{}
+		Expect(cloudConfig.isMachineShutdown(newMachine(computev1alpha1.PowerOff, computev1alpha1.MachineStateShutdown))).To(BeTrue())
+		Expect(cloudConfig.isMachineShutdown(newMachine(computev1alpha1.PowerOff, computev1alpha1.MachineStatePending))).To(BeTrue())
+		Expect(cloudConfig.isMachineShutdown(newMachine(computev1alpha1.PowerOn, computev1alpha1.MachineStatePending))).To(BeFalse())
+		Expect(cloudConfig.isMachineShutdown(newMachine(computev1alpha1.PowerOn, computev1alpha1.MachineStateTerminated))).To(BeFalse())
+
+		cloudConfig.ShutdownMachineStates = []computev1alpha1.MachineState{computev1alpha1.MachineStateTerminated}
+		Expect(cloudConfig.isMachineShutdown(newMachine(computev1alpha1.PowerOn, computev1alpha1.MachineStateTerminated))).To(BeTrue())
+
+		cloudConfig = CloudConfig{
+			NetworkName:           "my-network",
+			ClusterName:           "my-cluster",
+			ShutdownMachineStates: []computev1alpha1.MachineState{computev1alpha1.MachineStatePending, computev1alpha1.MachineStateRunning},
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring(`unsupported state "Running"`)))
+	})
+
+	It("should reject defaults of unsupported service annotations", func() {
+		cloudConfig := CloudConfig{
+			NetworkName: "my-network",
+			ClusterName: "my-cluster",
+			ServiceAnnotationDefaults: map[string]string{
+				ProxyProtocolAnnotation: proxyProtocolV2,
+				"example.org/foo":       "bar",
+			},
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(`serviceAnnotationDefaults contains unsupported annotation "example.org/foo"`))
+	})
+
+	It("should only allow passing through annotations with the pass-through prefix", func() {
+		cloudConfig := CloudConfig{
+			NetworkName:                "my-network",
+			ClusterName:                "my-cluster",
+			LoadBalancerAnnotationKeys: []string{"lb.onmetal.de/idle-timeout", "example.org/foo"},
+		}
+		Expect(cloudConfig.Validate()).To(MatchError(`loadBalancerAnnotationKeys contains annotation "example.org/foo" without prefix lb.onmetal.de/`))
+
+		cloudConfig.LoadBalancerAnnotationKeys = []string{"lb.onmetal.de/idle timeout"}
+		Expect(cloudConfig.Validate()).To(MatchError(ContainSubstring(`loadBalancerAnnotationKeys contains invalid annotation "lb.onmetal.de/idle timeout"`)))
+	})
+
+	It("should report missing onmetal objects and permissions", func(ctx SpecContext) {
+		network := &networkingv1alpha1.Network{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "my-network"}}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(network).WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+				if !ok {
+					return c.Create(ctx, obj, opts...)
+				}
+				review.Status.Allowed = review.Spec.ResourceAttributes.Verb != "delete"
+				return nil
+			},
+		}).Build()
+
+		cloudConfig := CloudConfig{NetworkName: "my-network", PrefixName: "my-prefix", ClusterName: "my-cluster"}
+		err := validateCloudConfigAgainstOnmetal(ctx, onmetalClient, "foo", cloudConfig)
+		Expect(err).To(MatchError(ContainSubstring("failed to get Prefix my-prefix")))
+		Expect(err).To(MatchError(ContainSubstring("missing permission to delete loadbalancers")))
+		Expect(err).NotTo(MatchError(ContainSubstring("Network")))
+	})
 })
@@ -0,0 +1,165 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// CloudConfigAPIVersion is the API version of the versioned cloud config.
+	CloudConfigAPIVersion = "cloud.onmetal.de/v1alpha1"
+	// CloudConfigKind is the kind of the versioned cloud config.
+	CloudConfigKind = "CloudConfig"
+
+	// defaultCloudConfigSourceKey is the key of the cloud config in a referenced Secret or ConfigMap if none is set.
+	defaultCloudConfigSourceKey = "cloud-config"
+	// cloudConfigSourceTimeout is the timeout of reading a referenced Secret or ConfigMap.
+	cloudConfigSourceTimeout = 30 * time.Second
+)
+
+// cloudConfigV1Alpha1 is the cloud.onmetal.de/v1alpha1 version of the cloud config. The fields of the CloudConfig are
+// inlined, so that the legacy format without apiVersion and kind converts by setting both.
+type cloudConfigV1Alpha1 struct {
+	metav1.TypeMeta `json:",inline"`
+	// ConfigFrom references a Secret or ConfigMap in the target cluster containing the cloud config. The fields set
+	// in the file take precedence over the ones of the referenced cloud config.
+	ConfigFrom  *CloudConfigSource `json:"configFrom,omitempty"`
+	CloudConfig `json:",inline"`
+}
+
+// CloudConfigSource references a Secret or ConfigMap containing a cloud config in the legacy or a versioned format.
+type CloudConfigSource struct {
+	// Kind is either Secret or ConfigMap.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Key is the key of the cloud config in the Secret or ConfigMap, defaults to cloud-config.
+	Key string `json:"key,omitempty"`
+}
+
+// newCloudConfigSourceReader returns the client to read referenced Secrets and ConfigMaps with. The cloud config is
+// loaded before the cloud controller manager provides its clients, hence the in-cluster config is used.
+var newCloudConfigSourceReader = func() (client.Reader, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+	return client.New(restConfig, client.Options{Scheme: targetScheme})
+}
+
+// decodeCloudConfig decodes the cloud config in the legacy format or the cloud.onmetal.de/v1alpha1 version, resolving
+// a referenced Secret or ConfigMap.
+func decodeCloudConfig(ctx context.Context, data []byte) (*CloudConfig, error) {
+	return decodeCloudConfigWithSource(ctx, data, true)
+}
+
+func decodeCloudConfigWithSource(ctx context.Context, data []byte, allowSource bool) (*CloudConfig, error) {
+	typeMeta := &metav1.TypeMeta{}
+	if err := yaml.Unmarshal(data, typeMeta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cloud config: %w", err)
+	}
+	switch {
+	case typeMeta.APIVersion == "" && typeMeta.Kind == "":
+		return convertLegacyCloudConfig(data)
+	case typeMeta.APIVersion == CloudConfigAPIVersion && typeMeta.Kind == CloudConfigKind:
+	default:
+		return nil, fmt.Errorf("unsupported cloud config apiVersion %q and kind %q, expected %s %s", typeMeta.APIVersion, typeMeta.Kind, CloudConfigAPIVersion, CloudConfigKind)
+	}
+
+	cloudConfig := &cloudConfigV1Alpha1{}
+	if err := yaml.Unmarshal(data, cloudConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cloud config: %w", err)
+	}
+	if cloudConfig.ConfigFrom == nil {
+		return &cloudConfig.CloudConfig, nil
+	}
+	if !allowSource {
+		return nil, fmt.Errorf("cloud config referenced by configFrom must not set configFrom")
+	}
+
+	sourceData, err := readCloudConfigSource(ctx, *cloudConfig.ConfigFrom)
+	if err != nil {
+		return nil, err
+	}
+	sourceConfig, err := decodeCloudConfigWithSource(ctx, sourceData, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cloud config of %s %s/%s: %w", cloudConfig.ConfigFrom.Kind, cloudConfig.ConfigFrom.Namespace, cloudConfig.ConfigFrom.Name, err)
+	}
+	// the fields of the file are decoded over the referenced cloud config
+	cloudConfig = &cloudConfigV1Alpha1{CloudConfig: *sourceConfig}
+	if err := yaml.Unmarshal(data, cloudConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cloud config: %w", err)
+	}
+	return &cloudConfig.CloudConfig, nil
+}
+
+// convertLegacyCloudConfig converts the cloud config of the legacy format without apiVersion and kind. It has the
+// same fields as the cloud.onmetal.de/v1alpha1 version, except for configFrom.
+func convertLegacyCloudConfig(data []byte) (*CloudConfig, error) {
+	klog.V(2).InfoS("Converting cloud config of the legacy format", "APIVersion", CloudConfigAPIVersion, "Kind", CloudConfigKind)
+	cloudConfig := &CloudConfig{}
+	if err := yaml.Unmarshal(data, cloudConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cloud config: %w", err)
+	}
+	return cloudConfig, nil
+}
+
+// readCloudConfigSource returns the cloud config of the referenced Secret or ConfigMap.
+func readCloudConfigSource(ctx context.Context, source CloudConfigSource) ([]byte, error) {
+	key := source.Key
+	if key == "" {
+		key = defaultCloudConfigSourceKey
+	}
+	reader, err := newCloudConfigSourceReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for configFrom: %w", err)
+	}
+	objKey := client.ObjectKey{Namespace: source.Namespace, Name: source.Name}
+
+	switch source.Kind {
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := reader.Get(ctx, objKey, secret); err != nil {
+			return nil, fmt.Errorf("failed to get Secret %s referenced by configFrom: %w", objKey, err)
+		}
+		data, ok := secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s missing in Secret %s referenced by configFrom", key, objKey)
+		}
+		return data, nil
+	case "ConfigMap":
+		configMap := &corev1.ConfigMap{}
+		if err := reader.Get(ctx, objKey, configMap); err != nil {
+			return nil, fmt.Errorf("failed to get ConfigMap %s referenced by configFrom: %w", objKey, err)
+		}
+		data, ok := configMap.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s missing in ConfigMap %s referenced by configFrom", key, objKey)
+		}
+		return []byte(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported configFrom kind %q, expected Secret or ConfigMap", source.Kind)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Config versions", func() {
+	BeforeEach(func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "cloud-config"},
+			Data: map[string][]byte{
+				"cloud-config": []byte("networkName: secret-network\nclusterName: secret-cluster\n"),
+			},
+		}
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "cloud-config"},
+			Data: map[string]string{
+				"config": "apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nnetworkName: config-map-network\nclusterName: config-map-cluster\n",
+				"nested": "apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: Secret\n  namespace: kube-system\n  name: cloud-config\n",
+			},
+		}
+		reader := fake.NewClientBuilder().WithScheme(targetScheme).WithObjects(secret, configMap).Build()
+
+		previous := newCloudConfigSourceReader
+		newCloudConfigSourceReader = func() (client.Reader, error) {
+			return reader, nil
+		}
+		DeferCleanup(func() {
+			newCloudConfigSourceReader = previous
+		})
+	})
+
+	It("should convert the legacy format", func(ctx context.Context) {
+		cloudConfig, err := decodeCloudConfig(ctx, []byte("networkName: my-network\nclusterName: my-cluster\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cloudConfig).To(Equal(CloudConfig{NetworkName: "my-network", ClusterName: "my-cluster"}))
+	})
+
+	It("should decode the v1alpha1 version", func(ctx context.Context) {
+		cloudConfig, err := decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nnetworkName: my-network\nclusterName: my-cluster\ndryRun: true\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cloudConfig).To(Equal(CloudConfig{NetworkName: "my-network", ClusterName: "my-cluster", DryRun: true}))
+	})
+
+	It("should reject unsupported versions", func(ctx context.Context) {
+		_, err := decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1\nkind: CloudConfig\n"))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported cloud config apiVersion "cloud.onmetal.de/v1"`)))
+	})
+
+	It("should load the cloud config of a referenced Secret with the fields of the file taking precedence", func(ctx context.Context) {
+		cloudConfig, err := decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: Secret\n  namespace: kube-system\n  name: cloud-config\nclusterName: my-cluster\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cloudConfig).To(Equal(CloudConfig{NetworkName: "secret-network", ClusterName: "my-cluster"}))
+	})
+
+	It("should load the cloud config of a referenced ConfigMap key", func(ctx context.Context) {
+		cloudConfig, err := decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: ConfigMap\n  namespace: kube-system\n  name: cloud-config\n  key: config\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cloudConfig).To(Equal(CloudConfig{NetworkName: "config-map-network", ClusterName: "config-map-cluster"}))
+	})
+
+	It("should reject nested and missing references", func(ctx context.Context) {
+		_, err := decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: ConfigMap\n  namespace: kube-system\n  name: cloud-config\n  key: nested\n"))
+		Expect(err).To(MatchError(ContainSubstring("must not set configFrom")))
+
+		_, err = decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: Secret\n  namespace: kube-system\n  name: cloud-config\n  key: other\n"))
+		Expect(err).To(MatchError(ContainSubstring("key other missing in Secret kube-system/cloud-config")))
+
+		_, err = decodeCloudConfig(ctx, []byte("apiVersion: cloud.onmetal.de/v1alpha1\nkind: CloudConfig\nconfigFrom:\n  kind: Node\n  name: cloud-config\n"))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported configFrom kind "Node"`)))
+	})
+})
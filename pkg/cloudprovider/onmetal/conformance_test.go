@@ -0,0 +1,121 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build conformance
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	servicecontroller "k8s.io/cloud-provider/controllers/service"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/component-base/featuregate"
+	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// The conformance specs run the upstream service controller of k8s.io/cloud-provider against the onmetal cloud
+// provider to validate the LoadBalancer implementation against the expectations of the upstream controller. They are
+// only built with the conformance build tag, see `make conformance`.
+var _ = Describe("Service controller conformance", Label("conformance"), func() {
+	ns, cp, _, clusterName := SetupTest()
+
+	BeforeEach(func() {
+		k8sClientSet, err := kubernetes.NewForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		informerFactory := informers.NewSharedInformerFactory(k8sClientSet, 0)
+		controller, err := servicecontroller.New(
+			*cp,
+			k8sClientSet,
+			informerFactory.Core().V1().Services(),
+			informerFactory.Core().V1().Nodes(),
+			clusterName,
+			featuregate.NewFeatureGate(),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		informerFactory.Start(ctx.Done())
+		go controller.Run(ctx, 1, controllersmetrics.NewControllerManagerMetrics("conformance"))
+	})
+
+	It("should provision, report and clean up the load balancer of a service", func(ctx SpecContext) {
+		lbProvider, ok := (*cp).LoadBalancer()
+		Expect(ok).To(BeTrue())
+
+		By("creating a service of type LoadBalancer")
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "service-",
+				Namespace:    ns.Name,
+			},
+			Spec: corev1.ServiceSpec{
+				Type: corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{
+					{
+						Name:       "https",
+						Protocol:   corev1.ProtocolTCP,
+						Port:       443,
+						TargetPort: intstr.FromInt(443),
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, service)).To(Succeed())
+
+		By("waiting for the load balancer to be created")
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      lbProvider.GetLoadBalancerName(ctx, clusterName, service),
+			},
+		}
+		Eventually(Get(loadBalancer)).Should(Succeed())
+
+		By("allocating an IP to the load balancer")
+		Eventually(UpdateStatus(loadBalancer, func() {
+			loadBalancer.Status.IPs = []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}
+		})).Should(Succeed())
+
+		By("ensuring the service reports the IP of the load balancer and carries the cleanup finalizer")
+		Eventually(Object(service)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Finalizers", ContainElement(servicehelpers.LoadBalancerCleanupFinalizer)),
+			HaveField("Status.LoadBalancer.Ingress", ConsistOf(corev1.LoadBalancerIngress{
+				IP:    "10.0.0.1",
+				Ports: []corev1.PortStatus{{Protocol: corev1.ProtocolTCP, Port: 443}},
+			})),
+		))
+
+		By("deleting the service")
+		Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+
+		By("ensuring the load balancer and the service are gone")
+		Eventually(Get(loadBalancer)).Should(Satisfy(apierrors.IsNotFound))
+		Eventually(Get(service)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
@@ -17,6 +17,70 @@ package onmetal
 const (
 	// InternalLoadBalancerAnnotation is internal load balancer annotation of service
 	InternalLoadBalancerAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-internal"
+	// LoadBalancerPortRangesAnnotation is the annotation of a service exposing port ranges, e.g. "10000-20000".
+	// Every range has to start at a port of the service.
+	LoadBalancerPortRangesAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-port-ranges"
+	// FlowLogsAnnotation is the annotation of a service to enable flow logging of its load balancer
+	FlowLogsAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-flow-logs"
+	// FlowLogsDestinationAnnotation is the annotation of a service referencing the destination of the flow logs
+	FlowLogsDestinationAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-flow-logs-destination"
+	// ProxyProtocolAnnotation is the annotation of a service to enable the PROXY protocol toward the backends of its
+	// load balancer. The only supported version is "v2".
+	ProxyProtocolAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-proxy-protocol"
+	// PublicPrefixAnnotation is the annotation of a service referencing the onmetal Prefix the IP of its public load
+	// balancer is allocated from. It is not supported for load balancers of multiple IP families.
+	PublicPrefixAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-public-prefix"
+	// ManageRoutingAnnotation is the annotation of a service to disable the management of the LoadBalancerRouting of
+	// its load balancer with "false", e.g. to let a CNI integration route directly to the pods
+	ManageRoutingAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-manage-routing"
+	// NodePoolsAnnotation is the annotation of a service limiting the destinations of its load balancer to the
+	// Machines of the given comma-separated MachinePools
+	NodePoolsAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-node-pools"
+	// ZonesAnnotation is the annotation of a service requesting its load balancer to be placed in the given
+	// comma-separated availability zones. The value "auto" places it in the zones of the MachinePools of the
+	// NodePoolsAnnotation or, without node pools, in the zones of the nodes of the cluster.
+	ZonesAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-zones"
+	// MaxDestinationsAnnotation is the annotation of a service limiting the number of destinations of its load
+	// balancer, overriding the maxDestinations of the cloud config
+	MaxDestinationsAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-max-destinations"
+	// DestinationOverflowPolicyAnnotation is the annotation of a service selecting the policy applied if its load
+	// balancer exceeds the maximum number of destinations, overriding the destinationOverflowPolicy of the cloud config
+	DestinationOverflowPolicyAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-destination-overflow-policy"
+	// EndpointDestinationsAnnotation is the annotation of a service without selector routing its load balancer to the
+	// addresses of its manually maintained EndpointSlices instead of its nodes, e.g. to external or VM-only backends
+	EndpointDestinationsAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-endpoint-destinations"
+	// LoadBalancerNameAnnotation is the annotation of a service adopting the pre-existing onmetal LoadBalancer of the
+	// given name instead of creating one. Only the routing of the load balancer is managed, it is never modified nor
+	// deleted
+	LoadBalancerNameAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-name"
+	// LoadBalancerHostnameAnnotation is the annotation of a service requesting a DNS record resolving the given
+	// hostname to the IPs of its load balancer, see the dnsRecords option of the cloud config
+	LoadBalancerHostnameAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-hostname"
+	// ZoneAffinityAnnotation is the annotation of a service requesting its load balancer to route clients to the
+	// destinations in their own zone, either "preferred" or "required". It is evaluated by data planes supporting zone
+	// affinity.
+	ZoneAffinityAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-zone-affinity"
+	// EgressSNATAnnotation is the annotation of a service requesting the destinations of its public load balancer to
+	// send their egress traffic from the IPs of the load balancer, either "true" or "false". It allows allowlisting a
+	// single egress IP per service and is evaluated by data planes supporting egress SNAT.
+	EgressSNATAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-egress-snat"
+	// InternalLoadBalancerPrefixLengthAnnotation is the annotation of an internal load balancer service setting the
+	// length of the prefixes allocated for its IPs per IP family, as a comma-separated list of <ip-family>=<length>,
+	// e.g. "IPv4=32,IPv6=64". IP families without length get a single IP.
+	InternalLoadBalancerPrefixLengthAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-internal-prefix-length"
+	// NodePoolWeightsAnnotation is the annotation of a service assigning relative weights to the destinations of its
+	// load balancer by their MachinePools as a comma-separated list of <machine-pool>=<weight>, e.g. "stable=9,canary=1".
+	// The weights are non-negative integers, destinations of MachinePools without weight have weight 1.
+	NodePoolWeightsAnnotation = "service.beta.kubernetes.io/onmetal-load-balancer-node-pool-weights"
+	// HealthCheckAnnotationPrefix is the prefix of the annotations of a service configuring the health check of the
+	// destinations of a port of its load balancer, followed by the port, e.g.
+	// "service.beta.kubernetes.io/onmetal-load-balancer-health-check.443". The value is the health check protocol
+	// "tcp", "http" or "https", optionally followed by the path of HTTP based health checks, e.g. "https:/healthz".
+	HealthCheckAnnotationPrefix = "service.beta.kubernetes.io/onmetal-load-balancer-health-check."
+	// PassThroughAnnotationPrefix is the prefix of the annotations of a service copied verbatim onto its load balancer
+	// if allowed by the loadBalancerAnnotationKeys of the cloud config, e.g. to tune backend specific settings of the
+	// load balancer data plane
+	PassThroughAnnotationPrefix = "lb.onmetal.de/"
 	// AnnotationKeyClusterName is the cluster name annotation key name
 	AnnotationKeyClusterName = "cluster-name"
 	// AnnotationKeyServiceName is the service name annotation key name
@@ -25,6 +89,111 @@ const (
 	AnnotationKeyServiceNamespace = "service-namespace"
 	// AnnotationKeyServiceUID is the service UID annotation key name
 	AnnotationKeyServiceUID = "service-uid"
+	// AnnotationKeyBackendPorts is the annotation key name of the backend ports the load balancer ports are mapped to
+	AnnotationKeyBackendPorts = "backend-ports"
+	// AnnotationKeyFlowLogsDestination is the annotation key name of the flow logs destination of a load balancer,
+	// evaluated by data planes supporting flow logs
+	AnnotationKeyFlowLogsDestination = "flow-logs-destination"
+	// AnnotationKeyProxyProtocol is the annotation key name of the PROXY protocol version a load balancer sends to
+	// its backends, evaluated by data planes supporting the PROXY protocol
+	AnnotationKeyProxyProtocol = "proxy-protocol"
+	// AnnotationKeyManageRouting is the annotation key name marking a load balancer whose LoadBalancerRouting is not
+	// managed by the cloud provider with "false"
+	AnnotationKeyManageRouting = "manage-routing"
+	// AnnotationKeyNodePools is the annotation key name of the comma-separated MachinePools the destinations of a
+	// load balancer are limited to
+	AnnotationKeyNodePools = "node-pools"
+	// AnnotationKeyZones is the annotation key name of the comma-separated availability zones a load balancer should
+	// be placed in, evaluated by data planes supporting zonal placement
+	AnnotationKeyZones = "zones"
+	// AnnotationKeyZoneAffinity is the annotation key name of the zone affinity of a load balancer, evaluated by data
+	// planes supporting zone affinity
+	AnnotationKeyZoneAffinity = "zone-affinity"
+	// AnnotationKeyDestinationZones is the annotation key name of the zones of the destinations of a load balancer
+	// routing, as a comma separated list of <network-interface>=<zone>. It is only set for load balancers with zone
+	// affinity.
+	AnnotationKeyDestinationZones = "destination-zones"
+	// AnnotationKeyAppProtocols is the annotation key name of the application protocols of the load balancer ports, as
+	// a comma separated list of <protocol>/<port>=<app-protocol>, evaluated by data planes supporting L7 features
+	AnnotationKeyAppProtocols = "app-protocols"
+	// AnnotationKeyHealthCheckNodePort is the annotation key name of the node port serving the health of the local
+	// endpoints of a Service with the Local external traffic policy, evaluated by data planes supporting health checks
+	// to take destinations without local endpoints out of rotation
+	AnnotationKeyHealthCheckNodePort = "health-check-node-port"
+	// AnnotationKeyEgressSNAT is the annotation key name of a load balancer whose destinations send their egress
+	// traffic from its IPs, evaluated by data planes supporting egress SNAT
+	AnnotationKeyEgressSNAT = "egress-snat"
+	// AnnotationKeyHealthChecks is the annotation key name of the health checks of the load balancer ports, as a comma
+	// separated list of <protocol>/<port>=<health-protocol>[:<path>], evaluated by data planes supporting health checks
+	AnnotationKeyHealthChecks = "health-checks"
+	// AnnotationKeyHostname is the annotation key name of the DNS name of a load balancer, set by data planes
+	// providing DNS names and reported as hostname of the ingresses of the Service
+	AnnotationKeyHostname = "hostname"
+	// AnnotationKeyAllocatedPorts is the annotation key name of the ports allocated for a load balancer, as a comma
+	// separated list of <protocol>/<port>, set by data planes reporting the allocation of ports. Service ports not
+	// allocated are reported with the error PortNotAllocated.
+	AnnotationKeyAllocatedPorts = "allocated-ports"
+	// AnnotationKeyCCMVersion is the annotation key name of the version of the cloud provider which last wrote an
+	// onmetal object
+	AnnotationKeyCCMVersion = "onmetal.de/ccm-version"
+	// AnnotationKeyCreatedBy is the annotation key name of the identity of the cloud provider replica which created a
+	// load balancer
+	AnnotationKeyCreatedBy = "created-by"
+	// AnnotationKeyMaxDestinations is the annotation key name of the maximum number of destinations of a load balancer
+	AnnotationKeyMaxDestinations = "max-destinations"
 	// LabelKeyClusterName is the label key name used to identify the cluster name in Kubernetes labels
 	LabelKeyClusterName = "kubernetes.io/cluster"
+	// LabelKeyServiceUID is the label key name used to identify the UID of the service of a load balancer
+	LabelKeyServiceUID = "onmetal.de/service-uid"
+	// LabelKeyMachinePool is the label key name of the MachinePool of a Node
+	LabelKeyMachinePool = "onmetal.de/machine-pool"
+	// LabelKeyMachineArchitecture is the label key name of the architecture of the Machine of a Node
+	LabelKeyMachineArchitecture = "onmetal.de/arch"
+	// LabelKeyMachineOS is the label key name of the operating system of the Machine of a Node
+	LabelKeyMachineOS = "onmetal.de/os"
+	// AnnotationKeyMachinePoolCapacity is the annotation key name of the capacity of the MachinePool of a Node
+	AnnotationKeyMachinePoolCapacity = "onmetal.de/machine-pool-capacity"
+	// AnnotationKeyMachinePoolAllocatable is the annotation key name of the allocatable resources of the MachinePool of a Node
+	AnnotationKeyMachinePoolAllocatable = "onmetal.de/machine-pool-allocatable"
+	// AnnotationKeyMachinePoolAllocatableMachines is the annotation key name of the number of Machines of the MachineClass
+	// of a Node that can still be allocated in the MachinePool of the Node
+	AnnotationKeyMachinePoolAllocatableMachines = "onmetal.de/machine-pool-allocatable-machines"
+	// AnnotationKeyPropagatedLabels is the annotation key name of the comma separated keys of the labels copied from the
+	// Machine and its MachinePool to a Node, so that they are removed once they are no longer copied
+	AnnotationKeyPropagatedLabels = "onmetal.de/propagated-labels"
+	// AnnotationKeyExcludeVirtualIPAddresses is the annotation key name of a Machine overriding whether the VirtualIPs
+	// of its network interfaces are excluded from the addresses of its Node, either "true" or "false"
+	AnnotationKeyExcludeVirtualIPAddresses = "onmetal.de/exclude-virtual-ip-addresses"
+	// AnnotationKeyExcludeNetworkInterfaces is the annotation key name of a Machine listing the comma-separated names
+	// of its network interfaces whose addresses are excluded from the addresses of its Node
+	AnnotationKeyExcludeNetworkInterfaces = "onmetal.de/exclude-network-interfaces"
+	// AnnotationKeyMachineUID is the annotation key name of the UID of the Machine backing a Node, used to detect
+	// Machines recreated under the same name
+	AnnotationKeyMachineUID = "onmetal.de/machine-uid"
+	// AnnotationKeyLoadBalancerUID is the annotation key name of the UID of the onmetal LoadBalancer of a Service
+	AnnotationKeyLoadBalancerUID = "onmetal.de/load-balancer-uid"
+	// AnnotationKeyLoadBalancerName is the annotation key name of the name of the onmetal LoadBalancer of a Service
+	AnnotationKeyLoadBalancerName = "onmetal.de/load-balancer-name"
+	// LabelKeyAutoscalerNodeGroup is the label key name of the node group of a Node for the node group
+	// auto-discovery of the cluster-autoscaler. Nodes of the same MachinePool and MachineClass form a node group.
+	LabelKeyAutoscalerNodeGroup = "autoscaler.onmetal.de/node-group"
+	// AnnotationKeyAutoscalerNodeGroupMinSize is the annotation key name of the minimum size of the node group of a
+	// Node, mirrored from the annotation of the same name of its MachinePool
+	AnnotationKeyAutoscalerNodeGroupMinSize = "autoscaler.onmetal.de/node-group-min-size"
+	// AnnotationKeyAutoscalerNodeGroupMaxSize is the annotation key name of the maximum size of the node group of a
+	// Node, mirrored from the annotation of the same name of its MachinePool
+	AnnotationKeyAutoscalerNodeGroupMaxSize = "autoscaler.onmetal.de/node-group-max-size"
+	// ServiceConditionLoadBalancerReady is the condition type of a service reporting whether the IPs of its load
+	// balancer are allocated
+	ServiceConditionLoadBalancerReady = "onmetal.de/LoadBalancerReady"
+	// ServiceConditionIPFamiliesDowngraded is the condition type of a PreferDualStack service whose load balancer is
+	// provisioned without the IP families not supported by the network
+	ServiceConditionIPFamiliesDowngraded = "onmetal.de/IPFamiliesDowngraded"
+	// ServiceConditionPortsNotAllowed is the condition type of a service whose load balancer is rejected by the onmetal
+	// API because of some of its ports, e.g. ports reserved by the infrastructure
+	ServiceConditionPortsNotAllowed = "onmetal.de/PortsNotAllowed"
+	// TaintKeyMachineShutdown is the taint key of Nodes whose Machine is shut down
+	TaintKeyMachineShutdown = "cloud-provider.onmetal.de/machine-shutdown"
+	// TaintKeyMachineFailed is the taint key of Nodes whose Machine failed, see CloudConfig.TaintFailedMachines
+	TaintKeyMachineFailed = "cloud-provider.onmetal.de/machine-failed"
 )
@@ -0,0 +1,140 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudproviderv1alpha1 "github.com/onmetal/cloud-provider-onmetal/pkg/apis/cloudprovider/v1alpha1"
+)
+
+// dnsRecordProvider manages the DNS records of the hostnames of LoadBalancer Services. The record of a Service is
+// identified by the Service, every Service has at most one record.
+type dnsRecordProvider interface {
+	// EnsureRecord creates or updates the record of the Service resolving hostname to the given IPs.
+	EnsureRecord(ctx context.Context, service *v1.Service, hostname string, ips []string) error
+	// DeleteRecord deletes the record of the Service. It succeeds if the Service has no record.
+	DeleteRecord(ctx context.Context, service *v1.Service) error
+}
+
+// dnsRecordObjectProvider manages the DNS records as DNSRecords next to the Services in the target cluster, which are
+// published by an external DNS controller. The DNSRecords are owned by their Service and hence garbage collected with
+// it.
+type dnsRecordObjectProvider struct {
+	targetClient client.Client
+}
+
+func newDNSRecordObjectProvider(targetClient client.Client) *dnsRecordObjectProvider {
+	return &dnsRecordObjectProvider{
+		targetClient: targetClient,
+	}
+}
+
+func (p *dnsRecordObjectProvider) EnsureRecord(ctx context.Context, service *v1.Service, hostname string, ips []string) error {
+	dnsRecord := &cloudproviderv1alpha1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+		},
+	}
+	result, err := controllerutil.CreateOrPatch(ctx, p.targetClient, dnsRecord, func() error {
+		dnsRecord.Spec.Hostname = hostname
+		dnsRecord.Spec.Addresses = ips
+		return controllerutil.SetOwnerReference(service, dnsRecord, p.targetClient.Scheme())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ensure DNSRecord %s: %w", client.ObjectKeyFromObject(dnsRecord), err)
+	}
+	if result != controllerutil.OperationResultNone {
+		klog.V(2).InfoS("Ensured DNSRecord for Service", "DNSRecord", client.ObjectKeyFromObject(dnsRecord), "Hostname", hostname, "Addresses", ips, "Result", result)
+	}
+	return nil
+}
+
+func (p *dnsRecordObjectProvider) DeleteRecord(ctx context.Context, service *v1.Service) error {
+	dnsRecord := &cloudproviderv1alpha1.DNSRecord{}
+	dnsRecordKey := client.ObjectKeyFromObject(service)
+	if err := p.targetClient.Get(ctx, dnsRecordKey, dnsRecord); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !isOwnedBy(dnsRecord, service) {
+		// the DNSRecord is not managed for this Service
+		return nil
+	}
+	klog.V(2).InfoS("Deleting DNSRecord of Service", "DNSRecord", dnsRecordKey)
+	if err := p.targetClient.Delete(ctx, dnsRecord); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete DNSRecord %s: %w", dnsRecordKey, err)
+	}
+	return nil
+}
+
+func isOwnedBy(obj metav1.Object, owner metav1.Object) bool {
+	for _, ownerReference := range obj.GetOwnerReferences() {
+		if ownerReference.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileDNSRecord ensures the DNS record of the hostname annotation of the Service resolves to the ingress IPs of
+// its load balancer. The record is deleted if the annotation was removed. If no IP is allocated yet, the record is
+// left as is.
+func reconcileDNSRecord(ctx context.Context, dnsRecords dnsRecordProvider, service *v1.Service, status *v1.LoadBalancerStatus) error {
+	if dnsRecords == nil {
+		return nil
+	}
+	hostname := service.Annotations[LoadBalancerHostnameAnnotation]
+	if hostname == "" {
+		return dnsRecords.DeleteRecord(ctx, service)
+	}
+	var ips []string
+	if status != nil {
+		for _, ingress := range status.Ingress {
+			if ingress.IP != "" {
+				ips = append(ips, ingress.IP)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	return dnsRecords.EnsureRecord(ctx, service, hostname, ips)
+}
+
+// validateLoadBalancerHostnameForService validates the hostname annotation of the Service.
+func validateLoadBalancerHostnameForService(service *v1.Service, cloudConfig CloudConfig) error {
+	hostname, ok := service.Annotations[LoadBalancerHostnameAnnotation]
+	if !ok {
+		return nil
+	}
+	if !cloudConfig.DNSRecords {
+		return fmt.Errorf("annotation %s of Service %s is not supported, dnsRecords is not enabled in the cloud config", LoadBalancerHostnameAnnotation, client.ObjectKeyFromObject(service))
+	}
+	if msgs := validation.IsDNS1123Subdomain(hostname); len(msgs) > 0 {
+		return fmt.Errorf("annotation %s is not a valid hostname: %s", LoadBalancerHostnameAnnotation, strings.Join(msgs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cloudproviderv1alpha1 "github.com/onmetal/cloud-provider-onmetal/pkg/apis/cloudprovider/v1alpha1"
+)
+
+var _ = Describe("DNSRecords", func() {
+	var (
+		targetClient client.Client
+		dnsRecords   *dnsRecordObjectProvider
+		service      *corev1.Service
+		status       *corev1.LoadBalancerStatus
+	)
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "service",
+				UID:         "service-uid",
+				Annotations: map[string]string{LoadBalancerHostnameAnnotation: "app.example.com"},
+			},
+		}
+		targetClient = fake.NewClientBuilder().WithScheme(targetScheme).WithObjects(service).Build()
+		dnsRecords = newDNSRecordObjectProvider(targetClient)
+		status = &corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}}
+	})
+
+	It("should create a DNSRecord owned by the Service for the ingress IPs", func(ctx SpecContext) {
+		Expect(reconcileDNSRecord(ctx, dnsRecords, service, status)).To(Succeed())
+
+		dnsRecord := &cloudproviderv1alpha1.DNSRecord{}
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), dnsRecord)).To(Succeed())
+		Expect(dnsRecord.Spec).To(Equal(cloudproviderv1alpha1.DNSRecordSpec{
+			Hostname:  "app.example.com",
+			Addresses: []string{"10.0.0.1"},
+		}))
+		Expect(isOwnedBy(dnsRecord, service)).To(BeTrue())
+
+		By("updating the DNSRecord once the IPs change")
+		status.Ingress = append(status.Ingress, corev1.LoadBalancerIngress{IP: "2001:db8::1"})
+		Expect(reconcileDNSRecord(ctx, dnsRecords, service, status)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), dnsRecord)).To(Succeed())
+		Expect(dnsRecord.Spec.Addresses).To(Equal([]string{"10.0.0.1", "2001:db8::1"}))
+
+		By("deleting the DNSRecord once the annotation is removed")
+		delete(service.Annotations, LoadBalancerHostnameAnnotation)
+		Expect(reconcileDNSRecord(ctx, dnsRecords, service, status)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), dnsRecord)).To(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should not create a DNSRecord before the IPs are allocated", func(ctx SpecContext) {
+		Expect(reconcileDNSRecord(ctx, dnsRecords, service, &corev1.LoadBalancerStatus{})).To(Succeed())
+
+		dnsRecordList := &cloudproviderv1alpha1.DNSRecordList{}
+		Expect(targetClient.List(ctx, dnsRecordList)).To(Succeed())
+		Expect(dnsRecordList.Items).To(BeEmpty())
+	})
+
+	It("should not delete DNSRecords not owned by the Service", func(ctx SpecContext) {
+		dnsRecord := &cloudproviderv1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"},
+			Spec:       cloudproviderv1alpha1.DNSRecordSpec{Hostname: "other.example.com"},
+		}
+		Expect(targetClient.Create(ctx, dnsRecord)).To(Succeed())
+
+		Expect(dnsRecords.DeleteRecord(ctx, service)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(dnsRecord), dnsRecord)).To(Succeed())
+	})
+
+	It("should validate the hostname annotation", func() {
+		Expect(validateLoadBalancerHostnameForService(service, CloudConfig{})).To(MatchError(ContainSubstring("dnsRecords is not enabled")))
+		Expect(validateLoadBalancerHostnameForService(service, CloudConfig{DNSRecords: true})).To(Succeed())
+
+		service.Annotations[LoadBalancerHostnameAnnotation] = "App_Example"
+		Expect(validateLoadBalancerHostnameForService(service, CloudConfig{DNSRecords: true})).To(MatchError(ContainSubstring("is not a valid hostname")))
+	})
+})
@@ -0,0 +1,68 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"errors"
+)
+
+// The errors below are wrapped into the errors returned by the provider interfaces, so that callers can distinguish
+// failures with errors.Is. Errors of the onmetal API stay wrapped as well, e.g. apierrors.IsNotFound keeps working.
+
+var (
+	// ErrLoadBalancerNotFound is returned if the LoadBalancer of a Service to update does not exist (yet). It is
+	// retryable, the LoadBalancer is created by the next EnsureLoadBalancer.
+	ErrLoadBalancerNotFound = errors.New("load balancer not found")
+	// ErrIPAllocationTimeout is returned if the IPs of a LoadBalancer are not allocated in time. It is retryable.
+	ErrIPAllocationTimeout = errors.New("timeout waiting for the IP allocation of the load balancer")
+	// ErrLoadBalancerProvisioning is returned if the IPs of a LoadBalancer are not allocated yet and EnsureLoadBalancer
+	// does not wait for them. It is retryable.
+	ErrLoadBalancerProvisioning = errors.New("load balancer provisioning in progress")
+	// ErrNetworkMismatch is returned if an existing LoadBalancer is in another Network than the one configured for
+	// the cluster. It is terminal, the LoadBalancer has to be moved or deleted manually.
+	ErrNetworkMismatch = errors.New("load balancer network does not match the configured network")
+	// ErrIPFamilyNotSupported is returned if a Service requires an IP family not supported by the Network. It is
+	// terminal until the IP families of the Service or the networkIPFamilies of the cloud config are changed.
+	ErrIPFamilyNotSupported = errors.New("ip family is not supported by the network")
+	// ErrPrefixMissing is returned if an internal LoadBalancer is requested without a prefixName in the cloud
+	// config. It is terminal until the cloud config is fixed.
+	ErrPrefixMissing = errors.New("prefixName is not defined in config")
+	// ErrQuotaExceeded is returned if a ResourceQuota of the onmetal namespace does not allow another LoadBalancer.
+	// It is terminal until the quota is raised or other LoadBalancers are deleted.
+	ErrQuotaExceeded = errors.New("onmetal quota exceeded")
+	// ErrLoadBalancerNameCollision is returned if the name of a new LoadBalancer is taken by the LoadBalancer of
+	// another Service, e.g. of a deleted Service with the same namespace and name whose LoadBalancer is not deleted
+	// yet. It is terminal until the other LoadBalancer is deleted.
+	ErrLoadBalancerNameCollision = errors.New("load balancer name is taken by another service")
+	// ErrLoadBalancerNotAdoptable is returned if the pre-existing LoadBalancer selected by a Service is not compatible
+	// with the Service, e.g. does not expose its ports. It is terminal until the LoadBalancer or the Service is changed.
+	ErrLoadBalancerNotAdoptable = errors.New("load balancer cannot be adopted by the service")
+	// ErrReadOnly is returned for writes to the onmetal API if the cloud provider runs with readOnly. It is terminal,
+	// the feature attempting the write is not supported with readOnly.
+	ErrReadOnly = errors.New("onmetal API is read-only")
+	// ErrPortNotAllowed is returned if the onmetal API rejects a LoadBalancer because of some of its ports, e.g.
+	// because they are reserved by the infrastructure. It is terminal until the ports of the Service are changed.
+	ErrPortNotAllowed = errors.New("port is not allowed by the onmetal load balancer")
+)
+
+// IsRetryableError returns true if the operation failing with the error is expected to succeed when retried without
+// any change of the cloud config or the onmetal objects, e.g. because the onmetal API was throttled or an IP
+// allocation did not complete in time.
+func IsRetryableError(err error) bool {
+	return errors.Is(err, ErrOnmetalAPIThrottled) ||
+		errors.Is(err, ErrIPAllocationTimeout) ||
+		errors.Is(err, ErrLoadBalancerProvisioning) ||
+		errors.Is(err, ErrLoadBalancerNotFound)
+}
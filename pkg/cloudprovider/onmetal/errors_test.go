@@ -0,0 +1,95 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Errors", func() {
+	var service *corev1.Service
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", UID: "service-uid"},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80}},
+			},
+		}
+	})
+
+	newLoadBalancerProvider := func(cloudConfig CloudConfig, objs ...*networkingv1alpha1.LoadBalancer) *onmetalLoadBalancer {
+		builder := fake.NewClientBuilder().WithScheme(onmetalScheme)
+		for _, obj := range objs {
+			builder = builder.WithObjects(obj)
+		}
+		onmetalClient := builder.Build()
+		return newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "foo", cloudConfig, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+	}
+
+	It("should distinguish retryable from terminal errors", func() {
+		Expect(IsRetryableError(fmt.Errorf("wrapped: %w", ErrIPAllocationTimeout))).To(BeTrue())
+		Expect(IsRetryableError(fmt.Errorf("wrapped: %w", ErrOnmetalAPIThrottled))).To(BeTrue())
+		Expect(IsRetryableError(fmt.Errorf("wrapped: %w", ErrLoadBalancerNotFound))).To(BeTrue())
+		Expect(IsRetryableError(fmt.Errorf("wrapped: %w", ErrNetworkMismatch))).To(BeFalse())
+		Expect(IsRetryableError(fmt.Errorf("wrapped: %w", ErrPrefixMissing))).To(BeFalse())
+	})
+
+	It("should return ErrLoadBalancerNotFound when updating a missing load balancer", func(ctx SpecContext) {
+		lb := newLoadBalancerProvider(CloudConfig{NetworkName: "network"})
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+
+		err := lb.UpdateLoadBalancer(ctx, "test", service, []*corev1.Node{node})
+		Expect(err).To(MatchError(ErrLoadBalancerNotFound))
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should return ErrPrefixMissing for an internal load balancer without prefix", func(ctx SpecContext) {
+		lb := newLoadBalancerProvider(CloudConfig{NetworkName: "network"})
+		service.Annotations = map[string]string{InternalLoadBalancerAnnotation: "true"}
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ErrPrefixMissing))
+	})
+
+	It("should return ErrNetworkMismatch for a load balancer in another network", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      getLoadBalancerNameForService("test", service, ""),
+				Labels:    getLoadBalancerLabelsForService("test", service),
+			},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				Type:       networkingv1alpha1.LoadBalancerTypePublic,
+				NetworkRef: corev1.LocalObjectReference{Name: "other-network"},
+			},
+		}
+		lb := newLoadBalancerProvider(CloudConfig{NetworkName: "network"}, loadBalancer)
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ErrNetworkMismatch))
+	})
+})
@@ -0,0 +1,139 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides an in-memory implementation of the onmetal cloud provider for unit tests of components
+// consuming the cloud provider interfaces. Every implementation records its calls and allows overriding its behavior
+// per method.
+package fake
+
+import (
+	"sync"
+
+	cloudprovider "k8s.io/cloud-provider"
+
+	"github.com/onmetal/cloud-provider-onmetal/pkg/cloudprovider/onmetal"
+)
+
+// Call is a recorded call of a method of a fake implementation.
+type Call struct {
+	// Method is the name of the called method.
+	Method string
+	// Args are the arguments of the call, excluding the context.
+	Args []interface{}
+}
+
+// CallRecorder records the calls of a fake implementation.
+type CallRecorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *CallRecorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns all recorded calls in the order they were made.
+func (r *CallRecorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the recorded calls of the given method in the order they were made.
+func (r *CallRecorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset removes all recorded calls.
+func (r *CallRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// Cloud is a fake cloudprovider.Interface. Interfaces which are nil are reported as unsupported.
+type Cloud struct {
+	CallRecorder
+
+	LoadBalancerImpl *LoadBalancer
+	InstancesV2Impl  *InstancesV2
+}
+
+// NewCloud returns a Cloud with an empty LoadBalancer and InstancesV2.
+func NewCloud() *Cloud {
+	return &Cloud{
+		LoadBalancerImpl: NewLoadBalancer(),
+		InstancesV2Impl:  NewInstancesV2(),
+	}
+}
+
+var _ cloudprovider.Interface = &Cloud{}
+
+func (c *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	c.record("Initialize", clientBuilder, stop)
+}
+
+func (c *Cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	c.record("LoadBalancer")
+	if c.LoadBalancerImpl == nil {
+		return nil, false
+	}
+	return c.LoadBalancerImpl, true
+}
+
+func (c *Cloud) Instances() (cloudprovider.Instances, bool) {
+	c.record("Instances")
+	return nil, false
+}
+
+func (c *Cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
+	c.record("InstancesV2")
+	if c.InstancesV2Impl == nil {
+		return nil, false
+	}
+	return c.InstancesV2Impl, true
+}
+
+func (c *Cloud) Zones() (cloudprovider.Zones, bool) {
+	c.record("Zones")
+	return nil, false
+}
+
+func (c *Cloud) Clusters() (cloudprovider.Clusters, bool) {
+	c.record("Clusters")
+	return nil, false
+}
+
+func (c *Cloud) Routes() (cloudprovider.Routes, bool) {
+	c.record("Routes")
+	return nil, false
+}
+
+func (c *Cloud) ProviderName() string {
+	c.record("ProviderName")
+	return onmetal.ProviderName
+}
+
+func (c *Cloud) HasClusterID() bool {
+	c.record("HasClusterID")
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+var _ = Describe("Cloud", func() {
+	var (
+		cloud   *Cloud
+		service *corev1.Service
+		node    *corev1.Node
+	)
+
+	BeforeEach(func() {
+		cloud = NewCloud()
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+		node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	})
+
+	It("should keep load balancers in memory and record the calls", func(ctx SpecContext) {
+		cloud.LoadBalancerImpl.Status = corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}}
+		lb, ok := cloud.LoadBalancer()
+		Expect(ok).To(BeTrue())
+
+		_, exists, err := lb.GetLoadBalancer(ctx, "test", service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+
+		Expect(lb.EnsureLoadBalancer(ctx, "test", service, []*corev1.Node{node})).To(HaveField("Ingress", ConsistOf(HaveField("IP", "10.0.0.1"))))
+		nodes, ok := cloud.LoadBalancerImpl.Nodes(service)
+		Expect(ok).To(BeTrue())
+		Expect(nodes).To(ConsistOf(node))
+
+		Expect(lb.EnsureLoadBalancerDeleted(ctx, "test", service)).To(Succeed())
+		Expect(lb.UpdateLoadBalancer(ctx, "test", service, nil)).NotTo(Succeed())
+
+		Expect(cloud.CallsTo("LoadBalancer")).To(HaveLen(1))
+		Expect(cloud.LoadBalancerImpl.Calls()).To(HaveExactElements(
+			HaveField("Method", "GetLoadBalancer"),
+			HaveField("Method", "EnsureLoadBalancer"),
+			HaveField("Method", "EnsureLoadBalancerDeleted"),
+			HaveField("Method", "UpdateLoadBalancer"),
+		))
+	})
+
+	It("should use the programmed responses", func(ctx SpecContext) {
+		cloud.LoadBalancerImpl.EnsureLoadBalancerFunc = func(_ context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) (*corev1.LoadBalancerStatus, error) {
+			return nil, errors.New("quota exceeded")
+		}
+		_, err := cloud.LoadBalancerImpl.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError("quota exceeded"))
+	})
+
+	It("should report the instances set", func(ctx SpecContext) {
+		instances, ok := cloud.InstancesV2()
+		Expect(ok).To(BeTrue())
+
+		_, err := instances.InstanceExists(ctx, node)
+		Expect(err).To(MatchError(cloudprovider.InstanceNotFound))
+
+		cloud.InstancesV2Impl.SetInstance(node.Name, cloudprovider.InstanceMetadata{ProviderID: "onmetal://foo/node"}, true)
+		Expect(instances.InstanceExists(ctx, node)).To(BeTrue())
+		Expect(instances.InstanceShutdown(ctx, node)).To(BeTrue())
+		Expect(instances.InstanceMetadata(ctx, node)).To(HaveField("ProviderID", "onmetal://foo/node"))
+		Expect(cloud.InstancesV2Impl.CallsTo("InstanceMetadata")).To(ConsistOf(HaveField("Args", ConsistOf(node))))
+	})
+
+	It("should report unset interfaces as unsupported", func() {
+		cloud.LoadBalancerImpl = nil
+		_, ok := cloud.LoadBalancer()
+		Expect(ok).To(BeFalse())
+		_, ok = cloud.Routes()
+		Expect(ok).To(BeFalse())
+	})
+})
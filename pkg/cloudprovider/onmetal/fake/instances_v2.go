@@ -0,0 +1,108 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// InstancesV2 is a fake cloudprovider.InstancesV2. By default, it reports the instances added by SetInstance by the
+// name of their Node. Nodes without an instance are reported as cloudprovider.InstanceNotFound. The behavior of
+// every method can be overridden by setting the corresponding function.
+type InstancesV2 struct {
+	CallRecorder
+
+	InstanceExistsFunc   func(ctx context.Context, node *v1.Node) (bool, error)
+	InstanceShutdownFunc func(ctx context.Context, node *v1.Node) (bool, error)
+	InstanceMetadataFunc func(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error)
+
+	mu        sync.Mutex
+	instances map[string]instance
+}
+
+type instance struct {
+	metadata cloudprovider.InstanceMetadata
+	shutdown bool
+}
+
+// NewInstancesV2 returns an InstancesV2 without any instances.
+func NewInstancesV2() *InstancesV2 {
+	return &InstancesV2{
+		instances: make(map[string]instance),
+	}
+}
+
+var _ cloudprovider.InstancesV2 = &InstancesV2{}
+
+// SetInstance adds or replaces the instance of the Node with the given name.
+func (i *InstancesV2) SetInstance(nodeName string, metadata cloudprovider.InstanceMetadata, shutdown bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.instances[nodeName] = instance{metadata: metadata, shutdown: shutdown}
+}
+
+// DeleteInstance removes the instance of the Node with the given name.
+func (i *InstancesV2) DeleteInstance(nodeName string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.instances, nodeName)
+}
+
+func (i *InstancesV2) getInstance(node *v1.Node) (instance, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	inst, ok := i.instances[node.Name]
+	return inst, ok
+}
+
+func (i *InstancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	i.record("InstanceExists", node)
+	if i.InstanceExistsFunc != nil {
+		return i.InstanceExistsFunc(ctx, node)
+	}
+	if _, ok := i.getInstance(node); !ok {
+		return false, cloudprovider.InstanceNotFound
+	}
+	return true, nil
+}
+
+func (i *InstancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	i.record("InstanceShutdown", node)
+	if i.InstanceShutdownFunc != nil {
+		return i.InstanceShutdownFunc(ctx, node)
+	}
+	inst, ok := i.getInstance(node)
+	if !ok {
+		return false, cloudprovider.InstanceNotFound
+	}
+	return inst.shutdown, nil
+}
+
+func (i *InstancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	i.record("InstanceMetadata", node)
+	if i.InstanceMetadataFunc != nil {
+		return i.InstanceMetadataFunc(ctx, node)
+	}
+	inst, ok := i.getInstance(node)
+	if !ok {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	metadata := inst.metadata
+	return &metadata, nil
+}
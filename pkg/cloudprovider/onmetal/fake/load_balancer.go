@@ -0,0 +1,122 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// LoadBalancer is a fake cloudprovider.LoadBalancer. By default, it keeps the load balancers of Services in memory
+// and reports Status for every ensured load balancer. The behavior of every method can be overridden by setting the
+// corresponding function.
+type LoadBalancer struct {
+	CallRecorder
+
+	// Status is the status reported for every ensured load balancer.
+	Status v1.LoadBalancerStatus
+
+	GetLoadBalancerFunc           func(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error)
+	GetLoadBalancerNameFunc       func(ctx context.Context, clusterName string, service *v1.Service) string
+	EnsureLoadBalancerFunc        func(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error)
+	UpdateLoadBalancerFunc        func(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error
+	EnsureLoadBalancerDeletedFunc func(ctx context.Context, clusterName string, service *v1.Service) error
+
+	mu            sync.Mutex
+	loadBalancers map[types.NamespacedName][]*v1.Node
+}
+
+// NewLoadBalancer returns a LoadBalancer without any load balancers.
+func NewLoadBalancer() *LoadBalancer {
+	return &LoadBalancer{
+		loadBalancers: make(map[types.NamespacedName][]*v1.Node),
+	}
+}
+
+var _ cloudprovider.LoadBalancer = &LoadBalancer{}
+
+func (l *LoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	l.record("GetLoadBalancer", clusterName, service)
+	if l.GetLoadBalancerFunc != nil {
+		return l.GetLoadBalancerFunc(ctx, clusterName, service)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.loadBalancers[serviceKey(service)]; !ok {
+		return nil, false, nil
+	}
+	return l.Status.DeepCopy(), true, nil
+}
+
+func (l *LoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	l.record("GetLoadBalancerName", clusterName, service)
+	if l.GetLoadBalancerNameFunc != nil {
+		return l.GetLoadBalancerNameFunc(ctx, clusterName, service)
+	}
+	return cloudprovider.DefaultLoadBalancerName(service)
+}
+
+func (l *LoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	l.record("EnsureLoadBalancer", clusterName, service, nodes)
+	if l.EnsureLoadBalancerFunc != nil {
+		return l.EnsureLoadBalancerFunc(ctx, clusterName, service, nodes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loadBalancers[serviceKey(service)] = nodes
+	return l.Status.DeepCopy(), nil
+}
+
+func (l *LoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	l.record("UpdateLoadBalancer", clusterName, service, nodes)
+	if l.UpdateLoadBalancerFunc != nil {
+		return l.UpdateLoadBalancerFunc(ctx, clusterName, service, nodes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.loadBalancers[serviceKey(service)]; !ok {
+		return fmt.Errorf("load balancer for service %s not found", serviceKey(service))
+	}
+	l.loadBalancers[serviceKey(service)] = nodes
+	return nil
+}
+
+func (l *LoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	l.record("EnsureLoadBalancerDeleted", clusterName, service)
+	if l.EnsureLoadBalancerDeletedFunc != nil {
+		return l.EnsureLoadBalancerDeletedFunc(ctx, clusterName, service)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.loadBalancers, serviceKey(service))
+	return nil
+}
+
+// Nodes returns the Nodes of the load balancer of the Service and whether the load balancer exists.
+func (l *LoadBalancer) Nodes(service *v1.Service) ([]*v1.Node, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	nodes, ok := l.loadBalancers[serviceKey(service)]
+	return nodes, ok
+}
+
+func serviceKey(service *v1.Service) types.NamespacedName {
+	return types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+}
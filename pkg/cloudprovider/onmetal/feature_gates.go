@@ -0,0 +1,76 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+
+	"k8s.io/component-base/featuregate"
+)
+
+// The feature gates of the cloud provider roll out experimental behaviors per cluster. They are set by the
+// featureGates of the cloud config and the --onmetal-feature-gates flag, the flag taking precedence. Behaviors which
+// are also enabled by a field of the cloud config are enabled if either the field or the feature gate is.
+
+const (
+	// DirectPodRouting enables routing the LoadBalancers of Services without selector to the addresses of their
+	// EndpointSlices like CloudConfig.EndpointDestinations.
+	DirectPodRouting featuregate.Feature = "DirectPodRouting"
+	// AsyncProvisioning enables the asynchronous provisioning of LoadBalancers like
+	// CloudConfig.AsyncLoadBalancerProvisioning.
+	AsyncProvisioning featuregate.Feature = "AsyncProvisioning"
+)
+
+// defaultFeatureGates are the feature gates known to the cloud provider.
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	DirectPodRouting:  {Default: false, PreRelease: featuregate.Alpha},
+	AsyncProvisioning: {Default: false, PreRelease: featuregate.Alpha},
+}
+
+// newFeatureGates returns the feature gates set by the cloud config and the flags, the flags taking precedence.
+// Unknown feature gates are rejected.
+func newFeatureGates(cloudConfig CloudConfig, flagFeatureGates map[string]bool) (featuregate.FeatureGate, error) {
+	featureGates := featuregate.NewFeatureGate()
+	if err := featureGates.Add(defaultFeatureGates); err != nil {
+		return nil, err
+	}
+	if err := featureGates.SetFromMap(cloudConfig.FeatureGates); err != nil {
+		return nil, fmt.Errorf("invalid featureGates: %w", err)
+	}
+	if err := featureGates.SetFromMap(flagFeatureGates); err != nil {
+		return nil, fmt.Errorf("invalid --onmetal-feature-gates: %w", err)
+	}
+	if cloudConfig.AsyncLoadBalancerStatus && featureGates.Enabled(AsyncProvisioning) {
+		return nil, fmt.Errorf("asyncLoadBalancerStatus and the %s feature gate are mutually exclusive", AsyncProvisioning)
+	}
+	return featureGates, nil
+}
+
+// isFeatureEnabled returns true if the feature gate is enabled. Nil feature gates have all features disabled.
+func isFeatureEnabled(featureGates featuregate.FeatureGate, feature featuregate.Feature) bool {
+	return featureGates != nil && featureGates.Enabled(feature)
+}
+
+// isEndpointDestinationsEnabled returns true if routing LoadBalancers to the addresses of EndpointSlices is enabled
+// by the cloud config or the DirectPodRouting feature gate.
+func (c CloudConfig) isEndpointDestinationsEnabled(featureGates featuregate.FeatureGate) bool {
+	return c.EndpointDestinations || isFeatureEnabled(featureGates, DirectPodRouting)
+}
+
+// isAsyncLoadBalancerProvisioningEnabled returns true if the asynchronous provisioning of LoadBalancers is enabled by
+// the cloud config or the AsyncProvisioning feature gate.
+func (c CloudConfig) isAsyncLoadBalancerProvisioningEnabled(featureGates featuregate.FeatureGate) bool {
+	return c.AsyncLoadBalancerProvisioning || isFeatureEnabled(featureGates, AsyncProvisioning)
+}
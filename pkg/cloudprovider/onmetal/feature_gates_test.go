@@ -0,0 +1,69 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Feature gates", func() {
+	It("should disable all feature gates by default", func() {
+		featureGates, err := newFeatureGates(CloudConfig{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(featureGates.Enabled(DirectPodRouting)).To(BeFalse())
+		Expect(featureGates.Enabled(AsyncProvisioning)).To(BeFalse())
+		Expect(isFeatureEnabled(nil, DirectPodRouting)).To(BeFalse())
+	})
+
+	It("should set the feature gates from the cloud config with the flags taking precedence", func() {
+		cloudConfig := CloudConfig{FeatureGates: map[string]bool{"DirectPodRouting": true, "AsyncProvisioning": true}}
+		featureGates, err := newFeatureGates(cloudConfig, map[string]bool{"AsyncProvisioning": false})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(featureGates.Enabled(DirectPodRouting)).To(BeTrue())
+		Expect(featureGates.Enabled(AsyncProvisioning)).To(BeFalse())
+	})
+
+	It("should reject unknown feature gates", func() {
+		_, err := newFeatureGates(CloudConfig{FeatureGates: map[string]bool{"Foo": true}}, nil)
+		Expect(err).To(MatchError(ContainSubstring("invalid featureGates")))
+
+		_, err = newFeatureGates(CloudConfig{}, map[string]bool{"Foo": true})
+		Expect(err).To(MatchError(ContainSubstring("invalid --onmetal-feature-gates")))
+	})
+
+	It("should reject asynchronous provisioning together with the asynchronous load balancer status", func() {
+		_, err := newFeatureGates(CloudConfig{AsyncLoadBalancerStatus: true}, map[string]bool{"AsyncProvisioning": true})
+		Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+	})
+
+	It("should enable behaviors by either the cloud config or the feature gate", func() {
+		featureGates, err := newFeatureGates(CloudConfig{}, map[string]bool{"DirectPodRouting": true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(CloudConfig{}.isEndpointDestinationsEnabled(featureGates)).To(BeTrue())
+		Expect(CloudConfig{EndpointDestinations: true}.isEndpointDestinationsEnabled(nil)).To(BeTrue())
+		Expect(CloudConfig{}.isEndpointDestinationsEnabled(nil)).To(BeFalse())
+		Expect(CloudConfig{AsyncLoadBalancerProvisioning: true}.isAsyncLoadBalancerProvisioningEnabled(nil)).To(BeTrue())
+		Expect(CloudConfig{}.isAsyncLoadBalancerProvisioningEnabled(featureGates)).To(BeFalse())
+
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", Annotations: map[string]string{EndpointDestinationsAnnotation: "true"}},
+		}
+		Expect(validateEndpointDestinationsForService(service, CloudConfig{}, featureGates)).To(Succeed())
+		Expect(validateEndpointDestinationsForService(service, CloudConfig{}, nil)).To(MatchError(ContainSubstring("nor by the DirectPodRouting feature gate")))
+	})
+})
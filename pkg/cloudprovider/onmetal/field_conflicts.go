@@ -0,0 +1,115 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkPatchConflicts returns a conflict error like the one of a server-side apply if the merge patch from base to obj
+// changes fields managed by field managers other than fieldOwner. Merge patches take over such fields unconditionally,
+// so writes with ApplyConflictPolicyFail check for them first. The managed fields of base are checked, the patch is
+// preconditioned on its resource version.
+func checkPatchConflicts(obj, base client.Object, fieldOwner client.FieldOwner) error {
+	changed, err := getChangedFieldPaths(obj, base)
+	if err != nil || len(changed) == 0 {
+		return err
+	}
+	var causes []metav1.StatusCause
+	for _, entry := range base.GetManagedFields() {
+		if entry.Manager == string(fieldOwner) || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return fmt.Errorf("failed to decode managed fields of %s: %w", entry.Manager, err)
+		}
+		for _, path := range changed {
+			if isFieldManaged(fields, path) {
+				causes = append(causes, metav1.StatusCause{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: fmt.Sprintf("conflict with %q", entry.Manager),
+					Field:   "." + strings.Join(path, "."),
+				})
+			}
+		}
+	}
+	if len(causes) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(causes))
+	for _, cause := range causes {
+		fields = append(fields, fmt.Sprintf("%s: %s", cause.Message, cause.Field))
+	}
+	return apierrors.NewApplyConflict(causes, fmt.Sprintf("Patch failed with %d conflicts: %s", len(causes), strings.Join(fields, ", ")))
+}
+
+// getChangedFieldPaths returns the paths of the fields changed from base to obj: the labels and annotations by key, the
+// fields of the spec and any other top-level field besides metadata and status.
+func getChangedFieldPaths(obj, base client.Object) ([][]string, error) {
+	objContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to unstructured: %w", client.ObjectKeyFromObject(obj), err)
+	}
+	baseContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to unstructured: %w", client.ObjectKeyFromObject(base), err)
+	}
+
+	var paths [][]string
+	addChangedKeys := func(prefix []string, objMap, baseMap map[string]interface{}, skip ...string) {
+		for _, key := range sets.List(sets.KeySet(objMap).Union(sets.KeySet(baseMap)).Delete(skip...)) {
+			if !equality.Semantic.DeepEqual(objMap[key], baseMap[key]) {
+				paths = append(paths, append(append([]string{}, prefix...), key))
+			}
+		}
+	}
+	addChangedKeys(nil, objContent, baseContent, "apiVersion", "kind", "metadata", "status", "spec")
+	spec, _ := objContent["spec"].(map[string]interface{})
+	baseSpec, _ := baseContent["spec"].(map[string]interface{})
+	addChangedKeys([]string{"spec"}, spec, baseSpec)
+	addChangedKeys([]string{"metadata", "labels"}, toInterfaceMap(obj.GetLabels()), toInterfaceMap(base.GetLabels()))
+	addChangedKeys([]string{"metadata", "annotations"}, toInterfaceMap(obj.GetAnnotations()), toInterfaceMap(base.GetAnnotations()))
+	return paths, nil
+}
+
+// isFieldManaged reports whether the field at the path or any of its children is contained in the managed fields.
+func isFieldManaged(fields map[string]interface{}, path []string) bool {
+	for _, segment := range path {
+		child, ok := fields["f:"+segment]
+		if !ok {
+			return false
+		}
+		fields, _ = child.(map[string]interface{})
+	}
+	return true
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+	return result
+}
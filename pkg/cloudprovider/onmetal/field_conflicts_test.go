@@ -0,0 +1,72 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("checkPatchConflicts", func() {
+	var base *networkingv1alpha1.LoadBalancerRouting
+
+	BeforeEach(func() {
+		base = &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "foo",
+				Name:        "lb",
+				Annotations: map[string]string{"foo": "bar"},
+				ManagedFields: []metav1.ManagedFieldsEntry{
+					{Manager: "other", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:destinations":{},"f:metadata":{"f:annotations":{"f:foo":{}}}}`)}},
+					{Manager: string(loadBalancerRoutingFieldOwner), FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:networkRef":{"f:name":{}}}`)}},
+				},
+			},
+			NetworkRef: commonv1alpha1.LocalUIDReference{Name: "network"},
+		}
+	})
+
+	It("should return a conflict for fields managed by other field managers", func() {
+		obj := base.DeepCopy()
+		obj.Destinations = []networkingv1alpha1.LoadBalancerDestination{{IP: commonv1alpha1.MustParseIP("10.0.0.1")}}
+		obj.Annotations["foo"] = "baz"
+
+		err := checkPatchConflicts(obj, base, loadBalancerRoutingFieldOwner)
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+		Expect(err).To(MatchError(SatisfyAll(ContainSubstring(".destinations"), ContainSubstring(".metadata.annotations.foo"))))
+	})
+
+	It("should not return a conflict for fields of the field owner or unmanaged fields", func() {
+		obj := base.DeepCopy()
+		obj.NetworkRef.Name = "other-network"
+		obj.Annotations["bar"] = "baz"
+
+		Expect(checkPatchConflicts(obj, base, loadBalancerRoutingFieldOwner)).To(Succeed())
+	})
+
+	It("should only check patches with the fail policy", func() {
+		obj := base.DeepCopy()
+		obj.Destinations = []networkingv1alpha1.LoadBalancerDestination{{IP: commonv1alpha1.MustParseIP("10.0.0.1")}}
+
+		Expect(CloudConfig{}.checkPatchConflictsFor("LoadBalancerRouting", obj, base)).To(Succeed())
+		Expect(apierrors.IsConflict(CloudConfig{
+			ApplyConflictPolicies: map[string]ApplyConflictPolicy{"LoadBalancerRouting": ApplyConflictPolicyFail},
+		}.checkPatchConflictsFor("LoadBalancerRouting", obj, base))).To(BeTrue())
+	})
+})
@@ -0,0 +1,150 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// instanceSnapshotter lists all Machines and NetworkInterfaces of the cluster at most once per resync window, so
+// the InstanceMetadata calls of a full resync of the node controller are resolved from a single snapshot instead of
+// getting the objects per Node.
+type instanceSnapshotter struct {
+	onmetalClient client.Client
+	namespaces    []string
+	clusterName   string
+	window        time.Duration
+	clock         clock.PassiveClock
+
+	mu       sync.Mutex
+	snapshot *instanceSnapshot
+}
+
+// instanceSnapshot are the Machines and NetworkInterfaces of the cluster listed at a point in time.
+type instanceSnapshot struct {
+	time              time.Time
+	machines          map[client.ObjectKey]*computev1alpha1.Machine
+	networkInterfaces map[client.ObjectKey]*networkingv1alpha1.NetworkInterface
+}
+
+func newInstanceSnapshotter(onmetalClient client.Client, namespaces []string, clusterName string, window time.Duration) *instanceSnapshotter {
+	return &instanceSnapshotter{
+		onmetalClient: onmetalClient,
+		namespaces:    namespaces,
+		clusterName:   clusterName,
+		window:        window,
+		clock:         clock.RealClock{},
+	}
+}
+
+// get returns the current snapshot, listing a new one if the current one is older than the resync window.
+func (s *instanceSnapshotter) get(ctx context.Context) (*instanceSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot != nil && s.clock.Since(s.snapshot.time) < s.window {
+		return s.snapshot, nil
+	}
+
+	snapshot := &instanceSnapshot{
+		time:              s.clock.Now(),
+		machines:          make(map[client.ObjectKey]*computev1alpha1.Machine),
+		networkInterfaces: make(map[client.ObjectKey]*networkingv1alpha1.NetworkInterface),
+	}
+	for _, namespace := range s.namespaces {
+		listOpts := []client.ListOption{client.InNamespace(namespace)}
+		if s.clusterName != "" {
+			// NetworkInterfaces not labeled yet are missing and read by the fallback to the onmetal API
+			listOpts = append(listOpts, client.MatchingLabels{LabelKeyClusterName: s.clusterName})
+		}
+		machineList := &computev1alpha1.MachineList{}
+		if err := s.onmetalClient.List(ctx, machineList, listOpts...); err != nil {
+			return nil, fmt.Errorf("failed to list Machines in namespace %s: %w", namespace, err)
+		}
+		for i := range machineList.Items {
+			machine := &machineList.Items[i]
+			snapshot.machines[client.ObjectKeyFromObject(machine)] = machine
+		}
+
+		nicList := &networkingv1alpha1.NetworkInterfaceList{}
+		if err := s.onmetalClient.List(ctx, nicList, listOpts...); err != nil {
+			return nil, fmt.Errorf("failed to list NetworkInterfaces in namespace %s: %w", namespace, err)
+		}
+		for i := range nicList.Items {
+			nic := &nicList.Items[i]
+			snapshot.networkInterfaces[client.ObjectKeyFromObject(nic)] = nic
+		}
+	}
+	klog.V(4).InfoS("Listed instance snapshot", "Machines", len(snapshot.machines), "NetworkInterfaces", len(snapshot.networkInterfaces))
+	s.snapshot = snapshot
+	return snapshot, nil
+}
+
+// update replaces an object of the current snapshot after it was written, e.g. labeled with the cluster name.
+func (s *instanceSnapshotter) update(obj client.Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil {
+		return
+	}
+	switch obj := obj.(type) {
+	case *computev1alpha1.Machine:
+		s.snapshot.machines[client.ObjectKeyFromObject(obj)] = obj.DeepCopy()
+	case *networkingv1alpha1.NetworkInterface:
+		s.snapshot.networkInterfaces[client.ObjectKeyFromObject(obj)] = obj.DeepCopy()
+	}
+}
+
+// machineForNode returns a copy of the Machine backing the Node, resolved like getMachineForNode. Objects created
+// after the snapshot was listed are missing, hence callers have to fall back to the onmetal API if nil is returned.
+func (sn *instanceSnapshot) machineForNode(node *corev1.Node, namespaces []string) *computev1alpha1.Machine {
+	if namespace, name, ok := parseProviderID(node.Spec.ProviderID); ok && slices.Contains(namespaces, namespace) {
+		return sn.machine(client.ObjectKey{Namespace: namespace, Name: name})
+	}
+	for _, namespace := range namespaces {
+		if machine := sn.machine(client.ObjectKey{Namespace: namespace, Name: node.Name}); machine != nil {
+			return machine
+		}
+	}
+	return nil
+}
+
+func (sn *instanceSnapshot) machine(key client.ObjectKey) *computev1alpha1.Machine {
+	machine, ok := sn.machines[key]
+	if !ok {
+		return nil
+	}
+	return machine.DeepCopy()
+}
+
+// networkInterface returns a copy of the NetworkInterface with the given key or nil if it is missing.
+func (sn *instanceSnapshot) networkInterface(key client.ObjectKey) *networkingv1alpha1.NetworkInterface {
+	nic, ok := sn.networkInterfaces[key]
+	if !ok {
+		return nil
+	}
+	return nic.DeepCopy()
+}
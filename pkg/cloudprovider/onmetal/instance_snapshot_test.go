@@ -0,0 +1,138 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("InstanceSnapshotter", func() {
+	var (
+		onmetalClient     client.Client
+		instancesProvider *onmetalInstancesV2
+		clk               *clocktesting.FakeClock
+		gets, lists       int
+		patches           int
+	)
+
+	newMachine := func(name string) (*computev1alpha1.Machine, *networkingv1alpha1.NetworkInterface) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+			Spec: computev1alpha1.MachineSpec{
+				MachineClassRef:   corev1.LocalObjectReference{Name: "machine-class"},
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+			Status: computev1alpha1.MachineStatus{
+				NetworkInterfaces: []computev1alpha1.NetworkInterfaceStatus{{
+					Name: "primary",
+					IPs:  []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+				}},
+			},
+		}
+		nic := &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: fmt.Sprintf("%s-primary", name)},
+			Spec:       networkingv1alpha1.NetworkInterfaceSpec{NetworkRef: corev1.LocalObjectReference{Name: "network"}},
+		}
+		return machine, nic
+	}
+
+	BeforeEach(func() {
+		gets, lists, patches = 0, 0, 0
+		machine1, nic1 := newMachine("machine-1")
+		machine2, nic2 := newMachine("machine-2")
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine1, nic1, machine2, nic2).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				gets++
+				return c.Get(ctx, key, obj, opts...)
+			},
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				lists++
+				return c.List(ctx, list, opts...)
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				patches++
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		instancesProvider = newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{
+			ClusterName:                  "test",
+			NetworkName:                  "network",
+			InstanceMetadataResyncWindow: metav1.Duration{Duration: time.Minute},
+		}, nil, record.NewFakeRecorder(10), nil).(*onmetalInstancesV2)
+		clk = clocktesting.NewFakeClock(time.Now())
+		instancesProvider.instanceSnapshotter.clock = clk
+	})
+
+	It("should resolve the metadata of all nodes from a single snapshot per resync window", func(ctx SpecContext) {
+		nodes := []*corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "machine-1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "machine-2"}},
+		}
+
+		By("resolving the metadata of all nodes")
+		for _, node := range nodes {
+			metadata, err := instancesProvider.InstanceMetadata(ctx, node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.InstanceType).To(Equal("machine-class"))
+			Expect(metadata.NodeAddresses).To(ConsistOf(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}))
+		}
+		Expect(lists).To(Equal(2))
+		Expect(gets).To(BeZero())
+		Expect(patches).To(Equal(4))
+
+		By("not patching the labeled objects again within the window")
+		for _, node := range nodes {
+			Expect(instancesProvider.InstanceMetadata(ctx, node)).NotTo(BeNil())
+		}
+		Expect(lists).To(Equal(2))
+		Expect(patches).To(Equal(4))
+
+		By("listing a new snapshot once the window passed")
+		clk.Step(time.Minute)
+		Expect(instancesProvider.InstanceMetadata(ctx, nodes[0])).NotTo(BeNil())
+		Expect(lists).To(Equal(4))
+		Expect(patches).To(Equal(4))
+	})
+
+	It("should fall back to the onmetal API for machines missing in the snapshot", func(ctx SpecContext) {
+		Expect(instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine-1"}})).NotTo(BeNil())
+
+		machine3, nic3 := newMachine("machine-3")
+		Expect(onmetalClient.Create(ctx, machine3)).To(Succeed())
+		Expect(onmetalClient.Create(ctx, nic3)).To(Succeed())
+
+		metadata, err := instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine-3"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.ProviderID).To(Equal(getProviderID("foo", "machine-3")))
+		Expect(lists).To(Equal(2))
+		Expect(gets).To(Equal(2))
+	})
+})
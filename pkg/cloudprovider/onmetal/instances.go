@@ -0,0 +1,167 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// onmetalInstances implements the legacy Instances interface on top of InstancesV2 for tooling still consuming it.
+// The cloud controllers always use InstancesV2. Instances are resolved to the Nodes of the target cluster by name or
+// provider ID, falling back to a Node carrying only the name or provider ID if no such Node exists.
+type onmetalInstances struct {
+	targetClient client.Client
+	instancesV2  cloudprovider.InstancesV2
+}
+
+func newOnmetalInstances(targetClient client.Client, instancesV2 cloudprovider.InstancesV2) cloudprovider.Instances {
+	return &onmetalInstances{
+		targetClient: targetClient,
+		instancesV2:  instancesV2,
+	}
+}
+
+func (o *onmetalInstances) NodeAddresses(ctx context.Context, name types.NodeName) ([]corev1.NodeAddress, error) {
+	metadata, err := o.instanceMetadataByNodeName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.NodeAddresses, nil
+}
+
+func (o *onmetalInstances) NodeAddressesByProviderID(ctx context.Context, providerID string) ([]corev1.NodeAddress, error) {
+	metadata, err := o.instanceMetadataByProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.NodeAddresses, nil
+}
+
+// InstanceID returns the provider ID of the instance without the provider name prefix, as the legacy cloud node
+// controller prefixes the instance ID with the provider name to get the provider ID.
+func (o *onmetalInstances) InstanceID(ctx context.Context, nodeName types.NodeName) (string, error) {
+	metadata, err := o.instanceMetadataByNodeName(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(metadata.ProviderID, ProviderName+"://"), nil
+}
+
+func (o *onmetalInstances) InstanceType(ctx context.Context, name types.NodeName) (string, error) {
+	metadata, err := o.instanceMetadataByNodeName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return metadata.InstanceType, nil
+}
+
+func (o *onmetalInstances) InstanceTypeByProviderID(ctx context.Context, providerID string) (string, error) {
+	metadata, err := o.instanceMetadataByProviderID(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	return metadata.InstanceType, nil
+}
+
+func (o *onmetalInstances) AddSSHKeyToAllInstances(_ context.Context, _ string, _ []byte) error {
+	return cloudprovider.NotImplemented
+}
+
+// CurrentNodeName returns the hostname, Nodes are named like their hostname.
+func (o *onmetalInstances) CurrentNodeName(_ context.Context, hostname string) (types.NodeName, error) {
+	return types.NodeName(hostname), nil
+}
+
+func (o *onmetalInstances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	node, err := o.getNodeByProviderID(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	exists, err := o.instancesV2.InstanceExists(ctx, node)
+	if errors.Is(err, cloudprovider.InstanceNotFound) {
+		return false, nil
+	}
+	return exists, err
+}
+
+func (o *onmetalInstances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	node, err := o.getNodeByProviderID(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	return o.instancesV2.InstanceShutdown(ctx, node)
+}
+
+func (o *onmetalInstances) instanceMetadataByNodeName(ctx context.Context, name types.NodeName) (*cloudprovider.InstanceMetadata, error) {
+	node := &corev1.Node{}
+	if err := o.targetClient.Get(ctx, client.ObjectKey{Name: string(name)}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get Node %s: %w", name, err)
+		}
+		node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: string(name)}}
+	}
+	return o.instanceMetadata(ctx, node)
+}
+
+func (o *onmetalInstances) instanceMetadataByProviderID(ctx context.Context, providerID string) (*cloudprovider.InstanceMetadata, error) {
+	node, err := o.getNodeByProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return o.instanceMetadata(ctx, node)
+}
+
+func (o *onmetalInstances) instanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
+	metadata, err := o.instancesV2.InstanceMetadata(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	return metadata, nil
+}
+
+// getNodeByProviderID returns the Node of the target cluster with the provider ID. Unknown provider IDs of onmetal
+// Machines are returned as a Node named like the Machine, as Nodes are named like their Machines.
+func (o *onmetalInstances) getNodeByProviderID(ctx context.Context, providerID string) (*corev1.Node, error) {
+	_, machineName, ok := parseProviderID(providerID)
+	if !ok {
+		return nil, fmt.Errorf("invalid provider ID %q, expected %s://<namespace>/<machine-name>", providerID, ProviderName)
+	}
+	nodeList := &corev1.NodeList{}
+	if err := o.targetClient.List(ctx, nodeList); err != nil {
+		return nil, fmt.Errorf("failed to list Nodes: %w", err)
+	}
+	for i := range nodeList.Items {
+		if nodeList.Items[i].Spec.ProviderID == providerID {
+			return &nodeList.Items[i], nil
+		}
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: machineName},
+		Spec:       corev1.NodeSpec{ProviderID: providerID},
+	}, nil
+}
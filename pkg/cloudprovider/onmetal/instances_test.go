@@ -0,0 +1,117 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// staticInstancesV2 reports the instances of the Nodes by name and records the Nodes it was called with.
+type staticInstancesV2 struct {
+	instances map[string]*cloudprovider.InstanceMetadata
+	shutdown  map[string]bool
+	nodes     []*corev1.Node
+}
+
+func (s *staticInstancesV2) InstanceExists(_ context.Context, node *corev1.Node) (bool, error) {
+	s.nodes = append(s.nodes, node)
+	if _, ok := s.instances[node.Name]; !ok {
+		return false, cloudprovider.InstanceNotFound
+	}
+	return true, nil
+}
+
+func (s *staticInstancesV2) InstanceShutdown(_ context.Context, node *corev1.Node) (bool, error) {
+	s.nodes = append(s.nodes, node)
+	if _, ok := s.instances[node.Name]; !ok {
+		return false, cloudprovider.InstanceNotFound
+	}
+	return s.shutdown[node.Name], nil
+}
+
+func (s *staticInstancesV2) InstanceMetadata(_ context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
+	s.nodes = append(s.nodes, node)
+	metadata, ok := s.instances[node.Name]
+	if !ok {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	return metadata, nil
+}
+
+var _ = Describe("Instances", func() {
+	var (
+		instancesV2 *staticInstancesV2
+		instances   cloudprovider.Instances
+	)
+
+	BeforeEach(func() {
+		instancesV2 = &staticInstancesV2{
+			instances: map[string]*cloudprovider.InstanceMetadata{
+				"node": {
+					ProviderID:    "onmetal://foo/machine",
+					InstanceType:  "x3-xlarge",
+					NodeAddresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+				},
+				"unregistered": {
+					ProviderID:   "onmetal://foo/unregistered",
+					InstanceType: "x3-small",
+				},
+			},
+			shutdown: map[string]bool{"node": true},
+		}
+		targetClient := fake.NewClientBuilder().WithObjects(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node"},
+			Spec:       corev1.NodeSpec{ProviderID: "onmetal://foo/machine"},
+		}).Build()
+		instances = newOnmetalInstances(targetClient, instancesV2)
+	})
+
+	It("should report the instances of nodes by name", func(ctx SpecContext) {
+		Expect(instances.NodeAddresses(ctx, "node")).To(ConsistOf(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}))
+		Expect(instances.InstanceType(ctx, "node")).To(Equal("x3-xlarge"))
+		Expect(instances.InstanceID(ctx, "node")).To(Equal("foo/machine"))
+		Expect(instancesV2.nodes).To(HaveEach(HaveField("Spec.ProviderID", "onmetal://foo/machine")))
+
+		_, err := instances.InstanceID(ctx, "missing")
+		Expect(err).To(MatchError(cloudprovider.InstanceNotFound))
+	})
+
+	It("should report the instances of nodes by provider ID", func(ctx SpecContext) {
+		Expect(instances.NodeAddressesByProviderID(ctx, "onmetal://foo/machine")).To(HaveLen(1))
+		Expect(instances.InstanceTypeByProviderID(ctx, "onmetal://foo/machine")).To(Equal("x3-xlarge"))
+		Expect(instances.InstanceExistsByProviderID(ctx, "onmetal://foo/machine")).To(BeTrue())
+		Expect(instances.InstanceShutdownByProviderID(ctx, "onmetal://foo/machine")).To(BeTrue())
+
+		By("resolving provider IDs without node to a node named like the machine")
+		Expect(instances.InstanceTypeByProviderID(ctx, "onmetal://foo/unregistered")).To(Equal("x3-small"))
+		Expect(instances.InstanceExistsByProviderID(ctx, "onmetal://foo/gone")).To(BeFalse())
+
+		By("rejecting provider IDs of other providers")
+		_, err := instances.InstanceExistsByProviderID(ctx, "aws:///eu-central-1a/i-123")
+		Expect(err).To(MatchError(ContainSubstring("invalid provider ID")))
+	})
+
+	It("should name nodes like their hostname and not support SSH keys", func(ctx SpecContext) {
+		Expect(instances.CurrentNodeName(ctx, "node")).To(BeEquivalentTo("node"))
+		Expect(instances.AddSSHKeyToAllInstances(ctx, "user", nil)).To(MatchError(cloudprovider.NotImplemented))
+	})
+})
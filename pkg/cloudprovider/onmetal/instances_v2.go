@@ -16,31 +16,175 @@ package onmetal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
 	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
 )
 
+var (
+	instancesFieldOwner = client.FieldOwner("cloud-provider.onmetal.de/instances")
+)
+
+const (
+	eventReasonMachineNotFound = "MachineNotFound"
+)
+
+var staleInstanceResponses = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Subsystem:      "cloud_provider_onmetal",
+		Name:           "stale_instance_responses_total",
+		Help:           "Number of instance responses served from the last known state because the onmetal API failed.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"method"},
+)
+
+func init() {
+	legacyregistry.MustRegister(staleInstanceResponses)
+}
+
 type onmetalInstancesV2 struct {
 	targetClient     client.Client
 	onmetalClient    client.Client
 	onmetalNamespace string
-	clusterName      string
+	cloudConfig      CloudConfig
+	clock            clock.PassiveClock
+	// featureGates enable experimental behaviors, see defaultFeatureGates. If nil, all of them are disabled.
+	featureGates featuregate.FeatureGate
+	recorder     record.EventRecorder
+
+	// lastKnownInstances are the last successfully observed instances by Node name, used if FailStaticDuration is set
+	lastKnownInstancesMu sync.Mutex
+	lastKnownInstances   map[string]*lastKnownInstance
+
+	// machineNodeIndex resolves the Nodes backing Machines to report Nodes replaced by a renamed Node as not existing.
+	// If nil, no Node is considered replaced.
+	machineNodeIndex *machineNodeIndex
+
+	// addressResolver resolves the IP addresses of Nodes, see RegisterNodeAddressResolver.
+	addressResolver NodeAddressResolver
+
+	// instanceSnapshotter resolves InstanceMetadata from a periodically listed snapshot if InstanceMetadataResyncWindow
+	// is set, nil otherwise.
+	instanceSnapshotter *instanceSnapshotter
+
+	// logSampler samples the verbose logs of InstanceMetadata if --onmetal-log-sampling-interval is set, nil otherwise.
+	logSampler *logSampler
+}
+
+// lastKnownInstance is the last successfully observed state of the instance of a Node.
+type lastKnownInstance struct {
+	exists   *observed[bool]
+	shutdown *observed[bool]
+	metadata *observed[*cloudprovider.InstanceMetadata]
 }
 
-func newOnmetalInstancesV2(targetClient client.Client, onmetalClient client.Client, namespace, clusterName string) cloudprovider.InstancesV2 {
-	return &onmetalInstancesV2{
-		targetClient:     targetClient,
-		onmetalClient:    onmetalClient,
-		onmetalNamespace: namespace,
-		clusterName:      clusterName,
+// observed is a value observed at a point in time.
+type observed[T any] struct {
+	value T
+	time  time.Time
+}
+
+func newOnmetalInstancesV2(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig, featureGates featuregate.FeatureGate, recorder record.EventRecorder, machineNodeIndex *machineNodeIndex) cloudprovider.InstancesV2 {
+	o := &onmetalInstancesV2{
+		targetClient:       targetClient,
+		onmetalClient:      onmetalClient,
+		onmetalNamespace:   namespace,
+		cloudConfig:        cloudConfig,
+		clock:              clock.RealClock{},
+		featureGates:       featureGates,
+		recorder:           recorder,
+		lastKnownInstances: make(map[string]*lastKnownInstance),
+		machineNodeIndex:   machineNodeIndex,
+		addressResolver:    getNodeAddressResolver(cloudConfig),
+		logSampler:         newLogSampler(OnmetalLogSamplingInterval),
+	}
+	if window := cloudConfig.InstanceMetadataResyncWindow.Duration; window > 0 {
+		o.instanceSnapshotter = newInstanceSnapshotter(onmetalClient, getMachineNamespaces(namespace, cloudConfig), getMachineClusterName(cloudConfig), window)
+	}
+	if machineNodeIndex != nil {
+		machineNodeIndex.AddNodeRenameHandler(o.renameLastKnownInstance)
+	}
+	return o
+}
+
+// failStatic returns the result of the last successful call of the given method for the given Node if calling the
+// onmetal API failed with the given error, FailStaticDuration is set and the result is not older than it.
+func failStatic[T any](ctx context.Context, o *onmetalInstancesV2, method string, node *corev1.Node, err error, get func(*lastKnownInstance) *observed[T]) (T, error) {
+	var zero T
+	if o.cloudConfig.FailStaticDuration.Duration <= 0 {
+		return zero, err
+	}
+
+	o.lastKnownInstancesMu.Lock()
+	defer o.lastKnownInstancesMu.Unlock()
+	if errors.Is(err, cloudprovider.InstanceNotFound) {
+		// the onmetal API is reachable and the instance is gone, its last known state must not be served anymore
+		delete(o.lastKnownInstances, node.Name)
+		return zero, err
+	}
+	instance, ok := o.lastKnownInstances[node.Name]
+	if !ok {
+		return zero, err
+	}
+	last := get(instance)
+	if last == nil || o.clock.Since(last.time) > o.cloudConfig.FailStaticDuration.Duration {
+		return zero, err
+	}
+
+	klog.FromContext(ctx).Info("Serving stale instance state because the onmetal API failed", "Method", method, "ObservedAt", last.time, "Error", err)
+	staleInstanceResponses.WithLabelValues(method).Inc()
+	return last.value, nil
+}
+
+// recordLastKnownInstance records a successfully observed state of the instance of the given Node if
+// FailStaticDuration is set.
+func (o *onmetalInstancesV2) recordLastKnownInstance(node *corev1.Node, record func(instance *lastKnownInstance, now time.Time)) {
+	if o.cloudConfig.FailStaticDuration.Duration <= 0 {
+		return
+	}
+
+	o.lastKnownInstancesMu.Lock()
+	defer o.lastKnownInstancesMu.Unlock()
+	instance, ok := o.lastKnownInstances[node.Name]
+	if !ok {
+		instance = &lastKnownInstance{}
+		o.lastKnownInstances[node.Name] = instance
+	}
+	record(instance, o.clock.Now())
+}
+
+// renameLastKnownInstance moves the last known instance of a renamed Node to its new name, so the instance stays
+// served during outages of the onmetal API.
+func (o *onmetalInstancesV2) renameLastKnownInstance(oldNodeName, newNodeName string) {
+	o.lastKnownInstancesMu.Lock()
+	defer o.lastKnownInstancesMu.Unlock()
+	instance, ok := o.lastKnownInstances[oldNodeName]
+	if !ok {
+		return
+	}
+	delete(o.lastKnownInstances, oldNodeName)
+	if _, ok := o.lastKnownInstances[newNodeName]; !ok {
+		o.lastKnownInstances[newNodeName] = instance
 	}
 }
 
@@ -48,113 +192,422 @@ func (o *onmetalInstancesV2) InstanceExists(ctx context.Context, node *corev1.No
 	if node == nil {
 		return false, nil
 	}
-	klog.V(4).InfoS("Checking if node exists", "Node", node.Name)
+	ctx = withLogger(ctx, logModuleInstances, "Node", node.Name)
+	exists, err := o.instanceExists(ctx, node)
+	if err != nil {
+		return failStatic(ctx, o, "InstanceExists", node, err, func(instance *lastKnownInstance) *observed[bool] {
+			return instance.exists
+		})
+	}
+	o.recordLastKnownInstance(node, func(instance *lastKnownInstance, now time.Time) {
+		instance.exists = &observed[bool]{value: exists, time: now}
+	})
+	return exists, nil
+}
 
-	machine := &computev1alpha1.Machine{}
-	if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: node.Name}, machine); err != nil {
+func (o *onmetalInstancesV2) InstanceShutdown(ctx context.Context, node *corev1.Node) (bool, error) {
+	if node == nil {
+		return false, nil
+	}
+	ctx = withLogger(ctx, logModuleInstances, "Node", node.Name)
+	shutdown, err := o.instanceShutdown(ctx, node)
+	if err != nil {
+		return failStatic(ctx, o, "InstanceShutdown", node, err, func(instance *lastKnownInstance) *observed[bool] {
+			return instance.shutdown
+		})
+	}
+	o.recordLastKnownInstance(node, func(instance *lastKnownInstance, now time.Time) {
+		instance.shutdown = &observed[bool]{value: shutdown, time: now}
+	})
+	return shutdown, nil
+}
+
+func (o *onmetalInstancesV2) InstanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
+	if node == nil {
+		return nil, nil
+	}
+	// InstanceMetadata is called for every Node on each sync of the cloud node controllers, its verbose logs are sampled
+	ctx = withLogger(ctx, logModuleInstances, "Node", node.Name)
+	ctx = klog.NewContext(ctx, o.logSampler.sample(klog.FromContext(ctx), node.Name))
+	ctx, span := startSpan(ctx, "InstanceMetadata", attributeKeyClusterName.String(o.cloudConfig.ClusterName), attributeKeyNodeName.String(node.Name))
+	metadata, err := o.instanceMetadata(ctx, node)
+	endSpan(span, err)
+	if err != nil {
+		return failStatic(ctx, o, "InstanceMetadata", node, err, func(instance *lastKnownInstance) *observed[*cloudprovider.InstanceMetadata] {
+			return instance.metadata
+		})
+	}
+	o.recordLastKnownInstance(node, func(instance *lastKnownInstance, now time.Time) {
+		instance.metadata = &observed[*cloudprovider.InstanceMetadata]{value: metadata, time: now}
+	})
+	return metadata, nil
+}
+
+func (o *onmetalInstancesV2) instanceExists(ctx context.Context, node *corev1.Node) (bool, error) {
+	klog.FromContext(ctx).V(4).Info("Checking if node exists")
+
+	// the Machine of a Node recreated under a new name is backed by the new Node, the stale Node has to be removed
+	if o.machineNodeIndex != nil && o.machineNodeIndex.IsNodeReplaced(node) {
+		klog.FromContext(ctx).V(2).Info("Instance of node was taken over by a renamed node")
+		return false, nil
+	}
+
+	machine, err := getMachineForNode(ctx, o.onmetalClient, node, getMachineNamespaces(o.onmetalNamespace, o.cloudConfig), getMachineClusterName(o.cloudConfig))
+	if err != nil {
 		if apierrors.IsNotFound(err) {
+			o.recordMachineNotFound(node)
 			return false, cloudprovider.InstanceNotFound
 		}
 		return false, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
 	}
 
-	klog.V(4).InfoS("Instance for node exists", "Node", node.Name, "Machine", client.ObjectKeyFromObject(machine))
+	klog.FromContext(ctx).V(4).Info("Instance for node exists", "Machine", client.ObjectKeyFromObject(machine))
 	return true, nil
 }
 
-func (o *onmetalInstancesV2) InstanceShutdown(ctx context.Context, node *corev1.Node) (bool, error) {
-	if node == nil {
-		return false, nil
-	}
-	klog.V(4).InfoS("Checking if instance is shut down", "Node", node.Name)
+func (o *onmetalInstancesV2) instanceShutdown(ctx context.Context, node *corev1.Node) (bool, error) {
+	klog.FromContext(ctx).V(4).Info("Checking if instance is shut down")
 
-	machine := &computev1alpha1.Machine{}
-	if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: node.Name}, machine); err != nil {
+	machine, err := getMachineForNode(ctx, o.onmetalClient, node, getMachineNamespaces(o.onmetalNamespace, o.cloudConfig), getMachineClusterName(o.cloudConfig))
+	if err != nil {
 		if apierrors.IsNotFound(err) {
 			return false, cloudprovider.InstanceNotFound
 		}
 		return false, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
 	}
 
-	nodeShutDownStatus := machine.Status.State == computev1alpha1.MachineStateShutdown
-	klog.V(4).InfoS("Instance shut down status", "NodeShutdown", nodeShutDownStatus)
+	nodeShutDownStatus := o.cloudConfig.isMachineShutdown(machine)
+	klog.FromContext(ctx).V(4).Info("Instance shut down status", "NodeShutdown", nodeShutDownStatus)
 	return nodeShutDownStatus, nil
 }
 
-func (o *onmetalInstancesV2) InstanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
-	if node == nil {
-		return nil, nil
+func (o *onmetalInstancesV2) instanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
+	var snapshot *instanceSnapshot
+	if o.instanceSnapshotter != nil {
+		var err error
+		if snapshot, err = o.instanceSnapshotter.get(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get instance snapshot for node %s: %w", node.Name, err)
+		}
 	}
-	machine := &computev1alpha1.Machine{}
-	if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: node.Name}, machine); err != nil {
+
+	machine, err := o.getMachineForNodeFromSnapshot(ctx, snapshot, node)
+	if err != nil {
 		if apierrors.IsNotFound(err) {
+			o.recordMachineNotFound(node)
 			return nil, cloudprovider.InstanceNotFound
 		}
 		return nil, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
 	}
-
-	//add label for clusterName to machine object
-	machineBase := machine.DeepCopy()
-	if machine.Labels == nil {
-		machine.Labels = make(map[string]string)
+	replaced := isMachineReplaced(node, machine)
+	if replaced && snapshot != nil {
+		// the snapshot may still hold the previous Machine and its NetworkInterfaces
+		snapshot = nil
+		if machine, err = o.getMachineForNodeFromSnapshot(ctx, nil, node); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, cloudprovider.InstanceNotFound
+			}
+			return nil, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
+		}
+		replaced = isMachineReplaced(node, machine)
 	}
-	machine.Labels[LabelKeyClusterName] = o.clusterName
-	klog.V(2).InfoS("Adding cluster name label to Machine object", "Machine", client.ObjectKeyFromObject(machine), "Node", node.Name)
-	if err := o.onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase)); err != nil {
-		return nil, fmt.Errorf("failed to patch Machine %s for Node %s: %w", client.ObjectKeyFromObject(machine), node.Name, err)
+	trace.SpanFromContext(ctx).SetAttributes(attributeKeyMachineName.String(machine.Name), attributeKeyMachineNamespace.String(machine.Namespace))
+
+	//add label for clusterName to machine object, unless the onmetal API is read-only
+	if machine.Labels[LabelKeyClusterName] != o.cloudConfig.ClusterName && !o.cloudConfig.ReadOnly {
+		machineBase := machine.DeepCopy()
+		if machine.Labels == nil {
+			machine.Labels = make(map[string]string)
+		}
+		machine.Labels[LabelKeyClusterName] = o.cloudConfig.ClusterName
+		setAuditAnnotations(machine, o.cloudConfig.ClusterName, nil)
+		klog.FromContext(ctx).V(2).Info("Adding cluster name label to Machine object", "Machine", client.ObjectKeyFromObject(machine))
+		if err := o.onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase), o.cloudConfig.fieldOwnerForInstances()); err != nil {
+			return nil, fmt.Errorf("failed to patch Machine %s for Node %s: %w", client.ObjectKeyFromObject(machine), node.Name, err)
+		}
+		o.updateInstanceSnapshot(machine)
 	}
 
+	// machine network interfaces whose addresses are reported
+	reportedInterfaces := make(map[string]*networkingv1alpha1.NetworkInterface)
+	excludedInterfaces := getExcludedNetworkInterfacesForMachine(machine)
 	for _, networkInterface := range machine.Spec.NetworkInterfaces {
-		nic := &networkingv1alpha1.NetworkInterface{}
-		nicName := fmt.Sprintf("%s-%s", machine.Name, networkInterface.Name)
-		if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: nicName}, nic); err != nil {
-			return nil, fmt.Errorf("failed to get network interface %s for machine %s: %w", client.ObjectKeyFromObject(nic), machine.Name, err)
+		nicKey := client.ObjectKey{Namespace: machine.Namespace, Name: fmt.Sprintf("%s-%s", machine.Name, networkInterface.Name)}
+		nic, err := o.getNetworkInterfaceFromSnapshot(ctx, snapshot, nicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network interface %s for machine %s: %w", nicKey, machine.Name, err)
 		}
 
 		// add label for clusterName to network interface of machine object
-		nicBase := nic.DeepCopy()
-		if nic.Labels == nil {
-			nic.Labels = make(map[string]string)
+		if nic.Labels[LabelKeyClusterName] != o.cloudConfig.ClusterName && !o.cloudConfig.ReadOnly {
+			nicBase := nic.DeepCopy()
+			if nic.Labels == nil {
+				nic.Labels = make(map[string]string)
+			}
+			nic.Labels[LabelKeyClusterName] = o.cloudConfig.ClusterName
+			setAuditAnnotations(nic, o.cloudConfig.ClusterName, nil)
+			klog.FromContext(ctx).V(2).Info("Adding cluster name label to NetworkInterface", "NetworkInterface", client.ObjectKeyFromObject(nic), "Label", nic.Labels[LabelKeyClusterName])
+			if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase), o.cloudConfig.fieldOwnerForInstances()); err != nil {
+				return nil, fmt.Errorf("failed to patch NetworkInterface %s for Node %s: %w", client.ObjectKeyFromObject(nic), node.Name, err)
+			}
+			o.updateInstanceSnapshot(nic)
 		}
-		nic.Labels[LabelKeyClusterName] = o.clusterName
-		klog.V(2).InfoS("Adding cluster name label to NetworkInterface", "NetworkInterface", client.ObjectKeyFromObject(nic), "Node", node.Name, "Label", nic.Labels[LabelKeyClusterName])
-		if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase)); err != nil {
-			return nil, fmt.Errorf("failed to patch NetworkInterface %s for Node %s: %w", client.ObjectKeyFromObject(nic), node.Name, err)
+
+		switch {
+		case excludedInterfaces.Has(networkInterface.Name):
+			klog.FromContext(ctx).V(4).Info("Not reporting addresses of NetworkInterface excluded by the Machine", "NetworkInterface", client.ObjectKeyFromObject(nic))
+		case o.cloudConfig.ReportAllNetworkInterfaceAddresses || nic.Spec.NetworkRef.Name == o.cloudConfig.NetworkName:
+			reportedInterfaces[networkInterface.Name] = nic
+		default:
+			klog.FromContext(ctx).V(4).Info("Not reporting addresses of NetworkInterface outside of the cluster network", "NetworkInterface", client.ObjectKeyFromObject(nic), "Network", nic.Spec.NetworkRef.Name)
 		}
 	}
 
-	addresses := make([]corev1.NodeAddress, 0)
-	for _, iface := range machine.Status.NetworkInterfaces {
-		if iface.VirtualIP != nil {
-			addresses = append(addresses, corev1.NodeAddress{
-				Type:    corev1.NodeExternalIP,
-				Address: iface.VirtualIP.String(),
-			})
-		}
-		for _, ip := range iface.IPs {
-			addresses = append(addresses, corev1.NodeAddress{
-				Type:    corev1.NodeInternalIP,
-				Address: ip.String(),
-			})
-		}
+	addresses, err := o.addressResolver.ResolveNodeAddresses(ctx, node, machine, reportedInterfaces)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve addresses of node %s: %w", node.Name, err)
 	}
 
 	providerID := node.Spec.ProviderID
 	if providerID == "" {
-		providerID = fmt.Sprintf("%s://%s/%s", ProviderName, o.onmetalNamespace, machine.Name)
+		providerID = fmt.Sprintf("%s://%s/%s", ProviderName, machine.Namespace, machine.Name)
 	}
 
-	zone := ""
+	zone, region := "", ""
 	if machine.Spec.MachinePoolRef != nil {
-		zone = machine.Spec.MachinePoolRef.Name
+		zone = o.cloudConfig.zoneForMachinePool(machine.Spec.MachinePoolRef.Name)
+		region = o.cloudConfig.MachinePoolTopology[machine.Spec.MachinePoolRef.Name].Region
+	}
+
+	if o.cloudConfig.ReportHostName {
+		addresses = append(addresses, corev1.NodeAddress{
+			Type:    corev1.NodeHostName,
+			Address: machine.Name,
+		})
+	}
+
+	if o.cloudConfig.InternalDNSSuffix != "" {
+		// TODO: register the name in the DNS zone once the onmetal API offers DNS records, until then the records
+		// have to be maintained outside of the cloud provider
+		addresses = append(addresses, corev1.NodeAddress{
+			Type:    corev1.NodeInternalDNS,
+			Address: getInternalDNSName(node.Name, zone, o.cloudConfig.ClusterName, o.cloudConfig.InternalDNSSuffix),
+		})
 	}
 
-	// TODO: handle region
-	return &cloudprovider.InstanceMetadata{
+	metadata := &cloudprovider.InstanceMetadata{
 		ProviderID:    providerID,
 		InstanceType:  machine.Spec.MachineClassRef.Name,
 		NodeAddresses: addresses,
 		Zone:          zone,
-		Region:        "",
-	}, nil
+		Region:        region,
+	}
+	if replaced {
+		o.handleMachineReplaced(node, machine)
+	}
+	if err := o.reconcileNodeMachine(ctx, node.DeepCopy(), machine, metadata, replaced); err != nil {
+		// the metadata is still valid, recording the Machine is retried with the next sync of the Node
+		klog.FromContext(ctx).Error(err, "Failed to record Machine of Node", "Machine", client.ObjectKeyFromObject(machine))
+	}
+	return metadata, nil
+}
+
+// getMachineForNodeFromSnapshot returns the Machine backing the Node from the snapshot. Machines missing in the
+// snapshot, e.g. created after it was listed, and all Machines without a snapshot are looked up in the onmetal API.
+func (o *onmetalInstancesV2) getMachineForNodeFromSnapshot(ctx context.Context, snapshot *instanceSnapshot, node *corev1.Node) (*computev1alpha1.Machine, error) {
+	namespaces := getMachineNamespaces(o.onmetalNamespace, o.cloudConfig)
+	if snapshot != nil {
+		if machine := snapshot.machineForNode(node, namespaces); machine != nil {
+			return machine, nil
+		}
+	}
+	return getMachineForNode(ctx, o.onmetalClient, node, namespaces, getMachineClusterName(o.cloudConfig))
+}
+
+// getNetworkInterfaceFromSnapshot returns the NetworkInterface with the given key from the snapshot, falling back to
+// the onmetal API like getMachineForNodeFromSnapshot.
+func (o *onmetalInstancesV2) getNetworkInterfaceFromSnapshot(ctx context.Context, snapshot *instanceSnapshot, key client.ObjectKey) (*networkingv1alpha1.NetworkInterface, error) {
+	if snapshot != nil {
+		if nic := snapshot.networkInterface(key); nic != nil {
+			return nic, nil
+		}
+	}
+	nic := &networkingv1alpha1.NetworkInterface{}
+	if err := o.onmetalClient.Get(ctx, key, nic); err != nil {
+		return nil, err
+	}
+	return nic, nil
+}
+
+// updateInstanceSnapshot replaces the written object in the instance snapshot, if any.
+func (o *onmetalInstancesV2) updateInstanceSnapshot(obj client.Object) {
+	if o.instanceSnapshotter != nil {
+		o.instanceSnapshotter.update(obj)
+	}
+}
+
+// getExcludedNetworkInterfacesForMachine returns the names of the network interfaces of the Machine whose addresses
+// are not reported as Node addresses.
+func getExcludedNetworkInterfacesForMachine(machine *computev1alpha1.Machine) sets.Set[string] {
+	excluded := sets.New[string]()
+	for _, name := range strings.Split(machine.Annotations[AnnotationKeyExcludeNetworkInterfaces], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			excluded.Insert(name)
+		}
+	}
+	return excluded
+}
+
+// isVirtualIPAddressesExcluded reports whether the VirtualIPs of the network interfaces of the Machine are excluded
+// from the Node addresses. The annotation of the Machine takes precedence over the cloud config.
+func (c CloudConfig) isVirtualIPAddressesExcluded(machine *computev1alpha1.Machine) bool {
+	switch machine.Annotations[AnnotationKeyExcludeVirtualIPAddresses] {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return c.ExcludeVirtualIPAddresses
+	}
+}
+
+// getInternalDNSName returns the internal DNS name <node>.<zone>.<cluster>.<suffix> of a Node. The zone is omitted if
+// it is empty.
+func getInternalDNSName(nodeName, zone, clusterName, suffix string) string {
+	labels := []string{nodeName}
+	if zone != "" {
+		labels = append(labels, zone)
+	}
+	labels = append(labels, clusterName, strings.TrimPrefix(suffix, "."))
+	return strings.ToLower(strings.Join(labels, "."))
+}
+
+// getMachineNamespaces returns the onmetal namespaces Machines are looked up in, starting with the namespace of the
+// onmetal kubeconfig.
+func getMachineNamespaces(namespace string, cloudConfig CloudConfig) []string {
+	return append([]string{namespace}, cloudConfig.AdditionalNamespaces...)
+}
+
+// getMachineClusterName returns the cluster name Machines have to be labeled with to be looked up, or an empty string
+// if Machines are not scoped by label.
+func getMachineClusterName(cloudConfig CloudConfig) string {
+	if !cloudConfig.SharedNamespace {
+		return ""
+	}
+	return cloudConfig.ClusterName
+}
+
+// getMachineForNode returns the Machine backing the Node. If the provider ID of the Node references one of the given
+// namespaces, the Machine is looked up in that namespace only. Otherwise, the Machine named like the Node is looked up
+// in the given namespaces in order. Nodes registered before the cloud provider initialized them have no provider ID
+// yet and, if no Machine is named like them, are correlated with a Machine by their internal IPs. If clusterName is
+// set, Machines labeled with another cluster name are not considered.
+func getMachineForNode(ctx context.Context, onmetalClient client.Client, node *corev1.Node, namespaces []string, clusterName string) (*computev1alpha1.Machine, error) {
+	if namespace, name, ok := parseProviderID(node.Spec.ProviderID); ok && slices.Contains(namespaces, namespace) {
+		return getMachine(ctx, onmetalClient, client.ObjectKey{Namespace: namespace, Name: name}, clusterName)
+	}
+
+	for _, namespace := range namespaces {
+		machine, err := getMachine(ctx, onmetalClient, client.ObjectKey{Namespace: namespace, Name: node.Name}, clusterName)
+		if err == nil {
+			return machine, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if node.Spec.ProviderID == "" {
+		machine, err := getMachineByNodeAddresses(ctx, onmetalClient, node, namespaces, clusterName)
+		if err != nil || machine != nil {
+			return machine, err
+		}
+	}
+	return nil, apierrors.NewNotFound(computev1alpha1.Resource("machines"), node.Name)
+}
+
+// getMachineByNodeAddresses returns the only Machine in the given namespaces with a network interface IP among the
+// internal IPs of the Node, or nil if there is no such Machine or the IPs are ambiguous.
+func getMachineByNodeAddresses(ctx context.Context, onmetalClient client.Client, node *corev1.Node, namespaces []string, clusterName string) (*computev1alpha1.Machine, error) {
+	nodeIPs := sets.New[string]()
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			nodeIPs.Insert(address.Address)
+		}
+	}
+	if nodeIPs.Len() == 0 {
+		return nil, nil
+	}
+
+	var matches []*computev1alpha1.Machine
+	for _, namespace := range namespaces {
+		machineList := &computev1alpha1.MachineList{}
+		if err := onmetalClient.List(ctx, machineList, client.InNamespace(namespace)); err != nil {
+			return nil, fmt.Errorf("failed to list Machines in namespace %s: %w", namespace, err)
+		}
+		for i := range machineList.Items {
+			if isMachineOfCluster(&machineList.Items[i], clusterName) && hasMachineIP(&machineList.Items[i], nodeIPs) {
+				matches = append(matches, &machineList.Items[i])
+			}
+		}
+	}
+	if len(matches) != 1 {
+		if len(matches) > 1 {
+			klog.FromContext(ctx).V(2).Info("Not correlating Node with Machines sharing its IPs", "Node", node.Name, "Machines", len(matches))
+		}
+		return nil, nil
+	}
+	klog.FromContext(ctx).V(2).Info("Correlated Node without provider ID with Machine by its IPs", "Node", node.Name, "Machine", client.ObjectKeyFromObject(matches[0]))
+	return matches[0], nil
+}
+
+// hasMachineIP reports whether one of the network interface IPs of the Machine is among the given IPs.
+func hasMachineIP(machine *computev1alpha1.Machine, ips sets.Set[string]) bool {
+	for _, iface := range machine.Status.NetworkInterfaces {
+		for _, ip := range iface.IPs {
+			if ips.Has(ip.String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordMachineNotFound reports a Node without provider ID which could not be correlated with any Machine, neither by
+// its name nor by its IPs.
+func (o *onmetalInstancesV2) recordMachineNotFound(node *corev1.Node) {
+	if node.Spec.ProviderID != "" || o.recorder == nil {
+		return
+	}
+	o.recorder.Eventf(node, corev1.EventTypeWarning, eventReasonMachineNotFound, "No Machine found for Node without provider ID, neither named %s in the namespaces %v nor with one of its internal IPs", node.Name, getMachineNamespaces(o.onmetalNamespace, o.cloudConfig))
+}
+
+// getMachine returns the Machine with the given key. If clusterName is set, Machines labeled with another cluster
+// sharing the namespace are reported as not found. Machines without cluster name label are returned, so new Machines
+// are found and claimed by InstanceMetadata labeling them.
+func getMachine(ctx context.Context, onmetalClient client.Client, key client.ObjectKey, clusterName string) (*computev1alpha1.Machine, error) {
+	machine := &computev1alpha1.Machine{}
+	if err := onmetalClient.Get(ctx, key, machine); err != nil {
+		return nil, err
+	}
+	if !isMachineOfCluster(machine, clusterName) {
+		return nil, apierrors.NewNotFound(computev1alpha1.Resource("machines"), key.Name)
+	}
+	return machine, nil
+}
+
+// isMachineOfCluster reports whether the Machine is labeled with the given cluster name or not labeled with any
+// cluster name. Without cluster name, all Machines are considered.
+func isMachineOfCluster(machine *computev1alpha1.Machine, clusterName string) bool {
+	machineClusterName, ok := machine.Labels[LabelKeyClusterName]
+	return clusterName == "" || !ok || machineClusterName == clusterName
+}
+
+// parseProviderID parses a provider ID of the form onmetal://<namespace>/<machine-name>.
+func parseProviderID(providerID string) (namespace, name string, ok bool) {
+	rest, ok := strings.CutPrefix(providerID, ProviderName+"://")
+	if !ok {
+		return "", "", false
+	}
+	namespace, name, ok = strings.Cut(rest, "/")
+	return namespace, name, ok && namespace != "" && name != ""
 }
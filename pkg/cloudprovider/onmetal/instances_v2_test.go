@@ -15,15 +15,22 @@
 package onmetal
 
 import (
+	"context"
 	"fmt"
 	"net/netip"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	testingclock "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 
 	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
@@ -203,6 +210,359 @@ var _ = Describe("InstancesV2", func() {
 	})
 })
 
+var _ = Describe("InstancesV2 topology", func() {
+	It("should map the machine pool to the configured zone and region", func(ctx SpecContext) {
+		newMachine := func(name, machinePoolName string) *computev1alpha1.Machine {
+			return &computev1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+				Spec: computev1alpha1.MachineSpec{
+					MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+					MachinePoolRef:  &corev1.LocalObjectReference{Name: machinePoolName},
+				},
+			}
+		}
+		mapped := newMachine("mapped", "pool1")
+		unmapped := newMachine("unmapped", "pool2")
+
+		instancesProvider := newOnmetalInstancesV2(
+			fake.NewClientBuilder().Build(),
+			fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(mapped, unmapped).Build(),
+			"foo",
+			CloudConfig{
+				ClusterName: "test",
+				MachinePoolTopology: map[string]MachinePoolTopology{
+					"pool1": {Zone: "zone1", Region: "region1"},
+				},
+			},
+			nil,
+			record.NewFakeRecorder(10),
+			nil,
+		)
+
+		Expect(instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "mapped"}})).To(SatisfyAll(
+			HaveField("Zone", "zone1"),
+			HaveField("Region", "region1"),
+		))
+		Expect(instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unmapped"}})).To(SatisfyAll(
+			HaveField("Zone", "pool2"),
+			HaveField("Region", ""),
+		))
+	})
+})
+
+var _ = Describe("InstancesV2 namespaces", func() {
+	var onmetalClient client.Client
+
+	BeforeEach(func() {
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"}},
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "machine"}},
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "other"}},
+		).Build()
+	})
+
+	It("should look up the machine in the namespace of the provider ID", func(ctx SpecContext) {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine"},
+			Spec:       corev1.NodeSpec{ProviderID: getProviderID("bar", "machine")},
+		}
+		Expect(getMachineForNode(ctx, onmetalClient, node, []string{"foo", "bar"}, "")).To(HaveField("Namespace", "bar"))
+	})
+
+	It("should look up the machine by the node name in all namespaces in order", func(ctx SpecContext) {
+		Expect(getMachineForNode(ctx, onmetalClient, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}, []string{"foo", "bar"}, "")).To(HaveField("Namespace", "foo"))
+		Expect(getMachineForNode(ctx, onmetalClient, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, []string{"foo", "bar"}, "")).To(HaveField("Namespace", "bar"))
+
+		_, err := getMachineForNode(ctx, onmetalClient, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, []string{"foo"}, "")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should only look up machines labeled with the cluster name in a shared namespace", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "own", Labels: map[string]string{LabelKeyClusterName: "test"}}},
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "foreign", Labels: map[string]string{LabelKeyClusterName: "other"}}},
+		).Build()
+
+		Expect(getMachineForNode(ctx, onmetalClient, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "own"}}, []string{"shared"}, "test")).To(HaveField("Name", "own"))
+
+		_, err := getMachineForNode(ctx, onmetalClient, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "foreign"}}, []string{"shared"}, "test")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should find and claim unlabeled machines in a shared namespace", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			&computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "new"}},
+		).Build()
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "shared", CloudConfig{
+			ClusterName:     "test",
+			SharedNamespace: true,
+		}, nil, record.NewFakeRecorder(10), nil)
+
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "new"}}
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("ProviderID", getProviderID("shared", "new")))
+
+		machine := &computev1alpha1.Machine{}
+		Expect(onmetalClient.Get(ctx, client.ObjectKey{Namespace: "shared", Name: "new"}, machine)).To(Succeed())
+		Expect(machine.Labels).To(HaveKeyWithValue(LabelKeyClusterName, "test"))
+
+		By("not finding the machine from another cluster once claimed")
+		_, err := getMachineForNode(ctx, onmetalClient, node, []string{"shared"}, "other")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("InstancesV2 nodes without provider ID", func() {
+	newMachine := func(name string, ips ...string) *computev1alpha1.Machine {
+		machine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name}}
+		status := computev1alpha1.NetworkInterfaceStatus{Name: "primary"}
+		for _, ip := range ips {
+			status.IPs = append(status.IPs, commonv1alpha1.MustParseIP(ip))
+		}
+		machine.Status.NetworkInterfaces = []computev1alpha1.NetworkInterfaceStatus{status}
+		return machine
+	}
+
+	newNode := func(name string, ips ...string) *corev1.Node {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, ip := range ips {
+			node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: ip})
+		}
+		return node
+	}
+
+	It("should correlate the node with the only machine sharing one of its internal IPs", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(
+			newMachine("machine-a", "10.0.0.1"),
+			newMachine("machine-b", "10.0.0.2"),
+			newMachine("machine-c", "10.0.0.2"),
+		).Build()
+
+		Expect(getMachineForNode(ctx, onmetalClient, newNode("node-a", "10.0.0.1"), []string{"foo"}, "")).To(HaveField("Name", "machine-a"))
+
+		By("not correlating the node with machines sharing its IPs")
+		_, err := getMachineForNode(ctx, onmetalClient, newNode("node-b", "10.0.0.2"), []string{"foo"}, "")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		By("not correlating nodes with a provider ID by their IPs")
+		node := newNode("node-a", "10.0.0.1")
+		node.Spec.ProviderID = getProviderID("foo", "node-a")
+		_, err = getMachineForNode(ctx, onmetalClient, node, []string{"foo"}, "")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should record an event for nodes without any machine", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(10)
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), fake.NewClientBuilder().WithScheme(onmetalScheme).Build(), "foo", CloudConfig{
+			ClusterName: "test",
+		}, nil, recorder, nil)
+
+		_, err := instancesProvider.InstanceMetadata(ctx, newNode("node", "10.0.0.1"))
+		Expect(err).To(MatchError(cloudprovider.InstanceNotFound))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonMachineNotFound)))
+	})
+})
+
 func getProviderID(namespace, machineName string) string {
 	return fmt.Sprintf("%s://%s/%s", ProviderName, namespace, machineName)
 }
+
+var _ = Describe("InstancesV2 addresses", func() {
+	machine := &computev1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+		Spec: computev1alpha1.MachineSpec{
+			MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+			NetworkInterfaces: []computev1alpha1.NetworkInterface{
+				{Name: "primary"},
+				{Name: "storage"},
+			},
+		},
+		Status: computev1alpha1.MachineStatus{
+			NetworkInterfaces: []computev1alpha1.NetworkInterfaceStatus{
+				{Name: "primary", IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}},
+				{Name: "storage", IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.1.0.1")}},
+			},
+		},
+	}
+	newNetworkInterface := func(name, networkName string) *networkingv1alpha1.NetworkInterface {
+		return &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+			Spec: networkingv1alpha1.NetworkInterfaceSpec{
+				NetworkRef: corev1.LocalObjectReference{Name: networkName},
+			},
+		}
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+	newInstancesProvider := func(cloudConfig CloudConfig, modifiers ...func(*computev1alpha1.Machine)) cloudprovider.InstancesV2 {
+		machine := machine.DeepCopy()
+		for _, modify := range modifiers {
+			modify(machine)
+		}
+		onmetalClient := fake.NewClientBuilder().
+			WithScheme(onmetalScheme).
+			WithObjects(machine, newNetworkInterface("machine-primary", "cluster"), newNetworkInterface("machine-storage", "storage")).
+			Build()
+		return newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", cloudConfig, nil, record.NewFakeRecorder(10), nil)
+	}
+
+	It("should only report the addresses of network interfaces in the cluster network", func(ctx SpecContext) {
+		instancesProvider := newInstancesProvider(CloudConfig{ClusterName: "test", NetworkName: "cluster"})
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		)))
+	})
+
+	It("should report the internal DNS name of the node if a suffix is configured", func(ctx SpecContext) {
+		instancesProvider := newInstancesProvider(CloudConfig{ClusterName: "test", NetworkName: "cluster", InternalDNSSuffix: "nodes.example.org"})
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			corev1.NodeAddress{Type: corev1.NodeInternalDNS, Address: "machine.test.nodes.example.org"},
+		)))
+		Expect(getInternalDNSName("machine", "zone1", "test", "nodes.example.org")).To(Equal("machine.zone1.test.nodes.example.org"))
+	})
+
+	It("should report the name of the machine as host name if configured", func(ctx SpecContext) {
+		instancesProvider := newInstancesProvider(CloudConfig{ClusterName: "test", NetworkName: "cluster", ReportHostName: true})
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			corev1.NodeAddress{Type: corev1.NodeHostName, Address: "machine"},
+		)))
+	})
+
+	It("should report the addresses of all network interfaces if configured", func(ctx SpecContext) {
+		instancesProvider := newInstancesProvider(CloudConfig{ClusterName: "test", NetworkName: "cluster", ReportAllNetworkInterfaceAddresses: true})
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.1.0.1"},
+		)))
+	})
+	withVirtualIP := func(machine *computev1alpha1.Machine) {
+		virtualIP := commonv1alpha1.MustParseIP("192.0.2.1")
+		machine.Status.NetworkInterfaces[0].VirtualIP = &virtualIP
+	}
+	withAnnotations := func(annotations map[string]string) func(*computev1alpha1.Machine) {
+		return func(machine *computev1alpha1.Machine) {
+			machine.Annotations = annotations
+		}
+	}
+
+	It("should exclude virtual IPs if configured unless the machine overrides it", func(ctx SpecContext) {
+		cloudConfig := CloudConfig{ClusterName: "test", NetworkName: "cluster"}
+		Expect(newInstancesProvider(cloudConfig, withVirtualIP).InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		)))
+
+		excludingMachine := withAnnotations(map[string]string{AnnotationKeyExcludeVirtualIPAddresses: "true"})
+		Expect(newInstancesProvider(cloudConfig, withVirtualIP, excludingMachine).InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		)))
+
+		cloudConfig.ExcludeVirtualIPAddresses = true
+		Expect(newInstancesProvider(cloudConfig, withVirtualIP).InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		)))
+
+		includingMachine := withAnnotations(map[string]string{AnnotationKeyExcludeVirtualIPAddresses: "false"})
+		Expect(newInstancesProvider(cloudConfig, withVirtualIP, includingMachine).InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		)))
+	})
+
+	It("should exclude the addresses of network interfaces excluded by the machine", func(ctx SpecContext) {
+		cloudConfig := CloudConfig{ClusterName: "test", NetworkName: "cluster", ReportAllNetworkInterfaceAddresses: true}
+		excludingMachine := withAnnotations(map[string]string{AnnotationKeyExcludeNetworkInterfaces: "primary"})
+		Expect(newInstancesProvider(cloudConfig, withVirtualIP, excludingMachine).InstanceMetadata(ctx, node)).To(HaveField("NodeAddresses", ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.1.0.1"},
+		)))
+	})
+})
+
+var _ = Describe("InstancesV2 fail static", func() {
+	machine := &computev1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+		Spec: computev1alpha1.MachineSpec{
+			MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+		},
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+	var (
+		unreachable       bool
+		fakeClock         *testingclock.FakeClock
+		instancesProvider *onmetalInstancesV2
+	)
+
+	BeforeEach(func() {
+		unreachable = false
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if unreachable {
+					return fmt.Errorf("connection refused")
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+		instancesProvider = newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{
+			ClusterName:        "test",
+			FailStaticDuration: metav1.Duration{Duration: time.Minute},
+		}, nil, record.NewFakeRecorder(10), nil).(*onmetalInstancesV2)
+		instancesProvider.clock = fakeClock
+	})
+
+	It("should serve the last known instance state while the onmetal API is unreachable", func(ctx SpecContext) {
+		Expect(instancesProvider.InstanceExists(ctx, node)).To(BeTrue())
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("InstanceType", "machine-class"))
+
+		unreachable = true
+		fakeClock.Step(30 * time.Second)
+		Expect(instancesProvider.InstanceExists(ctx, node)).To(BeTrue())
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("InstanceType", "machine-class"))
+		_, err := instancesProvider.InstanceShutdown(ctx, node)
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+
+	It("should not serve a last known instance state older than the fail static duration", func(ctx SpecContext) {
+		Expect(instancesProvider.InstanceExists(ctx, node)).To(BeTrue())
+
+		unreachable = true
+		fakeClock.Step(2 * time.Minute)
+		_, err := instancesProvider.InstanceExists(ctx, node)
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
+
+var _ = Describe("InstancesV2 node renames", func() {
+	It("should report a node replaced by a renamed node as not existing", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine", UID: "machine-uid"}}
+		oldNode := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: metav1.Unix(1, 0)},
+			Spec:       corev1.NodeSpec{ProviderID: getProviderID("foo", "machine")},
+		}
+		newNode := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", CreationTimestamp: metav1.Unix(2, 0)},
+			Spec:       corev1.NodeSpec{ProviderID: getProviderID("foo", "machine")},
+		}
+		index := newMachineNodeIndex("foo")
+		index.setMachine(machine)
+		index.setNode(oldNode)
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).Build()
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{
+			FailStaticDuration: metav1.Duration{Duration: time.Minute},
+		}, nil, record.NewFakeRecorder(10), index).(*onmetalInstancesV2)
+
+		By("reporting the instance of the old node")
+		Expect(instancesProvider.InstanceExists(ctx, oldNode)).To(BeTrue())
+
+		By("moving the last known instance to the renamed node")
+		index.setNode(newNode)
+		Expect(instancesProvider.lastKnownInstances).To(HaveKey("new"))
+		Expect(instancesProvider.lastKnownInstances).NotTo(HaveKey("old"))
+
+		By("reporting the old node as not existing")
+		Expect(instancesProvider.InstanceExists(ctx, oldNode)).To(BeFalse())
+		Expect(instancesProvider.InstanceExists(ctx, newNode)).To(BeTrue())
+	})
+})
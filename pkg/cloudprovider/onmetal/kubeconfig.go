@@ -0,0 +1,142 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// loadOnmetalKubeconfig returns the rest config and the namespace of the onmetal kubeconfig with the given data read
+// from the given path. Relative paths of the kubeconfig, e.g. of exec credential plugins or certificate files, are
+// resolved relative to the directory of the kubeconfig.
+func loadOnmetalKubeconfig(path string, data []byte) (*rest.Config, string, error) {
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read onmetal cluster kubeconfig: %w", err)
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		cluster.LocationOfOrigin = path
+	}
+	for _, authInfo := range kubeconfig.AuthInfos {
+		authInfo.LocationOfOrigin = path
+	}
+	if err := clientcmd.ResolveLocalPaths(kubeconfig); err != nil {
+		return nil, "", fmt.Errorf("unable to resolve paths of onmetal cluster kubeconfig: %w", err)
+	}
+
+	clientConfig := clientcmd.NewDefaultClientConfig(*kubeconfig, nil)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to get onmetal cluster rest config: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get namespace from onmetal kubeconfig: %w", err)
+	}
+	return restConfig, namespace, nil
+}
+
+// newReloadingRestConfig returns a rest config for the server of the given rest config whose credentials are re-read
+// from the onmetal kubeconfig at the given path at most once per interval. If the kubeconfig changed, e.g. because
+// its credentials were rotated, the connections to the onmetal API are rebuilt with the new credentials. The server
+// and the namespace are not reloaded.
+func newReloadingRestConfig(path string, data []byte, restConfig *rest.Config, interval time.Duration) (*rest.Config, error) {
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create onmetal transport: %w", err)
+	}
+	return &rest.Config{
+		Host:          restConfig.Host,
+		APIPath:       restConfig.APIPath,
+		ContentConfig: restConfig.ContentConfig,
+		UserAgent:     restConfig.UserAgent,
+		QPS:           restConfig.QPS,
+		Burst:         restConfig.Burst,
+		Timeout:       restConfig.Timeout,
+		Transport: &reloadingTransport{
+			path:      path,
+			interval:  interval,
+			clock:     clock.RealClock{},
+			data:      data,
+			transport: transport,
+			lastRead:  time.Now(),
+		},
+	}, nil
+}
+
+// reloadingTransport sends requests with a transport built from the onmetal kubeconfig, rebuilding the transport once
+// the kubeconfig changed.
+type reloadingTransport struct {
+	path     string
+	interval time.Duration
+	clock    clock.PassiveClock
+
+	mu        sync.Mutex
+	data      []byte
+	transport http.RoundTripper
+	lastRead  time.Time
+}
+
+func (t *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.getTransport().RoundTrip(req)
+}
+
+// getTransport returns the current transport, re-reading the kubeconfig if it was last read an interval ago. The
+// current transport is kept if the kubeconfig cannot be read or is invalid.
+func (t *reloadingTransport) getTransport() http.RoundTripper {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.clock.Since(t.lastRead) < t.interval {
+		return t.transport
+	}
+	t.lastRead = t.clock.Now()
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		klog.ErrorS(err, "Failed to re-read onmetal kubeconfig, keeping the current credentials", "Path", t.path)
+		return t.transport
+	}
+	if bytes.Equal(data, t.data) {
+		return t.transport
+	}
+	restConfig, _, err := loadOnmetalKubeconfig(t.path, data)
+	if err != nil {
+		klog.ErrorS(err, "Failed to load changed onmetal kubeconfig, keeping the current credentials", "Path", t.path)
+		return t.transport
+	}
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		klog.ErrorS(err, "Failed to create transport for changed onmetal kubeconfig, keeping the current credentials", "Path", t.path)
+		return t.transport
+	}
+
+	klog.InfoS("Onmetal kubeconfig changed, using the new credentials", "Path", t.path)
+	// requests in flight, e.g. watches, complete with the previous transport
+	utilnet.CloseIdleConnectionsFor(t.transport)
+	t.data = data
+	t.transport = transport
+	return t.transport
+}
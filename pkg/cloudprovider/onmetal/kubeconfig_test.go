@@ -0,0 +1,109 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Onmetal kubeconfig", func() {
+	var (
+		server         *httptest.Server
+		authorizations chan string
+		kubeconfigPath string
+	)
+
+	writeKubeconfig := func(authInfo *clientcmdapi.AuthInfo) []byte {
+		data, err := clientcmd.Write(clientcmdapi.Config{
+			Clusters:       map[string]*clientcmdapi.Cluster{"onmetal": {Server: server.URL, InsecureSkipTLSVerify: true}},
+			AuthInfos:      map[string]*clientcmdapi.AuthInfo{"onmetal": authInfo},
+			Contexts:       map[string]*clientcmdapi.Context{"onmetal": {Cluster: "onmetal", AuthInfo: "onmetal", Namespace: "foo"}},
+			CurrentContext: "onmetal",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(kubeconfigPath, data, 0600)).To(Succeed())
+		return data
+	}
+
+	BeforeEach(func() {
+		authorizations = make(chan string, 10)
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorizations <- r.Header.Get("Authorization")
+		}))
+		DeferCleanup(server.Close)
+		kubeconfigPath = filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+	})
+
+	It("should resolve relative paths of exec credential plugins relative to the kubeconfig", func() {
+		data := writeKubeconfig(&clientcmdapi.AuthInfo{Exec: &clientcmdapi.ExecConfig{
+			APIVersion:      "client.authentication.k8s.io/v1",
+			Command:         "./bin/credential-plugin",
+			InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+		}})
+
+		restConfig, namespace, err := loadOnmetalKubeconfig(kubeconfigPath, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespace).To(Equal("foo"))
+		Expect(restConfig.ExecProvider.Command).To(Equal(filepath.Join(filepath.Dir(kubeconfigPath), "bin", "credential-plugin")))
+	})
+
+	It("should send requests with the credentials of the changed kubeconfig", func() {
+		data := writeKubeconfig(&clientcmdapi.AuthInfo{Token: "old"})
+		restConfig, _, err := loadOnmetalKubeconfig(kubeconfigPath, data)
+		Expect(err).NotTo(HaveOccurred())
+		restConfig, err = newReloadingRestConfig(kubeconfigPath, data, restConfig, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		transport := restConfig.Transport.(*reloadingTransport)
+		clk := clocktesting.NewFakeClock(time.Now())
+		transport.clock = clk
+		transport.lastRead = clk.Now()
+		httpClient, err := rest.HTTPClientFor(restConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		get := func() string {
+			response, err := httpClient.Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.Body.Close()).To(Succeed())
+			return <-authorizations
+		}
+
+		By("sending a request with the initial credentials")
+		Expect(get()).To(Equal("Bearer old"))
+
+		By("not re-reading the kubeconfig within the interval")
+		writeKubeconfig(&clientcmdapi.AuthInfo{Token: "new"})
+		Expect(get()).To(Equal("Bearer old"))
+
+		By("using the rotated credentials once the interval passed")
+		clk.Step(time.Minute)
+		Expect(get()).To(Equal("Bearer new"))
+
+		By("keeping the credentials if the kubeconfig becomes invalid")
+		Expect(os.WriteFile(kubeconfigPath, []byte("invalid"), 0600)).To(Succeed())
+		clk.Step(time.Minute)
+		Expect(get()).To(Equal("Bearer new"))
+	})
+})
@@ -16,16 +16,32 @@ package onmetal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
 	servicehelper "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -40,200 +56,1224 @@ const (
 	waitLoadbalancerInitDelay   = 1 * time.Second
 	waitLoadbalancerFactor      = 1.2
 	waitLoadbalancerActiveSteps = 19
+	nodePortDialTimeout         = 3 * time.Second
+	// nodePortVerificationTimeout bounds the verification of all node ports of a Service, see
+	// CloudConfig.VerifyNodePorts.
+	nodePortVerificationTimeout = 10 * time.Second
+	proxyProtocolV2             = "v2"
+
+	defaultDestinationResolutionConcurrency = 10
+
+	// loadBalancerProvisioningRetryInterval is the delay after which the service controller retries a Service whose
+	// LoadBalancer is still being provisioned, see CloudConfig.AsyncLoadBalancerProvisioning.
+	loadBalancerProvisioningRetryInterval = 10 * time.Second
+
+	// maxLoadBalancerRoutingDestinations is the maximum number of destinations of a LoadBalancerRouting. The onmetal
+	// API routes a LoadBalancer by a single LoadBalancerRouting, hence its destinations cannot be sharded across
+	// multiple objects and more destinations would exceed the object size limit of etcd.
+	maxLoadBalancerRoutingDestinations = 4096
+)
+
+const (
+	eventReasonIPFamilyMismatch       = "IPFamilyMismatch"
+	eventReasonIPFamiliesDowngraded   = "IPFamiliesDowngraded"
+	eventReasonDryRun                 = "DryRun"
+	eventReasonObserved               = "Observed"
+	eventReasonNoPorts                = "NoPorts"
+	eventReasonDestinationsTruncated  = "DestinationsTruncated"
+	eventReasonUnsupportedAppProtocol = "UnsupportedAppProtocol"
+	eventReasonNamedTargetPort        = "NamedTargetPort"
+	eventReasonApplyConflict          = "ApplyConflict"
+
+	// portErrorNotProgrammed is the error of the status of a Service port not programmed at its LoadBalancer
+	portErrorNotProgrammed = "PortNotProgrammed"
+	// portErrorNotAllocated is the error of the status of a Service port the data plane did not allocate
+	portErrorNotAllocated = "PortNotAllocated"
+)
+
+var (
+	loadBalancerFieldOwner        = client.FieldOwner("cloud-provider.onmetal.de/loadbalancer")
+	loadBalancerRoutingFieldOwner = client.FieldOwner("cloud-provider.onmetal.de/loadbalancerrouting")
+)
+
+var truncatedLoadBalancerDestinations = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Subsystem:      "cloud_provider_onmetal",
+		Name:           "truncated_load_balancer_destinations_total",
+		Help:           "Number of LoadBalancer destinations dropped because the LoadBalancer exceeded its maximum number of destinations.",
+		StabilityLevel: metrics.ALPHA,
+	},
 )
 
-var (
-	loadBalancerFieldOwner = client.FieldOwner("cloud-provider.onmetal.de/loadbalancer")
-)
+var loadBalancerIPAllocationDuration = metrics.NewHistogramVec(
+	&metrics.HistogramOpts{
+		Subsystem:      "cloud_provider_onmetal",
+		Name:           "load_balancer_ip_allocation_duration_seconds",
+		Help:           "Time from the creation of a LoadBalancer until its IPs are allocated, by the Prefix the IPs are allocated from.",
+		Buckets:        metrics.ExponentialBuckets(1, 2, 10),
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"pool"},
+)
+
+func init() {
+	legacyregistry.MustRegister(truncatedLoadBalancerDestinations)
+	legacyregistry.MustRegister(loadBalancerIPAllocationDuration)
+}
+
+type onmetalLoadBalancer struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	// featureGates enable experimental behaviors, see defaultFeatureGates. If nil, all of them are disabled.
+	featureGates featuregate.FeatureGate
+	recorder     record.EventRecorder
+	// apiReader reads directly from the onmetal API, bypassing the cache of onmetalClient. If nil, onmetalClient is
+	// used instead.
+	apiReader   client.Reader
+	dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	// machineNodeIndex resolves the Nodes backing Machines to skip Nodes replaced by a renamed Node. If nil, no Node
+	// is skipped.
+	machineNodeIndex *machineNodeIndex
+	// loadBalancerWaiter observes the changes of LoadBalancers while waiting for their IPs. If nil, the LoadBalancer
+	// is polled instead.
+	loadBalancerWaiter *loadBalancerWaiter
+	// dnsRecords manages the DNS records of the hostname annotations of Services. If nil, no records are managed.
+	dnsRecords dnsRecordProvider
+}
+
+func newOnmetalLoadBalancer(targetClient client.Client, onmetalClient client.Client, apiReader client.Reader, namespace string, cloudConfig CloudConfig, featureGates featuregate.FeatureGate, recorder record.EventRecorder, machineNodeIndex *machineNodeIndex, loadBalancerWaiter *loadBalancerWaiter) cloudprovider.LoadBalancer {
+	loadBalancer := &onmetalLoadBalancer{
+		targetClient:       targetClient,
+		onmetalClient:      onmetalClient,
+		onmetalNamespace:   namespace,
+		cloudConfig:        cloudConfig,
+		featureGates:       featureGates,
+		recorder:           recorder,
+		apiReader:          apiReader,
+		dialContext:        (&net.Dialer{Timeout: nodePortDialTimeout}).DialContext,
+		machineNodeIndex:   machineNodeIndex,
+		loadBalancerWaiter: loadBalancerWaiter,
+	}
+	if cloudConfig.DNSRecords {
+		loadBalancer.dnsRecords = newDNSRecordObjectProvider(targetClient)
+	}
+	return loadBalancer
+}
+
+func (o *onmetalLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	ctx = withServiceLogger(ctx, clusterName, service)
+	klog.FromContext(ctx).V(2).Info("GetLoadBalancer for Service")
+
+	loadBalancer, err := o.lookupLoadBalancerForService(ctx, clusterName, service)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to get LoadBalancer %s for Service %s: %w", o.GetLoadBalancerName(ctx, clusterName, service), client.ObjectKeyFromObject(service), err)
+	}
+
+	lbAllocatedIps, mismatchingIPs := filterIPsByFamilies(loadBalancer.Status.IPs, service.Spec.IPFamilies)
+	if len(mismatchingIPs) > 0 {
+		klog.FromContext(ctx).V(2).Info("Ignoring LoadBalancer IPs not matching the IP families of the Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service), "IPs", mismatchingIPs)
+	}
+	status = &v1.LoadBalancerStatus{}
+	for _, ip := range lbAllocatedIps {
+		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: ip.String()})
+	}
+	return status, true, nil
+}
+
+func (o *onmetalLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	cloudprovider.DefaultLoadBalancerName(service)
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		return adoptedLoadBalancerName
+	}
+	// the recorded name is stable across renames of the cluster and changes of the naming scheme
+	if recordedLoadBalancerName := service.Annotations[AnnotationKeyLoadBalancerName]; recordedLoadBalancerName != "" {
+		return recordedLoadBalancerName
+	}
+	return o.cloudConfig.loadBalancerNameForService(clusterName, service)
+}
+
+func (o *onmetalLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	ctx = withServiceLogger(ctx, clusterName, service)
+	ctx, span := startSpan(ctx, "EnsureLoadBalancer", serviceAttributes(clusterName, service)...)
+	status, err := o.ensureLoadBalancer(ctx, clusterName, service, nodes)
+	endSpan(span, err)
+	if err == nil {
+		serviceLoadBalancerMetrics.observeSync(o.cloudConfig.ClusterName, service, status)
+	}
+	return status, err
+}
+
+func (o *onmetalLoadBalancer) ensureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	klog.FromContext(ctx).V(2).Info("EnsureLoadBalancer for Service")
+
+	if len(service.Spec.Ports) == 0 {
+		return o.ensureLoadBalancerWithoutPorts(ctx, clusterName, service)
+	}
+
+	// pre-existing load balancers are only fronted by the Service, none of the settings below apply to them
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		return o.ensureAdoptedLoadBalancer(ctx, clusterName, service, nodes, adoptedLoadBalancerName)
+	}
+
+	// unknown application protocols are rejected instead of silently serving them as plain L4 traffic
+	if _, err := getAppProtocolsForService(service); err != nil {
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonUnsupportedAppProtocol, err.Error())
+		return nil, err
+	}
+
+	// named target ports differ per Pod, routing to an arbitrary port instead would silently drop the traffic
+	if _, err := getBackendPortsForService(service); err != nil {
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonNamedTargetPort, err.Error())
+		return nil, err
+	}
+
+	nodePoolWeights, err := getNodePoolWeightsForService(service)
+	if err != nil {
+		return nil, err
+	}
+	o.recordUnsupportedDestinationWeights(service, nodePoolWeights)
+
+	desiredLoadBalancerType := getLoadBalancerTypeForService(service)
+	loadBalancerName := o.GetLoadBalancerName(ctx, clusterName, service)
+
+	// get existing load balancer type
+	var existingLoadBalancerType networkingv1alpha1.LoadBalancerType
+	existingLoadBalancer, err := o.getLoadBalancerForService(ctx, clusterName, service)
+	if apierrors.IsNotFound(err) {
+		// names not containing the Service UID map a recreated Service to the same name, and names of long cluster and
+		// Service names are truncated
+		if err := o.checkLoadBalancerNameAvailable(ctx, loadBalancerName, service); err != nil {
+			return nil, err
+		}
+		if err := o.checkLoadBalancerQuota(ctx, service, desiredLoadBalancerType); err != nil {
+			return nil, err
+		}
+	}
+	if err == nil {
+		existingLoadBalancerType = existingLoadBalancer.Spec.Type
+		if networkName := existingLoadBalancer.Spec.NetworkRef.Name; networkName != o.cloudConfig.NetworkName {
+			return nil, fmt.Errorf("LoadBalancer %s is in Network %s instead of %s: %w", client.ObjectKeyFromObject(existingLoadBalancer), networkName, o.cloudConfig.NetworkName, ErrNetworkMismatch)
+		}
+		if existingLoadBalancerType != desiredLoadBalancerType {
+			if err = o.EnsureLoadBalancerDeleted(ctx, clusterName, service); err != nil {
+				return nil, fmt.Errorf("failed deleting existing loadbalancer %s: %w", existingLoadBalancer.Name, err)
+			}
+		} else {
+			// keep the name of an existing load balancer, it might differ from the name derived from the cluster name
+			loadBalancerName = existingLoadBalancer.Name
+		}
+	}
+
+	desired, err := o.getDesiredLoadBalancerForService(ctx, clusterName, service, nodes, loadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancer, manageRouting, destinationLimit := desired.loadBalancer, desired.manageRouting, desired.destinationLimit
+
+	klog.FromContext(ctx).V(2).Info("Applying LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+	if err := applyPreservingUnknownFields(ctx, o.onmetalClient, loadBalancer, o.cloudConfig.applyOptionsFor("LoadBalancer")...); err != nil {
+		o.recordApplyConflict(service, loadBalancer, err)
+		if rejectedPorts := getRejectedLoadBalancerPorts(loadBalancer, err); len(rejectedPorts) > 0 {
+			return nil, o.reportRejectedLoadBalancerPorts(ctx, service, loadBalancer, rejectedPorts, err)
+		}
+		return nil, fmt.Errorf("failed to apply LoadBalancer %s for Service %s: %w", client.ObjectKeyFromObject(loadBalancer), client.ObjectKeyFromObject(service), err)
+	}
+	klog.FromContext(ctx).V(2).Info("Applied LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+
+	if manageRouting {
+		klog.FromContext(ctx).V(2).Info("Applying LoadBalancerRouting for LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+		if err := o.applyLoadBalancerRoutingForLoadBalancer(ctx, service, loadBalancer, nodes, destinationLimit); err != nil {
+			return nil, err
+		}
+		klog.FromContext(ctx).V(2).Info("Applied LoadBalancerRouting for LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	} else {
+		klog.FromContext(ctx).V(2).Info("Not managing LoadBalancerRouting of LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	}
+
+	if o.cloudConfig.Observer {
+		return o.observeLoadBalancer(ctx, service, loadBalancer)
+	}
+	if o.cloudConfig.DryRun {
+		// the applied objects are not persisted, hence the IPs of the load balancer will never be allocated
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonDryRun, "Dry-run: applied LoadBalancer %s and its LoadBalancerRouting", client.ObjectKeyFromObject(loadBalancer))
+		return getLoadBalancerStatusForService(loadBalancer, service), nil
+	}
+	if err := o.annotateServiceWithLoadBalancer(ctx, service, loadBalancer); err != nil {
+		return nil, err
+	}
+	if err := o.reconcileIPFamiliesDowngradedCondition(ctx, service, loadBalancer, desired.downgradedIPFamilies); err != nil {
+		return nil, err
+	}
+	if err := o.reconcilePortsNotAllowedCondition(ctx, service, nil); err != nil {
+		return nil, err
+	}
+	if o.cloudConfig.AsyncLoadBalancerStatus {
+		// the status of the Service is updated by the loadBalancerStatusReconciler once the IPs are allocated
+		klog.FromContext(ctx).V(2).Info("Not waiting for LoadBalancer to become ready", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+		return getLoadBalancerStatusForService(loadBalancer, service), nil
+	}
+	if o.cloudConfig.isAsyncLoadBalancerProvisioningEnabled(o.featureGates) {
+		// the status of the Service is updated by the loadBalancerStatusReconciler once the IPs are allocated, until
+		// then the service controller retries the Service after a fixed delay instead of backing off
+		lbStatus := getLoadBalancerStatusForService(loadBalancer, service)
+		if !isLoadBalancerProvisioned(existingLoadBalancerType, service, loadBalancer, lbStatus) {
+			klog.FromContext(ctx).V(2).Info("LoadBalancer is still being provisioned", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+			return nil, newLoadBalancerProvisioningError(loadBalancer)
+		}
+		observeIPAllocationDuration(loadBalancer, service, time.Now())
+		if err := reconcileDNSRecord(ctx, o.dnsRecords, service, lbStatus); err != nil {
+			return nil, err
+		}
+		return lbStatus, nil
+	}
+
+	lbStatus, err := waitLoadBalancerActive(ctx, o.onmetalClient, o.loadBalancerWaiter, existingLoadBalancerType, service, loadBalancer)
+	if err != nil {
+		return nil, err
+	}
+	// the destinations of an unmanaged LoadBalancerRouting are not necessarily Nodes
+	if o.cloudConfig.VerifyNodePorts && manageRouting {
+		if err := o.verifyNodePortsReachable(ctx, service, loadBalancer); err != nil {
+			return nil, err
+		}
+	}
+	if _, mismatchingIPs := filterIPsByFamilies(loadBalancer.Status.IPs, service.Spec.IPFamilies); len(mismatchingIPs) > 0 {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonIPFamilyMismatch, "Ignoring IPs %v of LoadBalancer %s not matching the IP families %v of the Service", mismatchingIPs, client.ObjectKeyFromObject(loadBalancer), service.Spec.IPFamilies)
+	}
+	if err := reconcileDNSRecord(ctx, o.dnsRecords, service, &lbStatus); err != nil {
+		return nil, err
+	}
+	return &lbStatus, nil
+}
+
+// ensureLoadBalancerWithoutPorts deletes the LoadBalancer of a Service whose ports were all removed and reports the
+// Service as not load balanced. A load balancer without ports would not forward any traffic, hence none is created for
+// a Service without ports.
+func (o *onmetalLoadBalancer) ensureLoadBalancerWithoutPorts(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, error) {
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonNoPorts, "Releasing the adopted LoadBalancer %s of a Service without ports", adoptedLoadBalancerName)
+	} else {
+		if _, err := o.getLoadBalancerForService(ctx, clusterName, service); apierrors.IsNotFound(err) {
+			o.recorder.Event(service, v1.EventTypeWarning, eventReasonNoPorts, "Not creating a LoadBalancer for a Service without ports")
+			return nil, fmt.Errorf("service %s has no ports", client.ObjectKeyFromObject(service))
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get LoadBalancer for Service %s: %w", client.ObjectKeyFromObject(service), err)
+		}
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonNoPorts, "Deleting the LoadBalancer of a Service without ports")
+	}
+
+	if err := o.ensureLoadBalancerDeleted(ctx, clusterName, service); err != nil {
+		return nil, err
+	}
+	return &v1.LoadBalancerStatus{}, nil
+}
+
+// desiredLoadBalancer is the LoadBalancer derived from a Service along with the settings of the Service applied to
+// its LoadBalancerRouting and the Service itself.
+type desiredLoadBalancer struct {
+	loadBalancer         *networkingv1alpha1.LoadBalancer
+	manageRouting        bool
+	destinationLimit     destinationLimit
+	downgradedIPFamilies []v1.IPFamily
+}
+
+// getDesiredLoadBalancerForService returns the LoadBalancer with the given name derived from the Service, i.e. its
+// spec, labels and annotations after running the registered LoadBalancerMutators. It is applied by ensureLoadBalancer
+// and compared with the existing LoadBalancer to correct drift.
+func (o *onmetalLoadBalancer) getDesiredLoadBalancerForService(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node, name string) (*desiredLoadBalancer, error) {
+	appProtocols, err := getAppProtocolsForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	healthChecks, err := getHealthChecksForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	backendPorts, err := getBackendPortsForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredLoadBalancerType := getLoadBalancerTypeForService(service)
+
+	egressSNAT, err := getEgressSNATForService(service, desiredLoadBalancerType == networkingv1alpha1.LoadBalancerTypeInternal)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.FromContext(ctx).V(2).Info("Getting LoadBalancer ports from Service", "Service", client.ObjectKeyFromObject(service))
+	lbPorts, err := getLoadBalancerPortsForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	flowLogsDestination, err := getFlowLogsDestinationForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyProtocol, err := getProxyProtocolForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	manageRouting, err := isRoutingManagedForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	zoneAffinity, err := getZoneAffinityForService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationLimit, err := getDestinationLimitForService(service, o.cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateEndpointDestinationsForService(service, o.cloudConfig, o.featureGates); err != nil {
+		return nil, err
+	}
+
+	zones, err := getZonesForService(service, nodes, o.cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ipFamilies, downgradedIPFamilies, err := getIPFamiliesForService(service, o.cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	loadBalancer := &networkingv1alpha1.LoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "LoadBalancer",
+			APIVersion: networkingv1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   o.onmetalNamespace,
+			Labels:      getLoadBalancerLabelsForService(clusterName, service),
+			Annotations: getLoadBalancerIdentityAnnotationsForService(clusterName, service),
+		},
+		Spec: networkingv1alpha1.LoadBalancerSpec{
+			Type:       desiredLoadBalancerType,
+			IPFamilies: ipFamilies,
+			NetworkRef: v1.LocalObjectReference{
+				Name: o.cloudConfig.NetworkName,
+			},
+			Ports: lbPorts,
+		},
+	}
+
+	loadBalancer.Annotations[AnnotationKeyBackendPorts] = backendPorts
+	if appProtocols != "" {
+		loadBalancer.Annotations[AnnotationKeyAppProtocols] = appProtocols
+	}
+	if healthChecks != "" {
+		loadBalancer.Annotations[AnnotationKeyHealthChecks] = healthChecks
+	}
+	if egressSNAT {
+		loadBalancer.Annotations[AnnotationKeyEgressSNAT] = "true"
+	}
+	if flowLogsDestination != "" {
+		loadBalancer.Annotations[AnnotationKeyFlowLogsDestination] = flowLogsDestination
+	}
+	if proxyProtocol != "" {
+		loadBalancer.Annotations[AnnotationKeyProxyProtocol] = proxyProtocol
+	}
+	if !manageRouting {
+		loadBalancer.Annotations[AnnotationKeyManageRouting] = "false"
+	}
+	if nodePools := getNodePoolsForService(service); nodePools.Len() > 0 {
+		loadBalancer.Annotations[AnnotationKeyNodePools] = strings.Join(sets.List(nodePools), ",")
+	}
+	if zones.Len() > 0 {
+		loadBalancer.Annotations[AnnotationKeyZones] = strings.Join(sets.List(zones), ",")
+	}
+	if zoneAffinity != "" {
+		loadBalancer.Annotations[AnnotationKeyZoneAffinity] = zoneAffinity
+	}
+	if healthCheckNodePort := getHealthCheckNodePortForService(service); healthCheckNodePort > 0 {
+		loadBalancer.Annotations[AnnotationKeyHealthCheckNodePort] = strconv.Itoa(int(healthCheckNodePort))
+	}
+	if destinationLimit.max > 0 {
+		loadBalancer.Annotations[AnnotationKeyMaxDestinations] = strconv.Itoa(destinationLimit.max)
+	}
+	for key, value := range getPassThroughAnnotationsForService(service, o.cloudConfig) {
+		loadBalancer.Annotations[key] = value
+	}
+
+	// if load balancer type is Internal then update IPSource with a valid prefix template per IP family
+	if desiredLoadBalancerType == networkingv1alpha1.LoadBalancerTypeInternal {
+		ipSources, err := getInternalLoadBalancerIPSources(service, o.cloudConfig, ipFamilies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate the IP of internal LoadBalancer %s: %w", name, err)
+		}
+		loadBalancer.Spec.IPs = ipSources
+	}
+
+	// allocate the IP of a public load balancer from the prefix selected by the Service, if any
+	if publicPrefixName := service.Annotations[PublicPrefixAnnotation]; publicPrefixName != "" && desiredLoadBalancerType == networkingv1alpha1.LoadBalancerTypePublic {
+		ipSources, err := getPublicPrefixIPSources(service, publicPrefixName, ipFamilies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate the IP of LoadBalancer %s: %w", name, err)
+		}
+		loadBalancer.Spec.IPs = ipSources
+	}
+
+	setAuditAnnotations(loadBalancer, clusterName, service)
+
+	if err := mutateLoadBalancer(ctx, service, loadBalancer); err != nil {
+		return nil, err
+	}
+
+	return &desiredLoadBalancer{
+		loadBalancer:         loadBalancer,
+		manageRouting:        manageRouting,
+		destinationLimit:     destinationLimit,
+		downgradedIPFamilies: downgradedIPFamilies,
+	}, nil
+}
+
+// verifyNodePortsReachable verifies that every TCP node port of the Service is reachable on at least one destination
+// of the LoadBalancerRouting of the LoadBalancer. The destinations are dialed concurrently and the whole verification
+// is bounded by nodePortVerificationTimeout.
+func (o *onmetalLoadBalancer) verifyNodePortsReachable(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+	if err := o.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancerRouting); err != nil {
+		return fmt.Errorf("failed to get LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, nodePortVerificationTimeout)
+	defer cancel()
+	for _, svcPort := range service.Spec.Ports {
+		if svcPort.Protocol != v1.ProtocolTCP || svcPort.NodePort == 0 {
+			continue
+		}
+		if !o.isNodePortReachable(ctx, loadBalancerRouting.Destinations, svcPort.NodePort) {
+			return fmt.Errorf("node port %d of Service %s is not reachable on any destination of LoadBalancer %s", svcPort.NodePort, client.ObjectKeyFromObject(service), client.ObjectKeyFromObject(loadBalancer))
+		}
+	}
+	return nil
+}
+
+// isNodePortReachable dials the node port on the destinations concurrently and reports whether any of them accepted
+// the connection. The remaining dials are canceled once a destination is reachable.
+func (o *onmetalLoadBalancer) isNodePortReachable(ctx context.Context, destinations []networkingv1alpha1.LoadBalancerDestination, nodePort int32) bool {
+	concurrency := o.cloudConfig.DestinationResolutionConcurrency
+	if concurrency == 0 {
+		concurrency = defaultDestinationResolutionConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var reachable atomic.Bool
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for _, destination := range destinations {
+		address := net.JoinHostPort(destination.IP.String(), strconv.Itoa(int(nodePort)))
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			conn, err := o.dialContext(ctx, "tcp", address)
+			if err != nil {
+				klog.FromContext(ctx).V(4).Info("Node port is not reachable", "Address", address, "Error", err)
+				return nil
+			}
+			_ = conn.Close()
+			reachable.Store(true)
+			cancel()
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return reachable.Load()
+}
+
+// annotateServiceWithLoadBalancer records the UID and the name of the LoadBalancer in annotations of the Service, so
+// the LoadBalancer of a Service can be traced in the onmetal API and is found by its name even if the cluster is
+// renamed or the naming scheme changes.
+func (o *onmetalLoadBalancer) annotateServiceWithLoadBalancer(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	if loadBalancer.UID == "" || (service.Annotations[AnnotationKeyLoadBalancerUID] == string(loadBalancer.UID) && service.Annotations[AnnotationKeyLoadBalancerName] == loadBalancer.Name) {
+		return nil
+	}
+	service = service.DeepCopy()
+	serviceBase := service.DeepCopy()
+	metav1.SetMetaDataAnnotation(&service.ObjectMeta, AnnotationKeyLoadBalancerUID, string(loadBalancer.UID))
+	metav1.SetMetaDataAnnotation(&service.ObjectMeta, AnnotationKeyLoadBalancerName, loadBalancer.Name)
+	klog.FromContext(ctx).V(2).Info("Annotating Service with its LoadBalancer", "Service", client.ObjectKeyFromObject(service), "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	if err := o.targetClient.Patch(ctx, service, client.MergeFrom(serviceBase)); err != nil {
+		return fmt.Errorf("failed to annotate Service %s with the UID of LoadBalancer %s: %w", client.ObjectKeyFromObject(service), client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	return nil
+}
+
+// getIPFamiliesForService returns the IP families of the LoadBalancer of the Service and the IP families of the Service
+// not supported by the Network. The LoadBalancer of a PreferDualStack Service falls back to the supported IP families,
+// while other Services requesting unsupported IP families are rejected.
+func getIPFamiliesForService(service *v1.Service, cloudConfig CloudConfig) (ipFamilies, downgradedIPFamilies []v1.IPFamily, err error) {
+	if len(cloudConfig.NetworkIPFamilies) == 0 {
+		return service.Spec.IPFamilies, nil, nil
+	}
+	for _, ipFamily := range service.Spec.IPFamilies {
+		if slices.Contains(cloudConfig.NetworkIPFamilies, ipFamily) {
+			ipFamilies = append(ipFamilies, ipFamily)
+		} else {
+			downgradedIPFamilies = append(downgradedIPFamilies, ipFamily)
+		}
+	}
+	if len(downgradedIPFamilies) == 0 {
+		return ipFamilies, nil, nil
+	}
+	if len(ipFamilies) == 0 || service.Spec.IPFamilyPolicy == nil || *service.Spec.IPFamilyPolicy != v1.IPFamilyPolicyPreferDualStack {
+		return nil, nil, fmt.Errorf("IP families %v of Service %s are not supported by Network %s: %w", downgradedIPFamilies, client.ObjectKeyFromObject(service), cloudConfig.NetworkName, ErrIPFamilyNotSupported)
+	}
+	return ipFamilies, downgradedIPFamilies, nil
+}
+
+// reconcileIPFamiliesDowngradedCondition records on the Service that its LoadBalancer is provisioned without the
+// given unsupported IP families. The condition is removed once all IP families of the Service are provisioned.
+func (o *onmetalLoadBalancer) reconcileIPFamiliesDowngradedCondition(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, downgradedIPFamilies []v1.IPFamily) error {
+	service = service.DeepCopy()
+	serviceBase := service.DeepCopy()
+	message := fmt.Sprintf("LoadBalancer %s is provisioned without the IP families %v not supported by Network %s", client.ObjectKeyFromObject(loadBalancer), downgradedIPFamilies, o.cloudConfig.NetworkName)
+	if len(downgradedIPFamilies) == 0 {
+		apimeta.RemoveStatusCondition(&service.Status.Conditions, ServiceConditionIPFamiliesDowngraded)
+	} else {
+		apimeta.SetStatusCondition(&service.Status.Conditions, metav1.Condition{
+			Type:               ServiceConditionIPFamiliesDowngraded,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: service.Generation,
+			Reason:             "IPFamiliesNotSupported",
+			Message:            message,
+		})
+	}
+	if equality.Semantic.DeepEqual(serviceBase.Status, service.Status) {
+		return nil
+	}
+	if len(downgradedIPFamilies) > 0 {
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonIPFamiliesDowngraded, message)
+	}
+	klog.FromContext(ctx).V(2).Info("Updating IP families downgraded condition of Service", "Service", client.ObjectKeyFromObject(service), "DowngradedIPFamilies", downgradedIPFamilies)
+	if err := o.targetClient.Status().Patch(ctx, service, client.MergeFrom(serviceBase)); err != nil {
+		return fmt.Errorf("failed to patch status of Service %s: %w", client.ObjectKeyFromObject(service), err)
+	}
+	return nil
+}
+
+// getLoadBalancerStatusForService returns the status of the LoadBalancer, containing the IPs of the LoadBalancer
+// matching the IP families of the Service and the DNS name of the LoadBalancer if the data plane provides one.
+func getLoadBalancerStatusForService(loadBalancer *networkingv1alpha1.LoadBalancer, service *v1.Service) *v1.LoadBalancerStatus {
+	ips, _ := filterIPsByFamilies(loadBalancer.Status.IPs, service.Spec.IPFamilies)
+	ports := getIngressPortsForService(loadBalancer, service)
+	status := &v1.LoadBalancerStatus{}
+	for _, ip := range ips {
+		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{
+			IP:       ip.String(),
+			Hostname: loadBalancer.Annotations[AnnotationKeyHostname],
+			Ports:    slices.Clone(ports),
+		})
+	}
+	return status
+}
+
+// getIngressPortsForService returns the status of the ports of the Service at the LoadBalancer. Ports not programmed
+// in the spec of the LoadBalancer report the error PortNotProgrammed. If the data plane reports the allocated ports
+// of the LoadBalancer, programmed ports not allocated report the error PortNotAllocated.
+func getIngressPortsForService(loadBalancer *networkingv1alpha1.LoadBalancer, service *v1.Service) []v1.PortStatus {
+	allocatedPorts, reportsAllocatedPorts := loadBalancer.Annotations[AnnotationKeyAllocatedPorts]
+	allocated := parseAllocatedPorts(allocatedPorts)
+	var ports []v1.PortStatus
+	for _, svcPort := range service.Spec.Ports {
+		port := v1.PortStatus{Port: svcPort.Port, Protocol: svcPort.Protocol}
+		switch {
+		case !isPortProgrammed(loadBalancer, svcPort):
+			portError := portErrorNotProgrammed
+			port.Error = &portError
+		case reportsAllocatedPorts && !allocated.Has(fmt.Sprintf("%s/%d", svcPort.Protocol, svcPort.Port)):
+			portError := portErrorNotAllocated
+			port.Error = &portError
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// parseAllocatedPorts returns the <protocol>/<port> entries of the allocated ports annotation of a LoadBalancer.
+// Protocols are normalized to upper case.
+func parseAllocatedPorts(value string) sets.Set[string] {
+	allocated := sets.New[string]()
+	for _, port := range strings.Split(value, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			allocated.Insert(strings.ToUpper(port))
+		}
+	}
+	return allocated
+}
+
+// isPortProgrammed returns whether a port of the LoadBalancer covers the given Service port.
+func isPortProgrammed(loadBalancer *networkingv1alpha1.LoadBalancer, svcPort v1.ServicePort) bool {
+	for _, lbPort := range loadBalancer.Spec.Ports {
+		protocol := v1.ProtocolTCP
+		if lbPort.Protocol != nil {
+			protocol = *lbPort.Protocol
+		}
+		endPort := lbPort.Port
+		if lbPort.EndPort != nil {
+			endPort = *lbPort.EndPort
+		}
+		if protocol == svcPort.Protocol && lbPort.Port <= svcPort.Port && svcPort.Port <= endPort {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIPsByFamilies splits the IPs into the IPs matching one of the IP families and the mismatching IPs.
+// If no IP families are given, all IPs are matching.
+func filterIPsByFamilies(ips []commonv1alpha1.IP, ipFamilies []v1.IPFamily) (matching, mismatching []commonv1alpha1.IP) {
+	if len(ipFamilies) == 0 {
+		return ips, nil
+	}
+	for _, ip := range ips {
+		if slices.Contains(ipFamilies, ip.Family()) {
+			matching = append(matching, ip)
+		} else {
+			mismatching = append(mismatching, ip)
+		}
+	}
+	return matching, mismatching
+}
+
+// getLoadBalancerTypeForService decides the type of the LoadBalancer based on the annotation of the Service for
+// internal load balancers.
+func getLoadBalancerTypeForService(service *v1.Service) networkingv1alpha1.LoadBalancerType {
+	if value, ok := service.Annotations[InternalLoadBalancerAnnotation]; ok && value == "true" {
+		return networkingv1alpha1.LoadBalancerTypeInternal
+	}
+	return networkingv1alpha1.LoadBalancerTypePublic
+}
+
+func getLoadBalancerPortsForService(service *v1.Service) ([]networkingv1alpha1.LoadBalancerPort, error) {
+	endPorts, err := parsePortRanges(service.Annotations[LoadBalancerPortRangesAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotation %s of Service %s: %w", LoadBalancerPortRangesAnnotation, client.ObjectKeyFromObject(service), err)
+	}
+
+	var lbPorts []networkingv1alpha1.LoadBalancerPort
+	for _, svcPort := range service.Spec.Ports {
+		protocol := svcPort.Protocol
+		lbPort := networkingv1alpha1.LoadBalancerPort{
+			Protocol: &protocol,
+			Port:     svcPort.Port,
+		}
+		if endPort, ok := endPorts[svcPort.Port]; ok {
+			lbPort.EndPort = &endPort
+			delete(endPorts, svcPort.Port)
+		}
+		lbPorts = append(lbPorts, lbPort)
+	}
+	if len(endPorts) > 0 {
+		return nil, fmt.Errorf("port ranges of Service %s have to start at a Service port", client.ObjectKeyFromObject(service))
+	}
+	return lbPorts, nil
+}
+
+// parsePortRanges parses a comma separated list of port ranges like "10000-20000" into a map of start to end port.
+func parsePortRanges(value string) (map[int32]int32, error) {
+	portRanges := make(map[int32]int32)
+	if value == "" {
+		return portRanges, nil
+	}
+	for _, portRange := range strings.Split(value, ",") {
+		start, end, found := strings.Cut(strings.TrimSpace(portRange), "-")
+		if !found {
+			return nil, fmt.Errorf("port range %q is not of the form <port>-<end-port>", portRange)
+		}
+		startPort, err := strconv.ParseInt(start, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start port of port range %q: %w", portRange, err)
+		}
+		endPort, err := strconv.ParseInt(end, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end port of port range %q: %w", portRange, err)
+		}
+		if startPort < 1 || endPort > 65535 || startPort >= endPort {
+			return nil, fmt.Errorf("port range %q has to be within 1-65535 and end after its start", portRange)
+		}
+		portRanges[int32(startPort)] = int32(endPort)
+	}
+	return portRanges, nil
+}
+
+// getFlowLogsDestinationForService returns the flow logs destination of the Service or an empty string if flow
+// logging is not enabled.
+func getFlowLogsDestinationForService(service *v1.Service) (string, error) {
+	value, ok := service.Annotations[FlowLogsAnnotation]
+	if !ok {
+		return "", nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid annotation %s of Service %s: %w", FlowLogsAnnotation, client.ObjectKeyFromObject(service), err)
+	}
+	if !enabled {
+		return "", nil
+	}
+	destination := service.Annotations[FlowLogsDestinationAnnotation]
+	if destination == "" {
+		return "", fmt.Errorf("annotation %s is required if flow logs are enabled for Service %s", FlowLogsDestinationAnnotation, client.ObjectKeyFromObject(service))
+	}
+	return destination, nil
+}
+
+// isRoutingManagedForService reports whether the LoadBalancerRouting of the LoadBalancer of the Service is managed
+// by the cloud provider. It is managed unless the Service disables it with the ManageRoutingAnnotation.
+func isRoutingManagedForService(service *v1.Service) (bool, error) {
+	value, ok := service.Annotations[ManageRoutingAnnotation]
+	if !ok {
+		return true, nil
+	}
+	manageRouting, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid annotation %s of Service %s: %w", ManageRoutingAnnotation, client.ObjectKeyFromObject(service), err)
+	}
+	return manageRouting, nil
+}
+
+// isRoutingManagedForLoadBalancer reports whether the LoadBalancerRouting of the LoadBalancer is managed by the cloud
+// provider, see isRoutingManagedForService.
+func isRoutingManagedForLoadBalancer(loadBalancer *networkingv1alpha1.LoadBalancer) bool {
+	return loadBalancer.Annotations[AnnotationKeyManageRouting] != "false"
+}
+
+// getEgressSNATForService reports whether the destinations of the load balancer of the Service send their egress
+// traffic from the IPs of the load balancer. Egress SNAT is only supported for public load balancers.
+func getEgressSNATForService(service *v1.Service, internal bool) (bool, error) {
+	value, ok := service.Annotations[EgressSNATAnnotation]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid annotation %s of Service %s: %w", EgressSNATAnnotation, client.ObjectKeyFromObject(service), err)
+	}
+	if enabled && internal {
+		return false, fmt.Errorf("annotation %s of Service %s is not supported for internal load balancers", EgressSNATAnnotation, client.ObjectKeyFromObject(service))
+	}
+	return enabled, nil
+}
+
+// getEphemeralPrefixIPSource returns an IPSource allocating an IP of the given family from the parent Prefix.
+func getEphemeralPrefixIPSource(parentPrefixName string, ipFamily v1.IPFamily) networkingv1alpha1.IPSource {
+	return networkingv1alpha1.IPSource{
+		Ephemeral: &networkingv1alpha1.EphemeralPrefixSource{
+			PrefixTemplate: &v1alpha1.PrefixTemplateSpec{
+				Spec: v1alpha1.PrefixSpec{
+					IPFamily: ipFamily,
+					ParentRef: &v1.LocalObjectReference{
+						Name: parentPrefixName,
+					},
+				},
+			},
+		},
+	}
+}
+
+// getProxyProtocolForService returns the PROXY protocol version of the Service or an empty string if the PROXY
+// protocol is not enabled.
+func getProxyProtocolForService(service *v1.Service) (string, error) {
+	version, ok := service.Annotations[ProxyProtocolAnnotation]
+	if !ok {
+		return "", nil
+	}
+	if version != proxyProtocolV2 {
+		return "", fmt.Errorf("unsupported PROXY protocol version %q in annotation %s of Service %s, supported versions: %s", version, ProxyProtocolAnnotation, client.ObjectKeyFromObject(service), proxyProtocolV2)
+	}
+	return version, nil
+}
+
+// getPassThroughAnnotationsForService returns the annotations of the Service allowed by the loadBalancerAnnotationKeys
+// of the cloud config, which are copied verbatim onto its LoadBalancer. Only keys with the prefix
+// PassThroughAnnotationPrefix are copied, so they never collide with the annotations set by the cloud provider.
+func getPassThroughAnnotationsForService(service *v1.Service, cloudConfig CloudConfig) map[string]string {
+	annotations := make(map[string]string)
+	for _, key := range cloudConfig.LoadBalancerAnnotationKeys {
+		if !strings.HasPrefix(key, PassThroughAnnotationPrefix) {
+			continue
+		}
+		if value, ok := service.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// getHealthCheckNodePortForService returns the node port serving the health of the local endpoints of the Service or
+// zero if the Service does not use the Local external traffic policy.
+func getHealthCheckNodePortForService(service *v1.Service) int32 {
+	if service.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyLocal {
+		return 0
+	}
+	return service.Spec.HealthCheckNodePort
+}
+
+// getBackendPortsForService returns the ports the backends of the Service listen on, as a comma separated list of
+// <protocol>/<port>=<backend-port>. The backend port is the node port of a Service port. If node ports are not
+// allocated for the Service or the Service routes to its endpoints, the traffic is routed directly to the target port.
+// Named target ports are resolved per Pod, hence they are rejected if the traffic is routed to the target port.
+func getBackendPortsForService(service *v1.Service) (string, error) {
+	var backendPorts []string
+	for _, svcPort := range service.Spec.Ports {
+		backendPort := svcPort.NodePort
+		if usesEndpointDestinations(service) {
+			backendPort = 0
+		}
+		if backendPort == 0 && svcPort.TargetPort.Type == intstr.String && svcPort.TargetPort.StrVal != "" {
+			return "", fmt.Errorf("port %s/%d of Service %s targets the named port %q, which the load balancer cannot route to without node port", svcPort.Protocol, svcPort.Port, client.ObjectKeyFromObject(service), svcPort.TargetPort.StrVal)
+		}
+		if backendPort == 0 {
+			backendPort = svcPort.TargetPort.IntVal
+		}
+		if backendPort == 0 {
+			backendPort = svcPort.Port
+		}
+		backendPorts = append(backendPorts, fmt.Sprintf("%s/%d=%d", svcPort.Protocol, svcPort.Port, backendPort))
+	}
+	return strings.Join(backendPorts, ","), nil
+}
+
+// supportedAppProtocols are the application protocols of Service ports the load balancer data plane can handle.
+var supportedAppProtocols = sets.New("http", "https", "tls", "grpc")
 
-type onmetalLoadBalancer struct {
-	targetClient     client.Client
-	onmetalClient    client.Client
-	onmetalNamespace string
-	cloudConfig      CloudConfig
+// getAppProtocolsForService returns the application protocols of the Service ports as a comma separated list of
+// <protocol>/<port>=<app-protocol>. Ports without an application protocol are omitted.
+func getAppProtocolsForService(service *v1.Service) (string, error) {
+	var appProtocols []string
+	for _, svcPort := range service.Spec.Ports {
+		if svcPort.AppProtocol == nil {
+			continue
+		}
+		appProtocol := strings.ToLower(*svcPort.AppProtocol)
+		if !supportedAppProtocols.Has(appProtocol) {
+			return "", fmt.Errorf("unsupported app protocol %q of port %d of Service %s, supported app protocols are %v", *svcPort.AppProtocol, svcPort.Port, client.ObjectKeyFromObject(service), sets.List(supportedAppProtocols))
+		}
+		appProtocols = append(appProtocols, fmt.Sprintf("%s/%d=%s", svcPort.Protocol, svcPort.Port, appProtocol))
+	}
+	return strings.Join(appProtocols, ","), nil
 }
 
-func newOnmetalLoadBalancer(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig) cloudprovider.LoadBalancer {
-	return &onmetalLoadBalancer{
-		targetClient:     targetClient,
-		onmetalClient:    onmetalClient,
-		onmetalNamespace: namespace,
-		cloudConfig:      cloudConfig,
+func getLoadBalancerNameForService(clusterName string, service *v1.Service, naming LoadBalancerNaming) string {
+	if naming == LoadBalancerNamingDeterministic {
+		return getDeterministicLoadBalancerNameForService(clusterName, service)
 	}
+	nameSuffix := strings.Split(string(service.UID), "-")[0]
+	return fmt.Sprintf("%s-%s-%s", clusterName, service.Name, nameSuffix)
 }
 
-func (o *onmetalLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
-	klog.V(2).InfoS("GetLoadBalancer for Service", "Cluster", clusterName, "Service", client.ObjectKeyFromObject(service))
+// getDeterministicLoadBalancerNameForService returns <cluster>-<service-name>-<hash> with the first 10 hex digits of
+// the SHA-256 of <cluster>/<namespace>/<service-name> as hash. The cluster and service name are truncated to keep the
+// name a DNS label.
+func getDeterministicLoadBalancerNameForService(clusterName string, service *v1.Service) string {
+	hash := hashLoadBalancerName(clusterName + "/" + service.Namespace + "/" + service.Name)
+	prefix := fmt.Sprintf("%s-%s", clusterName, service.Name)
+	if maxLength := validation.DNS1123LabelMaxLength - len(hash) - 1; len(prefix) > maxLength {
+		prefix = strings.TrimRight(prefix[:maxLength], "-.")
+	}
+	return prefix + "-" + hash
+}
 
+// checkLoadBalancerNameAvailable returns ErrLoadBalancerNameCollision if a LoadBalancer of another Service with the
+// given name exists.
+func (o *onmetalLoadBalancer) checkLoadBalancerNameAvailable(ctx context.Context, name string, service *v1.Service) error {
 	loadBalancer := &networkingv1alpha1.LoadBalancer{}
-	loadBalancerName := o.GetLoadBalancerName(ctx, clusterName, service)
-	if err = o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancerName}, loadBalancer); err != nil {
-		return nil, false, fmt.Errorf("failed to get LoadBalancer %s for Service %s: %w", loadBalancerName, client.ObjectKeyFromObject(service), err)
+	if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: name}, loadBalancer); err != nil {
+		return client.IgnoreNotFound(err)
 	}
+	if serviceUID := loadBalancer.Annotations[AnnotationKeyServiceUID]; serviceUID == "" || serviceUID == string(service.UID) {
+		return nil
+	}
+	return fmt.Errorf("LoadBalancer %s belongs to Service %s/%s with UID %s: %w", client.ObjectKeyFromObject(loadBalancer),
+		loadBalancer.Annotations[AnnotationKeyServiceNamespace], loadBalancer.Annotations[AnnotationKeyServiceName], loadBalancer.Annotations[AnnotationKeyServiceUID], ErrLoadBalancerNameCollision)
+}
 
-	lbAllocatedIps := loadBalancer.Status.IPs
-	status = &v1.LoadBalancerStatus{}
-	for _, ip := range lbAllocatedIps {
-		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: ip.String()})
+// getLoadBalancerLabelsForService returns the labels identifying the LoadBalancer of the given Service.
+func getLoadBalancerLabelsForService(clusterName string, service *v1.Service) map[string]string {
+	return map[string]string{
+		LabelKeyClusterName: clusterName,
+		LabelKeyServiceUID:  string(service.UID),
 	}
-	return status, true, nil
 }
 
-func (o *onmetalLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
-	cloudprovider.DefaultLoadBalancerName(service)
-	return getLoadBalancerNameForService(clusterName, service)
+// getLoadBalancerIdentityAnnotationsForService returns the annotations recording the cluster and the Service a
+// LoadBalancer belongs to.
+func getLoadBalancerIdentityAnnotationsForService(clusterName string, service *v1.Service) map[string]string {
+	return map[string]string{
+		AnnotationKeyClusterName:      clusterName,
+		AnnotationKeyServiceName:      service.Name,
+		AnnotationKeyServiceNamespace: service.Namespace,
+		AnnotationKeyServiceUID:       string(service.UID),
+	}
 }
 
-func (o *onmetalLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	klog.V(2).InfoS("EnsureLoadBalancer for Service", "Cluster", clusterName, "Service", client.ObjectKeyFromObject(service))
+// reconcileLoadBalancerIdentity updates the labels and annotations recording the cluster and the Service of the
+// LoadBalancer if they drifted from the given Service.
+func (o *onmetalLoadBalancer) reconcileLoadBalancerIdentity(ctx context.Context, clusterName string, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	loadBalancerBase := loadBalancer.DeepCopy()
+	if loadBalancer.Labels == nil {
+		loadBalancer.Labels = make(map[string]string)
+	}
+	if loadBalancer.Annotations == nil {
+		loadBalancer.Annotations = make(map[string]string)
+	}
+	for key, value := range getLoadBalancerLabelsForService(clusterName, service) {
+		loadBalancer.Labels[key] = value
+	}
+	for key, value := range getLoadBalancerIdentityAnnotationsForService(clusterName, service) {
+		loadBalancer.Annotations[key] = value
+	}
+	if equality.Semantic.DeepEqual(loadBalancerBase.Labels, loadBalancer.Labels) && equality.Semantic.DeepEqual(loadBalancerBase.Annotations, loadBalancer.Annotations) {
+		return nil
+	}
 
-	// decide load balancer type based on service annotation for internal load balancer
-	var desiredLoadBalancerType networkingv1alpha1.LoadBalancerType
-	if value, ok := service.Annotations[InternalLoadBalancerAnnotation]; ok && value == "true" {
-		desiredLoadBalancerType = networkingv1alpha1.LoadBalancerTypeInternal
-	} else {
-		desiredLoadBalancerType = networkingv1alpha1.LoadBalancerTypePublic
+	klog.FromContext(ctx).V(2).Info("Updating drifted cluster and Service metadata of LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+	if err := o.cloudConfig.checkPatchConflictsFor("LoadBalancer", loadBalancer, loadBalancerBase); err != nil {
+		o.recordApplyConflict(service, loadBalancer, err)
+		return fmt.Errorf("failed to patch metadata of LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	if err := o.onmetalClient.Patch(ctx, loadBalancer, client.MergeFromWithOptions(loadBalancerBase, client.MergeFromWithOptimisticLock{}), o.cloudConfig.fieldOwnerFor("LoadBalancer")); err != nil {
+		return fmt.Errorf("failed to patch metadata of LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	return nil
+}
 
-	loadBalancerName := getLoadBalancerNameForService(clusterName, service)
+// reconcileLoadBalancerZones updates the zones the LoadBalancer should be placed in, which depend on the Nodes of the
+// cluster for the value "auto" of the zones annotation of the Service.
+func (o *onmetalLoadBalancer) reconcileLoadBalancerZones(ctx context.Context, service *v1.Service, nodes []*v1.Node, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	zones, err := getZonesForService(service, nodes, o.cloudConfig)
+	if err != nil {
+		return err
+	}
+	desiredZones := strings.Join(sets.List(zones), ",")
+	if loadBalancer.Annotations[AnnotationKeyZones] == desiredZones {
+		return nil
+	}
 
-	// get existing load balancer type
-	existingLoadBalancer := &networkingv1alpha1.LoadBalancer{}
-	var existingLoadBalancerType networkingv1alpha1.LoadBalancerType
-	if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancerName}, existingLoadBalancer); err == nil {
-		existingLoadBalancerType = existingLoadBalancer.Spec.Type
-		if existingLoadBalancerType != desiredLoadBalancerType {
-			if err = o.EnsureLoadBalancerDeleted(ctx, clusterName, service); err != nil {
-				return nil, fmt.Errorf("failed deleting existing loadbalancer %s: %w", loadBalancerName, err)
-			}
+	loadBalancerBase := loadBalancer.DeepCopy()
+	if desiredZones == "" {
+		delete(loadBalancer.Annotations, AnnotationKeyZones)
+	} else {
+		if loadBalancer.Annotations == nil {
+			loadBalancer.Annotations = make(map[string]string)
 		}
+		loadBalancer.Annotations[AnnotationKeyZones] = desiredZones
 	}
-
-	klog.V(2).InfoS("Getting LoadBalancer ports from Service", "Service", client.ObjectKeyFromObject(service))
-	var lbPorts []networkingv1alpha1.LoadBalancerPort
-	for _, svcPort := range service.Spec.Ports {
-		lbPorts = append(lbPorts, networkingv1alpha1.LoadBalancerPort{
-			Protocol: &svcPort.Protocol,
-			Port:     svcPort.Port,
-		})
+	klog.FromContext(ctx).V(2).Info("Updating zones of LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Zones", desiredZones)
+	if err := o.cloudConfig.checkPatchConflictsFor("LoadBalancer", loadBalancer, loadBalancerBase); err != nil {
+		o.recordApplyConflict(service, loadBalancer, err)
+		return fmt.Errorf("failed to patch zones of LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	if err := o.onmetalClient.Patch(ctx, loadBalancer, client.MergeFromWithOptions(loadBalancerBase, client.MergeFromWithOptimisticLock{}), o.cloudConfig.fieldOwnerFor("LoadBalancer")); err != nil {
+		return fmt.Errorf("failed to patch zones of LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	return nil
+}
 
-	loadBalancer := &networkingv1alpha1.LoadBalancer{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "LoadBalancer",
-			APIVersion: networkingv1alpha1.SchemeGroupVersion.String(),
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      loadBalancerName,
-			Namespace: o.onmetalNamespace,
-			Annotations: map[string]string{
-				AnnotationKeyClusterName:      clusterName,
-				AnnotationKeyServiceName:      service.Name,
-				AnnotationKeyServiceNamespace: service.Namespace,
-				AnnotationKeyServiceUID:       string(service.UID),
-			},
-		},
-		Spec: networkingv1alpha1.LoadBalancerSpec{
-			Type:       desiredLoadBalancerType,
-			IPFamilies: service.Spec.IPFamilies,
-			NetworkRef: v1.LocalObjectReference{
-				Name: o.cloudConfig.NetworkName,
-			},
-			Ports: lbPorts,
-		},
+// getLoadBalancerForService returns the LoadBalancer of the given Service. The LoadBalancer is identified by its
+// labels. LoadBalancers created before they were labeled are looked up by their name. If a previous cluster name is
+// configured, a LoadBalancer created by the previous cluster for a Service with the same namespace and name is
+// returned instead, so that it can be adopted without losing its IPs.
+func (o *onmetalLoadBalancer) getLoadBalancerForService(ctx context.Context, clusterName string, service *v1.Service) (*networkingv1alpha1.LoadBalancer, error) {
+	return o.getLoadBalancerForServiceFrom(ctx, o.onmetalClient, clusterName, service)
+}
+
+// lookupLoadBalancerForService returns the LoadBalancer of the given Service for GetLoadBalancer. The LoadBalancer is
+// read from the cache. If CachedLoadBalancerLookup is set, the onmetal API is queried if the LoadBalancer is not
+// cached (yet).
+func (o *onmetalLoadBalancer) lookupLoadBalancerForService(ctx context.Context, clusterName string, service *v1.Service) (*networkingv1alpha1.LoadBalancer, error) {
+	loadBalancer, err := o.getLoadBalancerForService(ctx, clusterName, service)
+	if !o.cloudConfig.CachedLoadBalancerLookup || o.apiReader == nil || !apierrors.IsNotFound(err) {
+		return loadBalancer, err
 	}
+	klog.FromContext(ctx).V(4).Info("LoadBalancer for Service not cached, reading from onmetal API", "Service", client.ObjectKeyFromObject(service))
+	return o.getLoadBalancerForServiceFrom(ctx, o.apiReader, clusterName, service)
+}
 
-	// if load balancer type is Internal then update IPSource with valid prefix template
-	if desiredLoadBalancerType == networkingv1alpha1.LoadBalancerTypeInternal {
-		if o.cloudConfig.PrefixName == "" {
-			return nil, fmt.Errorf("prefixName is not defined in config")
-		}
-		loadBalancer.Spec.IPs = []networkingv1alpha1.IPSource{
-			{
-				Ephemeral: &networkingv1alpha1.EphemeralPrefixSource{
-					PrefixTemplate: &v1alpha1.PrefixTemplateSpec{
-						Spec: v1alpha1.PrefixSpec{
-							// TODO: for now we only support IPv4 until Gardener has support for IPv6 based Shoots
-							IPFamily: v1.IPv4Protocol,
-							ParentRef: &v1.LocalObjectReference{
-								Name: o.cloudConfig.PrefixName,
-							},
-						},
-					},
-				},
-			},
+func (o *onmetalLoadBalancer) getLoadBalancerForServiceFrom(ctx context.Context, reader client.Reader, clusterName string, service *v1.Service) (*networkingv1alpha1.LoadBalancer, error) {
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{}
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: adoptedLoadBalancerName}, loadBalancer); err != nil {
+			return nil, err
 		}
+		return loadBalancer, nil
 	}
 
-	klog.V(2).InfoS("Applying LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
-	if err := o.onmetalClient.Patch(ctx, loadBalancer, client.Apply, loadBalancerFieldOwner, client.ForceOwnership); err != nil {
-		return nil, fmt.Errorf("failed to apply LoadBalancer %s for Service %s: %w", client.ObjectKeyFromObject(loadBalancer), client.ObjectKeyFromObject(service), err)
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := reader.List(ctx, loadBalancerList,
+		client.InNamespace(o.onmetalNamespace),
+		client.MatchingLabels(getLoadBalancerLabelsForService(clusterName, service)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+	if len(loadBalancerList.Items) > 0 {
+		return &loadBalancerList.Items[0], nil
 	}
-	klog.V(2).InfoS("Applied LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
 
-	klog.V(2).InfoS("Applying LoadBalancerRouting for LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
-	if err := o.applyLoadBalancerRoutingForLoadBalancer(ctx, loadBalancer, nodes); err != nil {
-		return nil, err
+	loadBalancer := &networkingv1alpha1.LoadBalancer{}
+	loadBalancerKey := client.ObjectKey{Namespace: o.onmetalNamespace, Name: o.GetLoadBalancerName(ctx, clusterName, service)}
+	err := reader.Get(ctx, loadBalancerKey, loadBalancer)
+	if apierrors.IsNotFound(err) && o.cloudConfig.LoadBalancerNaming != "" && o.cloudConfig.LoadBalancerNaming != LoadBalancerNamingUID {
+		// unlabeled LoadBalancers created before switching the naming scheme are found by their previous name
+		loadBalancerKey.Name = getLoadBalancerNameForService(clusterName, service, LoadBalancerNamingUID)
+		err = reader.Get(ctx, loadBalancerKey, loadBalancer)
+	}
+	if err == nil && o.cloudConfig.SharedNamespace && loadBalancer.Annotations[AnnotationKeyClusterName] != clusterName {
+		// the LoadBalancer belongs to another cluster sharing the namespace
+		err = apierrors.NewNotFound(networkingv1alpha1.Resource("loadbalancers"), loadBalancerKey.Name)
+	}
+	if serviceUID := loadBalancer.Annotations[AnnotationKeyServiceUID]; err == nil && serviceUID != "" && serviceUID != string(service.UID) {
+		// the LoadBalancer belongs to another Service with a colliding name
+		err = apierrors.NewNotFound(networkingv1alpha1.Resource("loadbalancers"), loadBalancerKey.Name)
+	}
+	if !apierrors.IsNotFound(err) || o.cloudConfig.PreviousClusterName == "" {
+		return loadBalancer, err
 	}
-	klog.V(2).InfoS("Applied LoadBalancerRouting for LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 
-	lbStatus, err := waitLoadBalancerActive(ctx, o.onmetalClient, existingLoadBalancerType, service, loadBalancer)
-	if err != nil {
-		return nil, err
+	if err := reader.List(ctx, loadBalancerList, client.InNamespace(o.onmetalNamespace)); err != nil {
+		return nil, fmt.Errorf("failed to list LoadBalancers: %w", err)
 	}
-	return &lbStatus, nil
+	for i := range loadBalancerList.Items {
+		candidate := &loadBalancerList.Items[i]
+		if isMigratedLoadBalancerForService(candidate, clusterName, o.cloudConfig.PreviousClusterName, service) {
+			klog.FromContext(ctx).V(2).Info("Found LoadBalancer of previous cluster for Service", "LoadBalancer", client.ObjectKeyFromObject(candidate), "PreviousCluster", o.cloudConfig.PreviousClusterName, "Service", client.ObjectKeyFromObject(service))
+			return candidate, nil
+		}
+	}
+	return nil, err
 }
 
-func getLoadBalancerNameForService(clusterName string, service *v1.Service) string {
-	nameSuffix := strings.Split(string(service.UID), "-")[0]
-	return fmt.Sprintf("%s-%s-%s", clusterName, service.Name, nameSuffix)
+// isMigratedLoadBalancerForService reports whether the LoadBalancer was created by the previous cluster for a Service
+// with the same namespace and name, or was already adopted by the current cluster for the given Service.
+func isMigratedLoadBalancerForService(loadBalancer *networkingv1alpha1.LoadBalancer, clusterName, previousClusterName string, service *v1.Service) bool {
+	annotations := loadBalancer.Annotations
+	if annotations[AnnotationKeyServiceNamespace] != service.Namespace || annotations[AnnotationKeyServiceName] != service.Name {
+		return false
+	}
+	switch annotations[AnnotationKeyClusterName] {
+	case previousClusterName:
+		return true
+	case clusterName:
+		return annotations[AnnotationKeyServiceUID] == string(service.UID)
+	default:
+		return false
+	}
 }
 
-func waitLoadBalancerActive(ctx context.Context, onmetalClient client.Client, existingLoadBalancerType networkingv1alpha1.LoadBalancerType,
+func waitLoadBalancerActive(ctx context.Context, onmetalClient client.Client, waiter *loadBalancerWaiter, existingLoadBalancerType networkingv1alpha1.LoadBalancerType,
 	service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) (v1.LoadBalancerStatus, error) {
-	klog.V(2).InfoS("Waiting for LoadBalancer instance to become ready", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	klog.FromContext(ctx).V(2).Info("Waiting for LoadBalancer instance to become ready", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 	backoff := wait.Backoff{
 		Duration: waitLoadbalancerInitDelay,
 		Factor:   waitLoadbalancerFactor,
+		Jitter:   retryJitter,
 		Steps:    waitLoadbalancerActiveSteps,
 	}
 
 	loadBalancerStatus := v1.LoadBalancerStatus{}
-	if err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+	condition := func(ctx context.Context) (bool, error) {
 		if err := onmetalClient.Get(ctx, client.ObjectKey{Namespace: loadBalancer.Namespace, Name: loadBalancer.Name}, loadBalancer); err != nil {
 			return false, err
 		}
-		if len(loadBalancer.Status.IPs) == 0 {
+		ips, _ := filterIPsByFamilies(loadBalancer.Status.IPs, service.Spec.IPFamilies)
+		if len(ips) == 0 {
 			return false, nil
 		}
 		lbIngress := []v1.LoadBalancerIngress{}
-		for _, ipAddr := range loadBalancer.Status.IPs {
-			lbIngress = append(lbIngress, v1.LoadBalancerIngress{IP: ipAddr.String()})
+		for _, ipAddr := range ips {
+			lbIngress = append(lbIngress, v1.LoadBalancerIngress{IP: ipAddr.String(), Hostname: loadBalancer.Annotations[AnnotationKeyHostname]})
 		}
 		loadBalancerStatus.Ingress = lbIngress
 
-		if loadBalancer.Spec.Type != existingLoadBalancerType && servicehelper.LoadBalancerStatusEqual(&service.Status.LoadBalancer, &loadBalancerStatus) {
-			return false, nil
-		}
-		return true, nil
-	}); wait.Interrupted(err) {
-		return loadBalancerStatus, fmt.Errorf("timeout waiting for the LoadBalancer %s to become ready", client.ObjectKeyFromObject(loadBalancer))
+		return isLoadBalancerProvisioned(existingLoadBalancerType, service, loadBalancer, &loadBalancerStatus), nil
+	}
+
+	var err error
+	if waiter != nil {
+		// the condition is evaluated on every change of the LoadBalancer observed by the cache, for as long as the
+		// backoff would poll
+		err = waiter.waitFor(ctx, client.ObjectKeyFromObject(loadBalancer), getBackoffDuration(backoff), condition)
+	} else {
+		err = wait.ExponentialBackoffWithContext(ctx, backoff, condition)
+	}
+	if wait.Interrupted(err) {
+		return loadBalancerStatus, fmt.Errorf("LoadBalancer %s did not become ready: %w", client.ObjectKeyFromObject(loadBalancer), ErrIPAllocationTimeout)
 	}
 
-	klog.V(2).InfoS("LoadBalancer became ready", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	klog.FromContext(ctx).V(2).Info("LoadBalancer became ready", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	observeIPAllocationDuration(loadBalancer, service, time.Now())
 	return loadBalancerStatus, nil
 }
 
-func (o *onmetalLoadBalancer) applyLoadBalancerRoutingForLoadBalancer(ctx context.Context, loadBalancer *networkingv1alpha1.LoadBalancer, nodes []*v1.Node) error {
-	loadBalacerDestinations, err := o.getLoadBalancerDestinationsForNodes(ctx, nodes, loadBalancer.Spec.NetworkRef.Name)
+// isLoadBalancerProvisioned returns true if the IPs of the LoadBalancer are allocated. If the type of the LoadBalancer
+// changed, the IPs of the previous type reported for the Service are not considered allocated.
+func isLoadBalancerProvisioned(existingLoadBalancerType networkingv1alpha1.LoadBalancerType, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, loadBalancerStatus *v1.LoadBalancerStatus) bool {
+	if len(loadBalancerStatus.Ingress) == 0 {
+		return false
+	}
+	return loadBalancer.Spec.Type == existingLoadBalancerType || !servicehelper.LoadBalancerStatusEqual(&service.Status.LoadBalancer, loadBalancerStatus)
+}
+
+// newLoadBalancerProvisioningError returns the error for a LoadBalancer whose IPs are not allocated yet. It is
+// recognized by the service controller as retry error, retrying the Service after a fixed delay without recording a
+// failure.
+func newLoadBalancerProvisioningError(loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	retryErr := cloudproviderapi.NewRetryError(fmt.Sprintf("LoadBalancer %s is being provisioned", client.ObjectKeyFromObject(loadBalancer)), loadBalancerProvisioningRetryInterval)
+	return fmt.Errorf("%w: %w", retryErr, ErrLoadBalancerProvisioning)
+}
+
+// observeIPAllocationDuration records the time from the creation of the LoadBalancer until now as the duration of its
+// IP allocation. It is only recorded once the IPs are first reported for the Service, i.e. while the Service has no
+// ingress yet.
+func observeIPAllocationDuration(loadBalancer *networkingv1alpha1.LoadBalancer, service *v1.Service, now time.Time) {
+	if len(service.Status.LoadBalancer.Ingress) > 0 || loadBalancer.CreationTimestamp.IsZero() {
+		return
+	}
+	loadBalancerIPAllocationDuration.WithLabelValues(getIPPoolForLoadBalancer(loadBalancer)).Observe(now.Sub(loadBalancer.CreationTimestamp.Time).Seconds())
+}
+
+// getIPPoolForLoadBalancer returns the name of the parent Prefix the IPs of the LoadBalancer are allocated from. IPs of
+// public LoadBalancers not allocated from a Prefix are allocated from the default pool of the onmetal API.
+func getIPPoolForLoadBalancer(loadBalancer *networkingv1alpha1.LoadBalancer) string {
+	for _, ipSource := range loadBalancer.Spec.IPs {
+		if ipSource.Ephemeral != nil && ipSource.Ephemeral.PrefixTemplate != nil && ipSource.Ephemeral.PrefixTemplate.Spec.ParentRef != nil {
+			return ipSource.Ephemeral.PrefixTemplate.Spec.ParentRef.Name
+		}
+	}
+	return "default"
+}
+
+func (o *onmetalLoadBalancer) applyLoadBalancerRoutingForLoadBalancer(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, nodes []*v1.Node, limit destinationLimit) error {
+	loadBalacerDestinations, dropped, err := o.getLoadBalancerDestinationsForService(ctx, service, nodes, loadBalancer, limit)
 	if err != nil {
 		return fmt.Errorf("failed to get NetworkInterfaces for Nodes: %w", err)
 	}
+	o.recordTruncatedDestinations(service, loadBalancer, dropped, limit)
+	o.recordIPFamiliesWithoutDestinations(service, loadBalancer, loadBalacerDestinations)
 
 	network := &networkingv1alpha1.Network{}
 	networkKey := client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancer.Spec.NetworkRef.Name}
 	if err := o.onmetalClient.Get(ctx, networkKey, network); err != nil {
-		return fmt.Errorf("failed to get Network %s: %w", o.cloudConfig.NetworkName, err)
+		return fmt.Errorf("failed to get Network %s: %w", networkKey.Name, err)
 	}
 
 	loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
@@ -251,129 +1291,487 @@ func (o *onmetalLoadBalancer) applyLoadBalancerRoutingForLoadBalancer(ctx contex
 		},
 		Destinations: loadBalacerDestinations,
 	}
+	setAuditAnnotations(loadBalancerRouting, loadBalancer.Annotations[AnnotationKeyClusterName], service)
+	if err := o.applyDestinationZones(ctx, service, loadBalancerRouting); err != nil {
+		return err
+	}
 
 	if err := controllerutil.SetOwnerReference(loadBalancer, loadBalancerRouting, o.onmetalClient.Scheme()); err != nil {
 		return fmt.Errorf("failed to set owner reference for load balancer routing %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), err)
 	}
 
-	if err := o.onmetalClient.Patch(ctx, loadBalancerRouting, client.Apply, loadBalancerFieldOwner, client.ForceOwnership); err != nil {
+	if err := applyPreservingUnknownFields(ctx, o.onmetalClient, loadBalancerRouting, o.cloudConfig.applyOptionsFor("LoadBalancerRouting")...); err != nil {
+		o.recordApplyConflict(service, loadBalancerRouting, err)
 		return fmt.Errorf("failed to apply LoadBalancerRouting %s for LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	serviceLoadBalancerMetrics.observeDestinations(o.cloudConfig.ClusterName, service, len(loadBalancerRouting.Destinations))
 	return nil
 }
 
-func (o *onmetalLoadBalancer) getLoadBalancerDestinationsForNodes(ctx context.Context, nodes []*v1.Node, networkName string) ([]networkingv1alpha1.LoadBalancerDestination, error) {
-	var loadbalancerDestinations []networkingv1alpha1.LoadBalancerDestination
-	for _, node := range nodes {
-		machineName := extractMachineNameFromProviderID(node.Spec.ProviderID)
-		machine := &computev1alpha1.Machine{}
-		if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: machineName}, machine); client.IgnoreNotFound(err) != nil {
-			return nil, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
-		}
+// recordApplyConflict reports an apply or patch to the onmetal API failing because it conflicts with fields owned by
+// another field manager. Such conflicts only occur with ApplyConflictPolicyFail.
+func (o *onmetalLoadBalancer) recordApplyConflict(service *v1.Service, obj client.Object, err error) {
+	if !isFieldManagerConflict(err) {
+		return
+	}
+	o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonApplyConflict, "Not overwriting fields of %T %s owned by other field managers: %v", obj, client.ObjectKeyFromObject(obj), err)
+}
 
-		for _, machineNIC := range machine.Spec.NetworkInterfaces {
-			networkInterface := &networkingv1alpha1.NetworkInterface{}
-			networkInterfaceName := fmt.Sprintf("%s-%s", machine.Name, machineNIC.Name)
+// isFieldManagerConflict reports whether the error is a conflict with fields owned by other field managers, as opposed
+// to e.g. a conflict of the resource version.
+func isFieldManagerConflict(err error) bool {
+	var status apierrors.APIStatus
+	if !apierrors.IsConflict(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return false
+	}
+	return slices.ContainsFunc(status.Status().Details.Causes, func(cause metav1.StatusCause) bool {
+		return cause.Type == metav1.CauseTypeFieldManagerConflict
+	})
+}
+
+// getNodePoolsForService returns the MachinePools the destinations of the load balancer of the Service are limited to.
+// An empty set does not limit the destinations.
+func getNodePoolsForService(service *v1.Service) sets.Set[string] {
+	return parseNodePools(service.Annotations[NodePoolsAnnotation])
+}
+
+// getNodePoolsForLoadBalancer returns the MachinePools the destinations of the LoadBalancer are limited to. An empty
+// set does not limit the destinations.
+func getNodePoolsForLoadBalancer(loadBalancer *networkingv1alpha1.LoadBalancer) sets.Set[string] {
+	return parseNodePools(loadBalancer.Annotations[AnnotationKeyNodePools])
+}
+
+func parseNodePools(value string) sets.Set[string] {
+	nodePools := sets.New[string]()
+	for _, nodePool := range strings.Split(value, ",") {
+		if nodePool = strings.TrimSpace(nodePool); nodePool != "" {
+			nodePools.Insert(nodePool)
+		}
+	}
+	return nodePools
+}
 
-			if machineNIC.NetworkInterfaceRef != nil {
-				networkInterfaceName = machineNIC.NetworkInterfaceRef.Name
+// getZonesForService returns the availability zones the load balancer of the Service should be placed in. For the
+// value "auto", these are the zones of the MachinePools of the Service or, without MachinePools, the zones of the
+// given Nodes. An empty set does not request any placement.
+func getZonesForService(service *v1.Service, nodes []*v1.Node, cloudConfig CloudConfig) (sets.Set[string], error) {
+	value := strings.TrimSpace(service.Annotations[ZonesAnnotation])
+	zones := sets.New[string]()
+	switch value {
+	case "":
+	case "auto":
+		if nodePools := getNodePoolsForService(service); nodePools.Len() > 0 {
+			for nodePool := range nodePools {
+				zones.Insert(cloudConfig.zoneForMachinePool(nodePool))
+			}
+			break
+		}
+		for _, node := range nodes {
+			if zone := node.Labels[v1.LabelTopologyZone]; zone != "" {
+				zones.Insert(zone)
 			}
+		}
+	default:
+		for _, zone := range strings.Split(value, ",") {
+			zone = strings.TrimSpace(zone)
+			if zone == "" {
+				return nil, fmt.Errorf("annotation %s contains an empty zone", ZonesAnnotation)
+			}
+			if msgs := validation.IsValidLabelValue(zone); len(msgs) > 0 {
+				return nil, fmt.Errorf("annotation %s contains invalid zone %q: %s", ZonesAnnotation, zone, strings.Join(msgs, ", "))
+			}
+			zones.Insert(zone)
+		}
+	}
+	return zones, nil
+}
+
+// isMachineInNodePools reports whether the Machine belongs to one of the given MachinePools. Every Machine belongs to
+// an empty set of MachinePools.
+func isMachineInNodePools(machine *computev1alpha1.Machine, nodePools sets.Set[string]) bool {
+	if nodePools.Len() == 0 {
+		return true
+	}
+	return machine.Spec.MachinePoolRef != nil && nodePools.Has(machine.Spec.MachinePoolRef.Name)
+}
+
+// destinationLimit is the maximum number of destinations of a LoadBalancer and the policy applied if it is exceeded.
+// A maximum of zero does not limit the destinations.
+type destinationLimit struct {
+	max    int
+	policy DestinationOverflowPolicy
+}
+
+// getDestinationLimitForService returns the destination limit of the load balancer of the Service. The annotations of
+// the Service take precedence over the cloud config.
+func getDestinationLimitForService(service *v1.Service, cloudConfig CloudConfig) (destinationLimit, error) {
+	limit := destinationLimit{max: cloudConfig.MaxDestinations, policy: cloudConfig.DestinationOverflowPolicy}
+	if value, ok := service.Annotations[MaxDestinationsAnnotation]; ok {
+		maxDestinations, err := strconv.Atoi(value)
+		if err != nil || maxDestinations < 0 {
+			return destinationLimit{}, fmt.Errorf("invalid annotation %s of Service %s: must be a non-negative integer", MaxDestinationsAnnotation, client.ObjectKeyFromObject(service))
+		}
+		limit.max = maxDestinations
+	}
+	if value, ok := service.Annotations[DestinationOverflowPolicyAnnotation]; ok {
+		limit.policy = DestinationOverflowPolicy(value)
+		if err := validateDestinationOverflowPolicy(limit.policy); err != nil {
+			return destinationLimit{}, fmt.Errorf("invalid annotation %s of Service %s: %w", DestinationOverflowPolicyAnnotation, client.ObjectKeyFromObject(service), err)
+		}
+	}
+	if limit.policy == "" {
+		limit.policy = DestinationOverflowPolicyError
+	}
+	return limit, nil
+}
+
+// withinRoutingCapacity returns the limit capped to the maximum number of destinations of a LoadBalancerRouting.
+// Destinations exceeding the capacity of the LoadBalancerRouting are always truncated, as applying them would fail.
+func (l destinationLimit) withinRoutingCapacity() destinationLimit {
+	if l.max == 0 || l.max > maxLoadBalancerRoutingDestinations {
+		return destinationLimit{max: maxLoadBalancerRoutingDestinations, policy: DestinationOverflowPolicyTruncate}
+	}
+	return l
+}
+
+// recordTruncatedDestinations reports the destinations dropped from the LoadBalancer of the Service.
+func (o *onmetalLoadBalancer) recordTruncatedDestinations(service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, dropped int, limit destinationLimit) {
+	if dropped == 0 {
+		return
+	}
+	truncatedLoadBalancerDestinations.Add(float64(dropped))
+	if capped := limit.withinRoutingCapacity(); capped != limit {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonDestinationsTruncated, "Dropped %d destinations of LoadBalancer %s exceeding the maximum of %d destinations of a LoadBalancerRouting", dropped, client.ObjectKeyFromObject(loadBalancer), capped.max)
+		return
+	}
+	o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonDestinationsTruncated, "Dropped %d destinations of LoadBalancer %s exceeding the maximum of %d destinations", dropped, client.ObjectKeyFromObject(loadBalancer), limit.max)
+}
+
+// getLoadBalancerDestinationsForNodes returns the destinations of the given IP families of the given Nodes within the
+// given limit and the number of destinations dropped to stay within the limit.
+func (o *onmetalLoadBalancer) getLoadBalancerDestinationsForNodes(ctx context.Context, nodes []*v1.Node, networkName string, ipFamilies []v1.IPFamily, nodePools sets.Set[string], limit destinationLimit) ([]networkingv1alpha1.LoadBalancerDestination, int, error) {
+	concurrency := o.cloudConfig.DestinationResolutionConcurrency
+	if concurrency == 0 {
+		concurrency = defaultDestinationResolutionConcurrency
+	}
+
+	// resolve the destinations of every node concurrently, keeping the order of the nodes
+	nodeDestinations := make([][]networkingv1alpha1.LoadBalancerDestination, len(nodes))
+	nodeErrs := make([]error, len(nodes))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i, node := range nodes {
+		i, node := i, node
+		g.Go(func() error {
+			nodeDestinations[i], nodeErrs[i] = o.getLoadBalancerDestinationsForNode(gctx, node, networkName, ipFamilies, nodePools)
+			return nodeErrs[i]
+		})
+	}
+	_ = g.Wait()
+
+	var errs []error
+	for _, err := range nodeErrs {
+		// skip the errors of nodes canceled because resolving another node failed
+		if err == nil || (errors.Is(err, context.Canceled) && ctx.Err() == nil) {
+			continue
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, 0, errors.Join(errs...)
+	}
+
+	count := 0
+	for _, destinations := range nodeDestinations {
+		count += len(destinations)
+	}
+	if limit.max > 0 && count > limit.max {
+		if limit.policy != DestinationOverflowPolicyTruncate {
+			return nil, 0, fmt.Errorf("%d destinations exceed the maximum of %d destinations", count, limit.max)
+		}
+		nodeDestinations = truncateDestinationsByZone(nodes, nodeDestinations, limit.max)
+	}
+
+	var loadbalancerDestinations []networkingv1alpha1.LoadBalancerDestination
+	for _, destinations := range nodeDestinations {
+		loadbalancerDestinations = append(loadbalancerDestinations, destinations...)
+	}
+	return loadbalancerDestinations, count - len(loadbalancerDestinations), nil
+}
+
+// truncateDestinationsByZone keeps at most max of the destinations of the given Nodes, picking them round-robin from
+// the zones of the Nodes so the kept destinations are spread evenly across the zones. Within a zone, destinations are
+// picked in the order of the Nodes. The order of the kept destinations is preserved.
+func truncateDestinationsByZone(nodes []*v1.Node, nodeDestinations [][]networkingv1alpha1.LoadBalancerDestination, max int) [][]networkingv1alpha1.LoadBalancerDestination {
+	type position struct{ node, destination int }
+	zoneQueues := make(map[string][]position)
+	for i, node := range nodes {
+		zone := node.Labels[v1.LabelTopologyZone]
+		for j := range nodeDestinations[i] {
+			zoneQueues[zone] = append(zoneQueues[zone], position{node: i, destination: j})
+		}
+	}
+	zones := make([]string, 0, len(zoneQueues))
+	for zone := range zoneQueues {
+		zones = append(zones, zone)
+	}
+	slices.Sort(zones)
 
-			if err := o.onmetalClient.Get(ctx, client.ObjectKey{Namespace: o.onmetalNamespace, Name: networkInterfaceName}, networkInterface); err != nil {
-				return nil, fmt.Errorf("failed to get network interface %s for machine %s: %w", client.ObjectKeyFromObject(networkInterface), client.ObjectKeyFromObject(machine), err)
+	kept := sets.New[position]()
+	for kept.Len() < max {
+		for _, zone := range zones {
+			if queue := zoneQueues[zone]; len(queue) > 0 && kept.Len() < max {
+				kept.Insert(queue[0])
+				zoneQueues[zone] = queue[1:]
 			}
+		}
+	}
 
-			// If the NetworkInterface is not part of Network we continue
-			if networkInterface.Spec.NetworkRef.Name != networkName {
-				continue
+	truncated := make([][]networkingv1alpha1.LoadBalancerDestination, len(nodeDestinations))
+	for i, destinations := range nodeDestinations {
+		for j, destination := range destinations {
+			if kept.Has(position{node: i, destination: j}) {
+				truncated[i] = append(truncated[i], destination)
 			}
+		}
+	}
+	return truncated
+}
 
-			// Create a LoadBalancerDestination for every NetworkInterface IP
-			for _, nicIP := range networkInterface.Status.IPs {
-				loadbalancerDestinations = append(loadbalancerDestinations, networkingv1alpha1.LoadBalancerDestination{
-					IP: nicIP,
-					TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{
-						UID:        networkInterface.UID,
-						Name:       networkInterface.Name,
-						ProviderID: networkInterface.Spec.ProviderID,
-					},
-				})
+func (o *onmetalLoadBalancer) getLoadBalancerDestinationsForNode(ctx context.Context, node *v1.Node, networkName string, ipFamilies []v1.IPFamily, nodePools sets.Set[string]) ([]networkingv1alpha1.LoadBalancerDestination, error) {
+	// a Node recreated under a new name shares its Machine with the stale Node, whose destinations must not be
+	// routed twice
+	if o.machineNodeIndex != nil && o.machineNodeIndex.IsNodeReplaced(node) {
+		klog.FromContext(ctx).V(2).Info("Skipping LoadBalancer destinations of replaced Node", "Node", node.Name)
+		return nil, nil
+	}
+
+	machine, err := getMachineForNode(ctx, o.onmetalClient, node, getMachineNamespaces(o.onmetalNamespace, o.cloudConfig), getMachineClusterName(o.cloudConfig))
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get machine object for node %s: %w", node.Name, err)
+	}
+
+	// Machines which are shut down must not receive any traffic
+	if o.cloudConfig.TaintShutdownMachines && o.cloudConfig.isMachineShutdown(machine) {
+		klog.FromContext(ctx).V(2).Info("Skipping LoadBalancer destinations of shut down Machine", "Machine", client.ObjectKeyFromObject(machine), "Node", node.Name)
+		return nil, nil
+	}
+
+	if !isMachineInNodePools(machine, nodePools) {
+		klog.FromContext(ctx).V(4).Info("Skipping LoadBalancer destinations of Machine outside of the node pools", "Machine", client.ObjectKeyFromObject(machine), "Node", node.Name, "NodePools", sets.List(nodePools))
+		return nil, nil
+	}
+
+	return getLoadBalancerDestinationsForMachine(ctx, o.onmetalClient, machine, networkName, ipFamilies)
+}
+
+// getLoadBalancerDestinationsForMachine returns a destination for every IP of the given IP families of the
+// NetworkInterfaces of the Machine in the given Network.
+func getLoadBalancerDestinationsForMachine(ctx context.Context, onmetalClient client.Client, machine *computev1alpha1.Machine, networkName string, ipFamilies []v1.IPFamily) ([]networkingv1alpha1.LoadBalancerDestination, error) {
+	var loadbalancerDestinations []networkingv1alpha1.LoadBalancerDestination
+	for _, machineNIC := range machine.Spec.NetworkInterfaces {
+		networkInterface := &networkingv1alpha1.NetworkInterface{}
+		networkInterfaceName := getMachineNetworkInterfaceName(machine, machineNIC)
+
+		if err := onmetalClient.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: networkInterfaceName}, networkInterface); err != nil {
+			return nil, fmt.Errorf("failed to get network interface %s for machine %s: %w", client.ObjectKeyFromObject(networkInterface), client.ObjectKeyFromObject(machine), err)
+		}
+
+		// If the NetworkInterface is not part of Network we continue
+		if networkInterface.Spec.NetworkRef.Name != networkName {
+			continue
+		}
+
+		// Create a LoadBalancerDestination for every NetworkInterface IP of the IP families of the LoadBalancer
+		for _, nicIP := range networkInterface.Status.IPs {
+			if !isLoadBalancerDestinationIPFamily(nicIP.Family(), ipFamilies) {
+				continue
 			}
+			loadbalancerDestinations = append(loadbalancerDestinations, networkingv1alpha1.LoadBalancerDestination{
+				IP: nicIP,
+				TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{
+					UID:        networkInterface.UID,
+					Name:       networkInterface.Name,
+					ProviderID: networkInterface.Spec.ProviderID,
+				},
+			})
 		}
 	}
 	return loadbalancerDestinations, nil
 }
 
-func extractMachineNameFromProviderID(providerID string) string {
-	lastSlash := strings.LastIndex(providerID, "/")
-	if lastSlash == -1 || lastSlash+1 >= len(providerID) {
-		return ""
+func getMachineNetworkInterfaceName(machine *computev1alpha1.Machine, machineNIC computev1alpha1.NetworkInterface) string {
+	if machineNIC.NetworkInterfaceRef != nil {
+		return machineNIC.NetworkInterfaceRef.Name
 	}
-	return providerID[lastSlash+1:]
+	return fmt.Sprintf("%s-%s", machine.Name, machineNIC.Name)
 }
 
 func (o *onmetalLoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
-	klog.V(2).InfoS("Updating LoadBalancer for Service", "Service", client.ObjectKeyFromObject(service))
-	if len(nodes) == 0 {
+	ctx = withServiceLogger(ctx, clusterName, service)
+	ctx, span := startSpan(ctx, "UpdateLoadBalancer", serviceAttributes(clusterName, service)...)
+	err := o.updateLoadBalancer(ctx, clusterName, service, nodes)
+	endSpan(span, err)
+	if err == nil {
+		serviceLoadBalancerMetrics.observeSync(o.cloudConfig.ClusterName, service, nil)
+	}
+	return err
+}
+
+func (o *onmetalLoadBalancer) updateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	klog.FromContext(ctx).V(2).Info("Updating LoadBalancer for Service")
+	if len(nodes) == 0 && !usesEndpointDestinations(service) {
 		return fmt.Errorf("no Nodes available for LoadBalancer Service %s", client.ObjectKeyFromObject(service))
 	}
 
-	loadBalancerName := o.GetLoadBalancerName(ctx, clusterName, service)
-	loadBalancer := &networkingv1alpha1.LoadBalancer{}
-	loadBalancerKey := client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancerName}
-	if err := o.onmetalClient.Get(ctx, loadBalancerKey, loadBalancer); err != nil {
-		return fmt.Errorf("failed to get LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	loadBalancer, err := o.getLoadBalancerForService(ctx, clusterName, service)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get LoadBalancer %s: %w: %w", o.GetLoadBalancerName(ctx, clusterName, service), ErrLoadBalancerNotFound, err)
+		}
+		return fmt.Errorf("failed to get LoadBalancer %s: %w", o.GetLoadBalancerName(ctx, clusterName, service), err)
+	}
+
+	// adopted load balancers are never modified
+	if getAdoptedLoadBalancerName(service) == "" {
+		if err := o.reconcileLoadBalancerIdentity(ctx, clusterName, service, loadBalancer); err != nil {
+			return err
+		}
+
+		if err := o.reconcileLoadBalancerZones(ctx, service, nodes, loadBalancer); err != nil {
+			return err
+		}
+	}
+
+	manageRouting, err := isRoutingManagedForService(service)
+	if err != nil {
+		return err
+	}
+	if !manageRouting {
+		klog.FromContext(ctx).V(2).Info("Not managing LoadBalancerRouting of LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+		return nil
 	}
 
 	loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
-	loadBalancerRoutingKey := client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancerName}
+	loadBalancerRoutingKey := client.ObjectKey{Namespace: o.onmetalNamespace, Name: loadBalancer.Name}
 	if err := o.onmetalClient.Get(ctx, loadBalancerRoutingKey, loadBalancerRouting); err != nil {
 		return fmt.Errorf("failed to get LoadBalancerRouting %s for LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), client.ObjectKeyFromObject(loadBalancerRouting), err)
 	}
 
-	klog.V(2).InfoS("Updating LoadBalancerRouting destinations for LoadBalancer", "LoadBalancerRouting", client.ObjectKeyFromObject(loadBalancerRouting), "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
-	loadBalancerDestinations, err := o.getLoadBalancerDestinationsForNodes(ctx, nodes, loadBalancer.Spec.NetworkRef.Name)
+	klog.FromContext(ctx).V(2).Info("Updating LoadBalancerRouting destinations for LoadBalancer", "LoadBalancerRouting", client.ObjectKeyFromObject(loadBalancerRouting), "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	destinationLimit, err := getDestinationLimitForService(service, o.cloudConfig)
+	if err != nil {
+		return err
+	}
+	loadBalancerDestinations, dropped, err := o.getLoadBalancerDestinationsForService(ctx, service, nodes, loadBalancer, destinationLimit)
 	if err != nil {
 		return fmt.Errorf("failed to get NetworkInterfaces for LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	o.recordTruncatedDestinations(service, loadBalancer, dropped, destinationLimit)
+	o.recordIPFamiliesWithoutDestinations(service, loadBalancer, loadBalancerDestinations)
 	loadBalancerRoutingBase := loadBalancerRouting.DeepCopy()
 	loadBalancerRouting.Destinations = loadBalancerDestinations
+	setAuditAnnotations(loadBalancerRouting, clusterName, service)
+	if err := o.applyDestinationZones(ctx, service, loadBalancerRouting); err != nil {
+		return err
+	}
 
-	if err := o.onmetalClient.Patch(ctx, loadBalancerRouting, client.MergeFrom(loadBalancerRoutingBase)); err != nil {
+	if err := o.cloudConfig.checkPatchConflictsFor("LoadBalancerRouting", loadBalancerRouting, loadBalancerRoutingBase); err != nil {
+		o.recordApplyConflict(service, loadBalancerRouting, err)
+		return fmt.Errorf("failed to patch LoadBalancerRouting %s for LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	if err := patchPreservingUnknownFields(ctx, o.onmetalClient, loadBalancerRouting, loadBalancerRoutingBase, o.cloudConfig.fieldOwnerFor("LoadBalancerRouting")); err != nil {
 		return fmt.Errorf("failed to patch LoadBalancerRouting %s for LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	serviceLoadBalancerMetrics.observeDestinations(o.cloudConfig.ClusterName, service, len(loadBalancerRouting.Destinations))
 
-	klog.V(2).InfoS("Updated LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+	klog.FromContext(ctx).V(2).Info("Updated LoadBalancer for Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 	return nil
 }
 
 func (o *onmetalLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	ctx = withServiceLogger(ctx, clusterName, service)
+	ctx, span := startSpan(ctx, "EnsureLoadBalancerDeleted", serviceAttributes(clusterName, service)...)
+	err := o.ensureLoadBalancerDeleted(ctx, clusterName, service)
+	endSpan(span, err)
+	if err == nil {
+		serviceLoadBalancerMetrics.forget(o.cloudConfig.ClusterName, service)
+	}
+	return err
+}
+
+func (o *onmetalLoadBalancer) ensureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if o.dnsRecords != nil && !o.cloudConfig.DryRun && !o.cloudConfig.Observer {
+		if err := o.dnsRecords.DeleteRecord(ctx, service); err != nil {
+			return err
+		}
+	}
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		return o.releaseAdoptedLoadBalancer(ctx, service, adoptedLoadBalancerName)
+	}
 	loadBalancerName := o.GetLoadBalancerName(ctx, clusterName, service)
+	if existingLoadBalancer, err := o.getLoadBalancerForService(ctx, clusterName, service); err == nil {
+		loadBalancerName = existingLoadBalancer.Name
+	}
 	loadBalancer := &networkingv1alpha1.LoadBalancer{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: o.onmetalNamespace,
 			Name:      loadBalancerName,
 		},
 	}
-	klog.V(2).InfoS("Deleting LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	klog.FromContext(ctx).V(2).Info("Deleting LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 	if err := o.onmetalClient.Delete(ctx, loadBalancer); err != nil {
 		if apierrors.IsNotFound(err) {
-			klog.V(2).InfoS("LoadBalancer is already gone", client.ObjectKeyFromObject(loadBalancer))
+			klog.FromContext(ctx).V(2).Info("LoadBalancer is already gone", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 			return nil
 		}
 		return fmt.Errorf("failed to delete loadbalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
 	}
+	if o.cloudConfig.DryRun {
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonDryRun, "Dry-run: deleted LoadBalancer %s", client.ObjectKeyFromObject(loadBalancer))
+		return nil
+	}
+	if o.cloudConfig.Observer {
+		// the Service must keep its finalizer until the active cloud provider deleted the load balancer
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonObserved, "Observer: LoadBalancer %s would be deleted", client.ObjectKeyFromObject(loadBalancer))
+		return fmt.Errorf("observer: not deleting LoadBalancer %s", client.ObjectKeyFromObject(loadBalancer))
+	}
 	if err := waitForDeletingLoadBalancer(ctx, service, o.onmetalClient, loadBalancer); err != nil {
 		return err
 	}
 	return nil
 }
 
+// observeLoadBalancer reports whether the current LoadBalancer of the Service drifted from the desired LoadBalancer
+// and returns the status of the current LoadBalancer, so the status of the Service is the same as reported by the
+// active cloud provider.
+func (o *onmetalLoadBalancer) observeLoadBalancer(ctx context.Context, service *v1.Service, desired *networkingv1alpha1.LoadBalancer) (*v1.LoadBalancerStatus, error) {
+	current := &networkingv1alpha1.LoadBalancer{}
+	if err := o.onmetalClient.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonObserved, "Observer: LoadBalancer %s would be created", client.ObjectKeyFromObject(desired))
+		}
+		return nil, fmt.Errorf("observer: failed to get LoadBalancer %s: %w", client.ObjectKeyFromObject(desired), err)
+	}
+	drift, err := hasDrift(ctx, o.onmetalClient, desired)
+	if err != nil {
+		return nil, fmt.Errorf("observer: failed to compute drift of LoadBalancer %s: %w", client.ObjectKeyFromObject(desired), err)
+	}
+	if drift {
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonObserved, "Observer: LoadBalancer %s drifted from the desired state", client.ObjectKeyFromObject(desired))
+	}
+	return getLoadBalancerStatusForService(current, service), nil
+}
+
 func waitForDeletingLoadBalancer(ctx context.Context, service *v1.Service, onmetalClient client.Client, loadBalancer *networkingv1alpha1.LoadBalancer) error {
-	klog.V(2).InfoS("Waiting for LoadBalancer instance to be deleted", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	klog.FromContext(ctx).V(2).Info("Waiting for LoadBalancer instance to be deleted", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 	backoff := wait.Backoff{
 		Duration: waitLoadbalancerInitDelay,
 		Factor:   waitLoadbalancerFactor,
+		Jitter:   retryJitter,
 		Steps:    waitLoadbalancerActiveSteps,
 	}
 
@@ -386,6 +1784,6 @@ func waitForDeletingLoadBalancer(ctx context.Context, service *v1.Service, onmet
 		return fmt.Errorf("timeout waiting for the LoadBalancer %s to be deleted", client.ObjectKeyFromObject(loadBalancer))
 	}
 
-	klog.V(2).InfoS("Deleted LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+	klog.FromContext(ctx).V(2).Info("Deleted LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
 	return nil
 }
@@ -0,0 +1,189 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	eventReasonAdoptionFailed = "AdoptionFailed"
+)
+
+// getAdoptedLoadBalancerName returns the name of the pre-existing LoadBalancer adopted by the Service, or an empty
+// string if the LoadBalancer of the Service is managed by the cloud provider.
+func getAdoptedLoadBalancerName(service *v1.Service) string {
+	return service.Annotations[LoadBalancerNameAnnotation]
+}
+
+// validateAdoptedLoadBalancerNameForService returns an error if the load balancer name annotation of the Service is
+// invalid.
+func validateAdoptedLoadBalancerNameForService(service *v1.Service) error {
+	name, ok := service.Annotations[LoadBalancerNameAnnotation]
+	if !ok {
+		return nil
+	}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		return fmt.Errorf("annotation %s is not a valid LoadBalancer name: %s", LoadBalancerNameAnnotation, strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// ensureAdoptedLoadBalancer fronts the pre-existing LoadBalancer of the given name with the Service. The LoadBalancer
+// itself is never modified, only its LoadBalancerRouting is managed.
+func (o *onmetalLoadBalancer) ensureAdoptedLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node, loadBalancerName string) (*v1.LoadBalancerStatus, error) {
+	loadBalancer, err := o.getLoadBalancerForService(ctx, clusterName, service)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonAdoptionFailed, "LoadBalancer %s to adopt does not exist", loadBalancerName)
+			return nil, fmt.Errorf("failed to get LoadBalancer %s to adopt: %w: %w", loadBalancerName, ErrLoadBalancerNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to get LoadBalancer %s to adopt: %w", loadBalancerName, err)
+	}
+	if err := validateAdoptedLoadBalancer(loadBalancer, service, o.cloudConfig); err != nil {
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonAdoptionFailed, err.Error())
+		return nil, err
+	}
+
+	destinationLimit, err := getDestinationLimitForService(service, o.cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEndpointDestinationsForService(service, o.cloudConfig, o.featureGates); err != nil {
+		return nil, err
+	}
+
+	manageRouting, err := isRoutingManagedForService(service)
+	if err != nil {
+		return nil, err
+	}
+	if manageRouting {
+		klog.V(2).InfoS("Applying LoadBalancerRouting for adopted LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+		if err := o.applyLoadBalancerRoutingForLoadBalancer(ctx, service, loadBalancer, nodes, destinationLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	lbStatus := getLoadBalancerStatusForService(loadBalancer, service)
+	if o.cloudConfig.DryRun || o.cloudConfig.Observer {
+		return lbStatus, nil
+	}
+	if len(lbStatus.Ingress) == 0 {
+		klog.V(2).InfoS("Adopted LoadBalancer has no IPs yet", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+		return nil, newLoadBalancerProvisioningError(loadBalancer)
+	}
+	if err := reconcileDNSRecord(ctx, o.dnsRecords, service, lbStatus); err != nil {
+		return nil, err
+	}
+	return lbStatus, nil
+}
+
+// validateAdoptedLoadBalancer returns an error if the LoadBalancer cannot be adopted by the Service, i.e. if it is
+// managed for another Service, is in another Network, is of another type or does not expose all ports of the Service.
+func validateAdoptedLoadBalancer(loadBalancer *networkingv1alpha1.LoadBalancer, service *v1.Service, cloudConfig CloudConfig) error {
+	loadBalancerKey := client.ObjectKeyFromObject(loadBalancer)
+	if serviceUID := loadBalancer.Labels[LabelKeyServiceUID]; serviceUID != "" && serviceUID != string(service.UID) {
+		return fmt.Errorf("LoadBalancer %s is managed for another Service: %w", loadBalancerKey, ErrLoadBalancerNotAdoptable)
+	}
+	if networkName := loadBalancer.Spec.NetworkRef.Name; networkName != cloudConfig.NetworkName {
+		return fmt.Errorf("LoadBalancer %s is in Network %s instead of %s: %w", loadBalancerKey, networkName, cloudConfig.NetworkName, ErrNetworkMismatch)
+	}
+
+	desiredLoadBalancerType := networkingv1alpha1.LoadBalancerTypePublic
+	if service.Annotations[InternalLoadBalancerAnnotation] == "true" {
+		desiredLoadBalancerType = networkingv1alpha1.LoadBalancerTypeInternal
+	}
+	if loadBalancer.Spec.Type != desiredLoadBalancerType {
+		return fmt.Errorf("LoadBalancer %s is of type %s instead of %s: %w", loadBalancerKey, loadBalancer.Spec.Type, desiredLoadBalancerType, ErrLoadBalancerNotAdoptable)
+	}
+
+	servicePorts, err := getLoadBalancerPortsForService(service)
+	if err != nil {
+		return err
+	}
+	for _, servicePort := range servicePorts {
+		if !isLoadBalancerPortExposed(loadBalancer.Spec.Ports, servicePort) {
+			return fmt.Errorf("LoadBalancer %s does not expose %s port %s: %w", loadBalancerKey, getLoadBalancerPortProtocol(servicePort), formatLoadBalancerPort(servicePort), ErrLoadBalancerNotAdoptable)
+		}
+	}
+	return nil
+}
+
+// isLoadBalancerPortExposed reports whether one of the ports of a LoadBalancer covers the whole port range of the
+// given port with the same protocol.
+func isLoadBalancerPortExposed(loadBalancerPorts []networkingv1alpha1.LoadBalancerPort, port networkingv1alpha1.LoadBalancerPort) bool {
+	for _, loadBalancerPort := range loadBalancerPorts {
+		if getLoadBalancerPortProtocol(loadBalancerPort) != getLoadBalancerPortProtocol(port) {
+			continue
+		}
+		if loadBalancerPort.Port <= port.Port && getLoadBalancerEndPort(loadBalancerPort) >= getLoadBalancerEndPort(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func getLoadBalancerPortProtocol(port networkingv1alpha1.LoadBalancerPort) v1.Protocol {
+	if port.Protocol == nil {
+		return v1.ProtocolTCP
+	}
+	return *port.Protocol
+}
+
+func getLoadBalancerEndPort(port networkingv1alpha1.LoadBalancerPort) int32 {
+	if port.EndPort == nil {
+		return port.Port
+	}
+	return *port.EndPort
+}
+
+func formatLoadBalancerPort(port networkingv1alpha1.LoadBalancerPort) string {
+	if port.EndPort == nil {
+		return fmt.Sprint(port.Port)
+	}
+	return fmt.Sprintf("%d-%d", port.Port, *port.EndPort)
+}
+
+// releaseAdoptedLoadBalancer deletes the LoadBalancerRouting of the LoadBalancer adopted by the Service unless the
+// Service disables the management of the LoadBalancerRouting. The LoadBalancer itself is left untouched.
+func (o *onmetalLoadBalancer) releaseAdoptedLoadBalancer(ctx context.Context, service *v1.Service, loadBalancerName string) error {
+	// an invalid annotation must not block the deletion of the Service
+	if manageRouting, err := isRoutingManagedForService(service); err == nil && !manageRouting {
+		return nil
+	}
+	loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+	loadBalancerRouting.Namespace = o.onmetalNamespace
+	loadBalancerRouting.Name = loadBalancerName
+	if o.cloudConfig.Observer {
+		// the Service must keep its finalizer until the active cloud provider released the load balancer
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonObserved, "Observer: LoadBalancerRouting %s of adopted LoadBalancer would be deleted", client.ObjectKeyFromObject(loadBalancerRouting))
+		return fmt.Errorf("observer: not deleting LoadBalancerRouting %s", client.ObjectKeyFromObject(loadBalancerRouting))
+	}
+	klog.V(2).InfoS("Deleting LoadBalancerRouting of adopted LoadBalancer", "LoadBalancerRouting", client.ObjectKeyFromObject(loadBalancerRouting), "Service", client.ObjectKeyFromObject(service))
+	if err := o.onmetalClient.Delete(ctx, loadBalancerRouting); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer adoption", func() {
+	var (
+		service      *corev1.Service
+		loadBalancer *networkingv1alpha1.LoadBalancer
+		cloudConfig  CloudConfig
+	)
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "service",
+				UID:         "service-uid",
+				Annotations: map[string]string{LoadBalancerNameAnnotation: "hand-crafted"},
+			},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 443},
+					{Protocol: corev1.ProtocolUDP, Port: 53},
+				},
+			},
+		}
+		tcp, udp := corev1.ProtocolTCP, corev1.ProtocolUDP
+		endPort := int32(1024)
+		loadBalancer = &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "hand-crafted"},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				Type:       networkingv1alpha1.LoadBalancerTypePublic,
+				NetworkRef: corev1.LocalObjectReference{Name: "network"},
+				Ports: []networkingv1alpha1.LoadBalancerPort{
+					{Protocol: &tcp, Port: 1, EndPort: &endPort},
+					{Protocol: &udp, Port: 53},
+				},
+			},
+		}
+		cloudConfig = CloudConfig{NetworkName: "network"}
+	})
+
+	It("should accept load balancers exposing all ports of the service", func() {
+		Expect(validateAdoptedLoadBalancer(loadBalancer, service, cloudConfig)).To(Succeed())
+	})
+
+	It("should reject load balancers not exposing a port of the service", func() {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Protocol: corev1.ProtocolUDP, Port: 443})
+		err := validateAdoptedLoadBalancer(loadBalancer, service, cloudConfig)
+		Expect(err).To(MatchError(ErrLoadBalancerNotAdoptable))
+		Expect(err).To(MatchError(ContainSubstring("does not expose UDP port 443")))
+	})
+
+	It("should reject load balancers of another network, type or service", func() {
+		Expect(validateAdoptedLoadBalancer(loadBalancer, service, CloudConfig{NetworkName: "other"})).To(MatchError(ErrNetworkMismatch))
+
+		service.Annotations[InternalLoadBalancerAnnotation] = "true"
+		Expect(validateAdoptedLoadBalancer(loadBalancer, service, cloudConfig)).To(MatchError(ErrLoadBalancerNotAdoptable))
+		delete(service.Annotations, InternalLoadBalancerAnnotation)
+
+		loadBalancer.Labels = map[string]string{LabelKeyServiceUID: "other-uid"}
+		Expect(validateAdoptedLoadBalancer(loadBalancer, service, cloudConfig)).To(MatchError(ContainSubstring("managed for another Service")))
+	})
+
+	It("should resolve the adopted load balancer by its name", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", cloudConfig, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+
+		Expect(lb.GetLoadBalancerName(ctx, "test", service)).To(Equal("hand-crafted"))
+		Expect(lb.getLoadBalancerForService(ctx, "test", service)).To(HaveField("Name", "hand-crafted"))
+	})
+
+	It("should fail with an event if the load balancer to adopt does not exist", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).Build()
+		recorder := record.NewFakeRecorder(10)
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", cloudConfig, nil, recorder, nil, nil)
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ErrLoadBalancerNotFound))
+		Expect(recorder.Events).To(Receive(ContainSubstring("LoadBalancer hand-crafted to adopt does not exist")))
+	})
+
+	It("should only delete the routing of an adopted load balancer", func(ctx SpecContext) {
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "hand-crafted"},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer, loadBalancerRouting).Build()
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", cloudConfig, nil, record.NewFakeRecorder(10), nil, nil)
+
+		Expect(lb.EnsureLoadBalancerDeleted(ctx, "test", service)).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Satisfy(apierrors.IsNotFound))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+
+	It("should validate the load balancer name annotation", func() {
+		Expect(validateAdoptedLoadBalancerNameForService(service)).To(Succeed())
+		service.Annotations[LoadBalancerNameAnnotation] = "Hand_Crafted"
+		Expect(validateAdoptedLoadBalancerNameForService(service)).To(MatchError(ContainSubstring("is not a valid LoadBalancer name")))
+	})
+})
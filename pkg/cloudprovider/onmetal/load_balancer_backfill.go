@@ -0,0 +1,90 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// backfillLoadBalancerLabels labels the LoadBalancers created before LoadBalancers were identified by labels with the
+// cluster and the UID of their Service. Afterwards they are found by their labels even if the name derived from the
+// Service changes between releases. The Service of a LoadBalancer is resolved by the identity annotations of the
+// LoadBalancer or, for LoadBalancers without annotations, by the name derived from the Service.
+func (o *onmetalLoadBalancer) backfillLoadBalancerLabels(ctx context.Context, clusterName string) error {
+	unlabeledRequirement, err := labels.NewRequirement(LabelKeyServiceUID, selection.DoesNotExist, nil)
+	if err != nil {
+		return err
+	}
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := o.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(o.onmetalNamespace),
+		client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*unlabeledRequirement)},
+	); err != nil {
+		return fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+	if len(loadBalancerList.Items) == 0 {
+		return nil
+	}
+
+	serviceList := &v1.ServiceList{}
+	if err := o.targetClient.List(ctx, serviceList); err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+	servicesByUID := make(map[string]*v1.Service)
+	servicesByLoadBalancerName := make(map[string]*v1.Service)
+	for i := range serviceList.Items {
+		service := &serviceList.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		servicesByUID[string(service.UID)] = service
+		servicesByLoadBalancerName[getLoadBalancerNameForService(clusterName, service, LoadBalancerNamingUID)] = service
+	}
+
+	var errs []error
+	for i := range loadBalancerList.Items {
+		loadBalancer := &loadBalancerList.Items[i]
+		var service *v1.Service
+		switch loadBalancer.Annotations[AnnotationKeyClusterName] {
+		case clusterName:
+			service = servicesByUID[loadBalancer.Annotations[AnnotationKeyServiceUID]]
+		case "":
+			service = servicesByLoadBalancerName[loadBalancer.Name]
+		default:
+			// the LoadBalancer belongs to another cluster sharing the namespace
+			continue
+		}
+		if service == nil {
+			klog.V(2).InfoS("Not labeling LoadBalancer without Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer))
+			continue
+		}
+
+		klog.V(2).InfoS("Labeling LoadBalancer with its cluster and Service", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+		if err := o.reconcileLoadBalancerIdentity(ctx, clusterName, service, loadBalancer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// convertedServiceReconciler deletes the LoadBalancers of Services converted from type LoadBalancer to another type.
+// The service controller deletes them by EnsureLoadBalancerDeleted, but LoadBalancers survive if the conversion was
+// missed, e.g. while the cloud provider was down and the cleanup finalizer had been removed from the Service.
+type convertedServiceReconciler struct {
+	targetClient client.Client
+	loadBalancer *onmetalLoadBalancer
+	clusterName  string
+	queue        workqueue.RateLimitingInterface
+}
+
+func newConvertedServiceReconciler(targetClient client.Client, loadBalancer *onmetalLoadBalancer, clusterName string) *convertedServiceReconciler {
+	return &convertedServiceReconciler{
+		targetClient: targetClient,
+		loadBalancer: loadBalancer,
+		clusterName:  clusterName,
+		queue:        workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "converted-services"}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the reconciler at the Service informer of the given cache. All
+// Services not of type LoadBalancer are checked once the informer synced and on every resync, later on only Services
+// converted from type LoadBalancer.
+func (r *convertedServiceReconciler) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &corev1.Service{})
+	if err != nil {
+		return fmt.Errorf("failed to get Service informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if service, ok := obj.(*corev1.Service); ok && service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+				r.queue.Add(client.ObjectKeyFromObject(service))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldService, oldOK := oldObj.(*corev1.Service)
+			newService, newOK := newObj.(*corev1.Service)
+			if !oldOK || !newOK || newService.Spec.Type == corev1.ServiceTypeLoadBalancer {
+				return
+			}
+			if oldService.Spec.Type == corev1.ServiceTypeLoadBalancer || oldService.ResourceVersion == newService.ResourceVersion {
+				r.queue.Add(client.ObjectKeyFromObject(newService))
+			}
+		},
+	})
+	return err
+}
+
+// Start processes queued Services until the context is done.
+func (r *convertedServiceReconciler) Start(ctx context.Context) {
+	defer r.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (r *convertedServiceReconciler) processNextItem(ctx context.Context) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	serviceKey := item.(client.ObjectKey)
+	if err := r.reconcile(ctx, serviceKey); err != nil {
+		klog.ErrorS(err, "Failed to clean up LoadBalancer of converted Service", "Service", serviceKey)
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *convertedServiceReconciler) reconcile(ctx context.Context, serviceKey client.ObjectKey) error {
+	service := &corev1.Service{}
+	if err := r.targetClient.Get(ctx, serviceKey, service); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		return nil
+	}
+
+	exists, err := r.hasLoadBalancerObjects(ctx, service)
+	if err != nil || !exists {
+		return err
+	}
+	klog.InfoS("Deleting LoadBalancer of Service converted to another type", "Service", serviceKey, "Type", service.Spec.Type)
+	return r.loadBalancer.ensureLoadBalancerDeleted(ctx, r.clusterName, service)
+}
+
+// hasLoadBalancerObjects returns whether onmetal objects of the LoadBalancer of the Service are left, i.e. the
+// LoadBalancer labeled for the Service or the LoadBalancerRouting of the LoadBalancer adopted by the Service. Unlabeled
+// LoadBalancers are not considered, their names might have been taken over by other Services meanwhile.
+func (r *convertedServiceReconciler) hasLoadBalancerObjects(ctx context.Context, service *corev1.Service) (bool, error) {
+	if adoptedLoadBalancerName := getAdoptedLoadBalancerName(service); adoptedLoadBalancerName != "" {
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+		if err := r.loadBalancer.onmetalClient.Get(ctx, client.ObjectKey{Namespace: r.loadBalancer.onmetalNamespace, Name: adoptedLoadBalancerName}, loadBalancerRouting); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to get LoadBalancerRouting %s: %w", adoptedLoadBalancerName, err)
+		}
+		return true, nil
+	}
+
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := r.loadBalancer.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(r.loadBalancer.onmetalNamespace),
+		client.MatchingLabels(getLoadBalancerLabelsForService(r.clusterName, service)),
+	); err != nil {
+		return false, fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+	return len(loadBalancerList.Items) > 0, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Converted service cleanup", func() {
+	var (
+		service      *corev1.Service
+		loadBalancer *networkingv1alpha1.LoadBalancer
+	)
+
+	newReconciler := func(objects ...client.Object) (*convertedServiceReconciler, client.Client) {
+		targetClient := fake.NewClientBuilder().WithObjects(service).Build()
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(objects...).Build()
+		lb := newOnmetalLoadBalancer(targetClient, onmetalClient, onmetalClient, "onmetal", CloudConfig{ClusterName: "test"}, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+		return newConvertedServiceReconciler(targetClient, lb, "test"), onmetalClient
+	}
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", UID: "service-uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		}
+		loadBalancer = &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      "lb",
+				Labels:    getLoadBalancerLabelsForService("test", service),
+			},
+		}
+	})
+
+	It("should delete the load balancer of a service converted to another type", func(ctx SpecContext) {
+		reconciler, onmetalClient := newReconciler(loadBalancer)
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(service))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should not delete the load balancer of a service of type LoadBalancer", func(ctx SpecContext) {
+		service.Spec.Type = corev1.ServiceTypeLoadBalancer
+		reconciler, onmetalClient := newReconciler(loadBalancer)
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(service))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+
+	It("should not delete unlabeled load balancers", func(ctx SpecContext) {
+		loadBalancer.Labels = nil
+		loadBalancer.Name = getLoadBalancerNameForService("test", service, LoadBalancerNamingUID)
+		reconciler, onmetalClient := newReconciler(loadBalancer)
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(service))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+
+	It("should only release the load balancer adopted by a converted service", func(ctx SpecContext) {
+		service.Annotations = map[string]string{LoadBalancerNameAnnotation: "hand-crafted"}
+		loadBalancer.Name = "hand-crafted"
+		loadBalancer.Labels = nil
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "hand-crafted"},
+		}
+		reconciler, onmetalClient := newReconciler(loadBalancer, loadBalancerRouting)
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(service))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Satisfy(apierrors.IsNotFound))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+})
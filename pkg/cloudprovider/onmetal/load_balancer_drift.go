@@ -0,0 +1,152 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	loadBalancerDriftCheckInterval = 5 * time.Minute
+
+	eventReasonLoadBalancerDriftCorrected = "LoadBalancerDriftCorrected"
+)
+
+// loadBalancerDriftReconciler periodically compares the LoadBalancers of the cluster with the LoadBalancers derived
+// from their Services and patches the drifted fields if a LoadBalancer was changed out-of-band, e.g. its ports or
+// annotations were removed. Without it, such changes are only corrected by the next sync of the Service.
+type loadBalancerDriftReconciler struct {
+	targetClient client.Client
+	loadBalancer *onmetalLoadBalancer
+	clusterName  string
+}
+
+func newLoadBalancerDriftReconciler(targetClient client.Client, loadBalancer *onmetalLoadBalancer, clusterName string) *loadBalancerDriftReconciler {
+	return &loadBalancerDriftReconciler{
+		targetClient: targetClient,
+		loadBalancer: loadBalancer,
+		clusterName:  clusterName,
+	}
+}
+
+// Start periodically corrects the drift of the LoadBalancers until the context is done.
+func (r *loadBalancerDriftReconciler) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.sync(ctx); err != nil {
+			klog.FromContext(ctx).Error(err, "Failed to correct drift of LoadBalancers")
+		}
+	}, loadBalancerDriftCheckInterval)
+}
+
+func (r *loadBalancerDriftReconciler) sync(ctx context.Context) error {
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := r.loadBalancer.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(r.loadBalancer.onmetalNamespace),
+		client.MatchingLabels{LabelKeyClusterName: r.clusterName},
+	); err != nil {
+		return fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+	if len(loadBalancerList.Items) == 0 {
+		return nil
+	}
+
+	serviceList := &corev1.ServiceList{}
+	if err := r.targetClient.List(ctx, serviceList); err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+	servicesByUID := make(map[string]*corev1.Service)
+	for i := range serviceList.Items {
+		service := &serviceList.Items[i]
+		servicesByUID[string(service.UID)] = service
+	}
+
+	nodes, err := r.loadBalancer.getLoadBalancerNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range loadBalancerList.Items {
+		loadBalancer := &loadBalancerList.Items[i]
+		// LoadBalancers without Service are left to the repair sweep and the converted service reconciler
+		service := servicesByUID[loadBalancer.Labels[LabelKeyServiceUID]]
+		if !isLoadBalancerDriftCorrectable(service) {
+			continue
+		}
+		drifted, err := r.loadBalancer.correctLoadBalancerDrift(ctx, r.clusterName, service, loadBalancer, nodes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(drifted) > 0 {
+			r.loadBalancer.recorder.Eventf(service, corev1.EventTypeNormal, eventReasonLoadBalancerDriftCorrected, "Corrected drift of the %s of LoadBalancer %s", strings.Join(drifted, " and "), client.ObjectKeyFromObject(loadBalancer))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isLoadBalancerDriftCorrectable reports whether the drift of the LoadBalancer of the Service is corrected. The
+// LoadBalancers of Services without ports are deleted by the service controller, adopted LoadBalancers are not
+// derived from their Service.
+func isLoadBalancerDriftCorrectable(service *corev1.Service) bool {
+	return service != nil && service.Spec.Type == corev1.ServiceTypeLoadBalancer && service.DeletionTimestamp.IsZero() &&
+		len(service.Spec.Ports) > 0 && getAdoptedLoadBalancerName(service) == ""
+}
+
+// correctLoadBalancerDrift patches the fields of the LoadBalancer drifted from the LoadBalancer derived from the
+// Service by getDesiredLoadBalancerForService and returns them. Only the drifted fields are written, its
+// LoadBalancerRouting and the Service are left to the service controller. A LoadBalancer of another type or in
+// another Network is not corrected, as it had to be recreated.
+func (o *onmetalLoadBalancer) correctLoadBalancerDrift(ctx context.Context, clusterName string, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, nodes []*corev1.Node) ([]string, error) {
+	loadBalancerKey := client.ObjectKeyFromObject(loadBalancer)
+	desired, err := o.getDesiredLoadBalancerForService(ctx, clusterName, service, nodes, loadBalancer.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired LoadBalancer %s: %w", loadBalancerKey, err)
+	}
+	drifted, err := getDriftedFields(desired.loadBalancer, loadBalancer)
+	if err != nil || len(drifted) == 0 {
+		return nil, err
+	}
+	if slices.Contains(drifted, "spec.type") || slices.Contains(drifted, "spec.networkRef") {
+		return nil, fmt.Errorf("LoadBalancer %s is of type %s in Network %s instead of type %s in Network %s, not recreating it",
+			loadBalancerKey, loadBalancer.Spec.Type, loadBalancer.Spec.NetworkRef.Name, desired.loadBalancer.Spec.Type, desired.loadBalancer.Spec.NetworkRef.Name)
+	}
+
+	klog.FromContext(ctx).Info("Correcting drift of LoadBalancer", "LoadBalancer", loadBalancerKey, "Service", client.ObjectKeyFromObject(service), "Fields", drifted)
+	loadBalancerBase := loadBalancer.DeepCopy()
+	if err := setDriftedFields(desired.loadBalancer, loadBalancer, drifted); err != nil {
+		return nil, fmt.Errorf("failed to set drifted fields of LoadBalancer %s: %w", loadBalancerKey, err)
+	}
+	if err := o.cloudConfig.checkPatchConflictsFor("LoadBalancer", loadBalancer, loadBalancerBase); err != nil {
+		o.recordApplyConflict(service, loadBalancer, err)
+		return nil, fmt.Errorf("failed to correct drift of LoadBalancer %s: %w", loadBalancerKey, err)
+	}
+	if err := patchPreservingUnknownFields(ctx, o.onmetalClient, loadBalancer, loadBalancerBase, o.cloudConfig.fieldOwnerFor("LoadBalancer")); err != nil {
+		return nil, fmt.Errorf("failed to correct drift of LoadBalancer %s: %w", loadBalancerKey, err)
+	}
+	return drifted, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer drift", func() {
+	var (
+		recorder *record.FakeRecorder
+		applied  []string
+		patched  []string
+		service  *corev1.Service
+	)
+
+	newProvider := func(onmetalObjs ...client.Object) *onmetalLoadBalancer {
+		targetClient := fake.NewClientBuilder().WithObjects(service).WithStatusSubresource(&corev1.Service{}).Build()
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(onmetalObjs...).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if patch.Type() == types.ApplyPatchType {
+					applied = append(applied, obj.GetObjectKind().GroupVersionKind().Kind)
+					return nil
+				}
+				patched = append(patched, obj.GetName())
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		return &onmetalLoadBalancer{
+			targetClient:     targetClient,
+			onmetalClient:    onmetalClient,
+			onmetalNamespace: "foo",
+			cloudConfig:      CloudConfig{ClusterName: "test", NetworkName: "network", AsyncLoadBalancerStatus: true},
+			recorder:         recorder,
+		}
+	}
+
+	newLoadBalancer := func(ctx context.Context) *networkingv1alpha1.LoadBalancer {
+		desired, err := newProvider().getDesiredLoadBalancerForService(ctx, "test", service, nil, "lb")
+		Expect(err).NotTo(HaveOccurred())
+		return desired.loadBalancer
+	}
+
+	newReconciler := func(onmetalObjs ...client.Object) *loadBalancerDriftReconciler {
+		lb := newProvider(onmetalObjs...)
+		return newLoadBalancerDriftReconciler(lb.targetClient, lb, "test")
+	}
+
+	getLoadBalancer := func(ctx context.Context, r *loadBalancerDriftReconciler) *networkingv1alpha1.LoadBalancer {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{}
+		Expect(r.loadBalancer.onmetalClient.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "lb"}, loadBalancer)).To(Succeed())
+		return loadBalancer
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		applied = nil
+		patched = nil
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", UID: "service-uid"},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80}, {Protocol: corev1.ProtocolTCP, Port: 443}},
+			},
+		}
+	})
+
+	It("should patch the ports of a load balancer drifted from the service", func(ctx SpecContext) {
+		loadBalancer := newLoadBalancer(ctx)
+		loadBalancer.Spec.Ports = loadBalancer.Spec.Ports[:1]
+		r := newReconciler(loadBalancer)
+
+		Expect(r.sync(ctx)).To(Succeed())
+		Expect(getLoadBalancer(ctx, r).Spec.Ports).To(HaveExactElements(HaveField("Port", int32(80)), HaveField("Port", int32(443))))
+		Expect(patched).To(ConsistOf("lb"))
+		Expect(applied).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Corrected drift of the spec.ports of LoadBalancer foo/lb")))
+	})
+
+	It("should patch the annotations derived from the service and its mutators", func(ctx SpecContext) {
+		loadBalancerMutatorsMu.Lock()
+		registered := loadBalancerMutators
+		loadBalancerMutators = []LoadBalancerMutator{LoadBalancerMutatorFunc(func(ctx context.Context, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+			loadBalancer.Annotations["example.com/mutated"] = "true"
+			return nil
+		})}
+		loadBalancerMutatorsMu.Unlock()
+		DeferCleanup(func() {
+			loadBalancerMutatorsMu.Lock()
+			loadBalancerMutators = registered
+			loadBalancerMutatorsMu.Unlock()
+		})
+		service.Annotations = map[string]string{HealthCheckAnnotationPrefix + "443": "HTTPS:/healthz"}
+		loadBalancer := newLoadBalancer(ctx)
+		Expect(loadBalancer.Annotations).To(HaveKey("example.com/mutated"))
+		delete(loadBalancer.Annotations, "example.com/mutated")
+		delete(loadBalancer.Annotations, AnnotationKeyHealthChecks)
+		loadBalancer.Annotations["other"] = "annotation"
+		r := newReconciler(loadBalancer)
+
+		Expect(r.sync(ctx)).To(Succeed())
+		Expect(getLoadBalancer(ctx, r).Annotations).To(SatisfyAll(
+			HaveKeyWithValue("example.com/mutated", "true"),
+			HaveKey(AnnotationKeyHealthChecks),
+			HaveKeyWithValue("other", "annotation"),
+		))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Corrected drift of the annotations of LoadBalancer foo/lb")))
+	})
+
+	It("should leave load balancers without drift alone", func(ctx SpecContext) {
+		r := newReconciler(newLoadBalancer(ctx))
+
+		Expect(r.sync(ctx)).To(Succeed())
+		Expect(patched).To(BeEmpty())
+		Expect(applied).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should not recreate load balancers of another type", func(ctx SpecContext) {
+		loadBalancer := newLoadBalancer(ctx)
+		loadBalancer.Spec.Type = networkingv1alpha1.LoadBalancerTypeInternal
+		loadBalancer.Spec.Ports = nil
+		r := newReconciler(loadBalancer)
+
+		Expect(r.sync(ctx)).To(MatchError(ContainSubstring("not recreating it")))
+		Expect(getLoadBalancer(ctx, r).Spec.Type).To(Equal(networkingv1alpha1.LoadBalancerTypeInternal))
+		Expect(patched).To(BeEmpty())
+		Expect(applied).To(BeEmpty())
+	})
+
+	It("should leave load balancers of services being deleted, without ports or adopted alone", func(ctx SpecContext) {
+		loadBalancer := newLoadBalancer(ctx)
+		loadBalancer.Spec.Ports = nil
+
+		now := metav1.Now()
+		service.DeletionTimestamp = &now
+		service.Finalizers = []string{"service.kubernetes.io/load-balancer-cleanup"}
+		Expect(newReconciler(loadBalancer.DeepCopy()).sync(ctx)).To(Succeed())
+
+		service.DeletionTimestamp = nil
+		service.Spec.Ports = nil
+		Expect(newReconciler(loadBalancer.DeepCopy()).sync(ctx)).To(Succeed())
+
+		service.Spec.Ports = []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80}}
+		service.Annotations = map[string]string{LoadBalancerNameAnnotation: "lb"}
+		Expect(newReconciler(loadBalancer.DeepCopy()).sync(ctx)).To(Succeed())
+
+		Expect(patched).To(BeEmpty())
+		Expect(applied).To(BeEmpty())
+	})
+})
@@ -0,0 +1,252 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// usesEndpointDestinations reports whether the LoadBalancer of the Service routes to the addresses of the
+// EndpointSlices of the Service instead of its Nodes.
+func usesEndpointDestinations(service *corev1.Service) bool {
+	return service.Annotations[EndpointDestinationsAnnotation] == "true" && len(service.Spec.Selector) == 0
+}
+
+// validateEndpointDestinationsForService returns an error if the endpoint destinations annotation of the Service is
+// invalid or not supported for the Service.
+func validateEndpointDestinationsForService(service *corev1.Service, cloudConfig CloudConfig, featureGates featuregate.FeatureGate) error {
+	value, ok := service.Annotations[EndpointDestinationsAnnotation]
+	if !ok || value == "false" {
+		return nil
+	}
+	switch {
+	case value != "true":
+		return fmt.Errorf("annotation %s of Service %s must be either \"true\" or \"false\"", EndpointDestinationsAnnotation, client.ObjectKeyFromObject(service))
+	case len(service.Spec.Selector) > 0:
+		return fmt.Errorf("annotation %s of Service %s is only supported for Services without selector", EndpointDestinationsAnnotation, client.ObjectKeyFromObject(service))
+	case !cloudConfig.isEndpointDestinationsEnabled(featureGates):
+		return fmt.Errorf("annotation %s of Service %s is not supported, endpointDestinations is not enabled in the cloud config nor by the %s feature gate", EndpointDestinationsAnnotation, client.ObjectKeyFromObject(service), DirectPodRouting)
+	}
+	return nil
+}
+
+// getLoadBalancerDestinationsForService returns the destinations of the LoadBalancer of the Service, either the
+// NetworkInterfaces of the given Nodes or the addresses of the EndpointSlices of the Service, and the number of
+// destinations dropped because of the destination limit. Only destinations of the IP families of the LoadBalancer are
+// returned, grouped by IP family. The destinations are truncated to the capacity of a LoadBalancerRouting regardless of
+// the destination limit.
+func (o *onmetalLoadBalancer) getLoadBalancerDestinationsForService(ctx context.Context, service *corev1.Service, nodes []*corev1.Node, loadBalancer *networkingv1alpha1.LoadBalancer, limit destinationLimit) ([]networkingv1alpha1.LoadBalancerDestination, int, error) {
+	limit = limit.withinRoutingCapacity()
+	ipFamilies := loadBalancer.Spec.IPFamilies
+	if !usesEndpointDestinations(service) {
+		destinations, dropped, err := o.getLoadBalancerDestinationsForNodes(ctx, nodes, loadBalancer.Spec.NetworkRef.Name, ipFamilies, getNodePoolsForLoadBalancer(loadBalancer), limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		return groupLoadBalancerDestinationsByIPFamily(destinations, ipFamilies), dropped, nil
+	}
+
+	destinations, err := o.getLoadBalancerDestinationsForEndpoints(ctx, service, loadBalancer.Spec.NetworkRef.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+	destinations = groupLoadBalancerDestinationsByIPFamily(destinations, ipFamilies)
+	if limit.max > 0 && len(destinations) > limit.max {
+		if limit.policy != DestinationOverflowPolicyTruncate {
+			return nil, 0, fmt.Errorf("%d destinations exceed the maximum of %d destinations", len(destinations), limit.max)
+		}
+		return destinations[:limit.max], len(destinations) - limit.max, nil
+	}
+	return destinations, 0, nil
+}
+
+// getLoadBalancerDestinationsForEndpoints returns a destination for every address of the ready endpoints of the
+// EndpointSlices of the Service, sorted by IP. Addresses of NetworkInterfaces in the network of the LoadBalancer
+// reference their NetworkInterface, addresses of external backends are routed to as is.
+func (o *onmetalLoadBalancer) getLoadBalancerDestinationsForEndpoints(ctx context.Context, service *corev1.Service, networkName string) ([]networkingv1alpha1.LoadBalancerDestination, error) {
+	endpointSliceList := &discoveryv1.EndpointSliceList{}
+	if err := o.targetClient.List(ctx, endpointSliceList,
+		client.InNamespace(service.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: service.Name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list EndpointSlices of Service %s: %w", client.ObjectKeyFromObject(service), err)
+	}
+
+	nicList := &networkingv1alpha1.NetworkInterfaceList{}
+	if err := o.onmetalClient.List(ctx, nicList,
+		client.InNamespace(o.onmetalNamespace),
+		client.MatchingFields{networkInterfaceSpecNetworkRefNameField: networkName},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list NetworkInterfaces in Network %s: %w", networkName, err)
+	}
+	nicsByIP := make(map[string]*networkingv1alpha1.NetworkInterface)
+	for i := range nicList.Items {
+		nic := &nicList.Items[i]
+		for _, ip := range nic.Status.IPs {
+			nicsByIP[ip.String()] = nic
+		}
+	}
+
+	var destinations []networkingv1alpha1.LoadBalancerDestination
+	seen := sets.New[string]()
+	for _, endpointSlice := range endpointSliceList.Items {
+		if endpointSlice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		for _, endpoint := range endpointSlice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				ip, err := commonv1alpha1.ParseIP(address)
+				if err != nil {
+					klog.V(2).InfoS("Ignoring invalid endpoint address", "Service", client.ObjectKeyFromObject(service), "EndpointSlice", client.ObjectKeyFromObject(&endpointSlice), "Address", address)
+					continue
+				}
+				if seen.Has(ip.String()) {
+					continue
+				}
+				seen.Insert(ip.String())
+
+				destination := networkingv1alpha1.LoadBalancerDestination{IP: ip}
+				if nic, ok := nicsByIP[ip.String()]; ok {
+					destination.TargetRef = &networkingv1alpha1.LoadBalancerTargetRef{
+						UID:        nic.UID,
+						Name:       nic.Name,
+						ProviderID: nic.Spec.ProviderID,
+					}
+				}
+				destinations = append(destinations, destination)
+			}
+		}
+	}
+	sort.Slice(destinations, func(i, j int) bool {
+		return destinations[i].IP.String() < destinations[j].IP.String()
+	})
+	return destinations, nil
+}
+
+// endpointDestinationsReconciler updates the LoadBalancerRoutings of Services routing to the addresses of their
+// EndpointSlices once the EndpointSlices change. The Service controller only updates LoadBalancers on changes of the
+// Service or the Nodes.
+type endpointDestinationsReconciler struct {
+	targetClient client.Client
+	loadBalancer *onmetalLoadBalancer
+	clusterName  string
+	queue        workqueue.RateLimitingInterface
+}
+
+func newEndpointDestinationsReconciler(targetClient client.Client, loadBalancer *onmetalLoadBalancer, clusterName string) *endpointDestinationsReconciler {
+	return &endpointDestinationsReconciler{
+		targetClient: targetClient,
+		loadBalancer: loadBalancer,
+		clusterName:  clusterName,
+		queue:        workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "endpoint-destinations"}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the reconciler at the EndpointSlice informer of the given cache.
+func (r *endpointDestinationsReconciler) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &discoveryv1.EndpointSlice{})
+	if err != nil {
+		return fmt.Errorf("failed to get EndpointSlice informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueue(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			r.enqueue(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			r.enqueue(obj)
+		},
+	})
+	return err
+}
+
+func (r *endpointDestinationsReconciler) enqueue(obj interface{}) {
+	endpointSlice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	if serviceName := endpointSlice.Labels[discoveryv1.LabelServiceName]; serviceName != "" {
+		r.queue.Add(client.ObjectKey{Namespace: endpointSlice.Namespace, Name: serviceName})
+	}
+}
+
+// Start processes queued Services until the context is done.
+func (r *endpointDestinationsReconciler) Start(ctx context.Context) {
+	defer r.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (r *endpointDestinationsReconciler) processNextItem(ctx context.Context) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	serviceKey := item.(client.ObjectKey)
+	if err := r.reconcile(ctx, serviceKey); err != nil {
+		klog.ErrorS(err, "Failed to reconcile endpoint destinations of Service", "Service", serviceKey)
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *endpointDestinationsReconciler) reconcile(ctx context.Context, serviceKey client.ObjectKey) error {
+	service := &corev1.Service{}
+	if err := r.targetClient.Get(ctx, serviceKey, service); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer || !usesEndpointDestinations(service) || !service.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		// the LoadBalancer is created with the current destinations by EnsureLoadBalancer
+		return nil
+	}
+	if manageRouting, err := isRoutingManagedForService(service); err != nil || !manageRouting {
+		return err
+	}
+	return r.loadBalancer.updateLoadBalancer(ctx, r.clusterName, service, nil)
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("Endpoint destinations", func() {
+	newService := func(annotations map[string]string, selector map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "external", Annotations: annotations},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeLoadBalancer,
+				Selector: selector,
+				Ports: []corev1.ServicePort{{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       443,
+					NodePort:   30443,
+					TargetPort: intstr.FromInt(8443),
+				}},
+			},
+		}
+	}
+
+	It("should validate the endpoint destinations annotation", func() {
+		enabled := CloudConfig{EndpointDestinations: true}
+		annotated := map[string]string{EndpointDestinationsAnnotation: "true"}
+
+		Expect(validateEndpointDestinationsForService(newService(annotated, nil), enabled, nil)).To(Succeed())
+		Expect(validateEndpointDestinationsForService(newService(map[string]string{EndpointDestinationsAnnotation: "false"}, map[string]string{"app": "foo"}), CloudConfig{}, nil)).To(Succeed())
+		Expect(validateEndpointDestinationsForService(newService(map[string]string{EndpointDestinationsAnnotation: "yes"}, nil), enabled, nil)).To(MatchError(ContainSubstring("must be either")))
+		Expect(validateEndpointDestinationsForService(newService(annotated, map[string]string{"app": "foo"}), enabled, nil)).To(MatchError(ContainSubstring("without selector")))
+		Expect(validateEndpointDestinationsForService(newService(annotated, nil), CloudConfig{}, nil)).To(MatchError(ContainSubstring("not enabled")))
+	})
+
+	It("should route to the target ports of a service using endpoint destinations", func() {
+		Expect(getBackendPortsForService(newService(nil, nil))).To(Equal("TCP/443=30443"))
+		Expect(getBackendPortsForService(newService(map[string]string{EndpointDestinationsAnnotation: "true"}, nil))).To(Equal("TCP/443=8443"))
+
+		By("rejecting named target ports")
+		service := newService(map[string]string{EndpointDestinationsAnnotation: "true"}, nil)
+		service.Spec.Ports[0].TargetPort = intstr.FromString("https")
+		_, err := getBackendPortsForService(service)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should build destinations from the ready endpoint addresses matched to network interfaces", func(ctx SpecContext) {
+		service := newService(map[string]string{EndpointDestinationsAnnotation: "true"}, nil)
+		notReady := false
+		endpointSlice := &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "external-abc",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "external"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"192.168.0.10"}},
+				{Addresses: []string{"10.0.0.1"}},
+				{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+				{Addresses: []string{"10.0.0.1"}},
+			},
+		}
+		otherEndpointSlice := &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "other-abc",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "other"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.3"}}},
+		}
+		networkInterface := &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "vm-primary", UID: "nic-uid"},
+			Spec: networkingv1alpha1.NetworkInterfaceSpec{
+				NetworkRef: corev1.LocalObjectReference{Name: "network"},
+				ProviderID: "nic://vm-primary",
+			},
+			Status: networkingv1alpha1.NetworkInterfaceStatus{
+				IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+			},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				NetworkRef: corev1.LocalObjectReference{Name: "network"},
+			},
+		}
+
+		targetClient := fake.NewClientBuilder().WithObjects(service, endpointSlice, otherEndpointSlice).Build()
+		onmetalClient := fake.NewClientBuilder().
+			WithScheme(onmetalScheme).
+			WithObjects(networkInterface).
+			WithIndex(&networkingv1alpha1.NetworkInterface{}, networkInterfaceSpecNetworkRefNameField, func(obj client.Object) []string {
+				return []string{obj.(*networkingv1alpha1.NetworkInterface).Spec.NetworkRef.Name}
+			}).
+			Build()
+		lb := newOnmetalLoadBalancer(targetClient, onmetalClient, onmetalClient, "foo", CloudConfig{EndpointDestinations: true}, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+
+		destinations, dropped, err := lb.getLoadBalancerDestinationsForService(ctx, service, nil, loadBalancer, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(BeZero())
+		Expect(destinations).To(Equal([]networkingv1alpha1.LoadBalancerDestination{
+			{
+				IP: commonv1alpha1.MustParseIP("10.0.0.1"),
+				TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{
+					UID:        "nic-uid",
+					Name:       "vm-primary",
+					ProviderID: "nic://vm-primary",
+				},
+			},
+			{IP: commonv1alpha1.MustParseIP("192.168.0.10")},
+		}))
+
+		By("truncating the destinations to the destination limit")
+		destinations, dropped, err = lb.getLoadBalancerDestinationsForService(ctx, service, nil, loadBalancer, destinationLimit{max: 1, policy: DestinationOverflowPolicyTruncate})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(Equal(1))
+		Expect(destinations).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,80 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// supportedHealthCheckProtocols are the protocols the load balancer data plane can check the health of destinations
+// with. Only HTTP based health checks have a path.
+var supportedHealthCheckProtocols = sets.New("tcp", "http", "https")
+
+// getHealthChecksForService returns the health checks of the Service ports configured by the annotations with the
+// prefix HealthCheckAnnotationPrefix as a comma separated list of <protocol>/<port>=<health-protocol>[:<path>], in
+// the order of the Service ports. A health check applies to all Service ports of its port number.
+func getHealthChecksForService(service *v1.Service) (string, error) {
+	healthChecks := make(map[int32]string)
+	for key, value := range service.Annotations {
+		portValue, ok := strings.CutPrefix(key, HealthCheckAnnotationPrefix)
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(portValue, 10, 32)
+		if err != nil || !slices.ContainsFunc(service.Spec.Ports, func(svcPort v1.ServicePort) bool { return svcPort.Port == int32(port) }) {
+			return "", fmt.Errorf("annotation %s of Service %s does not reference a port of the Service", key, client.ObjectKeyFromObject(service))
+		}
+		healthCheck, err := parseHealthCheck(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid annotation %s of Service %s: %w", key, client.ObjectKeyFromObject(service), err)
+		}
+		healthChecks[int32(port)] = healthCheck
+	}
+
+	var entries []string
+	for _, svcPort := range service.Spec.Ports {
+		if healthCheck, ok := healthChecks[svcPort.Port]; ok {
+			entries = append(entries, fmt.Sprintf("%s/%d=%s", svcPort.Protocol, svcPort.Port, healthCheck))
+		}
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// parseHealthCheck parses a health check of the form <protocol>[:<path>], e.g. "tcp" or "https:/healthz", and returns
+// it with the protocol in lower case.
+func parseHealthCheck(value string) (string, error) {
+	protocol, path, hasPath := strings.Cut(strings.TrimSpace(value), ":")
+	protocol = strings.ToLower(protocol)
+	if !supportedHealthCheckProtocols.Has(protocol) {
+		return "", fmt.Errorf("unsupported health check protocol %q, supported protocols are %v", protocol, sets.List(supportedHealthCheckProtocols))
+	}
+	if !hasPath {
+		return protocol, nil
+	}
+	if protocol == "tcp" {
+		return "", fmt.Errorf("health check protocol %s does not support a path", protocol)
+	}
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, ", ") {
+		return "", fmt.Errorf("health check path %q must start with / and must not contain commas or spaces", path)
+	}
+	return protocol + ":" + path, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("LoadBalancer health checks", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", Annotations: annotations},
+			Spec: corev1.ServiceSpec{
+				Type: corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 443},
+					{Protocol: corev1.ProtocolTCP, Port: 22},
+					{Protocol: corev1.ProtocolUDP, Port: 443},
+					{Protocol: corev1.ProtocolTCP, Port: 8080},
+				},
+			},
+		}
+	}
+
+	It("should return the health checks of the annotated ports in the order of the service ports", func() {
+		service := newService(map[string]string{
+			HealthCheckAnnotationPrefix + "22":  "tcp",
+			HealthCheckAnnotationPrefix + "443": "HTTPS:/healthz",
+		})
+
+		Expect(getHealthChecksForService(service)).To(Equal("TCP/443=https:/healthz,TCP/22=tcp,UDP/443=https:/healthz"))
+		Expect(getHealthChecksForService(newService(nil))).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid health checks",
+		func(key, value, message string) {
+			_, err := getHealthChecksForService(newService(map[string]string{key: value}))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown port", HealthCheckAnnotationPrefix+"80", "tcp", "does not reference a port of the Service"),
+		Entry("malformed port", HealthCheckAnnotationPrefix+"https", "tcp", "does not reference a port of the Service"),
+		Entry("unsupported protocol", HealthCheckAnnotationPrefix+"443", "grpc", `unsupported health check protocol "grpc"`),
+		Entry("path of a TCP health check", HealthCheckAnnotationPrefix+"22", "tcp:/healthz", "does not support a path"),
+		Entry("relative path", HealthCheckAnnotationPrefix+"8080", "http:healthz", "must start with /"),
+	)
+
+	It("should validate the health checks in the service webhook", func() {
+		service := newService(map[string]string{HealthCheckAnnotationPrefix + "8080": "udp"})
+		Expect(validateServiceAnnotations(service, CloudConfig{}, nil)).To(MatchError(ContainSubstring("unsupported health check protocol")))
+	})
+})
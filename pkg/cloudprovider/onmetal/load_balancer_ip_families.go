@@ -0,0 +1,167 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	eventReasonIPFamilyWithoutDestinations = "IPFamilyWithoutDestinations"
+)
+
+// groupLoadBalancerDestinationsByIPFamily returns the destinations of the given IP families, grouped by IP family in
+// the order of the IP families. Within an IP family, the order of the destinations is preserved. Destinations of other
+// IP families, e.g. IPv6 addresses of dual-stack NetworkInterfaces behind an IPv4 LoadBalancer, are dropped. Without IP
+// families, all destinations are returned as is.
+func groupLoadBalancerDestinationsByIPFamily(destinations []networkingv1alpha1.LoadBalancerDestination, ipFamilies []v1.IPFamily) []networkingv1alpha1.LoadBalancerDestination {
+	if len(ipFamilies) == 0 {
+		return destinations
+	}
+	var grouped []networkingv1alpha1.LoadBalancerDestination
+	for _, ipFamily := range ipFamilies {
+		for _, destination := range destinations {
+			if destination.IP.Family() == ipFamily {
+				grouped = append(grouped, destination)
+			}
+		}
+	}
+	return grouped
+}
+
+// isLoadBalancerDestinationIPFamily reports whether an IP of the given family is a destination of a LoadBalancer of
+// the given IP families. Every IP is a destination of a LoadBalancer without IP families.
+func isLoadBalancerDestinationIPFamily(ipFamily v1.IPFamily, ipFamilies []v1.IPFamily) bool {
+	return len(ipFamilies) == 0 || slices.Contains(ipFamilies, ipFamily)
+}
+
+// getIPFamiliesWithoutDestinations returns the IP families of the LoadBalancer none of the destinations belongs to.
+func getIPFamiliesWithoutDestinations(destinations []networkingv1alpha1.LoadBalancerDestination, ipFamilies []v1.IPFamily) []v1.IPFamily {
+	var missing []v1.IPFamily
+	for _, ipFamily := range ipFamilies {
+		if !slices.ContainsFunc(destinations, func(destination networkingv1alpha1.LoadBalancerDestination) bool {
+			return destination.IP.Family() == ipFamily
+		}) {
+			missing = append(missing, ipFamily)
+		}
+	}
+	return missing
+}
+
+// recordIPFamiliesWithoutDestinations reports the IP families of the LoadBalancer of the Service whose traffic is
+// dropped because none of the destinations belongs to them, e.g. because all NetworkInterfaces are IPv4-only. A
+// LoadBalancer without any destinations is not reported.
+func (o *onmetalLoadBalancer) recordIPFamiliesWithoutDestinations(service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, destinations []networkingv1alpha1.LoadBalancerDestination) {
+	if len(destinations) == 0 {
+		return
+	}
+	if missing := getIPFamiliesWithoutDestinations(destinations, loadBalancer.Spec.IPFamilies); len(missing) > 0 {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonIPFamilyWithoutDestinations, "LoadBalancer %s has no destinations of the IP families %v, their traffic is dropped", client.ObjectKeyFromObject(loadBalancer), missing)
+	}
+}
+
+// maxPrefixLengths are the maximum lengths of the prefixes of the IP families.
+var maxPrefixLengths = map[v1.IPFamily]int32{
+	v1.IPv4Protocol: 32,
+	v1.IPv6Protocol: 128,
+}
+
+// getInternalLoadBalancerIPSources returns an ephemeral prefix template per IP family of an internal LoadBalancer,
+// each allocated from the parent Prefix of its IP family. A LoadBalancer without IP families gets an IPv4 IP.
+func getInternalLoadBalancerIPSources(service *v1.Service, cloudConfig CloudConfig, ipFamilies []v1.IPFamily) ([]networkingv1alpha1.IPSource, error) {
+	prefixLengths, err := getInternalPrefixLengthsForService(service)
+	if err != nil {
+		return nil, err
+	}
+	if len(ipFamilies) == 0 {
+		ipFamilies = []v1.IPFamily{v1.IPv4Protocol}
+	}
+	var ipSources []networkingv1alpha1.IPSource
+	for _, ipFamily := range ipFamilies {
+		parentPrefixName := cloudConfig.getInternalParentPrefixName(ipFamily)
+		if parentPrefixName == "" {
+			return nil, fmt.Errorf("no parent Prefix for %s: %w", ipFamily, ErrPrefixMissing)
+		}
+		ipSource := getEphemeralPrefixIPSource(parentPrefixName, ipFamily)
+		ipSource.Ephemeral.PrefixTemplate.Spec.PrefixLength = prefixLengths[ipFamily]
+		ipSources = append(ipSources, ipSource)
+	}
+	for ipFamily := range prefixLengths {
+		if !slices.Contains(ipFamilies, ipFamily) {
+			return nil, fmt.Errorf("annotation %s of Service %s sets a prefix length for %s, which is not an IP family of its LoadBalancer", InternalLoadBalancerPrefixLengthAnnotation, client.ObjectKeyFromObject(service), ipFamily)
+		}
+	}
+	return ipSources, nil
+}
+
+// getPublicPrefixIPSources returns an ephemeral prefix template allocating the IP of a public LoadBalancer from the
+// Prefix selected by the Service. A Prefix belongs to a single IP family, so LoadBalancers of multiple IP families are
+// rejected instead of leaving all but one IP family without IP. A LoadBalancer without IP families gets an IPv4 IP.
+func getPublicPrefixIPSources(service *v1.Service, publicPrefixName string, ipFamilies []v1.IPFamily) ([]networkingv1alpha1.IPSource, error) {
+	if len(ipFamilies) > 1 {
+		return nil, fmt.Errorf("annotation %s of Service %s selects a single Prefix, which cannot provide IPs of the IP families %v", PublicPrefixAnnotation, client.ObjectKeyFromObject(service), ipFamilies)
+	}
+	ipFamily := v1.IPv4Protocol
+	if len(ipFamilies) > 0 {
+		ipFamily = ipFamilies[0]
+	}
+	return []networkingv1alpha1.IPSource{getEphemeralPrefixIPSource(publicPrefixName, ipFamily)}, nil
+}
+
+// getInternalParentPrefixName returns the parent Prefix of the IPs of the IP family of internal LoadBalancers.
+func (c CloudConfig) getInternalParentPrefixName(ipFamily v1.IPFamily) string {
+	if ipFamily == v1.IPv6Protocol && c.IPv6PrefixName != "" {
+		return c.IPv6PrefixName
+	}
+	return c.PrefixName
+}
+
+// getInternalPrefixLengthsForService returns the prefix lengths per IP family of the
+// InternalLoadBalancerPrefixLengthAnnotation of the Service.
+func getInternalPrefixLengthsForService(service *v1.Service) (map[v1.IPFamily]int32, error) {
+	value, ok := service.Annotations[InternalLoadBalancerPrefixLengthAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	prefixLengths := make(map[v1.IPFamily]int32)
+	for _, entry := range strings.Split(value, ",") {
+		ipFamilyName, lengthValue, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q in annotation %s of Service %s, expected <ip-family>=<length>", entry, InternalLoadBalancerPrefixLengthAnnotation, client.ObjectKeyFromObject(service))
+		}
+		ipFamily := v1.IPFamily(ipFamilyName)
+		maxPrefixLength, ok := maxPrefixLengths[ipFamily]
+		if !ok {
+			return nil, fmt.Errorf("unsupported IP family %q in annotation %s of Service %s, supported IP families: %s, %s", ipFamilyName, InternalLoadBalancerPrefixLengthAnnotation, client.ObjectKeyFromObject(service), v1.IPv4Protocol, v1.IPv6Protocol)
+		}
+		if _, ok := prefixLengths[ipFamily]; ok {
+			return nil, fmt.Errorf("duplicate IP family %s in annotation %s of Service %s", ipFamily, InternalLoadBalancerPrefixLengthAnnotation, client.ObjectKeyFromObject(service))
+		}
+		length, err := strconv.ParseInt(lengthValue, 10, 32)
+		if err != nil || length < 1 || int32(length) > maxPrefixLength {
+			return nil, fmt.Errorf("invalid %s prefix length %q in annotation %s of Service %s, must be between 1 and %d", ipFamily, lengthValue, InternalLoadBalancerPrefixLengthAnnotation, client.ObjectKeyFromObject(service), maxPrefixLength)
+		}
+		prefixLengths[ipFamily] = int32(length)
+	}
+	return prefixLengths, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer destination IP families", func() {
+	newDestination := func(ip string) networkingv1alpha1.LoadBalancerDestination {
+		return networkingv1alpha1.LoadBalancerDestination{IP: commonv1alpha1.MustParseIP(ip)}
+	}
+
+	It("should group the destinations by the IP families of the load balancer", func() {
+		destinations := []networkingv1alpha1.LoadBalancerDestination{
+			newDestination("10.0.0.1"), newDestination("fd00::1"), newDestination("10.0.0.2"), newDestination("fd00::2"),
+		}
+
+		Expect(groupLoadBalancerDestinationsByIPFamily(destinations, []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol})).To(Equal([]networkingv1alpha1.LoadBalancerDestination{
+			newDestination("fd00::1"), newDestination("fd00::2"), newDestination("10.0.0.1"), newDestination("10.0.0.2"),
+		}))
+		Expect(groupLoadBalancerDestinationsByIPFamily(destinations, []corev1.IPFamily{corev1.IPv4Protocol})).To(Equal([]networkingv1alpha1.LoadBalancerDestination{
+			newDestination("10.0.0.1"), newDestination("10.0.0.2"),
+		}))
+		Expect(groupLoadBalancerDestinationsByIPFamily(destinations, nil)).To(Equal(destinations))
+	})
+
+	It("should report the IP families without destinations", func() {
+		destinations := []networkingv1alpha1.LoadBalancerDestination{newDestination("10.0.0.1")}
+
+		Expect(getIPFamiliesWithoutDestinations(destinations, []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol})).To(ConsistOf(corev1.IPv6Protocol))
+		Expect(getIPFamiliesWithoutDestinations(destinations, []corev1.IPFamily{corev1.IPv4Protocol})).To(BeEmpty())
+	})
+
+	It("should route a dual-stack load balancer to the IPs of each family", func(ctx SpecContext) {
+		newMachine := func(name string, ips ...string) (*computev1alpha1.Machine, *networkingv1alpha1.NetworkInterface) {
+			machine := &computev1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+				Spec: computev1alpha1.MachineSpec{
+					NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+				},
+			}
+			networkInterface := &networkingv1alpha1.NetworkInterface{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name + "-primary"},
+				Spec:       networkingv1alpha1.NetworkInterfaceSpec{NetworkRef: corev1.LocalObjectReference{Name: "network"}},
+			}
+			for _, ip := range ips {
+				networkInterface.Status.IPs = append(networkInterface.Status.IPs, commonv1alpha1.MustParseIP(ip))
+			}
+			return machine, networkInterface
+		}
+		ipv4Machine, ipv4NetworkInterface := newMachine("ipv4", "10.0.0.1")
+		dualStackMachine, dualStackNetworkInterface := newMachine("dual-stack", "fd00::2", "10.0.0.2")
+		recorder := record.NewFakeRecorder(10)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(ipv4Machine, ipv4NetworkInterface, dualStackMachine, dualStackNetworkInterface).Build(),
+			onmetalNamespace: "foo",
+			recorder:         recorder,
+		}
+		nodes := []*corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "ipv4"}, Spec: corev1.NodeSpec{ProviderID: getProviderID("foo", "ipv4")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "dual-stack"}, Spec: corev1.NodeSpec{ProviderID: getProviderID("foo", "dual-stack")}},
+		}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				NetworkRef: corev1.LocalObjectReference{Name: "network"},
+				IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+			},
+		}
+
+		By("routing every family to the IPs of that family")
+		destinations, _, err := lb.getLoadBalancerDestinationsForService(ctx, service, nodes, loadBalancer, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.2")),
+			HaveField("IP", commonv1alpha1.MustParseIP("fd00::2")),
+		))
+		lb.recordIPFamiliesWithoutDestinations(service, loadBalancer, destinations)
+		Expect(recorder.Events).To(BeEmpty())
+
+		By("reporting a family without destinations")
+		destinations, _, err = lb.getLoadBalancerDestinationsForService(ctx, service, nodes[:1], loadBalancer, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1"))))
+		lb.recordIPFamiliesWithoutDestinations(service, loadBalancer, destinations)
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonIPFamilyWithoutDestinations)))
+
+		By("not routing an IPv4 load balancer to IPv6 addresses")
+		loadBalancer.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol}
+		destinations, _, err = lb.getLoadBalancerDestinationsForService(ctx, service, nodes, loadBalancer, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.2")),
+		))
+	})
+})
+
+var _ = Describe("Internal LoadBalancer IP sources", func() {
+	var service *corev1.Service
+
+	BeforeEach(func() {
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "service",
+			Annotations: map[string]string{InternalLoadBalancerAnnotation: "true"},
+		}}
+	})
+
+	It("should allocate an IP per IP family of the load balancer from the parent prefix of the IP family", func() {
+		cloudConfig := CloudConfig{PrefixName: "ipv4-prefix", IPv6PrefixName: "ipv6-prefix"}
+
+		Expect(getInternalLoadBalancerIPSources(service, cloudConfig, nil)).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("ipv4-prefix", corev1.IPv4Protocol),
+		}))
+		Expect(getInternalLoadBalancerIPSources(service, cloudConfig, []corev1.IPFamily{corev1.IPv6Protocol})).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("ipv6-prefix", corev1.IPv6Protocol),
+		}))
+		Expect(getInternalLoadBalancerIPSources(service, cloudConfig, []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol})).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("ipv6-prefix", corev1.IPv6Protocol),
+			getEphemeralPrefixIPSource("ipv4-prefix", corev1.IPv4Protocol),
+		}))
+
+		By("falling back to the prefix of prefixName for IPv6")
+		Expect(getInternalLoadBalancerIPSources(service, CloudConfig{PrefixName: "ipv6-prefix"}, []corev1.IPFamily{corev1.IPv6Protocol})).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("ipv6-prefix", corev1.IPv6Protocol),
+		}))
+	})
+
+	It("should fail without a parent prefix for an IP family", func() {
+		_, err := getInternalLoadBalancerIPSources(service, CloudConfig{IPv6PrefixName: "ipv6-prefix"}, []corev1.IPFamily{corev1.IPv4Protocol})
+		Expect(err).To(MatchError(ErrPrefixMissing))
+	})
+
+	It("should set the prefix lengths of the annotation", func() {
+		service.Annotations[InternalLoadBalancerPrefixLengthAnnotation] = "IPv4=30, IPv6=64"
+		ipSources, err := getInternalLoadBalancerIPSources(service, CloudConfig{PrefixName: "ipv4-prefix", IPv6PrefixName: "ipv6-prefix"}, []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipSources).To(HaveExactElements(
+			HaveField("Ephemeral.PrefixTemplate.Spec.PrefixLength", int32(30)),
+			HaveField("Ephemeral.PrefixTemplate.Spec.PrefixLength", int32(64)),
+		))
+
+		By("rejecting prefix lengths of IP families the load balancer does not have")
+		_, err = getInternalLoadBalancerIPSources(service, CloudConfig{PrefixName: "ipv4-prefix"}, []corev1.IPFamily{corev1.IPv4Protocol})
+		Expect(err).To(MatchError(ContainSubstring("not an IP family of its LoadBalancer")))
+	})
+
+	It("should reject invalid prefix lengths", func() {
+		for value, message := range map[string]string{
+			"32":             "expected <ip-family>=<length>",
+			"IPv5=32":        "unsupported IP family",
+			"IPv4=32,IPv4=1": "duplicate IP family IPv4",
+			"IPv6=129":       "must be between 1 and 128",
+			"IPv4=0":         "must be between 1 and 32",
+		} {
+			service.Annotations[InternalLoadBalancerPrefixLengthAnnotation] = value
+			_, err := getInternalPrefixLengthsForService(service)
+			Expect(err).To(MatchError(ContainSubstring(message)), value)
+		}
+	})
+})
+
+var _ = Describe("Public prefix LoadBalancer IP sources", func() {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "service",
+		Annotations: map[string]string{PublicPrefixAnnotation: "public-prefix"},
+	}}
+
+	It("should allocate the IP of the IP family of the load balancer from the public prefix", func() {
+		Expect(getPublicPrefixIPSources(service, "public-prefix", nil)).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("public-prefix", corev1.IPv4Protocol),
+		}))
+		Expect(getPublicPrefixIPSources(service, "public-prefix", []corev1.IPFamily{corev1.IPv6Protocol})).To(Equal([]networkingv1alpha1.IPSource{
+			getEphemeralPrefixIPSource("public-prefix", corev1.IPv6Protocol),
+		}))
+	})
+
+	It("should reject load balancers of multiple IP families", func() {
+		_, err := getPublicPrefixIPSources(service, "public-prefix", []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol})
+		Expect(err).To(MatchError(ContainSubstring("cannot provide IPs of the IP families [IPv4 IPv6]")))
+	})
+})
@@ -0,0 +1,143 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	loadBalancerIngressIPsDesc = metrics.NewDesc(
+		"cloud_provider_onmetal_service_load_balancer_ingress_ips",
+		"Number of ingress IPs of the load balancer of a Service.",
+		[]string{"cluster", "namespace", "name"}, nil, metrics.ALPHA, "",
+	)
+	loadBalancerDestinationsDesc = metrics.NewDesc(
+		"cloud_provider_onmetal_service_load_balancer_destinations",
+		"Number of destinations of the LoadBalancerRouting of the load balancer of a Service.",
+		[]string{"cluster", "namespace", "name"}, nil, metrics.ALPHA, "",
+	)
+	loadBalancerSecondsSinceLastSyncDesc = metrics.NewDesc(
+		"cloud_provider_onmetal_service_load_balancer_seconds_since_last_sync",
+		"Seconds since the load balancer of a Service was last ensured or updated successfully.",
+		[]string{"cluster", "namespace", "name"}, nil, metrics.ALPHA, "",
+	)
+)
+
+// serviceLoadBalancerMetrics collects the state of the load balancers of the Services synced by this cloud provider.
+// The seconds since the last sync are computed on collection, so a Service whose sync keeps failing shows up as
+// degraded without having to be synced. The Services are keyed by their cluster, as the multi-cluster mode runs the
+// cloud providers of several target clusters in one process.
+var serviceLoadBalancerMetrics = newServiceLoadBalancerCollector(time.Now)
+
+func init() {
+	legacyregistry.CustomMustRegister(serviceLoadBalancerMetrics)
+}
+
+// serviceLoadBalancerState is the last observed state of the load balancer of a Service.
+type serviceLoadBalancerState struct {
+	ingressIPs   int
+	destinations int
+	lastSync     time.Time
+}
+
+type serviceLoadBalancerCollector struct {
+	metrics.BaseStableCollector
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[serviceLoadBalancerKey]*serviceLoadBalancerState
+}
+
+// serviceLoadBalancerKey identifies a Service across the target clusters.
+type serviceLoadBalancerKey struct {
+	cluster   string
+	namespace string
+	name      string
+}
+
+func newServiceLoadBalancerCollector(now func() time.Time) *serviceLoadBalancerCollector {
+	return &serviceLoadBalancerCollector{
+		now:    now,
+		states: make(map[serviceLoadBalancerKey]*serviceLoadBalancerState),
+	}
+}
+
+func (c *serviceLoadBalancerCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- loadBalancerIngressIPsDesc
+	ch <- loadBalancerDestinationsDesc
+	ch <- loadBalancerSecondsSinceLastSyncDesc
+}
+
+func (c *serviceLoadBalancerCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for key, state := range c.states {
+		ch <- metrics.NewLazyConstMetric(loadBalancerIngressIPsDesc, metrics.GaugeValue, float64(state.ingressIPs), key.cluster, key.namespace, key.name)
+		ch <- metrics.NewLazyConstMetric(loadBalancerDestinationsDesc, metrics.GaugeValue, float64(state.destinations), key.cluster, key.namespace, key.name)
+		if !state.lastSync.IsZero() {
+			ch <- metrics.NewLazyConstMetric(loadBalancerSecondsSinceLastSyncDesc, metrics.GaugeValue, now.Sub(state.lastSync).Seconds(), key.cluster, key.namespace, key.name)
+		}
+	}
+}
+
+// stateFor returns the state of the load balancer of the Service, creating it if necessary. It must be called with
+// the lock held.
+func (c *serviceLoadBalancerCollector) stateFor(clusterName string, service *v1.Service) *serviceLoadBalancerState {
+	key := keyFor(clusterName, service)
+	state, ok := c.states[key]
+	if !ok {
+		state = &serviceLoadBalancerState{}
+		c.states[key] = state
+	}
+	return state
+}
+
+func keyFor(clusterName string, service *v1.Service) serviceLoadBalancerKey {
+	return serviceLoadBalancerKey{cluster: clusterName, namespace: service.Namespace, name: service.Name}
+}
+
+// observeDestinations records the number of destinations of the LoadBalancerRouting of the Service.
+func (c *serviceLoadBalancerCollector) observeDestinations(clusterName string, service *v1.Service, destinations int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stateFor(clusterName, service).destinations = destinations
+}
+
+// observeSync records a successful sync of the load balancer of the Service. If the status is not nil, the number of
+// its ingress IPs is recorded as well.
+func (c *serviceLoadBalancerCollector) observeSync(clusterName string, service *v1.Service, status *v1.LoadBalancerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := c.stateFor(clusterName, service)
+	if status != nil {
+		state.ingressIPs = len(status.Ingress)
+	}
+	state.lastSync = c.now()
+}
+
+// forget removes the metrics of the Service once its load balancer is deleted.
+func (c *serviceLoadBalancerCollector) forget(clusterName string, service *v1.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.states, keyFor(clusterName, service))
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+var _ = Describe("Service LoadBalancer metrics", func() {
+	var (
+		now       time.Time
+		collector *serviceLoadBalancerCollector
+		service   *v1.Service
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		collector = newServiceLoadBalancerCollector(func() time.Time { return now })
+		service = &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+	})
+
+	expectMetrics := func(expected string) {
+		ExpectWithOffset(1, testutil.CustomCollectAndCompare(collector, strings.NewReader(expected),
+			"cloud_provider_onmetal_service_load_balancer_ingress_ips",
+			"cloud_provider_onmetal_service_load_balancer_destinations",
+			"cloud_provider_onmetal_service_load_balancer_seconds_since_last_sync",
+		)).To(Succeed())
+	}
+
+	It("should report the ingress IPs, destinations and seconds since the last sync of a Service", func() {
+		collector.observeDestinations("my-cluster", service, 3)
+		collector.observeSync("my-cluster", service, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}, {IP: "::1"}}})
+		now = now.Add(30 * time.Second)
+
+		By("keeping the ingress IPs on updates")
+		collector.observeDestinations("my-cluster", service, 2)
+		collector.observeSync("my-cluster", service, nil)
+		now = now.Add(15 * time.Second)
+
+		expectMetrics(`
+# HELP cloud_provider_onmetal_service_load_balancer_destinations [ALPHA] Number of destinations of the LoadBalancerRouting of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_destinations gauge
+cloud_provider_onmetal_service_load_balancer_destinations{cluster="my-cluster",name="foo",namespace="default"} 2
+# HELP cloud_provider_onmetal_service_load_balancer_ingress_ips [ALPHA] Number of ingress IPs of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_ingress_ips gauge
+cloud_provider_onmetal_service_load_balancer_ingress_ips{cluster="my-cluster",name="foo",namespace="default"} 2
+# HELP cloud_provider_onmetal_service_load_balancer_seconds_since_last_sync [ALPHA] Seconds since the load balancer of a Service was last ensured or updated successfully.
+# TYPE cloud_provider_onmetal_service_load_balancer_seconds_since_last_sync gauge
+cloud_provider_onmetal_service_load_balancer_seconds_since_last_sync{cluster="my-cluster",name="foo",namespace="default"} 15
+`)
+	})
+
+	It("should not report the seconds since the last sync of a Service never synced successfully", func() {
+		collector.observeDestinations("my-cluster", service, 1)
+
+		expectMetrics(`
+# HELP cloud_provider_onmetal_service_load_balancer_destinations [ALPHA] Number of destinations of the LoadBalancerRouting of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_destinations gauge
+cloud_provider_onmetal_service_load_balancer_destinations{cluster="my-cluster",name="foo",namespace="default"} 1
+# HELP cloud_provider_onmetal_service_load_balancer_ingress_ips [ALPHA] Number of ingress IPs of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_ingress_ips gauge
+cloud_provider_onmetal_service_load_balancer_ingress_ips{cluster="my-cluster",name="foo",namespace="default"} 0
+`)
+	})
+
+	It("should report the Services of different clusters separately", func() {
+		collector.observeDestinations("my-cluster", service, 1)
+		collector.observeDestinations("other-cluster", service, 2)
+		collector.forget("my-cluster", service)
+
+		expectMetrics(`
+# HELP cloud_provider_onmetal_service_load_balancer_destinations [ALPHA] Number of destinations of the LoadBalancerRouting of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_destinations gauge
+cloud_provider_onmetal_service_load_balancer_destinations{cluster="other-cluster",name="foo",namespace="default"} 2
+# HELP cloud_provider_onmetal_service_load_balancer_ingress_ips [ALPHA] Number of ingress IPs of the load balancer of a Service.
+# TYPE cloud_provider_onmetal_service_load_balancer_ingress_ips gauge
+cloud_provider_onmetal_service_load_balancer_ingress_ips{cluster="other-cluster",name="foo",namespace="default"} 0
+`)
+	})
+
+	It("should forget the metrics of a Service once its load balancer is deleted", func() {
+		collector.observeSync("my-cluster", service, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}})
+		collector.forget("my-cluster", service)
+
+		expectMetrics("")
+	})
+})
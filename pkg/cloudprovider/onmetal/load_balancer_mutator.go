@@ -0,0 +1,70 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// LoadBalancerMutator mutates the LoadBalancer of a Service before it is applied. It allows builds of the cloud
+// provider to support additional Service annotations without changing EnsureLoadBalancer.
+type LoadBalancerMutator interface {
+	// MutateLoadBalancer mutates the given LoadBalancer of the given Service. The name and namespace of the
+	// LoadBalancer must not be changed. An error aborts EnsureLoadBalancer.
+	MutateLoadBalancer(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error
+}
+
+// LoadBalancerMutatorFunc is a function implementing LoadBalancerMutator.
+type LoadBalancerMutatorFunc func(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error
+
+func (f LoadBalancerMutatorFunc) MutateLoadBalancer(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	return f(ctx, service, loadBalancer)
+}
+
+var (
+	loadBalancerMutatorsMu sync.RWMutex
+	loadBalancerMutators   []LoadBalancerMutator
+)
+
+// RegisterLoadBalancerMutator registers a LoadBalancerMutator. Mutators run in the order they were registered, after
+// the LoadBalancer has been built from the Service. It is meant to be called from init functions.
+func RegisterLoadBalancerMutator(mutator LoadBalancerMutator) {
+	loadBalancerMutatorsMu.Lock()
+	defer loadBalancerMutatorsMu.Unlock()
+	loadBalancerMutators = append(loadBalancerMutators, mutator)
+}
+
+func mutateLoadBalancer(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+	loadBalancerMutatorsMu.RLock()
+	mutators := append([]LoadBalancerMutator(nil), loadBalancerMutators...)
+	loadBalancerMutatorsMu.RUnlock()
+
+	name, namespace := loadBalancer.Name, loadBalancer.Namespace
+	for _, mutator := range mutators {
+		if err := mutator.MutateLoadBalancer(ctx, service, loadBalancer); err != nil {
+			return fmt.Errorf("failed to mutate LoadBalancer %s/%s: %w", namespace, name, err)
+		}
+		if loadBalancer.Name != name || loadBalancer.Namespace != namespace {
+			return fmt.Errorf("mutating LoadBalancer %s/%s must not change its name or namespace", namespace, name)
+		}
+	}
+	return nil
+}
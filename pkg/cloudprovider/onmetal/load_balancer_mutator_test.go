@@ -0,0 +1,85 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer mutators", func() {
+	BeforeEach(func() {
+		loadBalancerMutatorsMu.Lock()
+		registered := loadBalancerMutators
+		loadBalancerMutators = nil
+		loadBalancerMutatorsMu.Unlock()
+		DeferCleanup(func() {
+			loadBalancerMutatorsMu.Lock()
+			loadBalancerMutators = registered
+			loadBalancerMutatorsMu.Unlock()
+		})
+	})
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "foo",
+			Annotations: map[string]string{"example.org/tier": "gold"},
+		},
+	}
+
+	It("should apply the registered mutators in order", func(ctx SpecContext) {
+		RegisterLoadBalancerMutator(LoadBalancerMutatorFunc(func(ctx context.Context, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+			loadBalancer.Annotations["example.org/tier"] = service.Annotations["example.org/tier"]
+			return nil
+		}))
+		RegisterLoadBalancerMutator(LoadBalancerMutatorFunc(func(ctx context.Context, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+			loadBalancer.Annotations["example.org/tier"] += "-plus"
+			return nil
+		}))
+
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "test-foo", Annotations: map[string]string{}},
+		}
+		Expect(mutateLoadBalancer(ctx, service, loadBalancer)).To(Succeed())
+		Expect(loadBalancer.Annotations).To(HaveKeyWithValue("example.org/tier", "gold-plus"))
+	})
+
+	It("should return the error of a failing mutator", func(ctx SpecContext) {
+		RegisterLoadBalancerMutator(LoadBalancerMutatorFunc(func(ctx context.Context, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+			return fmt.Errorf("unsupported tier")
+		}))
+
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "test-foo"}}
+		Expect(mutateLoadBalancer(ctx, service, loadBalancer)).To(MatchError(ContainSubstring("unsupported tier")))
+	})
+
+	It("should reject mutators renaming the load balancer", func(ctx SpecContext) {
+		RegisterLoadBalancerMutator(LoadBalancerMutatorFunc(func(ctx context.Context, service *corev1.Service, loadBalancer *networkingv1alpha1.LoadBalancer) error {
+			loadBalancer.Name = "renamed"
+			return nil
+		}))
+
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "test-foo"}}
+		Expect(mutateLoadBalancer(ctx, service, loadBalancer)).To(MatchError(ContainSubstring("must not change its name")))
+	})
+})
@@ -0,0 +1,120 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// loadBalancerNameHashLength is the number of hex digits of the hashes in LoadBalancer names.
+const loadBalancerNameHashLength = 10
+
+var invalidLoadBalancerNameCharacters = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// loadBalancerNameTemplateData is the data the loadBalancerNameTemplate of the cloud config is executed with.
+type loadBalancerNameTemplateData struct {
+	ClusterName string
+	Namespace   string
+	Name        string
+	UID         string
+	// UIDPrefix is the first segment of the UID, as used by LoadBalancerNamingUID.
+	UIDPrefix string
+}
+
+// loadBalancerNameTemplateFuncs are the functions available in the loadBalancerNameTemplate of the cloud config.
+var loadBalancerNameTemplateFuncs = template.FuncMap{
+	// hash returns the first hex digits of the SHA-256 of its arguments joined by "/".
+	"hash": func(values ...string) string {
+		return hashLoadBalancerName(strings.Join(values, "/"))
+	},
+}
+
+func hashLoadBalancerName(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:loadBalancerNameHashLength]
+}
+
+// parseLoadBalancerNameTemplate parses the loadBalancerNameTemplate of the cloud config and verifies it renders a
+// name for an example Service.
+func parseLoadBalancerNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("loadBalancerName").Funcs(loadBalancerNameTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderLoadBalancerName(tmpl, "cluster", &v1.Service{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderLoadBalancerName executes the template for the Service and turns the result into a DNS label, see
+// sanitizeLoadBalancerName.
+func renderLoadBalancerName(tmpl *template.Template, clusterName string, service *v1.Service) (string, error) {
+	var name strings.Builder
+	if err := tmpl.Execute(&name, loadBalancerNameTemplateData{
+		ClusterName: clusterName,
+		Namespace:   service.Namespace,
+		Name:        service.Name,
+		UID:         string(service.UID),
+		UIDPrefix:   strings.Split(string(service.UID), "-")[0],
+	}); err != nil {
+		return "", err
+	}
+	sanitized := sanitizeLoadBalancerName(name.String())
+	if sanitized == "" {
+		return "", fmt.Errorf("template renders an empty name")
+	}
+	return sanitized, nil
+}
+
+// sanitizeLoadBalancerName lowercases the name and replaces characters invalid in a DNS label by dashes. Names
+// exceeding the maximum length of a DNS label are truncated and suffixed with a hash of the full name, so truncated
+// names of different Services do not collide.
+func sanitizeLoadBalancerName(name string) string {
+	sanitized := strings.Trim(invalidLoadBalancerNameCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(sanitized) <= validation.DNS1123LabelMaxLength {
+		return sanitized
+	}
+	prefix := strings.TrimRight(sanitized[:validation.DNS1123LabelMaxLength-loadBalancerNameHashLength-1], "-")
+	return prefix + "-" + hashLoadBalancerName(name)
+}
+
+// loadBalancerNameForService returns the name of a new LoadBalancer of the Service according to the naming scheme of
+// the cloud config. If the loadBalancerNameTemplate cannot be rendered for the Service, the deterministic name is
+// used instead.
+func (c CloudConfig) loadBalancerNameForService(clusterName string, service *v1.Service) string {
+	if c.LoadBalancerNaming != LoadBalancerNamingTemplate {
+		return getLoadBalancerNameForService(clusterName, service, c.LoadBalancerNaming)
+	}
+	tmpl, err := parseLoadBalancerNameTemplate(c.LoadBalancerNameTemplate)
+	if err == nil {
+		var name string
+		if name, err = renderLoadBalancerName(tmpl, clusterName, service); err == nil {
+			return name
+		}
+	}
+	klog.ErrorS(err, "Failed to render LoadBalancer name template, using the deterministic name", "Service", client.ObjectKeyFromObject(service))
+	return getLoadBalancerNameForService(clusterName, service, LoadBalancerNamingDeterministic)
+}
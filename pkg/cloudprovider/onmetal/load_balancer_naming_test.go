@@ -0,0 +1,84 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer name template", func() {
+	var service *corev1.Service
+
+	BeforeEach(func() {
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Foo", UID: "3f2b1c9e-aaaa-bbbb"}}
+	})
+
+	newTemplateCloudConfig := func(nameTemplate string) CloudConfig {
+		return CloudConfig{LoadBalancerNaming: LoadBalancerNamingTemplate, LoadBalancerNameTemplate: nameTemplate}
+	}
+
+	It("should render the template into a DNS label", func() {
+		cloudConfig := newTemplateCloudConfig("{{ .ClusterName }}_{{ .Namespace }}.{{ .Name }}-{{ .UIDPrefix }}")
+		Expect(cloudConfig.loadBalancerNameForService("test", service)).To(Equal("test-default-foo-3f2b1c9e"))
+
+		cloudConfig = newTemplateCloudConfig(`{{ .Name }}-{{ hash .ClusterName .Namespace .Name }}`)
+		Expect(cloudConfig.loadBalancerNameForService("test", service)).To(Equal("foo-" + hashLoadBalancerName("test/default/Foo")))
+	})
+
+	It("should truncate long names and suffix them with a hash of the full name", func() {
+		cloudConfig := newTemplateCloudConfig("{{ .ClusterName }}-{{ .Name }}")
+		service.Name = strings.Repeat("a", 60) + "-1"
+		name := cloudConfig.loadBalancerNameForService("test", service)
+		Expect(validation.IsDNS1123Label(name)).To(BeEmpty())
+		Expect(name).To(HavePrefix("test-aaaa"))
+
+		service.Name = strings.Repeat("a", 60) + "-2"
+		Expect(cloudConfig.loadBalancerNameForService("test", service)).NotTo(Equal(name))
+	})
+
+	It("should reject invalid templates", func() {
+		Expect(parseLoadBalancerNameTemplate("{{ .Name")).Error().To(HaveOccurred())
+		Expect(parseLoadBalancerNameTemplate("{{ .Unknown }}")).Error().To(HaveOccurred())
+		Expect(parseLoadBalancerNameTemplate("---")).Error().To(MatchError(ContainSubstring("empty name")))
+		Expect(newTemplateCloudConfig("").Validate()).To(MatchError(ContainSubstring("loadBalancerNameTemplate is required")))
+		Expect(CloudConfig{LoadBalancerNameTemplate: "{{ .Name }}"}.Validate()).To(MatchError(ContainSubstring("only supported for loadBalancerNaming Template")))
+	})
+
+	It("should keep using the name recorded in the service", func(ctx SpecContext) {
+		service.Annotations = map[string]string{AnnotationKeyLoadBalancerName: "previous-name"}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        "previous-name",
+				Annotations: map[string]string{AnnotationKeyServiceUID: string(service.UID)},
+			},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", newTemplateCloudConfig("{{ .Name }}"), nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+
+		Expect(lb.GetLoadBalancerName(ctx, "renamed", service)).To(Equal("previous-name"))
+		Expect(lb.getLoadBalancerForService(ctx, "renamed", service)).To(HaveField("Name", "previous-name"))
+	})
+})
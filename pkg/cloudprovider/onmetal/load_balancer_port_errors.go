@@ -0,0 +1,124 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const eventReasonPortNotAllowed = "PortNotAllowed"
+
+// loadBalancerPortFieldPattern matches the fields of the ports of a LoadBalancer in the causes of admission errors,
+// e.g. "spec.ports[0].port".
+var loadBalancerPortFieldPattern = regexp.MustCompile(`^spec\.ports\[(\d+)\]`)
+
+// rejectedLoadBalancerPort is a port of a LoadBalancer rejected by the onmetal API and the reason it was rejected for.
+type rejectedLoadBalancerPort struct {
+	port   networkingv1alpha1.LoadBalancerPort
+	reason string
+}
+
+func (p rejectedLoadBalancerPort) String() string {
+	protocol := v1.ProtocolTCP
+	if p.port.Protocol != nil {
+		protocol = *p.port.Protocol
+	}
+	port := strconv.Itoa(int(p.port.Port))
+	if p.port.EndPort != nil {
+		port = fmt.Sprintf("%d-%d", p.port.Port, *p.port.EndPort)
+	}
+	return fmt.Sprintf("%s/%s: %s", protocol, port, p.reason)
+}
+
+// getRejectedLoadBalancerPorts returns the ports of the LoadBalancer the onmetal API rejected applying it for, as
+// reported by the causes of the admission error. Errors not caused by the ports do not return any port.
+func getRejectedLoadBalancerPorts(loadBalancer *networkingv1alpha1.LoadBalancer, err error) []rejectedLoadBalancerPort {
+	var statusErr *apierrors.StatusError
+	if !apierrors.IsInvalid(err) || !errors.As(err, &statusErr) || statusErr.ErrStatus.Details == nil {
+		return nil
+	}
+	var rejected []rejectedLoadBalancerPort
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		match := loadBalancerPortFieldPattern.FindStringSubmatch(cause.Field)
+		if match == nil {
+			continue
+		}
+		i, err := strconv.Atoi(match[1])
+		if err != nil || i >= len(loadBalancer.Spec.Ports) {
+			continue
+		}
+		rejected = append(rejected, rejectedLoadBalancerPort{port: loadBalancer.Spec.Ports[i], reason: cause.Message})
+	}
+	return rejected
+}
+
+// reportRejectedLoadBalancerPorts records an event for every rejected port of the LoadBalancer of the Service, marks
+// the Service with the ServiceConditionPortsNotAllowed condition and returns an error wrapping ErrPortNotAllowed.
+func (o *onmetalLoadBalancer) reportRejectedLoadBalancerPorts(ctx context.Context, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, rejectedPorts []rejectedLoadBalancerPort, err error) error {
+	for _, rejectedPort := range rejectedPorts {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonPortNotAllowed, "%s", rejectedPort)
+	}
+	if !o.cloudConfig.DryRun && !o.cloudConfig.Observer {
+		if err := o.reconcilePortsNotAllowedCondition(ctx, service, rejectedPorts); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("onmetal API rejected ports of LoadBalancer %s for Service %s: %w: %w", client.ObjectKeyFromObject(loadBalancer), client.ObjectKeyFromObject(service), ErrPortNotAllowed, err)
+}
+
+// reconcilePortsNotAllowedCondition records on the Service that the onmetal API rejected the given ports of its
+// LoadBalancer. Without rejected ports, the condition is removed.
+func (o *onmetalLoadBalancer) reconcilePortsNotAllowedCondition(ctx context.Context, service *v1.Service, rejectedPorts []rejectedLoadBalancerPort) error {
+	service = service.DeepCopy()
+	serviceBase := service.DeepCopy()
+	if len(rejectedPorts) == 0 {
+		apimeta.RemoveStatusCondition(&service.Status.Conditions, ServiceConditionPortsNotAllowed)
+	} else {
+		messages := make([]string, 0, len(rejectedPorts))
+		for _, rejectedPort := range rejectedPorts {
+			messages = append(messages, rejectedPort.String())
+		}
+		apimeta.SetStatusCondition(&service.Status.Conditions, metav1.Condition{
+			Type:               ServiceConditionPortsNotAllowed,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: service.Generation,
+			Reason:             eventReasonPortNotAllowed,
+			Message:            strings.Join(messages, "; "),
+		})
+	}
+	if equality.Semantic.DeepEqual(serviceBase.Status, service.Status) {
+		return nil
+	}
+	klog.V(2).InfoS("Updating ports not allowed condition of Service", "Service", client.ObjectKeyFromObject(service), "RejectedPorts", len(rejectedPorts))
+	if err := o.targetClient.Status().Patch(ctx, service, client.MergeFrom(serviceBase)); err != nil {
+		return fmt.Errorf("failed to patch status of Service %s: %w", client.ObjectKeyFromObject(service), err)
+	}
+	return nil
+}
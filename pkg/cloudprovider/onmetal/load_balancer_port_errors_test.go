@@ -0,0 +1,100 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer port errors", func() {
+	var (
+		service      *corev1.Service
+		loadBalancer *networkingv1alpha1.LoadBalancer
+		invalidErr   error
+	)
+
+	BeforeEach(func() {
+		tcp, udp, endPort := corev1.ProtocolTCP, corev1.ProtocolUDP, int32(65010)
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		loadBalancer = &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "lb"},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				Ports: []networkingv1alpha1.LoadBalancerPort{
+					{Protocol: &tcp, Port: 443},
+					{Protocol: &udp, Port: 65000, EndPort: &endPort},
+				},
+			},
+		}
+		invalidErr = apierrors.NewInvalid(networkingv1alpha1.SchemeGroupVersion.WithKind("LoadBalancer").GroupKind(), "lb", field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "ports").Index(1).Child("port"), "reserved by infrastructure"),
+			field.Required(field.NewPath("spec", "networkRef"), "network is required"),
+		})
+	})
+
+	It("should translate admission errors of the ports of the LoadBalancer", func() {
+		Expect(getRejectedLoadBalancerPorts(loadBalancer, fmt.Errorf("failed to apply: %w", invalidErr))).To(HaveExactElements(
+			WithTransform(rejectedLoadBalancerPort.String, Equal("UDP/65000-65010: Forbidden: reserved by infrastructure")),
+		))
+
+		By("ignoring other errors")
+		Expect(getRejectedLoadBalancerPorts(loadBalancer, apierrors.NewInvalid(networkingv1alpha1.SchemeGroupVersion.WithKind("LoadBalancer").GroupKind(), "lb", field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "ports").Index(5), "out of range"),
+		}))).To(BeEmpty())
+		Expect(getRejectedLoadBalancerPorts(loadBalancer, apierrors.NewForbidden(networkingv1alpha1.Resource("loadbalancers"), "lb", fmt.Errorf("denied")))).To(BeEmpty())
+	})
+
+	It("should report the rejected ports on the service", func(ctx SpecContext) {
+		targetClient := fake.NewClientBuilder().WithObjects(service).WithStatusSubresource(service).Build()
+		recorder := record.NewFakeRecorder(10)
+		lb := &onmetalLoadBalancer{targetClient: targetClient, recorder: recorder}
+
+		err := lb.reportRejectedLoadBalancerPorts(ctx, service, loadBalancer, getRejectedLoadBalancerPorts(loadBalancer, invalidErr), invalidErr)
+		Expect(err).To(MatchError(ErrPortNotAllowed))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(Equal("Warning PortNotAllowed UDP/65000-65010: Forbidden: reserved by infrastructure")))
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.Conditions).To(ConsistOf(SatisfyAll(
+			HaveField("Type", ServiceConditionPortsNotAllowed),
+			HaveField("Status", metav1.ConditionTrue),
+			HaveField("Message", "UDP/65000-65010: Forbidden: reserved by infrastructure"),
+		)))
+
+		By("removing the condition once the LoadBalancer is applied")
+		Expect(lb.reconcilePortsNotAllowedCondition(ctx, service, nil)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.Conditions).To(BeEmpty())
+	})
+
+	It("should not mark the service in dry-run mode", func(ctx SpecContext) {
+		targetClient := fake.NewClientBuilder().WithObjects(service).WithStatusSubresource(service).Build()
+		lb := &onmetalLoadBalancer{targetClient: targetClient, recorder: record.NewFakeRecorder(10), cloudConfig: CloudConfig{DryRun: true}}
+
+		Expect(lb.reportRejectedLoadBalancerPorts(ctx, service, loadBalancer, getRejectedLoadBalancerPorts(loadBalancer, invalidErr), invalidErr)).To(MatchError(ErrPortNotAllowed))
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.Conditions).To(BeEmpty())
+	})
+})
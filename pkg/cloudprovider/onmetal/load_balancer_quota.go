@@ -0,0 +1,80 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/onmetal/onmetal-api/api/core/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	eventReasonQuotaExceeded = "QuotaExceeded"
+)
+
+// loadBalancerCountResourceName is the resource of onmetal ResourceQuotas limiting the number of LoadBalancers of a
+// namespace. Every LoadBalancer allocates one IP per IP family, hence the quota limits the public IPs as well.
+var loadBalancerCountResourceName = corev1alpha1.ObjectCountQuotaResourceNameFor(networkingv1alpha1.Resource("loadbalancers"))
+
+// checkLoadBalancerQuota returns an error wrapping ErrQuotaExceeded and records an event on the Service if a
+// ResourceQuota of the onmetal namespace does not allow another LoadBalancer. It is checked before a LoadBalancer is
+// created, as the onmetal API would otherwise reject it only after the Service waited for its IPs. The check is
+// skipped if the ResourceQuotas cannot be listed, e.g. because of missing permissions.
+func (o *onmetalLoadBalancer) checkLoadBalancerQuota(ctx context.Context, service *v1.Service, loadBalancerType networkingv1alpha1.LoadBalancerType) error {
+	reader := o.apiReader
+	if reader == nil {
+		reader = o.onmetalClient
+	}
+	resourceQuotaList := &corev1alpha1.ResourceQuotaList{}
+	if err := reader.List(ctx, resourceQuotaList, client.InNamespace(o.onmetalNamespace)); err != nil {
+		if apierrors.IsForbidden(err) || apimeta.IsNoMatchError(err) {
+			klog.V(2).InfoS("Skipping quota check of LoadBalancer", "Service", client.ObjectKeyFromObject(service), "Error", err)
+			return nil
+		}
+		return fmt.Errorf("failed to list ResourceQuotas in namespace %s: %w", o.onmetalNamespace, err)
+	}
+
+	for _, resourceQuota := range resourceQuotaList.Items {
+		// scoped quotas only count resources of the selected classes, LoadBalancers do not have a class
+		if resourceQuota.Spec.ScopeSelector != nil {
+			continue
+		}
+		hard, ok := resourceQuota.Status.Hard[loadBalancerCountResourceName]
+		if !ok {
+			continue
+		}
+		used := resourceQuota.Status.Used[loadBalancerCountResourceName]
+		if used.Cmp(hard) < 0 {
+			continue
+		}
+
+		quota := "LoadBalancer quota"
+		if loadBalancerType == networkingv1alpha1.LoadBalancerTypePublic {
+			quota = "Public IP quota"
+		}
+		message := fmt.Sprintf("%s exceeded: ResourceQuota %s allows %s LoadBalancers, %s are used", quota, client.ObjectKeyFromObject(&resourceQuota), hard.String(), used.String())
+		o.recorder.Event(service, v1.EventTypeWarning, eventReasonQuotaExceeded, message)
+		return fmt.Errorf("%s: %w", message, ErrQuotaExceeded)
+	}
+	return nil
+}
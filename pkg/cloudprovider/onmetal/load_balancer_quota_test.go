@@ -0,0 +1,91 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	corev1alpha1 "github.com/onmetal/onmetal-api/api/core/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer quota", func() {
+	var (
+		service  *corev1.Service
+		recorder *record.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		recorder = record.NewFakeRecorder(10)
+	})
+
+	newResourceQuota := func(name string, hard, used string) *corev1alpha1.ResourceQuota {
+		return &corev1alpha1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: name},
+			Status: corev1alpha1.ResourceQuotaStatus{
+				Hard: corev1alpha1.ResourceList{loadBalancerCountResourceName: resource.MustParse(hard)},
+				Used: corev1alpha1.ResourceList{loadBalancerCountResourceName: resource.MustParse(used)},
+			},
+		}
+	}
+
+	newLoadBalancerProvider := func(onmetalClient client.Client) *onmetalLoadBalancer {
+		return newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", CloudConfig{}, nil, recorder, nil, nil).(*onmetalLoadBalancer)
+	}
+
+	It("should allow load balancers within the quota", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newResourceQuota("quota", "2", "1")).Build()
+		lb := newLoadBalancerProvider(onmetalClient)
+		Expect(lb.checkLoadBalancerQuota(ctx, service, networkingv1alpha1.LoadBalancerTypePublic)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should fail fast with an event if the quota is exhausted", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newResourceQuota("quota", "2", "2")).Build()
+		lb := newLoadBalancerProvider(onmetalClient)
+		Expect(lb.checkLoadBalancerQuota(ctx, service, networkingv1alpha1.LoadBalancerTypePublic)).To(MatchError(ErrQuotaExceeded))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Public IP quota exceeded: ResourceQuota onmetal/quota allows 2 LoadBalancers, 2 are used")))
+	})
+
+	It("should ignore scoped quotas", func(ctx SpecContext) {
+		resourceQuota := newResourceQuota("quota", "1", "1")
+		resourceQuota.Spec.ScopeSelector = &corev1alpha1.ResourceScopeSelector{}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(resourceQuota).Build()
+		lb := newLoadBalancerProvider(onmetalClient)
+		Expect(lb.checkLoadBalancerQuota(ctx, service, networkingv1alpha1.LoadBalancerTypeInternal)).To(Succeed())
+	})
+
+	It("should skip the check if the quotas cannot be listed", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, client client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				return apierrors.NewForbidden(corev1alpha1.Resource("resourcequotas"), "", nil)
+			},
+		}).Build()
+		lb := newLoadBalancerProvider(onmetalClient)
+		Expect(lb.checkLoadBalancerQuota(ctx, service, networkingv1alpha1.LoadBalancerTypePublic)).To(Succeed())
+	})
+})
@@ -0,0 +1,50 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// readOnlyLoadBalancer is the LoadBalancer implementation of a cloud provider running with readOnly. LoadBalancers
+// cannot be managed without writing to the onmetal API, hence its methods return cloudprovider.NotImplemented.
+type readOnlyLoadBalancer struct{}
+
+var _ cloudprovider.LoadBalancer = readOnlyLoadBalancer{}
+
+func (readOnlyLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return nil, false, cloudprovider.NotImplemented
+}
+
+func (readOnlyLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	return cloudprovider.DefaultLoadBalancerName(service)
+}
+
+func (readOnlyLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	return nil, cloudprovider.NotImplemented
+}
+
+func (readOnlyLoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	return cloudprovider.NotImplemented
+}
+
+// EnsureLoadBalancerDeleted succeeds, as no LoadBalancer is ever created with readOnly. Failing would keep the cleanup
+// finalizer the service controller adds to every Service of type LoadBalancer, blocking the deletion of the Service.
+func (readOnlyLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+var _ = Describe("Read-only mode", func() {
+	It("should not implement load balancers", func(ctx SpecContext) {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		lb := readOnlyLoadBalancer{}
+
+		_, _, err := lb.GetLoadBalancer(ctx, "test", service)
+		Expect(err).To(MatchError(cloudprovider.NotImplemented))
+		_, err = lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(cloudprovider.NotImplemented))
+		Expect(lb.UpdateLoadBalancer(ctx, "test", service, nil)).To(MatchError(cloudprovider.NotImplemented))
+
+		By("not blocking the deletion of services")
+		Expect(lb.EnsureLoadBalancerDeleted(ctx, "test", service)).To(Succeed())
+	})
+
+	It("should serve instances without labeling machines", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec:       computev1alpha1.MachineSpec{MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"}},
+		}
+		onmetalClient := newReadOnlyClient(fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				Fail("unexpected patch of the onmetal API")
+				return nil
+			},
+		}).Build())
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{
+			ClusterName: "test",
+			ReadOnly:    true,
+		}, nil, nil, nil)
+
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+		Expect(instancesProvider.InstanceExists(ctx, node)).To(BeTrue())
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("InstanceType", "machine-class"))
+	})
+})
@@ -0,0 +1,152 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	// orphanedLoadBalancerGracePeriod is the minimum age of a LoadBalancer without Service to be deleted by the repair
+	// sweep. Younger LoadBalancers may belong to Services not yet observed by the cache of the target cluster.
+	orphanedLoadBalancerGracePeriod = time.Minute
+
+	eventReasonLoadBalancerRepaired = "LoadBalancerRepaired"
+)
+
+// repairLoadBalancers sweeps the LoadBalancers labeled with the cluster once, recovering from crashes in the middle
+// of provisioning. LoadBalancers whose Service is gone or no longer of type LoadBalancer are deleted, the others are
+// repaired by repairLoadBalancer.
+func (o *onmetalLoadBalancer) repairLoadBalancers(ctx context.Context, clusterName string, now time.Time) error {
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := o.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(o.onmetalNamespace),
+		client.MatchingLabels{LabelKeyClusterName: clusterName},
+	); err != nil {
+		return fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+	if len(loadBalancerList.Items) == 0 {
+		return nil
+	}
+
+	serviceList := &v1.ServiceList{}
+	if err := o.targetClient.List(ctx, serviceList); err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+	servicesByUID := make(map[string]*v1.Service)
+	for i := range serviceList.Items {
+		service := &serviceList.Items[i]
+		servicesByUID[string(service.UID)] = service
+	}
+
+	nodes, err := o.getLoadBalancerNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range loadBalancerList.Items {
+		loadBalancer := &loadBalancerList.Items[i]
+		service := servicesByUID[loadBalancer.Labels[LabelKeyServiceUID]]
+		if service == nil || service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			if err := o.deleteOrphanedLoadBalancer(ctx, loadBalancer, now); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := o.repairLoadBalancer(ctx, clusterName, service, loadBalancer, nodes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteOrphanedLoadBalancer deletes the LoadBalancer without Service unless it is younger than the grace period. Its
+// LoadBalancerRouting is garbage collected along with it.
+func (o *onmetalLoadBalancer) deleteOrphanedLoadBalancer(ctx context.Context, loadBalancer *networkingv1alpha1.LoadBalancer, now time.Time) error {
+	if now.Sub(loadBalancer.CreationTimestamp.Time) < orphanedLoadBalancerGracePeriod {
+		return nil
+	}
+	klog.InfoS("Deleting orphaned LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "ServiceUID", loadBalancer.Labels[LabelKeyServiceUID])
+	if err := o.onmetalClient.Delete(ctx, loadBalancer); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete orphaned LoadBalancer %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	return nil
+}
+
+// repairLoadBalancer resets the fields of the LoadBalancer diverged from its Service like the drift reconciler and
+// recreates its LoadBalancerRouting if it is missing and managed by the cloud provider. LoadBalancers whose drift is
+// not corrected are left to the service controller, anything else is reconciled by the next sync of the Service.
+func (o *onmetalLoadBalancer) repairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, loadBalancer *networkingv1alpha1.LoadBalancer, nodes []*v1.Node) error {
+	if !isLoadBalancerDriftCorrectable(service) {
+		return nil
+	}
+	drifted, err := o.correctLoadBalancerDrift(ctx, clusterName, service, loadBalancer, nodes)
+	if err != nil {
+		return err
+	}
+	if len(drifted) > 0 {
+		o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonLoadBalancerRepaired, "Reset diverged %s of LoadBalancer %s", strings.Join(drifted, " and "), client.ObjectKeyFromObject(loadBalancer))
+	}
+
+	if manageRouting, err := isRoutingManagedForService(service); err != nil || !manageRouting {
+		return err
+	}
+	loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+	if err := o.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancerRouting); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+	}
+	limit, err := getDestinationLimitForService(service, o.cloudConfig)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Recreating missing LoadBalancerRouting of LoadBalancer", "LoadBalancer", client.ObjectKeyFromObject(loadBalancer), "Service", client.ObjectKeyFromObject(service))
+	if err := o.applyLoadBalancerRoutingForLoadBalancer(ctx, service, loadBalancer, nodes, limit); err != nil {
+		return err
+	}
+	o.recorder.Eventf(service, v1.EventTypeNormal, eventReasonLoadBalancerRepaired, "Recreated missing LoadBalancerRouting of LoadBalancer %s", client.ObjectKeyFromObject(loadBalancer))
+	return nil
+}
+
+// getLoadBalancerNodes returns the Nodes eligible as LoadBalancer destinations like the service controller selects
+// them: ready Nodes not excluded from external load balancers.
+func (o *onmetalLoadBalancer) getLoadBalancerNodes(ctx context.Context) ([]*v1.Node, error) {
+	nodeList := &v1.NodeList{}
+	if err := o.targetClient.List(ctx, nodeList); err != nil {
+		return nil, fmt.Errorf("failed to list Nodes: %w", err)
+	}
+	var nodes []*v1.Node
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if _, excluded := node.Labels[v1.LabelNodeExcludeBalancers]; excluded || !isNodeReady(node) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer repair", func() {
+	var (
+		now      time.Time
+		recorder *record.FakeRecorder
+		applied  []string
+	)
+
+	newService := func(name string, uid types.UID, ports ...int32) *corev1.Service {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: uid},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		for _, port := range ports {
+			service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: port})
+		}
+		return service
+	}
+
+	newLoadBalancer := func(name string, serviceUID types.UID, age time.Duration) *networkingv1alpha1.LoadBalancer {
+		return &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "foo",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Labels:            map[string]string{LabelKeyClusterName: "test", LabelKeyServiceUID: string(serviceUID)},
+			},
+			Spec: networkingv1alpha1.LoadBalancerSpec{NetworkRef: corev1.LocalObjectReference{Name: "network"}},
+		}
+	}
+
+	newRouting := func(name string) *networkingv1alpha1.LoadBalancerRouting {
+		return &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+			NetworkRef: commonv1alpha1.LocalUIDReference{Name: "network"},
+		}
+	}
+
+	newLoadBalancerProvider := func(targetObjs []client.Object, onmetalObjs ...client.Object) *onmetalLoadBalancer {
+		return &onmetalLoadBalancer{
+			targetClient: fake.NewClientBuilder().WithObjects(targetObjs...).Build(),
+			onmetalClient: fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(onmetalObjs...).WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if patch.Type() == types.ApplyPatchType {
+						applied = append(applied, obj.GetName())
+						return nil
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}).Build(),
+			onmetalNamespace: "foo",
+			cloudConfig:      CloudConfig{ClusterName: "test", NetworkName: "network"},
+			recorder:         recorder,
+		}
+	}
+
+	newDesiredLoadBalancer := func(ctx context.Context, service *corev1.Service) *networkingv1alpha1.LoadBalancer {
+		desired, err := newLoadBalancerProvider(nil).getDesiredLoadBalancerForService(ctx, "test", service, nil, "lb")
+		Expect(err).NotTo(HaveOccurred())
+		desired.loadBalancer.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+		return desired.loadBalancer
+	}
+
+	BeforeEach(func() {
+		now = time.Now().Truncate(time.Second)
+		recorder = record.NewFakeRecorder(10)
+		applied = nil
+	})
+
+	It("should delete load balancers whose service is gone after the grace period", func(ctx SpecContext) {
+		converted := newService("converted", "converted-uid")
+		converted.Spec.Type = corev1.ServiceTypeClusterIP
+		lb := newLoadBalancerProvider([]client.Object{converted},
+			newLoadBalancer("gone", "gone-uid", time.Hour),
+			newLoadBalancer("converted", "converted-uid", time.Hour),
+			newLoadBalancer("young", "young-uid", time.Second),
+		)
+
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+
+		loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancerList)).To(Succeed())
+		Expect(loadBalancerList.Items).To(ConsistOf(HaveField("Name", "young")))
+	})
+
+	It("should reset diverged ports of load balancers", func(ctx SpecContext) {
+		service := newService("service", "service-uid", 80, 443)
+		loadBalancer := newDesiredLoadBalancer(ctx, service)
+		loadBalancer.Spec.Ports = loadBalancer.Spec.Ports[:1]
+		lb := newLoadBalancerProvider([]client.Object{service}, loadBalancer, newRouting("lb"))
+
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+
+		Expect(lb.onmetalClient.Get(ctx, client.ObjectKey{Namespace: "foo", Name: "lb"}, loadBalancer)).To(Succeed())
+		Expect(loadBalancer.Spec.Ports).To(HaveExactElements(HaveField("Port", int32(80)), HaveField("Port", int32(443))))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Reset diverged spec.ports of LoadBalancer foo/lb")))
+		Expect(applied).To(BeEmpty())
+	})
+
+	It("should recreate missing load balancer routings", func(ctx SpecContext) {
+		service := newService("service", "service-uid", 80)
+		machine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "node"}}
+		network := &networkingv1alpha1.Network{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "network"}}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node"},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+		}
+		lb := newLoadBalancerProvider([]client.Object{service, node}, newDesiredLoadBalancer(ctx, service), machine, network)
+
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+		Expect(applied).To(ConsistOf("lb"))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Recreated missing LoadBalancerRouting")))
+
+		By("leaving intact load balancers alone")
+		applied = nil
+		lb = newLoadBalancerProvider([]client.Object{service, node}, newDesiredLoadBalancer(ctx, service), newRouting("lb"))
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+		Expect(applied).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should not recreate load balancer routings not managed by the cloud provider", func(ctx SpecContext) {
+		service := newService("service", "service-uid", 80)
+		service.Annotations = map[string]string{ManageRoutingAnnotation: "false"}
+		lb := newLoadBalancerProvider([]client.Object{service}, newDesiredLoadBalancer(ctx, service))
+
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+		Expect(applied).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should leave load balancers of services being deleted, without ports or adopted alone", func(ctx SpecContext) {
+		deleting := newService("deleting", "deleting-uid", 80)
+		deleting.DeletionTimestamp = &metav1.Time{Time: now}
+		deleting.Finalizers = []string{"service.kubernetes.io/load-balancer-cleanup"}
+		adopted := newService("adopted", "adopted-uid", 80)
+		adopted.Annotations = map[string]string{LoadBalancerNameAnnotation: "adopted"}
+		lb := newLoadBalancerProvider([]client.Object{deleting, newService("no-ports", "no-ports-uid"), adopted},
+			newLoadBalancer("deleting", "deleting-uid", time.Hour),
+			newLoadBalancer("no-ports", "no-ports-uid", time.Hour),
+			newLoadBalancer("adopted", "adopted-uid", time.Hour),
+		)
+
+		Expect(lb.repairLoadBalancers(ctx, "test", now)).To(Succeed())
+
+		loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancerList)).To(Succeed())
+		Expect(loadBalancerList.Items).To(HaveEach(HaveField("Spec.Ports", BeEmpty())))
+		Expect(loadBalancerList.Items).To(HaveLen(3))
+		Expect(applied).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should only consider ready nodes not excluded from load balancers", func(ctx SpecContext) {
+		ready := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+		lb := newLoadBalancerProvider([]client.Object{
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ready"}, Status: corev1.NodeStatus{Conditions: ready}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{corev1.LabelNodeExcludeBalancers: ""}}, Status: corev1.NodeStatus{Conditions: ready}},
+		})
+
+		Expect(lb.getLoadBalancerNodes(ctx)).To(ConsistOf(HaveField("Name", "ready")))
+	})
+})
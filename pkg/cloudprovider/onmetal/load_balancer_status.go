@@ -0,0 +1,160 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// loadBalancerStatusReconciler updates the status of Services once the IPs of their LoadBalancers are allocated. It
+// is used if EnsureLoadBalancer does not wait for the IPs of a LoadBalancer.
+type loadBalancerStatusReconciler struct {
+	targetClient  client.Client
+	onmetalClient client.Client
+	clusterName   string
+	// dnsRecords manages the DNS records of the hostname annotations of Services. If nil, no records are managed.
+	dnsRecords dnsRecordProvider
+	queue      workqueue.RateLimitingInterface
+}
+
+func newLoadBalancerStatusReconciler(targetClient client.Client, onmetalClient client.Client, clusterName string, dnsRecords dnsRecordProvider) *loadBalancerStatusReconciler {
+	return &loadBalancerStatusReconciler{
+		targetClient:  targetClient,
+		onmetalClient: onmetalClient,
+		clusterName:   clusterName,
+		dnsRecords:    dnsRecords,
+		queue:         workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "load-balancer-status"}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the reconciler at the LoadBalancer informer of the given cache.
+func (r *loadBalancerStatusReconciler) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &networkingv1alpha1.LoadBalancer{})
+	if err != nil {
+		return fmt.Errorf("failed to get LoadBalancer informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueue(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldLoadBalancer, oldOK := oldObj.(*networkingv1alpha1.LoadBalancer)
+			newLoadBalancer, newOK := newObj.(*networkingv1alpha1.LoadBalancer)
+			if oldOK && newOK && equality.Semantic.DeepEqual(oldLoadBalancer.Status.IPs, newLoadBalancer.Status.IPs) {
+				return
+			}
+			r.enqueue(newObj)
+		},
+	})
+	return err
+}
+
+func (r *loadBalancerStatusReconciler) enqueue(obj interface{}) {
+	if loadBalancer, ok := obj.(*networkingv1alpha1.LoadBalancer); ok {
+		r.queue.Add(client.ObjectKeyFromObject(loadBalancer))
+	}
+}
+
+// Start processes queued LoadBalancers until the context is done.
+func (r *loadBalancerStatusReconciler) Start(ctx context.Context) {
+	defer r.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (r *loadBalancerStatusReconciler) processNextItem(ctx context.Context) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	loadBalancerKey := item.(client.ObjectKey)
+	if err := r.reconcile(ctx, loadBalancerKey); err != nil {
+		klog.ErrorS(err, "Failed to reconcile Service status of LoadBalancer", "LoadBalancer", loadBalancerKey)
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *loadBalancerStatusReconciler) reconcile(ctx context.Context, loadBalancerKey client.ObjectKey) error {
+	loadBalancer := &networkingv1alpha1.LoadBalancer{}
+	if err := r.onmetalClient.Get(ctx, loadBalancerKey, loadBalancer); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	annotations := loadBalancer.Annotations
+	if annotations[AnnotationKeyClusterName] != r.clusterName {
+		return nil
+	}
+
+	service := &corev1.Service{}
+	serviceKey := client.ObjectKey{Namespace: annotations[AnnotationKeyServiceNamespace], Name: annotations[AnnotationKeyServiceName]}
+	if err := r.targetClient.Get(ctx, serviceKey, service); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if string(service.UID) != annotations[AnnotationKeyServiceUID] || service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil
+	}
+
+	serviceBase := service.DeepCopy()
+	status := getLoadBalancerStatusForService(loadBalancer, service)
+	condition := metav1.Condition{
+		Type:               ServiceConditionLoadBalancerReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: service.Generation,
+		Reason:             "IPsPending",
+		Message:            fmt.Sprintf("Waiting for the IPs of LoadBalancer %s", loadBalancerKey),
+	}
+	if len(status.Ingress) > 0 {
+		observeIPAllocationDuration(loadBalancer, service, time.Now())
+		service.Status.LoadBalancer = *status
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "IPsAllocated"
+		condition.Message = fmt.Sprintf("IPs of LoadBalancer %s are allocated", loadBalancerKey)
+	}
+	apimeta.SetStatusCondition(&service.Status.Conditions, condition)
+	if err := reconcileDNSRecord(ctx, r.dnsRecords, service, status); err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(serviceBase.Status, service.Status) {
+		return nil
+	}
+	klog.V(2).InfoS("Updating status of Service", "Service", serviceKey, "LoadBalancer", loadBalancerKey, "Ingress", service.Status.LoadBalancer.Ingress)
+	if err := r.targetClient.Status().Patch(ctx, service, client.MergeFrom(serviceBase)); err != nil {
+		return fmt.Errorf("failed to patch status of Service %s: %w", serviceKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancerStatusReconciler", func() {
+	It("should update the status of the service once the IPs of the load balancer are allocated", func(ctx SpecContext) {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc", UID: "svc-uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "lb",
+				Annotations: map[string]string{
+					AnnotationKeyClusterName:      "test",
+					AnnotationKeyServiceNamespace: service.Namespace,
+					AnnotationKeyServiceName:      service.Name,
+					AnnotationKeyServiceUID:       string(service.UID),
+				},
+			},
+		}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(service).WithStatusSubresource(service).Build()
+		reconciler := newLoadBalancerStatusReconciler(targetClient, onmetalClient, "test", nil)
+
+		By("reconciling the load balancer without IPs")
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(loadBalancer))).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.LoadBalancer.Ingress).To(BeEmpty())
+		Expect(service.Status.Conditions).To(ConsistOf(SatisfyAll(
+			HaveField("Type", ServiceConditionLoadBalancerReady),
+			HaveField("Status", metav1.ConditionFalse),
+		)))
+
+		By("reconciling the load balancer with allocated IPs")
+		loadBalancerBase := loadBalancer.DeepCopy()
+		loadBalancer.Status.IPs = []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}
+		Expect(onmetalClient.Patch(ctx, loadBalancer, client.MergeFrom(loadBalancerBase))).To(Succeed())
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(loadBalancer))).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.LoadBalancer.Ingress).To(ConsistOf(corev1.LoadBalancerIngress{IP: "10.0.0.1"}))
+		Expect(service.Status.Conditions).To(ConsistOf(SatisfyAll(
+			HaveField("Type", ServiceConditionLoadBalancerReady),
+			HaveField("Status", metav1.ConditionTrue),
+		)))
+	})
+
+	It("should ignore load balancers of other clusters", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "foo",
+				Name:        "lb",
+				Annotations: map[string]string{AnnotationKeyClusterName: "other"},
+			},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		reconciler := newLoadBalancerStatusReconciler(fake.NewClientBuilder().Build(), onmetalClient, "test", nil)
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(loadBalancer))).To(Succeed())
+	})
+})
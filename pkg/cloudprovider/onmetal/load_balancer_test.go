@@ -15,14 +15,29 @@
 package onmetal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/component-base/metrics/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 
 	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
@@ -619,7 +634,7 @@ var _ = Describe("LoadBalancer", func() {
 		))
 	})
 
-	It("should fail to get load balancer info if no load balancer is present", func(ctx SpecContext) {
+	It("should report no load balancer if no load balancer is present", func(ctx SpecContext) {
 		By("creating test service of type LoadBalancer")
 		service := &corev1.Service{
 			ObjectMeta: metav1.ObjectMeta{
@@ -641,9 +656,1232 @@ var _ = Describe("LoadBalancer", func() {
 		Expect(k8sClient.Create(ctx, service)).To(Succeed())
 		DeferCleanup(k8sClient.Delete, service)
 
-		By("ensuring that GetLoadBalancer returns instance not found for non existing object")
+		By("ensuring that GetLoadBalancer reports a non existing load balancer without an error")
 		_, exist, err := lbProvider.GetLoadBalancer(ctx, "foo", &corev1.Service{})
-		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(HaveOccurred())
 		Expect(exist).To(BeFalse())
 	})
+
+	It("should allocate the IP of a public load balancer from the prefix selected by the service", func(ctx SpecContext) {
+		By("creating test service of type LoadBalancer selecting a public prefix")
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "service-",
+				Namespace:    ns.Name,
+				Annotations: map[string]string{
+					PublicPrefixAnnotation: "public-prefix",
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Type: corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{
+					{
+						Name:       "https",
+						Protocol:   "TCP",
+						Port:       443,
+						TargetPort: intstr.IntOrString{IntVal: 443},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, service)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, service)
+
+		// Start a goroutine to patch public IP into load banacer status in order to succeed EnsureLoadBalancer call
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      lbProvider.GetLoadBalancerName(ctx, clusterName, service),
+			},
+		}
+		go func() {
+			defer GinkgoRecover()
+			By("patching public IP into load balancer status")
+			Eventually(UpdateStatus(loadBalancer, func() {
+				loadBalancer.Status.IPs = []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}
+			})).Should(Succeed())
+		}()
+
+		By("ensuring load balancer for service")
+		Expect(lbProvider.EnsureLoadBalancer(ctx, clusterName, service, nil)).Error().To(BeNil())
+
+		By("ensuring the load balancer allocates its IP from the public prefix")
+		Eventually(Object(loadBalancer)).Should(SatisfyAll(
+			HaveField("Spec.Type", Equal(networkingv1alpha1.LoadBalancerTypePublic)),
+			HaveField("Spec.IPs", ConsistOf(HaveField("Ephemeral.PrefixTemplate.Spec", SatisfyAll(
+				HaveField("IPFamily", corev1.IPv4Protocol),
+				HaveField("ParentRef.Name", "public-prefix"),
+			)))),
+		))
+	})
+})
+
+var _ = Describe("LoadBalancer migration", func() {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo",
+			UID:       "new-uid",
+		},
+	}
+
+	newLoadBalancer := func(clusterName, serviceNamespace, serviceName, serviceUID string) *networkingv1alpha1.LoadBalancer {
+		return &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					AnnotationKeyClusterName:      clusterName,
+					AnnotationKeyServiceNamespace: serviceNamespace,
+					AnnotationKeyServiceName:      serviceName,
+					AnnotationKeyServiceUID:       serviceUID,
+				},
+			},
+		}
+	}
+
+	It("should match a load balancer of the previous cluster for the same service", func() {
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("old", "default", "foo", "old-uid"), "new", "old", service)).To(BeTrue())
+	})
+
+	It("should match an already adopted load balancer only for the same service UID", func() {
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("new", "default", "foo", "new-uid"), "new", "old", service)).To(BeTrue())
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("new", "default", "foo", "other-uid"), "new", "old", service)).To(BeFalse())
+	})
+
+	It("should not match load balancers of other services or clusters", func() {
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("old", "default", "bar", "old-uid"), "new", "old", service)).To(BeFalse())
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("old", "other", "foo", "old-uid"), "new", "old", service)).To(BeFalse())
+		Expect(isMigratedLoadBalancerForService(newLoadBalancer("other", "default", "foo", "old-uid"), "new", "old", service)).To(BeFalse())
+	})
+})
+
+var _ = Describe("LoadBalancer naming", func() {
+	newService := func(namespace, name, uid string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80}},
+			},
+		}
+	}
+
+	It("should derive deterministic names without the service UID", func() {
+		service := newService("default", "foo", "3f2b1c9e-0000-0000-0000-000000000000")
+		Expect(getLoadBalancerNameForService("test", service, "")).To(Equal("test-foo-3f2b1c9e"))
+		Expect(getLoadBalancerNameForService("test", service, LoadBalancerNamingDeterministic)).To(Equal("test-foo-47094f59db"))
+
+		Expect(getLoadBalancerNameForService("test", newService("default", "foo", "other-uid"), LoadBalancerNamingDeterministic)).To(Equal("test-foo-47094f59db"))
+		Expect(getLoadBalancerNameForService("test", newService("other", "foo", "other-uid"), LoadBalancerNamingDeterministic)).NotTo(Equal("test-foo-47094f59db"))
+	})
+
+	It("should truncate long deterministic names to a DNS label", func() {
+		service := newService("default", strings.Repeat("a", 62), "uid")
+		name := getLoadBalancerNameForService("my-cluster", service, LoadBalancerNamingDeterministic)
+		Expect(name).To(HaveLen(63))
+		Expect(validation.IsDNS1123Label(name)).To(BeEmpty())
+	})
+
+	It("should reject a deterministic name taken by the load balancer of another service", func(ctx SpecContext) {
+		service := newService("default", "foo", "new-uid")
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        getLoadBalancerNameForService("test", service, LoadBalancerNamingDeterministic),
+				Annotations: getLoadBalancerIdentityAnnotationsForService("test", newService("default", "foo", "old-uid")),
+			},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		cloudConfig := CloudConfig{NetworkName: "network", LoadBalancerNaming: LoadBalancerNamingDeterministic}
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", cloudConfig, nil, record.NewFakeRecorder(10), nil, nil)
+
+		_, exists, err := lb.GetLoadBalancer(ctx, "test", service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+
+		_, err = lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ErrLoadBalancerNameCollision))
+	})
+
+	It("should find unlabeled load balancers by their UID-suffixed name with deterministic naming", func(ctx SpecContext) {
+		service := newService("default", "foo", "3f2b1c9e-0000-0000-0000-000000000000")
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "test-foo-3f2b1c9e"},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		cloudConfig := CloudConfig{NetworkName: "network", LoadBalancerNaming: LoadBalancerNamingDeterministic}
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", cloudConfig, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+
+		found, err := lb.getLoadBalancerForService(ctx, "test", service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Name).To(Equal("test-foo-3f2b1c9e"))
+	})
+})
+
+var _ = Describe("LoadBalancer zones", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}}
+	}
+	newNode := func(name, zone string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyZone: zone}}}
+	}
+	nodes := []*corev1.Node{newNode("a", "zone-a"), newNode("b", "zone-b"), newNode("c", "zone-a")}
+
+	It("should return the requested zones", func() {
+		zones, err := getZonesForService(newService(map[string]string{ZonesAnnotation: "zone-b, zone-a"}), nodes, CloudConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sets.List(zones)).To(Equal([]string{"zone-a", "zone-b"}))
+
+		zones, err = getZonesForService(newService(nil), nodes, CloudConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zones.Len()).To(BeZero())
+	})
+
+	It("should derive the zones of the node pools or the nodes", func() {
+		cloudConfig := CloudConfig{MachinePoolTopology: map[string]MachinePoolTopology{"pool-1": {Zone: "zone-1"}}}
+		zones, err := getZonesForService(newService(map[string]string{ZonesAnnotation: "auto", NodePoolsAnnotation: "pool-1,pool-2"}), nodes, cloudConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sets.List(zones)).To(Equal([]string{"pool-2", "zone-1"}))
+
+		zones, err = getZonesForService(newService(map[string]string{ZonesAnnotation: "auto"}), nodes, cloudConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sets.List(zones)).To(Equal([]string{"zone-a", "zone-b"}))
+	})
+
+	It("should reject invalid zones", func() {
+		_, err := getZonesForService(newService(map[string]string{ZonesAnnotation: "zone-a,,zone-b"}), nil, CloudConfig{})
+		Expect(err).To(MatchError(ContainSubstring("empty zone")))
+		_, err = getZonesForService(newService(map[string]string{ZonesAnnotation: "zone a"}), nil, CloudConfig{})
+		Expect(err).To(MatchError(ContainSubstring(`invalid zone "zone a"`)))
+	})
+
+	It("should update the zones of the load balancer with the nodes", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "lb", Annotations: map[string]string{AnnotationKeyZones: "zone-a"}},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build()
+		lb := newOnmetalLoadBalancer(fake.NewClientBuilder().Build(), onmetalClient, onmetalClient, "onmetal", CloudConfig{}, nil, record.NewFakeRecorder(10), nil, nil).(*onmetalLoadBalancer)
+
+		Expect(lb.reconcileLoadBalancerZones(ctx, newService(map[string]string{ZonesAnnotation: "auto"}), nodes, loadBalancer)).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+		Expect(loadBalancer.Annotations).To(HaveKeyWithValue(AnnotationKeyZones, "zone-a,zone-b"))
+
+		Expect(lb.reconcileLoadBalancerZones(ctx, newService(nil), nodes, loadBalancer)).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+		Expect(loadBalancer.Annotations).NotTo(HaveKey(AnnotationKeyZones))
+	})
+})
+
+var _ = Describe("LoadBalancer ports", func() {
+	newService := func(annotations map[string]string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Ports: ports},
+		}
+	}
+
+	It("should expose port ranges starting at service ports", func() {
+		service := newService(map[string]string{LoadBalancerPortRangesAnnotation: "10000-20000"},
+			corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 443},
+			corev1.ServicePort{Protocol: corev1.ProtocolUDP, Port: 10000},
+		)
+		lbPorts, err := getLoadBalancerPortsForService(service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lbPorts).To(ConsistOf(
+			SatisfyAll(HaveField("Protocol", HaveValue(Equal(corev1.ProtocolTCP))), HaveField("Port", BeEquivalentTo(443)), HaveField("EndPort", BeNil())),
+			SatisfyAll(HaveField("Protocol", HaveValue(Equal(corev1.ProtocolUDP))), HaveField("Port", BeEquivalentTo(10000)), HaveField("EndPort", HaveValue(BeEquivalentTo(20000)))),
+		))
+	})
+
+	It("should reject port ranges not starting at a service port", func() {
+		service := newService(map[string]string{LoadBalancerPortRangesAnnotation: "10000-20000"},
+			corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 443},
+		)
+		_, err := getLoadBalancerPortsForService(service)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject invalid port ranges", func() {
+		for _, value := range []string{"10000", "a-b", "20000-10000", "0-10", "1-70000"} {
+			_, err := parsePortRanges(value)
+			Expect(err).To(HaveOccurred(), value)
+		}
+	})
+
+	It("should map service ports to node ports or target ports", func() {
+		service := newService(nil,
+			corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 443, NodePort: 30443, TargetPort: intstr.FromInt(8443)},
+			corev1.ServicePort{Protocol: corev1.ProtocolUDP, Port: 53, TargetPort: intstr.FromInt(5353)},
+			corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 80},
+			corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 8080, NodePort: 30080, TargetPort: intstr.FromString("http")},
+		)
+		Expect(getBackendPortsForService(service)).To(Equal("TCP/443=30443,UDP/53=5353,TCP/80=80,TCP/8080=30080"))
+	})
+
+	It("should reject named target ports routed to directly", func() {
+		service := newService(nil, corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 80, TargetPort: intstr.FromString("http")})
+		_, err := getBackendPortsForService(service)
+		Expect(err).To(MatchError(ContainSubstring(`targets the named port "http"`)))
+	})
+})
+
+var _ = Describe("LoadBalancer IP families", func() {
+	It("should split IPs by the IP families of the service", func() {
+		ips := []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1"), commonv1alpha1.MustParseIP("2001:db8::1")}
+
+		matching, mismatching := filterIPsByFamilies(ips, []corev1.IPFamily{corev1.IPv4Protocol})
+		Expect(matching).To(Equal([]commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}))
+		Expect(mismatching).To(Equal([]commonv1alpha1.IP{commonv1alpha1.MustParseIP("2001:db8::1")}))
+
+		matching, mismatching = filterIPsByFamilies(ips, []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol})
+		Expect(matching).To(Equal(ips))
+		Expect(mismatching).To(BeEmpty())
+	})
+
+	It("should accept all IPs if the service has no IP families", func() {
+		ips := []commonv1alpha1.IP{commonv1alpha1.MustParseIP("2001:db8::1")}
+		matching, mismatching := filterIPsByFamilies(ips, nil)
+		Expect(matching).To(Equal(ips))
+		Expect(mismatching).To(BeEmpty())
+	})
+})
+
+var _ = Describe("LoadBalancer IP family fallback", func() {
+	var service *corev1.Service
+
+	BeforeEach(func() {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"},
+			Spec: corev1.ServiceSpec{
+				Type:           corev1.ServiceTypeLoadBalancer,
+				IPFamilies:     []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+				IPFamilyPolicy: getIPFamilyPolicy(corev1.IPFamilyPolicyPreferDualStack),
+			},
+		}
+	})
+
+	It("should provision all IP families if the network IP families are not configured", func() {
+		ipFamilies, downgradedIPFamilies, err := getIPFamiliesForService(service, CloudConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipFamilies).To(Equal(service.Spec.IPFamilies))
+		Expect(downgradedIPFamilies).To(BeEmpty())
+	})
+
+	It("should fall back to the IP families supported by the network for PreferDualStack services", func() {
+		ipFamilies, downgradedIPFamilies, err := getIPFamiliesForService(service, CloudConfig{NetworkIPFamilies: []corev1.IPFamily{corev1.IPv4Protocol}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipFamilies).To(Equal([]corev1.IPFamily{corev1.IPv4Protocol}))
+		Expect(downgradedIPFamilies).To(Equal([]corev1.IPFamily{corev1.IPv6Protocol}))
+	})
+
+	It("should reject services requiring IP families not supported by the network", func() {
+		service.Spec.IPFamilyPolicy = getIPFamilyPolicy(corev1.IPFamilyPolicyRequireDualStack)
+		_, _, err := getIPFamiliesForService(service, CloudConfig{NetworkIPFamilies: []corev1.IPFamily{corev1.IPv4Protocol}})
+		Expect(err).To(MatchError(ErrIPFamilyNotSupported))
+
+		service.Spec.IPFamilyPolicy = getIPFamilyPolicy(corev1.IPFamilyPolicySingleStack)
+		service.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol}
+		_, _, err = getIPFamiliesForService(service, CloudConfig{NetworkIPFamilies: []corev1.IPFamily{corev1.IPv4Protocol}})
+		Expect(err).To(MatchError(ErrIPFamilyNotSupported))
+	})
+
+	It("should record the downgrade on the service", func(ctx SpecContext) {
+		targetClient := fake.NewClientBuilder().WithObjects(service).WithStatusSubresource(service).Build()
+		recorder := record.NewFakeRecorder(10)
+		lb := newOnmetalLoadBalancer(targetClient, nil, nil, "onmetal", CloudConfig{NetworkName: "network"}, nil, recorder, nil, nil).(*onmetalLoadBalancer)
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "lb"}}
+
+		By("setting the condition for downgraded IP families")
+		Expect(lb.reconcileIPFamiliesDowngradedCondition(ctx, service, loadBalancer, []corev1.IPFamily{corev1.IPv6Protocol})).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.Conditions).To(ConsistOf(HaveField("Type", ServiceConditionIPFamiliesDowngraded)))
+		Expect(recorder.Events).To(Receive(ContainSubstring("IPFamiliesDowngraded")))
+
+		By("not recording the unchanged downgrade again")
+		Expect(lb.reconcileIPFamiliesDowngradedCondition(ctx, service, loadBalancer, []corev1.IPFamily{corev1.IPv6Protocol})).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("removing the condition once all IP families are provisioned")
+		Expect(lb.reconcileIPFamiliesDowngradedCondition(ctx, service, loadBalancer, nil)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Status.Conditions).To(BeEmpty())
+	})
+})
+
+func getIPFamilyPolicy(policy corev1.IPFamilyPolicy) *corev1.IPFamilyPolicy {
+	return &policy
+}
+
+var _ = Describe("LoadBalancer flow logs", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}}
+	}
+
+	It("should return the flow logs destination if flow logs are enabled", func() {
+		Expect(getFlowLogsDestinationForService(newService(map[string]string{
+			FlowLogsAnnotation:            "true",
+			FlowLogsDestinationAnnotation: "my-collector",
+		}))).To(Equal("my-collector"))
+		Expect(getFlowLogsDestinationForService(newService(map[string]string{
+			FlowLogsAnnotation:            "false",
+			FlowLogsDestinationAnnotation: "my-collector",
+		}))).To(BeEmpty())
+		Expect(getFlowLogsDestinationForService(newService(nil))).To(BeEmpty())
+	})
+
+	It("should reject enabled flow logs without a destination", func() {
+		_, err := getFlowLogsDestinationForService(newService(map[string]string{FlowLogsAnnotation: "true"}))
+		Expect(err).To(HaveOccurred())
+		_, err = getFlowLogsDestinationForService(newService(map[string]string{FlowLogsAnnotation: "yes please"}))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("LoadBalancer routing management", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}}
+	}
+
+	It("should manage the routing unless the service disables it", func() {
+		Expect(isRoutingManagedForService(newService(nil))).To(BeTrue())
+		Expect(isRoutingManagedForService(newService(map[string]string{ManageRoutingAnnotation: "true"}))).To(BeTrue())
+		Expect(isRoutingManagedForService(newService(map[string]string{ManageRoutingAnnotation: "false"}))).To(BeFalse())
+		_, err := isRoutingManagedForService(newService(map[string]string{ManageRoutingAnnotation: "external"}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not update the routing of a load balancer whose routing is not managed", func(ctx SpecContext) {
+		service := newService(map[string]string{ManageRoutingAnnotation: "false"})
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        "lb",
+				Labels:      getLoadBalancerLabelsForService("test", service),
+				Annotations: getLoadBalancerIdentityAnnotationsForService("test", service),
+			},
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta:   metav1.ObjectMeta{Namespace: "onmetal", Name: "lb"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{{IP: commonv1alpha1.MustParseIP("10.0.0.1")}},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer, loadBalancerRouting).Build(),
+			onmetalNamespace: "onmetal",
+		}
+
+		Expect(lb.UpdateLoadBalancer(ctx, "test", service, []*corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node"}}})).To(Succeed())
+
+		updated := &networkingv1alpha1.LoadBalancerRouting{}
+		Expect(lb.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), updated)).To(Succeed())
+		Expect(updated.Destinations).To(Equal(loadBalancerRouting.Destinations))
+	})
+})
+
+var _ = Describe("LoadBalancer node port verification", func() {
+	It("should verify that every TCP node port is reachable on a destination", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{
+				{IP: commonv1alpha1.MustParseIP("10.0.0.1")},
+				{IP: commonv1alpha1.MustParseIP("10.0.0.2")},
+			},
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 443, NodePort: 30443},
+					{Protocol: corev1.ProtocolUDP, Port: 53, NodePort: 30053},
+				},
+			},
+		}
+
+		var (
+			mu        sync.Mutex
+			reachable = map[string]bool{"10.0.0.2:30443": true}
+			hanging   = map[string]bool{"10.0.0.1:30443": true}
+			dialed    []string
+		)
+		lb := &onmetalLoadBalancer{
+			onmetalClient: fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer, loadBalancerRouting).Build(),
+			dialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
+				mu.Lock()
+				dialed = append(dialed, address)
+				isReachable, isHanging := reachable[address], hanging[address]
+				mu.Unlock()
+				if isHanging {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				if !isReachable {
+					return nil, fmt.Errorf("connection refused")
+				}
+				server, conn := net.Pipe()
+				_ = server.Close()
+				return conn, nil
+			},
+		}
+
+		By("not waiting for hanging destinations once a destination is reachable")
+		start := time.Now()
+		Expect(lb.verifyNodePortsReachable(ctx, service, loadBalancer)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", nodePortDialTimeout))
+		Expect(dialed).To(ContainElement("10.0.0.2:30443"))
+
+		By("failing if no destination is reachable")
+		reachable, hanging = nil, nil
+		Expect(lb.verifyNodePortsReachable(ctx, service, loadBalancer)).To(MatchError(ContainSubstring("node port 30443")))
+	})
+})
+
+var _ = Describe("LoadBalancer proxy protocol", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}}
+	}
+
+	It("should return the PROXY protocol version of the service", func() {
+		Expect(getProxyProtocolForService(newService(map[string]string{ProxyProtocolAnnotation: "v2"}))).To(Equal("v2"))
+		Expect(getProxyProtocolForService(newService(nil))).To(BeEmpty())
+	})
+
+	It("should reject unsupported PROXY protocol versions", func() {
+		_, err := getProxyProtocolForService(newService(map[string]string{ProxyProtocolAnnotation: "v1"}))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("LoadBalancer egress SNAT", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}}
+	}
+
+	It("should return whether the destinations of the service use the load balancer IPs for egress", func() {
+		Expect(getEgressSNATForService(newService(map[string]string{EgressSNATAnnotation: "true"}), false)).To(BeTrue())
+		Expect(getEgressSNATForService(newService(map[string]string{EgressSNATAnnotation: "false"}), true)).To(BeFalse())
+		Expect(getEgressSNATForService(newService(nil), false)).To(BeFalse())
+	})
+
+	It("should reject egress SNAT of internal load balancers and invalid values", func() {
+		_, err := getEgressSNATForService(newService(map[string]string{EgressSNATAnnotation: "true"}), true)
+		Expect(err).To(MatchError(ContainSubstring("not supported for internal load balancers")))
+		_, err = getEgressSNATForService(newService(map[string]string{EgressSNATAnnotation: "always"}), false)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("LoadBalancer annotation pass-through", func() {
+	It("should only copy the allowed pass-through annotations of the service", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: map[string]string{
+			"lb.onmetal.de/idle-timeout":    "30s",
+			"lb.onmetal.de/not-allowed":     "true",
+			"example.org/foo":               "bar",
+			ProxyProtocolAnnotation:         proxyProtocolV2,
+			"lb.onmetal.de/max-connections": "1000",
+		}}}
+		cloudConfig := CloudConfig{LoadBalancerAnnotationKeys: []string{
+			"lb.onmetal.de/idle-timeout",
+			"lb.onmetal.de/max-connections",
+			"lb.onmetal.de/unset",
+			"example.org/foo",
+		}}
+
+		Expect(getPassThroughAnnotationsForService(service, cloudConfig)).To(Equal(map[string]string{
+			"lb.onmetal.de/idle-timeout":    "30s",
+			"lb.onmetal.de/max-connections": "1000",
+		}))
+		Expect(getPassThroughAnnotationsForService(service, CloudConfig{})).To(BeEmpty())
+	})
+})
+
+var _ = Describe("LoadBalancer health check node port", func() {
+	It("should only return the health check node port of services with the local external traffic policy", func() {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+			Spec: corev1.ServiceSpec{
+				Type:                  corev1.ServiceTypeLoadBalancer,
+				ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+				HealthCheckNodePort:   32000,
+			},
+		}
+		Expect(getHealthCheckNodePortForService(service)).To(Equal(int32(32000)))
+
+		service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyCluster
+		Expect(getHealthCheckNodePortForService(service)).To(BeZero())
+	})
+})
+
+var _ = Describe("LoadBalancer lookup", func() {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "0a1b2c3d-uid"},
+	}
+
+	It("should find the load balancer of a service by its labels", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      "renamed",
+				Labels:    getLoadBalancerLabelsForService("test", service),
+			},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "onmetal",
+		}
+		Expect(lb.getLoadBalancerForService(ctx, "test", service)).To(HaveField("Name", "renamed"))
+	})
+
+	It("should fall back to the name of an unlabeled load balancer", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      getLoadBalancerNameForService("test", service, ""),
+			},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "onmetal",
+		}
+		Expect(lb.getLoadBalancerForService(ctx, "test", service)).To(HaveField("Name", "test-foo-0a1b2c3d"))
+	})
+
+	It("should not fall back to a load balancer of another cluster in a shared namespace", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        getLoadBalancerNameForService("test", service, ""),
+				Annotations: map[string]string{AnnotationKeyClusterName: "other"},
+			},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "onmetal",
+			cloudConfig:      CloudConfig{SharedNamespace: true},
+		}
+		_, err := lb.getLoadBalancerForService(ctx, "test", service)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should report a missing load balancer as not existing", func(ctx SpecContext) {
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			onmetalNamespace: "onmetal",
+		}
+		_, exists, err := lb.GetLoadBalancer(ctx, "test", service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should read a load balancer missing in the cache from the onmetal API", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      "test-foo-0a1b2c3d",
+				Labels:    getLoadBalancerLabelsForService("test", service),
+			},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			apiReader:        fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "onmetal",
+			cloudConfig:      CloudConfig{CachedLoadBalancerLookup: true},
+		}
+		Expect(lb.lookupLoadBalancerForService(ctx, "test", service)).To(HaveField("Name", "test-foo-0a1b2c3d"))
+
+		By("only reading from the cache by default")
+		lb.cloudConfig.CachedLoadBalancerLookup = false
+		_, err := lb.lookupLoadBalancerForService(ctx, "test", service)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("LoadBalancer destinations", func() {
+	newMachineWithNetworkInterface := func(name, ip string) (*computev1alpha1.Machine, *networkingv1alpha1.NetworkInterface) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+		}
+		networkInterface := &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name + "-primary"},
+			Spec:       networkingv1alpha1.NetworkInterfaceSpec{NetworkRef: corev1.LocalObjectReference{Name: "network"}},
+			Status:     networkingv1alpha1.NetworkInterfaceStatus{IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP(ip)}},
+		}
+		return machine, networkInterface
+	}
+	newNode := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{ProviderID: getProviderID("foo", name)},
+		}
+	}
+
+	It("should resolve the destinations of all nodes concurrently in the order of the nodes", func(ctx SpecContext) {
+		var objs []client.Object
+		var nodes []*corev1.Node
+		for i := 0; i < 5; i++ {
+			machine, networkInterface := newMachineWithNetworkInterface(fmt.Sprintf("machine-%d", i), fmt.Sprintf("10.0.0.%d", i))
+			objs = append(objs, machine, networkInterface)
+			nodes = append(nodes, newNode(machine.Name))
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(objs...).Build(),
+			onmetalNamespace: "foo",
+			cloudConfig:      CloudConfig{DestinationResolutionConcurrency: 2},
+		}
+
+		destinations, _, err := lb.getLoadBalancerDestinationsForNodes(ctx, nodes, "network", nil, nil, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.0")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.2")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.3")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.4")),
+		))
+	})
+
+	It("should return the errors of the nodes whose destinations failed to resolve", func(ctx SpecContext) {
+		machine, networkInterface := newMachineWithNetworkInterface("machine", "10.0.0.1")
+		brokenMachine, _ := newMachineWithNetworkInterface("broken", "10.0.0.2")
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, networkInterface, brokenMachine).Build(),
+			onmetalNamespace: "foo",
+		}
+
+		_, _, err := lb.getLoadBalancerDestinationsForNodes(ctx, []*corev1.Node{newNode("machine"), newNode("broken")}, "network", nil, nil, destinationLimit{})
+		Expect(err).To(MatchError(ContainSubstring("broken-primary")))
+	})
+
+	It("should only resolve the destinations of nodes in the node pools of the load balancer", func(ctx SpecContext) {
+		ingressMachine, ingressNetworkInterface := newMachineWithNetworkInterface("ingress", "10.0.0.1")
+		ingressMachine.Spec.MachinePoolRef = &corev1.LocalObjectReference{Name: "ingress-pool"}
+		workerMachine, workerNetworkInterface := newMachineWithNetworkInterface("worker", "10.0.0.2")
+		workerMachine.Spec.MachinePoolRef = &corev1.LocalObjectReference{Name: "worker-pool"}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(ingressMachine, ingressNetworkInterface, workerMachine, workerNetworkInterface).Build(),
+			onmetalNamespace: "foo",
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{NodePoolsAnnotation: "ingress-pool, other-pool"},
+			},
+		}
+
+		destinations, _, err := lb.getLoadBalancerDestinationsForNodes(ctx, []*corev1.Node{newNode("ingress"), newNode("worker")}, "network", nil, getNodePoolsForService(service), destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1"))))
+	})
+
+	It("should skip the destinations of nodes replaced by a renamed node", func(ctx SpecContext) {
+		machine, networkInterface := newMachineWithNetworkInterface("machine", "10.0.0.1")
+		machine.UID = "machine-uid"
+		oldNode := newNode("machine")
+		oldNode.CreationTimestamp = metav1.Unix(1, 0)
+		renamedNode := newNode("machine")
+		renamedNode.Name = "renamed"
+		renamedNode.CreationTimestamp = metav1.Unix(2, 0)
+		index := newMachineNodeIndex("foo")
+		index.setMachine(machine)
+		index.setNode(oldNode)
+		index.setNode(renamedNode)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, networkInterface).Build(),
+			onmetalNamespace: "foo",
+			machineNodeIndex: index,
+		}
+
+		destinations, _, err := lb.getLoadBalancerDestinationsForNodes(ctx, []*corev1.Node{oldNode, renamedNode}, "network", nil, nil, destinationLimit{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(HaveExactElements(HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1"))))
+	})
+
+	It("should truncate the destinations spread across the zones of the nodes", func(ctx SpecContext) {
+		var objs []client.Object
+		var nodes []*corev1.Node
+		for i, zone := range []string{"zone-a", "zone-a", "zone-a", "zone-b", "zone-b"} {
+			machine, networkInterface := newMachineWithNetworkInterface(fmt.Sprintf("machine-%d", i), fmt.Sprintf("10.0.0.%d", i))
+			objs = append(objs, machine, networkInterface)
+			node := newNode(machine.Name)
+			node.Labels = map[string]string{corev1.LabelTopologyZone: zone}
+			nodes = append(nodes, node)
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(objs...).Build(),
+			onmetalNamespace: "foo",
+		}
+
+		destinations, dropped, err := lb.getLoadBalancerDestinationsForNodes(ctx, nodes, "network", nil, nil, destinationLimit{max: 3, policy: DestinationOverflowPolicyTruncate})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(Equal(2))
+		Expect(destinations).To(HaveExactElements(
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.0")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.1")),
+			HaveField("IP", commonv1alpha1.MustParseIP("10.0.0.3")),
+		))
+	})
+
+	It("should fail if the destinations exceed the maximum", func(ctx SpecContext) {
+		machine0, networkInterface0 := newMachineWithNetworkInterface("machine-0", "10.0.0.0")
+		machine1, networkInterface1 := newMachineWithNetworkInterface("machine-1", "10.0.0.1")
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine0, networkInterface0, machine1, networkInterface1).Build(),
+			onmetalNamespace: "foo",
+		}
+
+		_, _, err := lb.getLoadBalancerDestinationsForNodes(ctx, []*corev1.Node{newNode("machine-0"), newNode("machine-1")}, "network", nil, nil, destinationLimit{max: 1, policy: DestinationOverflowPolicyError})
+		Expect(err).To(MatchError(ContainSubstring("exceed the maximum of 1")))
+	})
+
+	It("should prefer the destination limit of the service annotations", func() {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					MaxDestinationsAnnotation:           "2",
+					DestinationOverflowPolicyAnnotation: string(DestinationOverflowPolicyTruncate),
+				},
+			},
+		}
+		Expect(getDestinationLimitForService(service, CloudConfig{MaxDestinations: 10})).To(Equal(destinationLimit{max: 2, policy: DestinationOverflowPolicyTruncate}))
+		Expect(getDestinationLimitForService(&corev1.Service{}, CloudConfig{MaxDestinations: 10})).To(Equal(destinationLimit{max: 10, policy: DestinationOverflowPolicyError}))
+
+		service.Annotations[MaxDestinationsAnnotation] = "-1"
+		_, err := getDestinationLimitForService(service, CloudConfig{})
+		Expect(err).To(HaveOccurred())
+	})
+	It("should cap the destination limit to the capacity of a LoadBalancerRouting", func() {
+		capped := destinationLimit{max: maxLoadBalancerRoutingDestinations, policy: DestinationOverflowPolicyTruncate}
+		Expect(destinationLimit{policy: DestinationOverflowPolicyError}.withinRoutingCapacity()).To(Equal(capped))
+		Expect(destinationLimit{max: maxLoadBalancerRoutingDestinations + 1, policy: DestinationOverflowPolicyError}.withinRoutingCapacity()).To(Equal(capped))
+		Expect(destinationLimit{max: 10, policy: DestinationOverflowPolicyError}.withinRoutingCapacity()).To(Equal(destinationLimit{max: 10, policy: DestinationOverflowPolicyError}))
+	})
+
+	It("should report destinations truncated to the capacity of a LoadBalancerRouting", func() {
+		recorder := record.NewFakeRecorder(10)
+		lb := &onmetalLoadBalancer{recorder: recorder}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"}}
+
+		lb.recordTruncatedDestinations(service, loadBalancer, 5, destinationLimit{policy: DestinationOverflowPolicyError})
+		Expect(recorder.Events).To(Receive(ContainSubstring(fmt.Sprintf("exceeding the maximum of %d destinations of a LoadBalancerRouting", maxLoadBalancerRoutingDestinations))))
+
+		lb.recordTruncatedDestinations(service, loadBalancer, 5, destinationLimit{max: 10, policy: DestinationOverflowPolicyTruncate})
+		Expect(recorder.Events).To(Receive(HaveSuffix("exceeding the maximum of 10 destinations")))
+	})
 })
+
+var _ = Describe("LoadBalancer without ports", func() {
+	It("should reject a service without ports", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(1)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			onmetalNamespace: "foo",
+			recorder:         recorder,
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ContainSubstring("has no ports")))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonNoPorts)))
+
+		loadBalancers := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancers)).To(Succeed())
+		Expect(loadBalancers.Items).To(BeEmpty())
+	})
+
+	It("should delete the load balancer of a service whose ports were removed", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(1)
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb", Labels: getLoadBalancerLabelsForService("test", service)},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "foo",
+			cloudConfig:      CloudConfig{ClusterName: "test"},
+			recorder:         recorder,
+		}
+
+		status, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(&corev1.LoadBalancerStatus{}))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Deleting the LoadBalancer of a Service without ports")))
+
+		loadBalancers := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancers)).To(Succeed())
+		Expect(loadBalancers.Items).To(BeEmpty())
+	})
+
+	It("should only release the adopted load balancer of a service whose ports were removed", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(1)
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid", Annotations: map[string]string{LoadBalancerNameAnnotation: "hand-crafted"}},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "hand-crafted"},
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "hand-crafted"},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer, loadBalancerRouting).Build(),
+			onmetalNamespace: "foo",
+			cloudConfig:      CloudConfig{ClusterName: "test"},
+			recorder:         recorder,
+		}
+
+		status, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(&corev1.LoadBalancerStatus{}))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Releasing the adopted LoadBalancer hand-crafted of a Service without ports")))
+
+		Expect(lb.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Satisfy(apierrors.IsNotFound))
+		Expect(lb.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancer)).To(Succeed())
+	})
+})
+
+var _ = Describe("LoadBalancer app protocols", func() {
+	appProtocol := func(appProtocol string) *string {
+		return &appProtocol
+	}
+
+	It("should return the app protocols of the service ports", func() {
+		service := &corev1.Service{
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 80, AppProtocol: appProtocol("http")},
+					{Protocol: corev1.ProtocolTCP, Port: 443, AppProtocol: appProtocol("HTTPS")},
+					{Protocol: corev1.ProtocolTCP, Port: 8080},
+				},
+			},
+		}
+		Expect(getAppProtocolsForService(service)).To(Equal("TCP/80=http,TCP/443=https"))
+	})
+
+	It("should reject a service with an unsupported app protocol", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(1)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			onmetalNamespace: "foo",
+			recorder:         recorder,
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid"},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80, AppProtocol: appProtocol("kubernetes.io/ws")}},
+			},
+		}
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ContainSubstring("unsupported app protocol")))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonUnsupportedAppProtocol)))
+
+		loadBalancers := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancers)).To(Succeed())
+		Expect(loadBalancers.Items).To(BeEmpty())
+	})
+
+	It("should reject a service routing to a named target port", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(1)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			onmetalNamespace: "foo",
+			recorder:         recorder,
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid"},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolTCP, Port: 80, TargetPort: intstr.FromString("http")}},
+			},
+		}
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(MatchError(ContainSubstring("named port")))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonNamedTargetPort)))
+
+		loadBalancers := &networkingv1alpha1.LoadBalancerList{}
+		Expect(lb.onmetalClient.List(ctx, loadBalancers)).To(Succeed())
+		Expect(loadBalancers.Items).To(BeEmpty())
+	})
+})
+
+var _ = Describe("LoadBalancer status", func() {
+	It("should report the ports of the service at every ingress", func() {
+		tcp := corev1.ProtocolTCP
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				Ports: []networkingv1alpha1.LoadBalancerPort{{Protocol: &tcp, Port: 80}},
+			},
+			Status: networkingv1alpha1.LoadBalancerStatus{
+				IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+			},
+		}
+		service := &corev1.Service{
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 80},
+					{Protocol: corev1.ProtocolUDP, Port: 80},
+				},
+			},
+		}
+		portError := portErrorNotProgrammed
+		Expect(getLoadBalancerStatusForService(loadBalancer, service).Ingress).To(ConsistOf(corev1.LoadBalancerIngress{
+			IP: "10.0.0.1",
+			Ports: []corev1.PortStatus{
+				{Protocol: corev1.ProtocolTCP, Port: 80},
+				{Protocol: corev1.ProtocolUDP, Port: 80, Error: &portError},
+			},
+		}))
+	})
+
+	It("should report the DNS name and the allocated ports provided by the data plane", func() {
+		tcp := corev1.ProtocolTCP
+		endPort := int32(443)
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					AnnotationKeyHostname:       "lb.example.org",
+					AnnotationKeyAllocatedPorts: "tcp/80",
+				},
+			},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				Ports: []networkingv1alpha1.LoadBalancerPort{{Protocol: &tcp, Port: 80, EndPort: &endPort}},
+			},
+			Status: networkingv1alpha1.LoadBalancerStatus{
+				IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+			},
+		}
+		service := &corev1.Service{
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Protocol: corev1.ProtocolTCP, Port: 80},
+					{Protocol: corev1.ProtocolTCP, Port: 443},
+				},
+			},
+		}
+		portError := portErrorNotAllocated
+		Expect(getLoadBalancerStatusForService(loadBalancer, service).Ingress).To(ConsistOf(corev1.LoadBalancerIngress{
+			IP:       "10.0.0.1",
+			Hostname: "lb.example.org",
+			Ports: []corev1.PortStatus{
+				{Protocol: corev1.ProtocolTCP, Port: 80},
+				{Protocol: corev1.ProtocolTCP, Port: 443, Error: &portError},
+			},
+		}))
+	})
+
+	It("should annotate the service with the UID and name of its load balancer", func(ctx SpecContext) {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+		lb := &onmetalLoadBalancer{targetClient: fake.NewClientBuilder().WithObjects(service).Build()}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar", UID: "lb-uid"}}
+
+		Expect(lb.annotateServiceWithLoadBalancer(ctx, service, loadBalancer)).To(Succeed())
+		Expect(lb.targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Annotations).To(HaveKeyWithValue(AnnotationKeyLoadBalancerUID, "lb-uid"))
+		Expect(service.Annotations).To(HaveKeyWithValue(AnnotationKeyLoadBalancerName, "bar"))
+	})
+})
+
+var _ = Describe("LoadBalancer apply conflicts", func() {
+	It("should emit an event for an apply conflicting with another field manager", func() {
+		recorder := record.NewFakeRecorder(2)
+		lb := &onmetalLoadBalancer{recorder: recorder}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"}}
+
+		lb.recordApplyConflict(service, loadBalancer, apierrors.NewApplyConflict([]metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict, Field: ".spec.ports"}}, "conflict"))
+		Expect(recorder.Events).To(Receive(And(ContainSubstring(eventReasonApplyConflict), ContainSubstring("foo/bar"))))
+
+		lb.recordApplyConflict(service, loadBalancer, apierrors.NewInternalError(errors.New("internal")))
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("not reporting conflicts of the resource version")
+		lb.recordApplyConflict(service, loadBalancer, apierrors.NewConflict(networkingv1alpha1.Resource("loadbalancers"), "bar", errors.New("the object has been modified")))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
+
+var _ = Describe("LoadBalancer identity", func() {
+	It("should update drifted cluster and service metadata of the load balancer", func(ctx SpecContext) {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "0a1b2c3d-uid"},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "onmetal",
+				Name:      "test-foo-0a1b2c3d",
+				Labels:    getLoadBalancerLabelsForService("test", service),
+				Annotations: map[string]string{
+					AnnotationKeyClusterName:      "test",
+					AnnotationKeyServiceName:      "bar",
+					AnnotationKeyServiceNamespace: "default",
+					AnnotationKeyBackendPorts:     "80",
+				},
+			},
+		}
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).Build(),
+			onmetalNamespace: "onmetal",
+		}
+
+		Expect(lb.reconcileLoadBalancerIdentity(ctx, "test", service, loadBalancer)).To(Succeed())
+
+		updated := &networkingv1alpha1.LoadBalancer{}
+		Expect(lb.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), updated)).To(Succeed())
+		Expect(updated.Annotations).To(Equal(map[string]string{
+			AnnotationKeyClusterName:      "test",
+			AnnotationKeyServiceName:      "foo",
+			AnnotationKeyServiceNamespace: "default",
+			AnnotationKeyServiceUID:       "0a1b2c3d-uid",
+			AnnotationKeyBackendPorts:     "80",
+		}))
+	})
+})
+
+var _ = Describe("LoadBalancer label backfill", func() {
+	It("should label the load balancers of services created before they were labeled", func(ctx SpecContext) {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "0a1b2c3d-uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		annotatedService := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bar", UID: "4e5f6a7b-uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+		nameDerived := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: getLoadBalancerNameForService("test", service, "")},
+		}
+		annotated := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        "renamed",
+				Annotations: getLoadBalancerIdentityAnnotationsForService("test", annotatedService),
+			},
+		}
+		otherCluster := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "onmetal",
+				Name:        "other",
+				Annotations: map[string]string{AnnotationKeyClusterName: "other"},
+			},
+		}
+		orphaned := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "onmetal", Name: "orphaned"},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(nameDerived, annotated, otherCluster, orphaned).Build()
+		lb := &onmetalLoadBalancer{
+			targetClient:     fake.NewClientBuilder().WithObjects(service, annotatedService).Build(),
+			onmetalClient:    onmetalClient,
+			onmetalNamespace: "onmetal",
+		}
+
+		Expect(lb.backfillLoadBalancerLabels(ctx, "test")).To(Succeed())
+
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(nameDerived), nameDerived)).To(Succeed())
+		Expect(nameDerived.Labels).To(Equal(getLoadBalancerLabelsForService("test", service)))
+		Expect(nameDerived.Annotations).To(Equal(getLoadBalancerIdentityAnnotationsForService("test", service)))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(annotated), annotated)).To(Succeed())
+		Expect(annotated.Labels).To(Equal(getLoadBalancerLabelsForService("test", annotatedService)))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(otherCluster), otherCluster)).To(Succeed())
+		Expect(otherCluster.Labels).To(BeEmpty())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(orphaned), orphaned)).To(Succeed())
+		Expect(orphaned.Labels).To(BeEmpty())
+
+		By("finding the renamed load balancer by its labels")
+		Expect(lb.getLoadBalancerForService(ctx, "test", annotatedService)).To(HaveField("Name", "renamed"))
+	})
+})
+
+var _ = Describe("LoadBalancer IP allocation duration", func() {
+	It("should return the parent prefix of the load balancer IPs as pool", func() {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				IPs: []networkingv1alpha1.IPSource{getEphemeralPrefixIPSource("internal-prefix", corev1.IPv4Protocol)},
+			},
+		}
+		Expect(getIPPoolForLoadBalancer(loadBalancer)).To(Equal("internal-prefix"))
+		Expect(getIPPoolForLoadBalancer(&networkingv1alpha1.LoadBalancer{})).To(Equal("default"))
+	})
+
+	It("should observe the allocation duration only until the service has an ingress", func() {
+		created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+			Spec: networkingv1alpha1.LoadBalancerSpec{
+				IPs: []networkingv1alpha1.IPSource{getEphemeralPrefixIPSource("slo-prefix", corev1.IPv4Protocol)},
+			},
+		}
+		service := &corev1.Service{}
+
+		observeIPAllocationDuration(loadBalancer, service, created.Add(3*time.Second))
+		count, sum := getIPAllocationDurationForPool("slo-prefix")
+		Expect(count).To(Equal(uint64(1)))
+		Expect(sum).To(Equal(3.0))
+
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+		observeIPAllocationDuration(loadBalancer, service, created.Add(time.Minute))
+		count, _ = getIPAllocationDurationForPool("slo-prefix")
+		Expect(count).To(Equal(uint64(1)))
+	})
+})
+
+var _ = Describe("LoadBalancer asynchronous provisioning", func() {
+	var (
+		service      *corev1.Service
+		loadBalancer *networkingv1alpha1.LoadBalancer
+	)
+
+	BeforeEach(func() {
+		service = &corev1.Service{}
+		loadBalancer = &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Spec:       networkingv1alpha1.LoadBalancerSpec{Type: networkingv1alpha1.LoadBalancerTypePublic},
+		}
+	})
+
+	It("should only consider load balancers with IPs as provisioned", func() {
+		Expect(isLoadBalancerProvisioned(networkingv1alpha1.LoadBalancerTypePublic, service, loadBalancer, &corev1.LoadBalancerStatus{})).To(BeFalse())
+
+		status := &corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}}
+		Expect(isLoadBalancerProvisioned(networkingv1alpha1.LoadBalancerTypePublic, service, loadBalancer, status)).To(BeTrue())
+	})
+
+	It("should not consider the IPs of the previous type as provisioned", func() {
+		status := &corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}}
+		service.Status.LoadBalancer = *status
+		Expect(isLoadBalancerProvisioned(networkingv1alpha1.LoadBalancerTypeInternal, service, loadBalancer, status)).To(BeFalse())
+
+		newStatus := &corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "192.168.0.1"}}}
+		Expect(isLoadBalancerProvisioned(networkingv1alpha1.LoadBalancerTypeInternal, service, loadBalancer, newStatus)).To(BeTrue())
+	})
+
+	It("should return a retry error recognized by the service controller", func() {
+		err := newLoadBalancerProvisioningError(loadBalancer)
+		var retryErr *cloudproviderapi.RetryError
+		Expect(errors.As(err, &retryErr)).To(BeTrue())
+		Expect(retryErr.RetryAfter()).To(Equal(loadBalancerProvisioningRetryInterval))
+		Expect(err).To(MatchError(ErrLoadBalancerProvisioning))
+		Expect(err).To(MatchError(ContainSubstring("foo/lb")))
+		Expect(IsRetryableError(err)).To(BeTrue())
+	})
+})
+
+func getIPAllocationDurationForPool(pool string) (uint64, float64) {
+	observer := loadBalancerIPAllocationDuration.WithLabelValues(pool)
+	count, err := testutil.GetHistogramMetricCount(observer)
+	Expect(err).NotTo(HaveOccurred())
+	sum, err := testutil.GetHistogramMetricValue(observer)
+	Expect(err).NotTo(HaveOccurred())
+	return count, sum
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// loadBalancerWaiter notifies the waiters for a LoadBalancer whenever it is changed. It is fed by the LoadBalancer
+// informer of the onmetal cluster, so that waiting for the IPs of a LoadBalancer observes their allocation as soon as
+// the cache does, instead of polling.
+type loadBalancerWaiter struct {
+	mu      sync.Mutex
+	waiters map[client.ObjectKey]map[chan struct{}]struct{}
+}
+
+func newLoadBalancerWaiter() *loadBalancerWaiter {
+	return &loadBalancerWaiter{
+		waiters: make(map[client.ObjectKey]map[chan struct{}]struct{}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the waiter at the LoadBalancer informer of the given cache.
+func (w *loadBalancerWaiter) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &networkingv1alpha1.LoadBalancer{})
+	if err != nil {
+		return fmt.Errorf("failed to get LoadBalancer informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.notify(obj)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			w.notify(newObj)
+		},
+	})
+	return err
+}
+
+func (w *loadBalancerWaiter) notify(obj interface{}) {
+	loadBalancer, ok := obj.(*networkingv1alpha1.LoadBalancer)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for changed := range w.waiters[client.ObjectKeyFromObject(loadBalancer)] {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// a pending notification is not consumed yet
+		}
+	}
+}
+
+// watch returns a channel receiving a value whenever the LoadBalancer changed since the last value was received. The
+// returned function stops the watch.
+func (w *loadBalancerWaiter) watch(key client.ObjectKey) (<-chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiters[key] == nil {
+		w.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[key][changed] = struct{}{}
+	return changed, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.waiters[key], changed)
+		if len(w.waiters[key]) == 0 {
+			delete(w.waiters, key)
+		}
+	}
+}
+
+// waitFor evaluates the condition whenever the LoadBalancer changes until it is true, returns an error or the
+// timeout expires. It returns an error for which wait.Interrupted is true on timeout.
+func (w *loadBalancerWaiter) waitFor(ctx context.Context, key client.ObjectKey, timeout time.Duration, condition wait.ConditionWithContextFunc) error {
+	// the watch is started before the first evaluation to not miss a change in between
+	changed, stop := w.watch(key)
+	defer stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		done, err := condition(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return wait.ErrorInterrupted(fmt.Errorf("timed out waiting for LoadBalancer %s", key))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// getBackoffDuration returns the total duration of all steps of the backoff.
+func getBackoffDuration(backoff wait.Backoff) time.Duration {
+	var duration time.Duration
+	for backoff.Steps > 0 {
+		duration += backoff.Step()
+	}
+	return duration
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer waiter", func() {
+	var loadBalancer *networkingv1alpha1.LoadBalancer
+
+	BeforeEach(func() {
+		loadBalancer = &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Spec:       networkingv1alpha1.LoadBalancerSpec{Type: networkingv1alpha1.LoadBalancerTypePublic},
+		}
+	})
+
+	It("should return the status once the IPs of the observed load balancer are allocated", func(ctx SpecContext) {
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).WithStatusSubresource(loadBalancer).Build()
+		waiter := newLoadBalancerWaiter()
+		service := &corev1.Service{}
+
+		type result struct {
+			status corev1.LoadBalancerStatus
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			defer GinkgoRecover()
+			status, err := waitLoadBalancerActive(ctx, onmetalClient, waiter, networkingv1alpha1.LoadBalancerTypePublic, service, loadBalancer.DeepCopy())
+			results <- result{status: status, err: err}
+		}()
+
+		By("not returning before the IPs are allocated")
+		Eventually(func() int {
+			waiter.mu.Lock()
+			defer waiter.mu.Unlock()
+			return len(waiter.waiters[client.ObjectKeyFromObject(loadBalancer)])
+		}).Should(Equal(1))
+		waiter.notify(loadBalancer)
+		Consistently(results, 100*time.Millisecond).ShouldNot(Receive())
+
+		By("returning once the change of the load balancer is observed")
+		loadBalancer.Status.IPs = []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}
+		Expect(onmetalClient.Status().Update(ctx, loadBalancer)).To(Succeed())
+		waiter.notify(loadBalancer)
+
+		var r result
+		Eventually(results).Should(Receive(&r))
+		Expect(r.err).NotTo(HaveOccurred())
+		Expect(r.status.Ingress).To(ConsistOf(HaveField("IP", "10.0.0.1")))
+		Expect(waiter.waiters).To(BeEmpty())
+	})
+
+	It("should time out if the condition is not met", func(ctx SpecContext) {
+		waiter := newLoadBalancerWaiter()
+		err := waiter.waitFor(ctx, client.ObjectKeyFromObject(loadBalancer), 10*time.Millisecond, func(context.Context) (bool, error) {
+			return false, nil
+		})
+		Expect(wait.Interrupted(err)).To(BeTrue())
+	})
+
+	It("should sum up the steps of the backoff", func() {
+		Expect(getBackoffDuration(wait.Backoff{Duration: time.Second, Factor: 2, Steps: 3})).To(Equal(7 * time.Second))
+	})
+})
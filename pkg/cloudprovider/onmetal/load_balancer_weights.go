@@ -0,0 +1,68 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const eventReasonDestinationWeightsUnsupported = "DestinationWeightsUnsupported"
+
+// getNodePoolWeightsForService returns the weights of the destinations of the load balancer of the Service by their
+// MachinePools, see NodePoolWeightsAnnotation. If the destinations are limited to node pools, the weighted
+// MachinePools must be among them.
+func getNodePoolWeightsForService(service *v1.Service) (map[string]int32, error) {
+	value, ok := service.Annotations[NodePoolWeightsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	nodePools := getNodePoolsForService(service)
+	weights := make(map[string]int32)
+	for _, entry := range strings.Split(value, ",") {
+		nodePool, weightValue, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || nodePool == "" {
+			return nil, fmt.Errorf("invalid entry %q in annotation %s of Service %s, expected <machine-pool>=<weight>", entry, NodePoolWeightsAnnotation, client.ObjectKeyFromObject(service))
+		}
+		weight, err := strconv.ParseInt(weightValue, 10, 32)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q of MachinePool %s in annotation %s of Service %s, must be a non-negative integer", weightValue, nodePool, NodePoolWeightsAnnotation, client.ObjectKeyFromObject(service))
+		}
+		if _, ok := weights[nodePool]; ok {
+			return nil, fmt.Errorf("duplicate MachinePool %s in annotation %s of Service %s", nodePool, NodePoolWeightsAnnotation, client.ObjectKeyFromObject(service))
+		}
+		if nodePools.Len() > 0 && !nodePools.Has(nodePool) {
+			return nil, fmt.Errorf("MachinePool %s in annotation %s of Service %s is not among the node pools of annotation %s", nodePool, NodePoolWeightsAnnotation, client.ObjectKeyFromObject(service), NodePoolsAnnotation)
+		}
+		weights[nodePool] = int32(weight)
+	}
+	return weights, nil
+}
+
+// recordUnsupportedDestinationWeights reports that the weights of the destinations of the load balancer of the Service
+// are not applied. The LoadBalancerRouting of the onmetal API has no notion of weights yet, hence traffic is
+// distributed evenly among all destinations regardless of their MachinePools.
+func (o *onmetalLoadBalancer) recordUnsupportedDestinationWeights(service *v1.Service, weights map[string]int32) {
+	if len(weights) == 0 {
+		return
+	}
+	o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonDestinationWeightsUnsupported, "The onmetal LoadBalancerRouting does not support destination weights, ignoring the weights of the MachinePools %v of annotation %s", sets.List(sets.KeySet(weights)), NodePoolWeightsAnnotation)
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("LoadBalancer destination weights", func() {
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", Annotations: annotations}}
+	}
+
+	It("should parse the node pool weights of the service", func() {
+		Expect(getNodePoolWeightsForService(newService(nil))).To(BeEmpty())
+		Expect(getNodePoolWeightsForService(newService(map[string]string{
+			NodePoolWeightsAnnotation: "stable=9, canary=1,drained=0",
+		}))).To(Equal(map[string]int32{"stable": 9, "canary": 1, "drained": 0}))
+	})
+
+	DescribeTable("should reject invalid node pool weights",
+		func(annotations map[string]string, expectedErr string) {
+			_, err := getNodePoolWeightsForService(newService(annotations))
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("missing weight", map[string]string{NodePoolWeightsAnnotation: "stable"}, `invalid entry "stable"`),
+		Entry("negative weight", map[string]string{NodePoolWeightsAnnotation: "stable=-1"}, `invalid weight "-1"`),
+		Entry("duplicate node pool", map[string]string{NodePoolWeightsAnnotation: "stable=1,stable=2"}, "duplicate MachinePool stable"),
+		Entry("node pool not selected", map[string]string{NodePoolsAnnotation: "stable", NodePoolWeightsAnnotation: "canary=1"}, "MachinePool canary"),
+	)
+
+	It("should report that destination weights are not supported", func() {
+		recorder := record.NewFakeRecorder(10)
+		o := &onmetalLoadBalancer{recorder: recorder}
+		service := newService(nil)
+
+		o.recordUnsupportedDestinationWeights(service, nil)
+		Expect(recorder.Events).NotTo(Receive())
+
+		o.recordUnsupportedDestinationWeights(service, map[string]int32{"stable": 9, "canary": 1})
+		Expect(recorder.Events).To(Receive(SatisfyAll(
+			ContainSubstring(eventReasonDestinationWeightsUnsupported),
+			ContainSubstring("[canary stable]"),
+		)))
+	})
+})
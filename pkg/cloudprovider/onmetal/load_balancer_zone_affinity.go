@@ -0,0 +1,158 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+const (
+	// zoneAffinityPreferred prefers destinations in the zone of the client, falling back to the other zones
+	zoneAffinityPreferred = "preferred"
+	// zoneAffinityRequired only routes to destinations in the zone of the client
+	zoneAffinityRequired = "required"
+
+	eventReasonDestinationsWithoutZone = "DestinationsWithoutZone"
+)
+
+// getZoneAffinityForService returns the zone affinity of the Service or an empty string if its load balancer routes
+// to the destinations of all zones alike.
+func getZoneAffinityForService(service *v1.Service) (string, error) {
+	zoneAffinity, ok := service.Annotations[ZoneAffinityAnnotation]
+	if !ok {
+		return "", nil
+	}
+	if zoneAffinity != zoneAffinityPreferred && zoneAffinity != zoneAffinityRequired {
+		return "", fmt.Errorf("unsupported zone affinity %q in annotation %s of Service %s, supported zone affinities: %s, %s", zoneAffinity, ZoneAffinityAnnotation, client.ObjectKeyFromObject(service), zoneAffinityPreferred, zoneAffinityRequired)
+	}
+	return zoneAffinity, nil
+}
+
+// getDestinationZonesForMachine returns the zone of the MachinePool of the Machine by the names of its
+// NetworkInterfaces. The NetworkInterfaces of Machines not scheduled to a MachinePool are not in any zone.
+func getDestinationZonesForMachine(machine *computev1alpha1.Machine, cloudConfig CloudConfig) map[string]string {
+	zones := make(map[string]string)
+	if machine.Spec.MachinePoolRef == nil || machine.Spec.MachinePoolRef.Name == "" {
+		return zones
+	}
+	zone := cloudConfig.zoneForMachinePool(machine.Spec.MachinePoolRef.Name)
+	for _, machineNIC := range machine.Spec.NetworkInterfaces {
+		zones[getMachineNetworkInterfaceName(machine, machineNIC)] = zone
+	}
+	return zones
+}
+
+// getDestinationZones returns the zones of the NetworkInterfaces of the Machines in the namespaces of the cloud
+// provider by the names of the NetworkInterfaces.
+func (o *onmetalLoadBalancer) getDestinationZones(ctx context.Context) (map[string]string, error) {
+	zones := make(map[string]string)
+	for _, namespace := range getMachineNamespaces(o.onmetalNamespace, o.cloudConfig) {
+		listOpts := []client.ListOption{client.InNamespace(namespace)}
+		if clusterName := getMachineClusterName(o.cloudConfig); clusterName != "" {
+			listOpts = append(listOpts, client.MatchingLabels{LabelKeyClusterName: clusterName})
+		}
+		machineList := &computev1alpha1.MachineList{}
+		if err := o.onmetalClient.List(ctx, machineList, listOpts...); err != nil {
+			return nil, fmt.Errorf("failed to list Machines in namespace %s: %w", namespace, err)
+		}
+		for i := range machineList.Items {
+			for name, zone := range getDestinationZonesForMachine(&machineList.Items[i], o.cloudConfig) {
+				zones[name] = zone
+			}
+		}
+	}
+	return zones, nil
+}
+
+// formatDestinationZones returns the zones of the NetworkInterfaces of the destinations as a comma separated list of
+// <network-interface>=<zone>, sorted by NetworkInterface. It also returns the number of destinations of unknown zone.
+func formatDestinationZones(destinations []networkingv1alpha1.LoadBalancerDestination, zones map[string]string) (string, int) {
+	var entries []string
+	withoutZone := 0
+	for _, destination := range destinations {
+		if destination.TargetRef == nil {
+			withoutZone++
+			continue
+		}
+		zone, ok := zones[destination.TargetRef.Name]
+		if !ok {
+			withoutZone++
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s=%s", destination.TargetRef.Name, zone))
+	}
+	slices.Sort(entries)
+	return strings.Join(slices.Compact(entries), ","), withoutZone
+}
+
+// parseDestinationZones parses the zones of the NetworkInterfaces formatted by formatDestinationZones. Malformed
+// entries are skipped.
+func parseDestinationZones(value string) map[string]string {
+	zones := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		name, zone, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || zone == "" {
+			continue
+		}
+		zones[name] = zone
+	}
+	return zones
+}
+
+// setDestinationZones annotates the LoadBalancerRouting with the zones of its destinations for data planes
+// implementing zone affinity. Without zone affinity, the annotation is removed. It returns the number of destinations
+// of unknown zone.
+func setDestinationZones(loadBalancerRouting *networkingv1alpha1.LoadBalancerRouting, zoneAffinity string, zones map[string]string) int {
+	annotations := loadBalancerRouting.GetAnnotations()
+	if zoneAffinity == "" {
+		delete(annotations, AnnotationKeyDestinationZones)
+		return 0
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	destinationZones, withoutZone := formatDestinationZones(loadBalancerRouting.Destinations, zones)
+	annotations[AnnotationKeyDestinationZones] = destinationZones
+	loadBalancerRouting.SetAnnotations(annotations)
+	return withoutZone
+}
+
+// applyDestinationZones annotates the LoadBalancerRouting of the Service with the zones of its destinations if the
+// Service requests zone affinity.
+func (o *onmetalLoadBalancer) applyDestinationZones(ctx context.Context, service *v1.Service, loadBalancerRouting *networkingv1alpha1.LoadBalancerRouting) error {
+	zoneAffinity, err := getZoneAffinityForService(service)
+	if err != nil {
+		return err
+	}
+	var zones map[string]string
+	if zoneAffinity != "" {
+		if zones, err = o.getDestinationZones(ctx); err != nil {
+			return err
+		}
+	}
+	if withoutZone := setDestinationZones(loadBalancerRouting, zoneAffinity, zones); withoutZone > 0 && zoneAffinity == zoneAffinityRequired {
+		o.recorder.Eventf(service, v1.EventTypeWarning, eventReasonDestinationsWithoutZone, "%d destinations of LoadBalancerRouting %s are not in any zone and are not routed to with the zone affinity %s", withoutZone, client.ObjectKeyFromObject(loadBalancerRouting), zoneAffinityRequired)
+	}
+	return nil
+}
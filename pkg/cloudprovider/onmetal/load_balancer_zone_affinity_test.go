@@ -0,0 +1,111 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("LoadBalancer zone affinity", func() {
+	newDestination := func(ip, networkInterfaceName string) networkingv1alpha1.LoadBalancerDestination {
+		return networkingv1alpha1.LoadBalancerDestination{
+			IP:        commonv1alpha1.MustParseIP(ip),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{Name: networkInterfaceName},
+		}
+	}
+
+	newMachine := func(name, machinePoolName string) *computev1alpha1.Machine {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+		}
+		if machinePoolName != "" {
+			machine.Spec.MachinePoolRef = &corev1.LocalObjectReference{Name: machinePoolName}
+		}
+		return machine
+	}
+
+	It("should validate the zone affinity of the service", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"}}
+		Expect(getZoneAffinityForService(service)).To(BeEmpty())
+
+		service.Annotations = map[string]string{ZoneAffinityAnnotation: zoneAffinityRequired}
+		Expect(getZoneAffinityForService(service)).To(Equal(zoneAffinityRequired))
+
+		service.Annotations[ZoneAffinityAnnotation] = "always"
+		_, err := getZoneAffinityForService(service)
+		Expect(err).To(MatchError(ContainSubstring(`unsupported zone affinity "always"`)))
+	})
+
+	It("should resolve the zones of the network interfaces from the machine pools", func() {
+		cloudConfig := CloudConfig{MachinePoolTopology: map[string]MachinePoolTopology{"pool-a": {Zone: "zone-a"}}}
+
+		Expect(getDestinationZonesForMachine(newMachine("machine-a", "pool-a"), cloudConfig)).To(Equal(map[string]string{"machine-a-primary": "zone-a"}))
+		Expect(getDestinationZonesForMachine(newMachine("machine-b", "pool-b"), cloudConfig)).To(Equal(map[string]string{"machine-b-primary": "pool-b"}))
+		Expect(getDestinationZonesForMachine(newMachine("machine-c", ""), cloudConfig)).To(BeEmpty())
+	})
+
+	It("should format and parse the zones of the destinations", func() {
+		destinations := []networkingv1alpha1.LoadBalancerDestination{
+			newDestination("10.0.0.2", "nic-b"), newDestination("10.0.0.1", "nic-a"), newDestination("fd00::1", "nic-a"), newDestination("10.0.0.3", "nic-c"),
+		}
+
+		value, withoutZone := formatDestinationZones(destinations, map[string]string{"nic-a": "zone-a", "nic-b": "zone-b"})
+		Expect(value).To(Equal("nic-a=zone-a,nic-b=zone-b"))
+		Expect(withoutZone).To(Equal(1))
+		Expect(parseDestinationZones(value + ",malformed")).To(Equal(map[string]string{"nic-a": "zone-a", "nic-b": "zone-b"}))
+	})
+
+	It("should annotate the load balancer routing of services with zone affinity", func(ctx SpecContext) {
+		recorder := record.NewFakeRecorder(10)
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newMachine("machine-a", "zone-a"), newMachine("machine-b", "")).Build(),
+			onmetalNamespace: "foo",
+			recorder:         recorder,
+		}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "service",
+			Annotations: map[string]string{ZoneAffinityAnnotation: zoneAffinityRequired},
+		}}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{
+				newDestination("10.0.0.1", "machine-a-primary"), newDestination("10.0.0.2", "machine-b-primary"),
+			},
+		}
+
+		By("annotating the zones of the destinations")
+		Expect(lb.applyDestinationZones(ctx, service, loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Annotations).To(HaveKeyWithValue(AnnotationKeyDestinationZones, "machine-a-primary=zone-a"))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonDestinationsWithoutZone)))
+
+		By("removing the annotation once the service has no zone affinity")
+		delete(service.Annotations, ZoneAffinityAnnotation)
+		Expect(lb.applyDestinationZones(ctx, service, loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Annotations).NotTo(HaveKey(AnnotationKeyDestinationZones))
+	})
+})
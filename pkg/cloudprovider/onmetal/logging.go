@@ -0,0 +1,243 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Log modules group the logs of the onmetal cloud provider, their verbosity can be set independently of the global
+// verbosity with --onmetal-log-verbosity.
+const (
+	logModuleLoadBalancer = "load-balancer"
+	logModuleInstances    = "instances"
+	logModuleRoutes       = "routes"
+)
+
+var logModules = sets.New(logModuleLoadBalancer, logModuleInstances, logModuleRoutes)
+
+// logVerbosityFlag is a flag of comma-separated module=level pairs setting the verbosity of log modules.
+type logVerbosityFlag struct {
+	verbosity *map[string]int
+}
+
+func newLogVerbosityFlag(verbosity *map[string]int) *logVerbosityFlag {
+	return &logVerbosityFlag{verbosity: verbosity}
+}
+
+func (f *logVerbosityFlag) String() string {
+	if f.verbosity == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*f.verbosity))
+	for module, level := range *f.verbosity {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", module, level))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f *logVerbosityFlag) Set(value string) error {
+	verbosity := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		module, levelStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid log verbosity %q, expected module=level", pair)
+		}
+		module = strings.TrimSpace(module)
+		if !logModules.Has(module) {
+			return fmt.Errorf("unknown log module %q, supported modules are %s", module, strings.Join(sets.List(logModules), ", "))
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(levelStr))
+		if err != nil || level < 0 {
+			return fmt.Errorf("invalid log verbosity %q of module %s, expected a non-negative integer", levelStr, module)
+		}
+		verbosity[module] = level
+	}
+	*f.verbosity = verbosity
+	return nil
+}
+
+func (f *logVerbosityFlag) Type() string {
+	return "mapStringInt"
+}
+
+// logModuleContextKey is the context key of the log module of the logger in the context.
+type logModuleContextKey struct{}
+
+// withLogger returns a context carrying the logger of the given module with the given key/value pairs attached, to
+// be retrieved with klog.FromContext by everything called with the context. The logger logs at the verbosity of the
+// module if it is set with --onmetal-log-verbosity, at the global verbosity otherwise.
+func withLogger(ctx context.Context, module string, keysAndValues ...any) context.Context {
+	logger := klog.FromContext(ctx)
+	if ctx.Value(logModuleContextKey{}) == module {
+		// e.g. EnsureLoadBalancer deleting a LoadBalancer changed to another type
+		return klog.NewContext(ctx, logger.WithValues(keysAndValues...))
+	}
+
+	logger = logger.WithName(module).WithValues(keysAndValues...)
+	if verbosity, ok := OnmetalLogVerbosity[module]; ok {
+		logger = withVerbosity(logger, verbosity)
+	}
+	return klog.NewContext(context.WithValue(ctx, logModuleContextKey{}, module), logger)
+}
+
+// withServiceLogger returns a context carrying the logger of the LoadBalancer of the given Service.
+func withServiceLogger(ctx context.Context, clusterName string, service *corev1.Service) context.Context {
+	return withLogger(ctx, logModuleLoadBalancer, "Cluster", clusterName, "Service", client.ObjectKeyFromObject(service))
+}
+
+// withVerbosity returns a logger logging messages up to the given verbosity regardless of the global verbosity.
+func withVerbosity(logger logr.Logger, verbosity int) logr.Logger {
+	sink := logger.WithCallDepth(1).GetSink()
+	if sink == nil {
+		return logger
+	}
+	return logr.New(&verbosityLogSink{LogSink: sink, verbosity: verbosity})
+}
+
+// verbosityLogSink enables the messages up to a verbosity. As klog checks the global verbosity again when logging,
+// enabled messages are passed to the wrapped sink at level 0.
+type verbosityLogSink struct {
+	logr.LogSink
+	verbosity int
+}
+
+func (s *verbosityLogSink) Init(logr.RuntimeInfo) {}
+
+func (s *verbosityLogSink) Enabled(level int) bool {
+	return level <= s.verbosity
+}
+
+func (s *verbosityLogSink) Info(_ int, msg string, keysAndValues ...any) {
+	s.LogSink.Info(0, msg, keysAndValues...)
+}
+
+func (s *verbosityLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &verbosityLogSink{LogSink: s.LogSink.WithValues(keysAndValues...), verbosity: s.verbosity}
+}
+
+func (s *verbosityLogSink) WithName(name string) logr.LogSink {
+	return &verbosityLogSink{LogSink: s.LogSink.WithName(name), verbosity: s.verbosity}
+}
+
+func (s *verbosityLogSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.LogSink.(logr.CallDepthLogSink); ok {
+		return &verbosityLogSink{LogSink: sink.WithCallDepth(depth), verbosity: s.verbosity}
+	}
+	return s
+}
+
+// logSampler samples the verbose logs of high-frequency operations: per key, the verbose logs of one operation per
+// interval are kept, those of the other operations are dropped and their number is reported with the next kept
+// operation. Non-verbose logs and errors are never dropped. A nil logSampler or a zero interval keeps all logs.
+type logSampler struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*logSampleWindow
+}
+
+// logSampleWindow is the interval in which the verbose logs of one operation of a key were kept.
+type logSampleWindow struct {
+	start   time.Time
+	dropped int
+}
+
+func newLogSampler(interval time.Duration) *logSampler {
+	if interval <= 0 {
+		return nil
+	}
+	return &logSampler{
+		interval: interval,
+		now:      time.Now,
+		windows:  make(map[string]*logSampleWindow),
+	}
+}
+
+// sample returns the logger to use for an operation of the given key.
+func (s *logSampler) sample(logger logr.Logger, key string) logr.Logger {
+	if s == nil {
+		return logger
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	window, ok := s.windows[key]
+	if ok && now.Sub(window.start) < s.interval {
+		window.dropped++
+		return logr.New(&sampledLogSink{LogSink: logger.WithCallDepth(1).GetSink()})
+	}
+
+	s.pruneLocked(now)
+	s.windows[key] = &logSampleWindow{start: now}
+	if ok && window.dropped > 0 {
+		return logger.WithValues("SampledOut", window.dropped)
+	}
+	return logger
+}
+
+// pruneLocked removes the windows which ended an interval ago, so keys that are not logged anymore, e.g. of deleted
+// Nodes, are forgotten.
+func (s *logSampler) pruneLocked(now time.Time) {
+	for key, window := range s.windows {
+		if now.Sub(window.start) >= 2*s.interval {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// sampledLogSink drops the verbose messages of a sampled out operation.
+type sampledLogSink struct {
+	logr.LogSink
+}
+
+func (s *sampledLogSink) Init(logr.RuntimeInfo) {}
+
+func (s *sampledLogSink) Enabled(level int) bool {
+	return level == 0 && s.LogSink.Enabled(level)
+}
+
+func (s *sampledLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &sampledLogSink{LogSink: s.LogSink.WithValues(keysAndValues...)}
+}
+
+func (s *sampledLogSink) WithName(name string) logr.LogSink {
+	return &sampledLogSink{LogSink: s.LogSink.WithName(name)}
+}
+
+func (s *sampledLogSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.LogSink.(logr.CallDepthLogSink); ok {
+		return &sampledLogSink{LogSink: sink.WithCallDepth(depth)}
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Logging", func() {
+	var (
+		logs   []string
+		logger logr.Logger
+	)
+
+	BeforeEach(func() {
+		logs = nil
+		logger = funcr.New(func(prefix, args string) {
+			logs = append(logs, prefix+" "+args)
+		}, funcr.Options{Verbosity: 2})
+	})
+
+	It("should parse the verbosity of log modules", func() {
+		var verbosity map[string]int
+		flag := newLogVerbosityFlag(&verbosity)
+
+		Expect(flag.Set("load-balancer=4, instances=0")).To(Succeed())
+		Expect(verbosity).To(Equal(map[string]int{logModuleLoadBalancer: 4, logModuleInstances: 0}))
+		Expect(flag.String()).To(Equal("instances=0,load-balancer=4"))
+
+		Expect(flag.Set("machines=4")).To(MatchError(ContainSubstring(`unknown log module "machines"`)))
+		Expect(flag.Set("routes=-1")).To(MatchError(ContainSubstring("expected a non-negative integer")))
+		Expect(flag.Set("routes")).To(MatchError(ContainSubstring("expected module=level")))
+	})
+
+	It("should log at the verbosity of the module", func() {
+		verbosity := OnmetalLogVerbosity
+		DeferCleanup(func() { OnmetalLogVerbosity = verbosity })
+		OnmetalLogVerbosity = map[string]int{logModuleInstances: 4, logModuleRoutes: 0}
+		ctx := klog.NewContext(context.Background(), logger)
+
+		instancesCtx := withLogger(ctx, logModuleInstances, "Node", "node")
+		klog.FromContext(instancesCtx).V(4).Info("kept")
+		klog.FromContext(instancesCtx).V(5).Info("dropped")
+		Expect(logs).To(ConsistOf(And(HavePrefix("instances "), ContainSubstring(`"msg"="kept"`), ContainSubstring(`"Node"="node"`))))
+
+		By("lowering the verbosity of a module below the global verbosity")
+		logs = nil
+		klog.FromContext(withLogger(ctx, logModuleRoutes)).V(1).Info("dropped")
+		Expect(logs).To(BeEmpty())
+
+		By("keeping the global verbosity of modules without verbosity")
+		klog.FromContext(withLogger(ctx, logModuleLoadBalancer)).V(2).Info("kept")
+		klog.FromContext(withLogger(ctx, logModuleLoadBalancer)).V(3).Info("dropped")
+		Expect(logs).To(ConsistOf(ContainSubstring(`"msg"="kept"`)))
+
+		By("naming nested loggers of the same module once")
+		logs = nil
+		nestedCtx := withLogger(withLogger(ctx, logModuleLoadBalancer, "Service", "foo/bar"), logModuleLoadBalancer, "Service", "foo/bar")
+		klog.FromContext(nestedCtx).Info("nested")
+		Expect(logs).To(ConsistOf(HavePrefix("load-balancer \"")))
+	})
+
+	It("should sample the verbose logs of an operation per key", func() {
+		now := time.Unix(0, 0)
+		sampler := newLogSampler(time.Minute)
+		sampler.now = func() time.Time { return now }
+
+		sampler.sample(logger, "node").V(2).Info("kept")
+		Expect(logs).To(HaveLen(1))
+
+		By("dropping only the verbose logs of operations within the interval")
+		logs = nil
+		sampled := sampler.sample(logger, "node")
+		sampled.V(2).Info("dropped")
+		sampled.Info("kept")
+		sampled.Error(errors.New("failed"), "kept")
+		sampler.sample(logger, "other-node").V(2).Info("kept")
+		Expect(logs).To(HaveLen(3))
+		Expect(logs).NotTo(ContainElement(ContainSubstring("dropped")))
+
+		By("reporting the number of dropped operations with the next kept operation")
+		logs = nil
+		now = now.Add(time.Minute)
+		sampler.sample(logger, "node").V(2).Info("kept")
+		Expect(logs).To(ConsistOf(ContainSubstring(`"SampledOut"=1`)))
+
+		By("keeping all logs without sampling interval")
+		Expect(newLogSampler(0).sample(logger, "node")).To(Equal(logger))
+	})
+})
@@ -0,0 +1,177 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+const (
+	eventReasonMachineFailed    = "MachineFailed"
+	eventReasonMachineRecovered = "MachineRecovered"
+)
+
+// machineFailureReconciler records a Warning event on the Nodes of failed Machines and, with TaintFailedMachines,
+// taints them until the Machine recovers.
+type machineFailureReconciler struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	recorder         record.EventRecorder
+	machineNodeIndex *machineNodeIndex
+	queue            workqueue.RateLimitingInterface
+}
+
+func newMachineFailureReconciler(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig, recorder record.EventRecorder, machineNodeIndex *machineNodeIndex) *machineFailureReconciler {
+	return &machineFailureReconciler{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+		recorder:         recorder,
+		machineNodeIndex: machineNodeIndex,
+		queue:            workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "machine-failure"}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the reconciler at the Machine informer of the given cache.
+func (r *machineFailureReconciler) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &computev1alpha1.Machine{})
+	if err != nil {
+		return fmt.Errorf("failed to get Machine informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueue(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMachine, oldOK := oldObj.(*computev1alpha1.Machine)
+			newMachine, newOK := newObj.(*computev1alpha1.Machine)
+			if oldOK && newOK && oldMachine.Status.State == newMachine.Status.State {
+				return
+			}
+			r.enqueue(newObj)
+		},
+	})
+	return err
+}
+
+func (r *machineFailureReconciler) enqueue(obj interface{}) {
+	if machine, ok := obj.(*computev1alpha1.Machine); ok {
+		r.queue.Add(machine.Name)
+	}
+}
+
+// Start processes queued Machines until the context is done.
+func (r *machineFailureReconciler) Start(ctx context.Context) {
+	defer r.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (r *machineFailureReconciler) processNextItem(ctx context.Context) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	machineName := item.(string)
+	if err := r.reconcile(ctx, machineName); err != nil {
+		klog.ErrorS(err, "Failed to reconcile failure state of Machine", "Machine", machineName)
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *machineFailureReconciler) reconcile(ctx context.Context, machineName string) error {
+	machine := &computev1alpha1.Machine{}
+	if err := r.onmetalClient.Get(ctx, client.ObjectKey{Namespace: r.onmetalNamespace, Name: machineName}, machine); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	nodeName, ok := r.machineNodeIndex.NodeNameForMachine(machine.UID)
+	if !ok {
+		nodeName = machine.Name
+	}
+	node := &corev1.Node{}
+	if err := r.targetClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Machine does not back a Node of this cluster
+			return nil
+		}
+		return fmt.Errorf("failed to get Node %s: %w", nodeName, err)
+	}
+
+	failed := isMachineFailed(machine)
+	if failed {
+		r.recorder.Eventf(node, corev1.EventTypeWarning, eventReasonMachineFailed, "Machine %s backing the Node is in state %s", client.ObjectKeyFromObject(machine), machine.Status.State)
+	}
+	if !r.cloudConfig.TaintFailedMachines {
+		return nil
+	}
+	return r.reconcileNodeTaint(ctx, node, machine, failed)
+}
+
+func (r *machineFailureReconciler) reconcileNodeTaint(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, failed bool) error {
+	hasTaint := false
+	var taints []corev1.Taint
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintKeyMachineFailed {
+			hasTaint = true
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	if hasTaint == failed {
+		return nil
+	}
+
+	nodeBase := node.DeepCopy()
+	if failed {
+		taints = append(taints, corev1.Taint{
+			Key:    TaintKeyMachineFailed,
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+	node.Spec.Taints = taints
+	klog.V(2).InfoS("Updating failure taint of Node", "Node", node.Name, "Failed", failed)
+	if err := r.targetClient.Patch(ctx, node, client.MergeFrom(nodeBase)); err != nil {
+		return fmt.Errorf("failed to patch taints of Node %s: %w", node.Name, err)
+	}
+	if !failed {
+		r.recorder.Eventf(node, corev1.EventTypeNormal, eventReasonMachineRecovered, "Machine %s backing the Node recovered in state %s", client.ObjectKeyFromObject(machine), machine.Status.State)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+var _ = Describe("MachineFailureReconciler", func() {
+	var (
+		machine       *computev1alpha1.Machine
+		node          *corev1.Node
+		onmetalClient client.Client
+		targetClient  client.Client
+		recorder      *record.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		machine = &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Status:     computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateTerminated},
+		}
+		node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).Build()
+		targetClient = fake.NewClientBuilder().WithObjects(node).Build()
+		recorder = record.NewFakeRecorder(10)
+	})
+
+	It("should report the failure of a machine on its node", func(ctx SpecContext) {
+		reconciler := newMachineFailureReconciler(targetClient, onmetalClient, "foo", CloudConfig{ReportMachineFailures: true}, recorder, newMachineNodeIndex("foo"))
+
+		Expect(reconciler.reconcile(ctx, machine.Name)).To(Succeed())
+		Expect(recorder.Events).To(Receive(Equal("Warning MachineFailed Machine foo/machine backing the Node is in state Terminated")))
+
+		By("not tainting the node without taintFailedMachines")
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(BeEmpty())
+	})
+
+	It("should taint the node of a failed machine until it recovers", func(ctx SpecContext) {
+		reconciler := newMachineFailureReconciler(targetClient, onmetalClient, "foo", CloudConfig{TaintFailedMachines: true}, recorder, newMachineNodeIndex("foo"))
+
+		By("reconciling the failed machine")
+		Expect(reconciler.reconcile(ctx, machine.Name)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(ConsistOf(corev1.Taint{Key: TaintKeyMachineFailed, Effect: corev1.TaintEffectNoSchedule}))
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonMachineFailed)))
+
+		By("reconciling the recovered machine")
+		machineBase := machine.DeepCopy()
+		machine.Status.State = computev1alpha1.MachineStateRunning
+		Expect(onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase))).To(Succeed())
+		Expect(reconciler.reconcile(ctx, machine.Name)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonMachineRecovered)))
+
+		By("not reporting the running machine again")
+		Expect(reconciler.reconcile(ctx, machine.Name)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should ignore machines not backing a node of the cluster", func(ctx SpecContext) {
+		reconciler := newMachineFailureReconciler(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{TaintFailedMachines: true}, recorder, newMachineNodeIndex("foo"))
+
+		Expect(reconciler.reconcile(ctx, machine.Name)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
@@ -0,0 +1,237 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+const (
+	machineNodeIndexPath = "/debug/machine-node-index"
+)
+
+// machineNodeIndex maps the UIDs of Machines to the names of the Nodes they back. It is fed by the Machine informer
+// of the onmetal cluster and the Node informer of the target cluster. Nodes are matched to Machines by their provider
+// ID, Machines without a Node with a provider ID are matched to the Node with the same name. If several Nodes
+// reference the same Machine, e.g. because the Node was recreated under a new name, the newest Node backs the Machine.
+type machineNodeIndex struct {
+	onmetalNamespace string
+
+	mu                        sync.RWMutex
+	machineNameByUID          map[types.UID]string
+	nodeByMachineName         map[string]indexedNode
+	lastNodeNameByMachineName map[string]string
+	nodeRenameHandlers        []func(oldNodeName, newNodeName string)
+}
+
+// indexedNode is a Node backed by a Machine.
+type indexedNode struct {
+	name              string
+	creationTimestamp metav1.Time
+}
+
+func newMachineNodeIndex(namespace string) *machineNodeIndex {
+	return &machineNodeIndex{
+		onmetalNamespace:          namespace,
+		machineNameByUID:          make(map[types.UID]string),
+		nodeByMachineName:         make(map[string]indexedNode),
+		lastNodeNameByMachineName: make(map[string]string),
+	}
+}
+
+// AddNodeRenameHandler registers a handler called once a Machine is backed by a Node with another name than before.
+func (i *machineNodeIndex) AddNodeRenameHandler(handler func(oldNodeName, newNodeName string)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.nodeRenameHandlers = append(i.nodeRenameHandlers, handler)
+}
+
+// SetupWithCaches registers the event handlers of the index at the Machine informer of the onmetal cache and the
+// Node informer of the target cache.
+func (i *machineNodeIndex) SetupWithCaches(ctx context.Context, onmetalCache, targetCache cache.Cache) error {
+	machineInformer, err := onmetalCache.GetInformer(ctx, &computev1alpha1.Machine{})
+	if err != nil {
+		return fmt.Errorf("failed to get Machine informer: %w", err)
+	}
+	if _, err := machineInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if machine, ok := obj.(*computev1alpha1.Machine); ok {
+				i.setMachine(machine)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if machine, ok := newObj.(*computev1alpha1.Machine); ok {
+				i.setMachine(machine)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if machine, ok := obj.(*computev1alpha1.Machine); ok {
+				i.deleteMachine(machine)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add Machine event handler: %w", err)
+	}
+
+	nodeInformer, err := targetCache.GetInformer(ctx, &corev1.Node{})
+	if err != nil {
+		return fmt.Errorf("failed to get Node informer: %w", err)
+	}
+	if _, err := nodeInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				i.setNode(node)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if node, ok := newObj.(*corev1.Node); ok {
+				i.setNode(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*corev1.Node); ok {
+				i.deleteNode(node)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add Node event handler: %w", err)
+	}
+	return nil
+}
+
+func (i *machineNodeIndex) setMachine(machine *computev1alpha1.Machine) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.machineNameByUID[machine.UID] = machine.Name
+}
+
+func (i *machineNodeIndex) deleteMachine(machine *computev1alpha1.Machine) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.machineNameByUID, machine.UID)
+	delete(i.lastNodeNameByMachineName, machine.Name)
+}
+
+func (i *machineNodeIndex) setNode(node *corev1.Node) {
+	machineName, ok := i.machineNameForNode(node)
+	if !ok {
+		return
+	}
+	i.mu.Lock()
+	current, ok := i.nodeByMachineName[machineName]
+	if ok && current.name != node.Name && node.CreationTimestamp.Before(&current.creationTimestamp) {
+		// a stale Node of the Machine must not take over from the Node replacing it
+		i.mu.Unlock()
+		return
+	}
+	i.nodeByMachineName[machineName] = indexedNode{name: node.Name, creationTimestamp: node.CreationTimestamp}
+	lastNodeName, renamed := i.lastNodeNameByMachineName[machineName]
+	renamed = renamed && lastNodeName != node.Name
+	i.lastNodeNameByMachineName[machineName] = node.Name
+	handlers := slices.Clone(i.nodeRenameHandlers)
+	i.mu.Unlock()
+
+	if renamed {
+		klog.InfoS("Node of Machine was renamed", "Machine", machineName, "OldNode", lastNodeName, "Node", node.Name)
+		for _, handler := range handlers {
+			handler(lastNodeName, node.Name)
+		}
+	}
+}
+
+func (i *machineNodeIndex) deleteNode(node *corev1.Node) {
+	machineName, ok := i.machineNameForNode(node)
+	if !ok {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.nodeByMachineName[machineName].name == node.Name {
+		delete(i.nodeByMachineName, machineName)
+	}
+}
+
+// IsNodeReplaced returns whether the Machine referenced by the provider ID of the Node is backed by another Node,
+// i.e. the Node was recreated under a new name and the given Node is stale.
+func (i *machineNodeIndex) IsNodeReplaced(node *corev1.Node) bool {
+	machineName, ok := i.machineNameForNode(node)
+	if !ok {
+		return false
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	current, ok := i.nodeByMachineName[machineName]
+	return ok && current.name != node.Name
+}
+
+// machineNameForNode returns the name of the Machine referenced by the provider ID of the Node.
+func (i *machineNodeIndex) machineNameForNode(node *corev1.Node) (string, bool) {
+	machineName, ok := strings.CutPrefix(node.Spec.ProviderID, fmt.Sprintf("%s://%s/", ProviderName, i.onmetalNamespace))
+	return machineName, ok && machineName != ""
+}
+
+// NodeNameForMachine returns the name of the Node backed by the Machine with the given UID.
+func (i *machineNodeIndex) NodeNameForMachine(uid types.UID) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	machineName, ok := i.machineNameByUID[uid]
+	if !ok {
+		return "", false
+	}
+	if node, ok := i.nodeByMachineName[machineName]; ok {
+		return node.name, true
+	}
+	return machineName, true
+}
+
+// ServeHTTP writes the Node names by Machine UID as JSON.
+func (i *machineNodeIndex) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	i.mu.RLock()
+	nodeNameByMachineUID := make(map[types.UID]string, len(i.machineNameByUID))
+	for uid, machineName := range i.machineNameByUID {
+		nodeName := machineName
+		if node, ok := i.nodeByMachineName[machineName]; ok {
+			nodeName = node.name
+		}
+		nodeNameByMachineUID[uid] = nodeName
+	}
+	i.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(nodeNameByMachineUID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+var _ = Describe("MachineNodeIndex", func() {
+	It("should map machine UIDs to node names", func() {
+		index := newMachineNodeIndex("foo")
+		nodeNameForMachine := func(uid types.UID) string {
+			nodeName, ok := index.NodeNameForMachine(uid)
+			Expect(ok).To(BeTrue())
+			return nodeName
+		}
+		machine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine", UID: "machine-uid"}}
+		otherMachine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "other", UID: "other-uid"}}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node"},
+			Spec:       corev1.NodeSpec{ProviderID: "onmetal://foo/machine"},
+		}
+
+		By("falling back to the machine name for unknown nodes")
+		index.setMachine(machine)
+		index.setMachine(otherMachine)
+		Expect(nodeNameForMachine(machine.UID)).To(Equal("machine"))
+
+		By("resolving the node referencing the machine by its provider ID")
+		index.setNode(node)
+		Expect(nodeNameForMachine(machine.UID)).To(Equal("node"))
+		Expect(nodeNameForMachine(otherMachine.UID)).To(Equal("other"))
+
+		By("serving the index as JSON")
+		recorder := httptest.NewRecorder()
+		index.ServeHTTP(recorder, httptest.NewRequest("GET", machineNodeIndexPath, nil))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"machine-uid": "node", "other-uid": "other"}`))
+
+		By("removing deleted nodes and machines")
+		index.deleteNode(node)
+		Expect(nodeNameForMachine(machine.UID)).To(Equal("machine"))
+		index.deleteMachine(machine)
+		_, ok := index.NodeNameForMachine(machine.UID)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should resolve the newest node of a machine and notify about renames", func() {
+		index := newMachineNodeIndex("foo")
+		var renames [][2]string
+		index.AddNodeRenameHandler(func(oldNodeName, newNodeName string) {
+			renames = append(renames, [2]string{oldNodeName, newNodeName})
+		})
+		machine := &computev1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine", UID: "machine-uid"}}
+		oldNode := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: metav1.Unix(1, 0)},
+			Spec:       corev1.NodeSpec{ProviderID: "onmetal://foo/machine"},
+		}
+		newNode := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", CreationTimestamp: metav1.Unix(2, 0)},
+			Spec:       corev1.NodeSpec{ProviderID: "onmetal://foo/machine"},
+		}
+		index.setMachine(machine)
+		index.setNode(oldNode)
+		Expect(index.IsNodeReplaced(oldNode)).To(BeFalse())
+
+		By("taking over the machine by the renamed node")
+		index.setNode(newNode)
+		nodeName, _ := index.NodeNameForMachine(machine.UID)
+		Expect(nodeName).To(Equal("new"))
+		Expect(index.IsNodeReplaced(oldNode)).To(BeTrue())
+		Expect(index.IsNodeReplaced(newNode)).To(BeFalse())
+		Expect(renames).To(Equal([][2]string{{"old", "new"}}))
+
+		By("ignoring updates of the stale node")
+		index.setNode(oldNode)
+		nodeName, _ = index.NodeNameForMachine(machine.UID)
+		Expect(nodeName).To(Equal("new"))
+		Expect(renames).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,228 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	corev1alpha1 "github.com/onmetal/onmetal-api/api/core/v1alpha1"
+)
+
+const (
+	machinePoolLabelSyncInterval = 1 * time.Minute
+)
+
+// machinePoolLabelReconciler mirrors the MachinePool of the Machine backing a Node and the capacity and allocatable
+// resources of the MachinePool into labels and annotations of the Node. Additionally, it publishes the node group of
+// the Node for the cluster-autoscaler and copies the allow-listed labels of the Machine and its MachinePool to the
+// Node.
+type machinePoolLabelReconciler struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+}
+
+func newMachinePoolLabelReconciler(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig) *machinePoolLabelReconciler {
+	return &machinePoolLabelReconciler{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+	}
+}
+
+// Start periodically synchronizes the MachinePool information of all Nodes until the context is done.
+func (r *machinePoolLabelReconciler) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.sync(ctx); err != nil {
+			klog.ErrorS(err, "Failed to sync MachinePool labels of Nodes")
+		}
+	}, machinePoolLabelSyncInterval)
+}
+
+func (r *machinePoolLabelReconciler) sync(ctx context.Context) error {
+	nodeList := &corev1.NodeList{}
+	if err := r.targetClient.List(ctx, nodeList); err != nil {
+		return fmt.Errorf("failed to list Nodes: %w", err)
+	}
+
+	var errs []error
+	for i := range nodeList.Items {
+		if err := r.reconcile(ctx, &nodeList.Items[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *machinePoolLabelReconciler) reconcile(ctx context.Context, node *corev1.Node) error {
+	machine, err := getMachineForNode(ctx, r.onmetalClient, node, getMachineNamespaces(r.onmetalNamespace, r.cloudConfig), getMachineClusterName(r.cloudConfig))
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	var machinePool *computev1alpha1.MachinePool
+	if machine.Spec.MachinePoolRef != nil {
+		machinePool = &computev1alpha1.MachinePool{}
+		if err := r.onmetalClient.Get(ctx, client.ObjectKey{Name: machine.Spec.MachinePoolRef.Name}, machinePool); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get MachinePool %s for Node %s: %w", machine.Spec.MachinePoolRef.Name, node.Name, err)
+			}
+			machinePool = nil
+		}
+	}
+
+	var platformLabels map[string]string
+	if r.cloudConfig.SyncMachinePlatformLabels {
+		if platformLabels, err = r.getMachinePlatformLabels(ctx, machine); err != nil {
+			return fmt.Errorf("failed to get platform labels of Machine %s for Node %s: %w", client.ObjectKeyFromObject(machine), node.Name, err)
+		}
+	}
+
+	nodeBase := node.DeepCopy()
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	if r.cloudConfig.SyncMachinePoolLabels && machinePool != nil {
+		node.Labels[LabelKeyMachinePool] = machinePool.Name
+		node.Annotations[AnnotationKeyMachinePoolCapacity] = formatResourceList(machinePool.Status.Capacity)
+		node.Annotations[AnnotationKeyMachinePoolAllocatable] = formatResourceList(machinePool.Status.Allocatable)
+		allocatableMachines := machinePool.Status.Allocatable[corev1alpha1.ClassCountFor(corev1alpha1.ClassTypeMachineClass, machine.Spec.MachineClassRef.Name)]
+		node.Annotations[AnnotationKeyMachinePoolAllocatableMachines] = allocatableMachines.String()
+	}
+	if r.cloudConfig.PublishAutoscalerNodeGroups && machinePool != nil {
+		node.Labels[LabelKeyAutoscalerNodeGroup] = getNodeGroupName(machinePool.Name, machine.Spec.MachineClassRef.Name)
+		for _, key := range []string{AnnotationKeyAutoscalerNodeGroupMinSize, AnnotationKeyAutoscalerNodeGroupMaxSize} {
+			if value, ok := machinePool.Annotations[key]; ok {
+				node.Annotations[key] = value
+			} else {
+				delete(node.Annotations, key)
+			}
+		}
+	}
+	propagatedLabels := sets.New[string]()
+	for _, key := range r.cloudConfig.NodeLabelKeys {
+		if value, ok := machine.Labels[key]; ok {
+			node.Labels[key] = value
+			propagatedLabels.Insert(key)
+		} else if machinePool != nil {
+			if value, ok := machinePool.Labels[key]; ok {
+				node.Labels[key] = value
+				propagatedLabels.Insert(key)
+			}
+		}
+	}
+	// labels removed from the Machine and its MachinePool or from the allow-list are removed from the Node as well
+	for _, key := range strings.Split(node.Annotations[AnnotationKeyPropagatedLabels], ",") {
+		if key != "" && !propagatedLabels.Has(key) {
+			delete(node.Labels, key)
+		}
+	}
+	if propagatedLabels.Len() > 0 {
+		node.Annotations[AnnotationKeyPropagatedLabels] = strings.Join(sets.List(propagatedLabels), ",")
+	} else {
+		delete(node.Annotations, AnnotationKeyPropagatedLabels)
+	}
+
+	for key, value := range platformLabels {
+		node.Labels[key] = value
+	}
+
+	if equality.Semantic.DeepEqual(nodeBase.Labels, node.Labels) && equality.Semantic.DeepEqual(nodeBase.Annotations, node.Annotations) {
+		return nil
+	}
+	klog.V(2).InfoS("Updating MachinePool labels of Node", "Node", node.Name, "Machine", client.ObjectKeyFromObject(machine))
+	if err := r.targetClient.Patch(ctx, node, client.MergeFrom(nodeBase)); err != nil {
+		return fmt.Errorf("failed to patch Node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// getMachinePlatformLabels returns the Node labels of the architecture and operating system of the Machine. They are
+// taken from the well-known labels of the Machine or else of its MachineClass. Unknown platform attributes are omitted.
+func (r *machinePoolLabelReconciler) getMachinePlatformLabels(ctx context.Context, machine *computev1alpha1.Machine) (map[string]string, error) {
+	platformLabelKeys := map[string]string{
+		corev1.LabelArchStable: LabelKeyMachineArchitecture,
+		corev1.LabelOSStable:   LabelKeyMachineOS,
+	}
+	platformLabels := make(map[string]string)
+	for sourceKey, nodeKey := range platformLabelKeys {
+		if value, ok := machine.Labels[sourceKey]; ok {
+			platformLabels[nodeKey] = value
+		}
+	}
+	if len(platformLabels) == len(platformLabelKeys) {
+		return platformLabels, nil
+	}
+
+	machineClass := &computev1alpha1.MachineClass{}
+	if err := r.onmetalClient.Get(ctx, client.ObjectKey{Name: machine.Spec.MachineClassRef.Name}, machineClass); err != nil {
+		if apierrors.IsNotFound(err) {
+			return platformLabels, nil
+		}
+		return nil, fmt.Errorf("failed to get MachineClass %s: %w", machine.Spec.MachineClassRef.Name, err)
+	}
+	for sourceKey, nodeKey := range platformLabelKeys {
+		if _, ok := platformLabels[nodeKey]; ok {
+			continue
+		}
+		if value, ok := machineClass.Labels[sourceKey]; ok {
+			platformLabels[nodeKey] = value
+		}
+	}
+	return platformLabels, nil
+}
+
+// formatResourceList formats the resource list as a sorted, comma separated list of <name>=<quantity>.
+func formatResourceList(resources corev1alpha1.ResourceList) string {
+	var entries []string
+	for name, quantity := range resources {
+		entries = append(entries, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// getNodeGroupName returns the name of the node group of the Nodes of the given MachinePool and MachineClass. Names
+// exceeding the maximum length of a label value are shortened and suffixed with a hash of the full name.
+func getNodeGroupName(machinePoolName, machineClassName string) string {
+	name := fmt.Sprintf("%s-%s", machinePoolName, machineClassName)
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+	return strings.TrimRight(name[:validation.LabelValueMaxLength-len(suffix)], "-.") + suffix
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	corev1alpha1 "github.com/onmetal/onmetal-api/api/core/v1alpha1"
+)
+
+var _ = Describe("MachinePoolLabelReconciler", func() {
+	It("should mirror the machine pool and its resources into the node", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+				MachinePoolRef:  &corev1.LocalObjectReference{Name: "pool"},
+			},
+		}
+		machinePool := &computev1alpha1.MachinePool{
+			ObjectMeta: metav1.ObjectMeta{Name: "pool"},
+			Status: computev1alpha1.MachinePoolStatus{
+				Capacity: corev1alpha1.ResourceList{
+					corev1alpha1.ResourceCPU:    resource.MustParse("64"),
+					corev1alpha1.ResourceMemory: resource.MustParse("256Gi"),
+				},
+				Allocatable: corev1alpha1.ResourceList{
+					corev1alpha1.ClassCountFor(corev1alpha1.ClassTypeMachineClass, "machine-class"): resource.MustParse("3"),
+				},
+			},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, machinePool).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachinePoolLabelReconciler(targetClient, onmetalClient, "foo", CloudConfig{SyncMachinePoolLabels: true})
+
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(HaveKeyWithValue(LabelKeyMachinePool, "pool"))
+		Expect(node.Annotations).To(SatisfyAll(
+			HaveKeyWithValue(AnnotationKeyMachinePoolCapacity, "cpu=64,memory=256Gi"),
+			HaveKeyWithValue(AnnotationKeyMachinePoolAllocatable, "class/machine.machine-class=3"),
+			HaveKeyWithValue(AnnotationKeyMachinePoolAllocatableMachines, "3"),
+		))
+	})
+
+	It("should copy the allow-listed labels of the machine and its machine pool to the node", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "machine",
+				Labels:    map[string]string{"rack": "r1", "gpu": "a100", "ignored": "true"},
+			},
+			Spec: computev1alpha1.MachineSpec{
+				MachinePoolRef: &corev1.LocalObjectReference{Name: "pool"},
+			},
+		}
+		machinePool := &computev1alpha1.MachinePool{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "pool",
+				Labels: map[string]string{"rack": "r2", "numa": "2"},
+			},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, machinePool).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachinePoolLabelReconciler(targetClient, onmetalClient, "foo", CloudConfig{NodeLabelKeys: []string{"rack", "gpu", "numa", "missing"}})
+
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(Equal(map[string]string{"rack": "r1", "gpu": "a100", "numa": "2"}))
+		Expect(node.Annotations).To(Equal(map[string]string{AnnotationKeyPropagatedLabels: "gpu,numa,rack"}))
+
+		By("removing the labels no longer present on the machine and its machine pool")
+		machineBase := machine.DeepCopy()
+		delete(machine.Labels, "gpu")
+		Expect(onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase))).To(Succeed())
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(Equal(map[string]string{"rack": "r1", "numa": "2"}))
+		Expect(node.Annotations).To(Equal(map[string]string{AnnotationKeyPropagatedLabels: "numa,rack"}))
+
+		By("removing the labels no longer allow-listed")
+		reconciler = newMachinePoolLabelReconciler(targetClient, onmetalClient, "foo", CloudConfig{})
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(BeEmpty())
+		Expect(node.Annotations).To(BeEmpty())
+	})
+
+	It("should label the node with the platform of the machine and its machine class", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "machine",
+				Labels:    map[string]string{corev1.LabelOSStable: "linux"},
+			},
+			Spec: computev1alpha1.MachineSpec{
+				MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+			},
+		}
+		machineClass := &computev1alpha1.MachineClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "machine-class",
+				Labels: map[string]string{corev1.LabelArchStable: "arm64", corev1.LabelOSStable: "windows"},
+			},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, machineClass).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachinePoolLabelReconciler(targetClient, onmetalClient, "foo", CloudConfig{SyncMachinePlatformLabels: true})
+
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(Equal(map[string]string{LabelKeyMachineArchitecture: "arm64", LabelKeyMachineOS: "linux"}))
+	})
+
+	It("should publish the node group of the node for the cluster-autoscaler", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				MachineClassRef: corev1.LocalObjectReference{Name: "machine-class"},
+				MachinePoolRef:  &corev1.LocalObjectReference{Name: "pool"},
+			},
+		}
+		machinePool := &computev1alpha1.MachinePool{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pool",
+				Annotations: map[string]string{AnnotationKeyAutoscalerNodeGroupMaxSize: "10"},
+			},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "machine",
+			Annotations: map[string]string{AnnotationKeyAutoscalerNodeGroupMinSize: "1"},
+		}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, machinePool).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachinePoolLabelReconciler(targetClient, onmetalClient, "foo", CloudConfig{PublishAutoscalerNodeGroups: true})
+
+		Expect(reconciler.sync(ctx)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Labels).To(Equal(map[string]string{LabelKeyAutoscalerNodeGroup: "pool-machine-class"}))
+		Expect(node.Annotations).To(Equal(map[string]string{AnnotationKeyAutoscalerNodeGroupMaxSize: "10"}))
+	})
+
+	It("should shorten node group names exceeding the maximum label value length", func() {
+		name := getNodeGroupName(strings.Repeat("a", 60), "machine-class")
+		Expect(name).To(HaveLen(63))
+		Expect(name).To(Equal(getNodeGroupName(strings.Repeat("a", 60), "machine-class")))
+		Expect(name).NotTo(Equal(getNodeGroupName(strings.Repeat("a", 60), "other-class")))
+	})
+})
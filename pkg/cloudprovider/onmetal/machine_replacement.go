@@ -0,0 +1,92 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+const (
+	eventReasonMachineReplaced = "MachineReplaced"
+)
+
+// isMachineReplaced returns whether the Machine backing the Node was deleted and recreated under the same name since
+// the Node was last synced, i.e. the UID of the Machine differs from the one recorded at the Node.
+func isMachineReplaced(node *corev1.Node, machine *computev1alpha1.Machine) bool {
+	recordedUID := node.Annotations[AnnotationKeyMachineUID]
+	return recordedUID != "" && types.UID(recordedUID) != machine.UID
+}
+
+// handleMachineReplaced drops the last known state of the instance of a Node whose Machine was recreated, so the
+// state of the previous Machine is never served again, and reports the replacement at the Node.
+func (o *onmetalInstancesV2) handleMachineReplaced(node *corev1.Node, machine *computev1alpha1.Machine) {
+	klog.InfoS("Machine of Node was replaced", "Node", node.Name, "Machine", client.ObjectKeyFromObject(machine), "OldUID", node.Annotations[AnnotationKeyMachineUID], "UID", machine.UID)
+	o.lastKnownInstancesMu.Lock()
+	delete(o.lastKnownInstances, node.Name)
+	o.lastKnownInstancesMu.Unlock()
+	o.recorder.Eventf(node, corev1.EventTypeWarning, eventReasonMachineReplaced, "Machine %s was replaced, previous UID %s, new UID %s", client.ObjectKeyFromObject(machine), node.Annotations[AnnotationKeyMachineUID], machine.UID)
+}
+
+// reconcileNodeMachine records the UID of the Machine backing the Node. If the Machine was replaced, the instance type
+// and topology labels of the Node, which are set only once by the cloud node controller, are updated to the metadata
+// of the new Machine. The addresses of the Node are refreshed by the cloud node controller from the metadata.
+func (o *onmetalInstancesV2) reconcileNodeMachine(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, metadata *cloudprovider.InstanceMetadata, replaced bool) error {
+	nodeBase := node.DeepCopy()
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[AnnotationKeyMachineUID] = string(machine.UID)
+	if replaced {
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		setNodeMetadataLabel(node, metadata.InstanceType, corev1.LabelInstanceTypeStable, corev1.LabelInstanceType)
+		setNodeMetadataLabel(node, metadata.Zone, corev1.LabelTopologyZone, corev1.LabelFailureDomainBetaZone)
+		setNodeMetadataLabel(node, metadata.Region, corev1.LabelTopologyRegion, corev1.LabelFailureDomainBetaRegion)
+	}
+
+	if equality.Semantic.DeepEqual(nodeBase.Annotations, node.Annotations) && equality.Semantic.DeepEqual(nodeBase.Labels, node.Labels) {
+		return nil
+	}
+	klog.V(2).InfoS("Recording Machine of Node", "Node", node.Name, "Machine", client.ObjectKeyFromObject(machine), "UID", machine.UID)
+	if err := o.targetClient.Patch(ctx, node, client.MergeFrom(nodeBase)); err != nil {
+		return client.IgnoreNotFound(fmt.Errorf("failed to patch Node %s: %w", node.Name, err))
+	}
+	return nil
+}
+
+// setNodeMetadataLabel sets the stable label of the Node to the given value and updates the deprecated label if the
+// Node still carries it. Labels of empty values are removed.
+func setNodeMetadataLabel(node *corev1.Node, value, stableKey, deprecatedKey string) {
+	if value == "" {
+		delete(node.Labels, stableKey)
+		delete(node.Labels, deprecatedKey)
+		return
+	}
+	node.Labels[stableKey] = value
+	if _, ok := node.Labels[deprecatedKey]; ok {
+		node.Labels[deprecatedKey] = value
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+var _ = Describe("Machine replacement", func() {
+	var (
+		targetClient  client.Client
+		onmetalClient client.Client
+		recorder      *record.FakeRecorder
+		cloudConfig   CloudConfig
+	)
+
+	newMachine := func(uid types.UID, machineClassName string) *computev1alpha1.Machine {
+		return &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine", UID: uid},
+			Spec: computev1alpha1.MachineSpec{
+				MachineClassRef: corev1.LocalObjectReference{Name: machineClassName},
+				MachinePoolRef:  &corev1.LocalObjectReference{Name: "pool2"},
+			},
+		}
+	}
+
+	newNode := func(machineUID string) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "machine",
+				Labels: map[string]string{
+					corev1.LabelInstanceTypeStable: "old-class",
+					corev1.LabelInstanceType:       "old-class",
+					corev1.LabelTopologyZone:       "zone1",
+				},
+			},
+			Spec: corev1.NodeSpec{ProviderID: getProviderID("foo", "machine")},
+		}
+		if machineUID != "" {
+			node.Annotations = map[string]string{AnnotationKeyMachineUID: machineUID}
+		}
+		return node
+	}
+
+	newInstancesProvider := func() *onmetalInstancesV2 {
+		return newOnmetalInstancesV2(targetClient, onmetalClient, "foo", cloudConfig, nil, recorder, nil).(*onmetalInstancesV2)
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		cloudConfig = CloudConfig{
+			ClusterName:        "test",
+			FailStaticDuration: metav1.Duration{Duration: time.Minute},
+			MachinePoolTopology: map[string]MachinePoolTopology{
+				"pool2": {Zone: "zone2"},
+			},
+		}
+	})
+
+	It("should record the UID of the machine of a node", func(ctx SpecContext) {
+		node := newNode("")
+		targetClient = fake.NewClientBuilder().WithObjects(node).Build()
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newMachine("uid-1", "old-class")).Build()
+
+		Expect(newInstancesProvider().InstanceMetadata(ctx, node)).To(HaveField("InstanceType", "old-class"))
+
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Annotations).To(HaveKeyWithValue(AnnotationKeyMachineUID, "uid-1"))
+		Expect(node.Labels).To(HaveKeyWithValue(corev1.LabelTopologyZone, "zone1"))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should update the node of a machine recreated under the same name", func(ctx SpecContext) {
+		node := newNode("uid-1")
+		targetClient = fake.NewClientBuilder().WithObjects(node).Build()
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newMachine("uid-2", "new-class")).Build()
+		instancesProvider := newInstancesProvider()
+		instancesProvider.lastKnownInstances[node.Name] = &lastKnownInstance{exists: &observed[bool]{value: true}}
+
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(SatisfyAll(
+			HaveField("InstanceType", "new-class"),
+			HaveField("Zone", "zone2"),
+		))
+		Expect(instancesProvider.lastKnownInstances[node.Name].exists).To(BeNil())
+		Expect(recorder.Events).To(Receive(SatisfyAll(
+			ContainSubstring(eventReasonMachineReplaced),
+			ContainSubstring("previous UID uid-1, new UID uid-2"),
+		)))
+
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Annotations).To(HaveKeyWithValue(AnnotationKeyMachineUID, "uid-2"))
+		Expect(node.Labels).To(SatisfyAll(
+			HaveKeyWithValue(corev1.LabelInstanceTypeStable, "new-class"),
+			HaveKeyWithValue(corev1.LabelInstanceType, "new-class"),
+			HaveKeyWithValue(corev1.LabelTopologyZone, "zone2"),
+			Not(HaveKey(corev1.LabelFailureDomainBetaZone)),
+			Not(HaveKey(corev1.LabelTopologyRegion)),
+		))
+
+		By("not reporting the replacement again")
+		Expect(instancesProvider.InstanceMetadata(ctx, node)).To(HaveField("InstanceType", "new-class"))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should not serve a replaced machine from a stale instance snapshot", func(ctx SpecContext) {
+		cloudConfig.InstanceMetadataResyncWindow = metav1.Duration{Duration: time.Hour}
+		targetClient = fake.NewClientBuilder().Build()
+		onmetalClient = fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(newMachine("uid-1", "old-class")).Build()
+		instancesProvider := newInstancesProvider()
+
+		By("listing the snapshot holding the previous machine")
+		Expect(instancesProvider.InstanceMetadata(ctx, newNode("uid-1"))).To(HaveField("InstanceType", "old-class"))
+
+		By("recreating the machine")
+		Expect(onmetalClient.Delete(ctx, newMachine("uid-1", "old-class"))).To(Succeed())
+		Expect(onmetalClient.Create(ctx, newMachine("uid-2", "new-class"))).To(Succeed())
+
+		Expect(instancesProvider.InstanceMetadata(ctx, newNode("uid-2"))).To(HaveField("InstanceType", "new-class"))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
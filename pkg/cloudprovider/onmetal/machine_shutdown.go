@@ -0,0 +1,251 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// machineShutdownReconciler taints the Nodes of shut down Machines and removes their NetworkInterfaces from the
+// LoadBalancerRouting destinations of the cluster. Once the Machine is running again, the taint is removed. The
+// destinations are restored by the service controller updating the LoadBalancers of the Node, as only it knows which
+// Nodes and endpoints a Service routes to.
+type machineShutdownReconciler struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	machineNodeIndex *machineNodeIndex
+	queue            workqueue.RateLimitingInterface
+}
+
+func newMachineShutdownReconciler(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig, machineNodeIndex *machineNodeIndex) *machineShutdownReconciler {
+	return &machineShutdownReconciler{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+		machineNodeIndex: machineNodeIndex,
+		queue:            workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "machine-shutdown"}),
+	}
+}
+
+// SetupWithCache registers the event handlers of the reconciler at the Machine informer of the given cache.
+func (r *machineShutdownReconciler) SetupWithCache(ctx context.Context, c cache.Cache) error {
+	informer, err := c.GetInformer(ctx, &computev1alpha1.Machine{})
+	if err != nil {
+		return fmt.Errorf("failed to get Machine informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueue(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMachine, oldOK := oldObj.(*computev1alpha1.Machine)
+			newMachine, newOK := newObj.(*computev1alpha1.Machine)
+			if oldOK && newOK && oldMachine.Status.State == newMachine.Status.State && oldMachine.Spec.Power == newMachine.Spec.Power {
+				return
+			}
+			r.enqueue(newObj)
+		},
+	})
+	return err
+}
+
+func (r *machineShutdownReconciler) enqueue(obj interface{}) {
+	if machine, ok := obj.(*computev1alpha1.Machine); ok {
+		r.queue.Add(client.ObjectKeyFromObject(machine))
+	}
+}
+
+// Start processes queued Machines until the context is done.
+func (r *machineShutdownReconciler) Start(ctx context.Context) {
+	defer r.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (r *machineShutdownReconciler) processNextItem(ctx context.Context) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	machineKey := item.(client.ObjectKey)
+	if err := r.reconcile(ctx, machineKey); err != nil {
+		klog.ErrorS(err, "Failed to reconcile shutdown state of Machine", "Machine", machineKey)
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *machineShutdownReconciler) reconcile(ctx context.Context, machineKey client.ObjectKey) error {
+	if !slices.Contains(getMachineNamespaces(r.onmetalNamespace, r.cloudConfig), machineKey.Namespace) {
+		return nil
+	}
+	machine := &computev1alpha1.Machine{}
+	if err := r.onmetalClient.Get(ctx, machineKey, machine); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	nodeName, ok := r.machineNodeIndex.NodeNameForMachine(machine.UID)
+	if !ok {
+		nodeName = machine.Name
+	}
+	node := &corev1.Node{}
+	if err := r.targetClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Machine does not back a Node of this cluster
+			return nil
+		}
+		return fmt.Errorf("failed to get Node %s: %w", nodeName, err)
+	}
+
+	shutdown := r.cloudConfig.isMachineShutdown(machine)
+	if err := r.reconcileNodeTaint(ctx, node, shutdown); err != nil {
+		return err
+	}
+	if !shutdown || r.cloudConfig.ReadOnly {
+		// LoadBalancers are not supported with readOnly
+		return nil
+	}
+	return r.removeLoadBalancerDestinations(ctx, machine)
+}
+
+func (r *machineShutdownReconciler) reconcileNodeTaint(ctx context.Context, node *corev1.Node, shutdown bool) error {
+	hasTaint := false
+	var taints []corev1.Taint
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintKeyMachineShutdown {
+			hasTaint = true
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	if hasTaint == shutdown {
+		return nil
+	}
+
+	nodeBase := node.DeepCopy()
+	if shutdown {
+		taints = append(taints, corev1.Taint{
+			Key:    TaintKeyMachineShutdown,
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+	node.Spec.Taints = taints
+	klog.V(2).InfoS("Updating shutdown taint of Node", "Node", node.Name, "Shutdown", shutdown)
+	if err := r.targetClient.Patch(ctx, node, client.MergeFrom(nodeBase)); err != nil {
+		return fmt.Errorf("failed to patch taints of Node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// removeLoadBalancerDestinations removes the NetworkInterfaces of the shut down Machine from the destinations of the
+// LoadBalancerRoutings of the cluster. LoadBalancerRoutings without destinations of the Machine are not written.
+func (r *machineShutdownReconciler) removeLoadBalancerDestinations(ctx context.Context, machine *computev1alpha1.Machine) error {
+	networkInterfaceNames := sets.New[string]()
+	networkInterfaceUIDs := sets.New[types.UID]()
+	for _, machineNIC := range machine.Spec.NetworkInterfaces {
+		nicKey := client.ObjectKey{Namespace: machine.Namespace, Name: getMachineNetworkInterfaceName(machine, machineNIC)}
+		networkInterfaceNames.Insert(nicKey.Name)
+		nic := &networkingv1alpha1.NetworkInterface{}
+		if err := r.onmetalClient.Get(ctx, nicKey, nic); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get NetworkInterface %s: %w", nicKey, err)
+		}
+		networkInterfaceUIDs.Insert(nic.UID)
+	}
+	isMachineDestination := func(destination networkingv1alpha1.LoadBalancerDestination) bool {
+		if destination.TargetRef == nil {
+			return false
+		}
+		if destination.TargetRef.UID != "" {
+			return networkInterfaceUIDs.Has(destination.TargetRef.UID)
+		}
+		return machine.Namespace == r.onmetalNamespace && networkInterfaceNames.Has(destination.TargetRef.Name)
+	}
+
+	loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+	if err := r.onmetalClient.List(ctx, loadBalancerList,
+		client.InNamespace(r.onmetalNamespace),
+		client.MatchingLabels{LabelKeyClusterName: r.cloudConfig.ClusterName},
+	); err != nil {
+		return fmt.Errorf("failed to list LoadBalancers: %w", err)
+	}
+
+	for i := range loadBalancerList.Items {
+		loadBalancer := &loadBalancerList.Items[i]
+		// LoadBalancerRoutings not managed by the cloud provider are left to their external controller
+		if !isRoutingManagedForLoadBalancer(loadBalancer) {
+			continue
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+		if err := r.onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), loadBalancerRouting); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancer), err)
+		}
+
+		var destinations []networkingv1alpha1.LoadBalancerDestination
+		for _, destination := range loadBalancerRouting.Destinations {
+			if !isMachineDestination(destination) {
+				destinations = append(destinations, destination)
+			}
+		}
+		if len(destinations) == len(loadBalancerRouting.Destinations) {
+			continue
+		}
+
+		loadBalancerRoutingBase := loadBalancerRouting.DeepCopy()
+		loadBalancerRouting.Destinations = destinations
+		if zoneAffinity := loadBalancer.Annotations[AnnotationKeyZoneAffinity]; zoneAffinity != "" {
+			setDestinationZones(loadBalancerRouting, zoneAffinity, parseDestinationZones(loadBalancerRouting.Annotations[AnnotationKeyDestinationZones]))
+		}
+		klog.V(2).InfoS("Removing LoadBalancerRouting destinations of shut down Machine", "LoadBalancerRouting", client.ObjectKeyFromObject(loadBalancerRouting), "Machine", client.ObjectKeyFromObject(machine))
+		if err := r.cloudConfig.checkPatchConflictsFor("LoadBalancerRouting", loadBalancerRouting, loadBalancerRoutingBase); err != nil {
+			return fmt.Errorf("failed to patch LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), err)
+		}
+		if err := patchPreservingUnknownFields(ctx, r.onmetalClient, loadBalancerRouting, loadBalancerRoutingBase, r.cloudConfig.fieldOwnerFor("LoadBalancerRouting")); err != nil {
+			return fmt.Errorf("failed to patch LoadBalancerRouting %s: %w", client.ObjectKeyFromObject(loadBalancerRouting), err)
+		}
+	}
+	return nil
+}
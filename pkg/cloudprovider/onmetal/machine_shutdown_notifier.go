@@ -0,0 +1,187 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+// machineShutdownNotifier taints NotReady Nodes of shut down Machines with the shutdown taint of the node lifecycle
+// controller as soon as the Machine or the readiness of the Node changes. The node lifecycle controller only polls
+// InstanceShutdown periodically and removes the taint once the Node is ready again.
+type machineShutdownNotifier struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	machineNodeIndex *machineNodeIndex
+	queue            workqueue.RateLimitingInterface
+}
+
+func newMachineShutdownNotifier(targetClient client.Client, onmetalClient client.Client, namespace string, cloudConfig CloudConfig, machineNodeIndex *machineNodeIndex) *machineShutdownNotifier {
+	return &machineShutdownNotifier{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: namespace,
+		cloudConfig:      cloudConfig,
+		machineNodeIndex: machineNodeIndex,
+		queue:            workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "machine-shutdown-notifier"}),
+	}
+}
+
+// SetupWithCaches registers the event handlers of the notifier at the Machine informer of the onmetal cache and the
+// Node informer of the target cache.
+func (n *machineShutdownNotifier) SetupWithCaches(ctx context.Context, onmetalCache, targetCache cache.Cache) error {
+	machineInformer, err := onmetalCache.GetInformer(ctx, &computev1alpha1.Machine{})
+	if err != nil {
+		return fmt.Errorf("failed to get Machine informer: %w", err)
+	}
+	if _, err := machineInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if machine, ok := obj.(*computev1alpha1.Machine); ok {
+				n.queue.Add(machine.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMachine, oldOK := oldObj.(*computev1alpha1.Machine)
+			newMachine, newOK := newObj.(*computev1alpha1.Machine)
+			if !oldOK || !newOK || n.cloudConfig.isMachineShutdown(oldMachine) == n.cloudConfig.isMachineShutdown(newMachine) {
+				return
+			}
+			n.queue.Add(newMachine.Name)
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add Machine event handler: %w", err)
+	}
+
+	nodeInformer, err := targetCache.GetInformer(ctx, &corev1.Node{})
+	if err != nil {
+		return fmt.Errorf("failed to get Node informer: %w", err)
+	}
+	if _, err := nodeInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, oldOK := oldObj.(*corev1.Node)
+			newNode, newOK := newObj.(*corev1.Node)
+			if !oldOK || !newOK || isNodeReady(oldNode) == isNodeReady(newNode) {
+				return
+			}
+			n.enqueueNode(newNode)
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add Node event handler: %w", err)
+	}
+	return nil
+}
+
+func (n *machineShutdownNotifier) enqueueNode(node *corev1.Node) {
+	machineName, ok := n.machineNodeIndex.machineNameForNode(node)
+	if !ok {
+		machineName = node.Name
+	}
+	n.queue.Add(machineName)
+}
+
+// Start processes queued Machines until the context is done.
+func (n *machineShutdownNotifier) Start(ctx context.Context) {
+	defer n.queue.ShutDown()
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for n.processNextItem(ctx) {
+		}
+	}, 0)
+	<-ctx.Done()
+}
+
+func (n *machineShutdownNotifier) processNextItem(ctx context.Context) bool {
+	item, shutdown := n.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer n.queue.Done(item)
+
+	machineName := item.(string)
+	if err := n.notify(ctx, machineName); err != nil {
+		klog.ErrorS(err, "Failed to notify about shutdown of Machine", "Machine", machineName)
+		n.queue.AddRateLimited(item)
+		return true
+	}
+	n.queue.Forget(item)
+	return true
+}
+
+func (n *machineShutdownNotifier) notify(ctx context.Context, machineName string) error {
+	machine := &computev1alpha1.Machine{}
+	if err := n.onmetalClient.Get(ctx, client.ObjectKey{Namespace: n.onmetalNamespace, Name: machineName}, machine); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !n.cloudConfig.isMachineShutdown(machine) {
+		return nil
+	}
+
+	nodeName, ok := n.machineNodeIndex.NodeNameForMachine(machine.UID)
+	if !ok {
+		nodeName = machine.Name
+	}
+	node := &corev1.Node{}
+	if err := n.targetClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Machine does not back a Node of this cluster
+			return nil
+		}
+		return fmt.Errorf("failed to get Node %s: %w", nodeName, err)
+	}
+	// the node lifecycle controller removes the shutdown taint of ready Nodes again
+	if isNodeReady(node) {
+		return nil
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == cloudproviderapi.TaintNodeShutdown {
+			return nil
+		}
+	}
+
+	nodeBase := node.DeepCopy()
+	node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{
+		Key:    cloudproviderapi.TaintNodeShutdown,
+		Effect: corev1.TaintEffectNoSchedule,
+	})
+	klog.V(2).InfoS("Adding shutdown taint to Node of shut down Machine", "Node", node.Name, "Machine", client.ObjectKeyFromObject(machine), "State", machine.Status.State)
+	if err := n.targetClient.Patch(ctx, node, client.MergeFrom(nodeBase)); err != nil {
+		return fmt.Errorf("failed to patch taints of Node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// isNodeReady reports whether the Ready condition of the Node is true.
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+)
+
+var _ = Describe("MachineShutdownNotifier", func() {
+	It("should taint the not ready node of a machine being powered off", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec:       computev1alpha1.MachineSpec{Power: computev1alpha1.PowerOff},
+			Status:     computev1alpha1.MachineStatus{State: computev1alpha1.MachineStatePending},
+		}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine"},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		notifier := newMachineShutdownNotifier(targetClient, onmetalClient, "foo", CloudConfig{}, newMachineNodeIndex("foo"))
+
+		By("not tainting the ready node")
+		Expect(notifier.notify(ctx, machine.Name)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(BeEmpty())
+
+		By("tainting the node once it is not ready")
+		nodeBase := node.DeepCopy()
+		node.Status.Conditions[0].Status = corev1.ConditionFalse
+		Expect(targetClient.Status().Patch(ctx, node, client.MergeFrom(nodeBase))).To(Succeed())
+		Expect(notifier.notify(ctx, machine.Name)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(ConsistOf(corev1.Taint{Key: cloudproviderapi.TaintNodeShutdown, Effect: corev1.TaintEffectNoSchedule}))
+	})
+
+	It("should not taint the node of a running machine", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Status:     computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateRunning},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		notifier := newMachineShutdownNotifier(targetClient, onmetalClient, "foo", CloudConfig{}, newMachineNodeIndex("foo"))
+
+		Expect(notifier.notify(ctx, machine.Name)).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(BeEmpty())
+	})
+})
@@ -0,0 +1,223 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("MachineShutdownReconciler", func() {
+	It("should taint the node and remove the load balancer destinations of a shut down machine", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+			Status: computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateShutdown},
+		}
+		networkInterface := &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine-primary", UID: "nic-uid"},
+			Spec: networkingv1alpha1.NetworkInterfaceSpec{
+				NetworkRef: corev1.LocalObjectReference{Name: "network"},
+				ProviderID: "nic://machine-primary",
+			},
+			Status: networkingv1alpha1.NetworkInterfaceStatus{
+				IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+			},
+		}
+		destination := networkingv1alpha1.LoadBalancerDestination{
+			IP: commonv1alpha1.MustParseIP("10.0.0.1"),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{
+				UID:        networkInterface.UID,
+				Name:       networkInterface.Name,
+				ProviderID: networkInterface.Spec.ProviderID,
+			},
+		}
+		otherDestination := networkingv1alpha1.LoadBalancerDestination{
+			IP: commonv1alpha1.MustParseIP("10.0.0.2"),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{
+				UID:  "other-nic-uid",
+				Name: "other-primary",
+			},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "foo",
+				Name:        "lb",
+				Labels:      map[string]string{LabelKeyClusterName: "test"},
+				Annotations: map[string]string{AnnotationKeyClusterName: "test"},
+			},
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta:   metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			NetworkRef:   commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{destination, otherDestination},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, networkInterface, loadBalancer, loadBalancerRouting).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachineShutdownReconciler(targetClient, onmetalClient, "foo", CloudConfig{ClusterName: "test"}, newMachineNodeIndex("foo"))
+
+		By("reconciling the shut down machine")
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(ConsistOf(HaveField("Key", TaintKeyMachineShutdown)))
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Destinations).To(Equal([]networkingv1alpha1.LoadBalancerDestination{otherDestination}))
+
+		By("not writing load balancer routings without destinations of the machine")
+		resourceVersion := loadBalancerRouting.ResourceVersion
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.ResourceVersion).To(Equal(resourceVersion))
+
+		By("reconciling the running machine")
+		machineBase := machine.DeepCopy()
+		machine.Status.State = computev1alpha1.MachineStateRunning
+		Expect(onmetalClient.Patch(ctx, machine, client.MergeFrom(machineBase))).To(Succeed())
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))).To(Succeed())
+		Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(node), node)).To(Succeed())
+		Expect(node.Spec.Taints).To(BeEmpty())
+
+		By("leaving the restoration of the destinations to the service controller")
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Destinations).To(Equal([]networkingv1alpha1.LoadBalancerDestination{otherDestination}))
+	})
+
+	It("should not change the destinations of load balancer routings not managed by the cloud provider", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+			Status: computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateShutdown},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "foo",
+				Name:        "lb",
+				Annotations: map[string]string{AnnotationKeyClusterName: "test", AnnotationKeyManageRouting: "false"},
+			},
+		}
+		destinations := []networkingv1alpha1.LoadBalancerDestination{{
+			IP:        commonv1alpha1.MustParseIP("10.0.0.1"),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{UID: "nic-uid", Name: "machine-primary"},
+		}}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta:   metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			NetworkRef:   commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: destinations,
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, loadBalancer, loadBalancerRouting).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachineShutdownReconciler(targetClient, onmetalClient, "foo", CloudConfig{ClusterName: "test"}, newMachineNodeIndex("foo"))
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Destinations).To(Equal(destinations))
+	})
+
+	It("should not take over destinations managed by other field managers with the fail policy", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+			Status: computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateShutdown},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb", Labels: map[string]string{LabelKeyClusterName: "test"}},
+		}
+		destinations := []networkingv1alpha1.LoadBalancerDestination{{
+			IP:        commonv1alpha1.MustParseIP("10.0.0.1"),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{Name: "machine-primary"},
+		}}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "lb",
+				ManagedFields: []metav1.ManagedFieldsEntry{
+					{Manager: "other", Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:destinations":{}}`)}},
+				},
+			},
+			NetworkRef:   commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: destinations,
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, loadBalancer, loadBalancerRouting).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		cloudConfig := CloudConfig{
+			ClusterName:           "test",
+			ApplyConflictPolicies: map[string]ApplyConflictPolicy{"LoadBalancerRouting": ApplyConflictPolicyFail},
+		}
+		reconciler := newMachineShutdownReconciler(targetClient, onmetalClient, "foo", cloudConfig, newMachineNodeIndex("foo"))
+
+		err := reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Destinations).To(Equal(destinations))
+	})
+
+	It("should remove the load balancer destinations of shut down machines in additional namespaces", func(ctx SpecContext) {
+		machine := &computev1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "machine"},
+			Spec: computev1alpha1.MachineSpec{
+				NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}},
+			},
+			Status: computev1alpha1.MachineStatus{State: computev1alpha1.MachineStateShutdown},
+		}
+		networkInterface := &networkingv1alpha1.NetworkInterface{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "machine-primary", UID: "nic-uid"},
+		}
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb", Labels: map[string]string{LabelKeyClusterName: "test"}},
+		}
+		sameNameDestination := networkingv1alpha1.LoadBalancerDestination{
+			IP:        commonv1alpha1.MustParseIP("10.0.0.2"),
+			TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{UID: "foo-nic-uid", Name: "machine-primary"},
+		}
+		loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			NetworkRef: commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{
+				{IP: commonv1alpha1.MustParseIP("10.0.0.1"), TargetRef: &networkingv1alpha1.LoadBalancerTargetRef{UID: "nic-uid", Name: "machine-primary"}},
+				sameNameDestination,
+			},
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine, networkInterface, loadBalancer, loadBalancerRouting).Build()
+		targetClient := fake.NewClientBuilder().WithObjects(node).Build()
+		reconciler := newMachineShutdownReconciler(targetClient, onmetalClient, "foo", CloudConfig{ClusterName: "test", AdditionalNamespaces: []string{"bar"}}, newMachineNodeIndex("foo"))
+
+		Expect(reconciler.reconcile(ctx, client.ObjectKeyFromObject(machine))).To(Succeed())
+		Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancerRouting), loadBalancerRouting)).To(Succeed())
+		Expect(loadBalancerRouting.Destinations).To(Equal([]networkingv1alpha1.LoadBalancerDestination{sameNameDestination}))
+	})
+})
@@ -0,0 +1,263 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudnodecontroller "k8s.io/cloud-provider/controllers/node"
+	cloudnodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
+	servicecontroller "k8s.io/cloud-provider/controllers/service"
+	"k8s.io/component-base/metrics/legacyregistry"
+	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
+	"k8s.io/controller-manager/pkg/clientbuilder"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// TargetCluster is a target cluster of the multi-cluster mode.
+type TargetCluster struct {
+	// Name is the name of the cluster. It replaces the clusterName of the cloud config and is part of the names of
+	// the LoadBalancers of the cluster.
+	Name string `json:"name"`
+	// Kubeconfig is the path to the kubeconfig of the cluster.
+	Kubeconfig string `json:"kubeconfig"`
+	// NetworkName is the onmetal Network of the cluster. If empty, the networkName of the cloud config is used.
+	NetworkName string `json:"networkName,omitempty"`
+}
+
+// TargetClusters is the list of target clusters of the multi-cluster mode.
+type TargetClusters struct {
+	Clusters []TargetCluster `json:"clusters"`
+}
+
+type MultiClusterOptions struct {
+	// CloudConfigPath is the path to the cloud config shared by all target clusters.
+	CloudConfigPath string
+	// OnmetalKubeconfigPath is the path to the onmetal kubeconfig shared by all target clusters.
+	OnmetalKubeconfigPath string
+	// ClustersPath is the path to the TargetClusters.
+	ClustersPath string
+	// ConcurrentServiceSyncs is the number of Services of every target cluster synced concurrently.
+	ConcurrentServiceSyncs int
+	// ConcurrentNodeSyncs is the number of Nodes of every target cluster initialized concurrently.
+	ConcurrentNodeSyncs int32
+	// NodeStatusUpdateFrequency is the interval the addresses of the Nodes are updated in.
+	NodeStatusUpdateFrequency time.Duration
+	// NodeMonitorPeriod is the interval the Nodes are checked for deleted or shut down Machines in.
+	NodeMonitorPeriod time.Duration
+	// MetricsBindAddress is the address the metrics are served on. Empty disables serving the metrics.
+	MetricsBindAddress string
+}
+
+// NewMultiClusterCommand returns the command running the cloud provider for several target clusters in one process.
+// Every target cluster gets its own cloud provider and service, cloud node and cloud node lifecycle controllers,
+// sharing the onmetal namespace with the other target clusters.
+func NewMultiClusterCommand() *cobra.Command {
+	opts := MultiClusterOptions{
+		ConcurrentServiceSyncs:    1,
+		ConcurrentNodeSyncs:       1,
+		NodeStatusUpdateFrequency: 5 * time.Minute,
+		NodeMonitorPeriod:         5 * time.Second,
+		MetricsBindAddress:        ":10258",
+	}
+	cmd := &cobra.Command{
+		Use:   "multi-cluster",
+		Short: "Run the LoadBalancer and Node controllers of several target clusters against a shared onmetal namespace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunMultiCluster(cmd.Context(), opts)
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&opts.CloudConfigPath, "cloud-config", opts.CloudConfigPath, "Path to the cloud config shared by all target clusters.")
+	fs.StringVar(&opts.OnmetalKubeconfigPath, "onmetal-kubeconfig", opts.OnmetalKubeconfigPath, "Path to the onmetal kubeconfig shared by all target clusters.")
+	fs.StringVar(&opts.ClustersPath, "clusters", opts.ClustersPath, "Path to the list of target clusters.")
+	fs.IntVar(&opts.ConcurrentServiceSyncs, "concurrent-service-syncs", opts.ConcurrentServiceSyncs, "Number of Services of every target cluster synced concurrently.")
+	fs.Int32Var(&opts.ConcurrentNodeSyncs, "concurrent-node-syncs", opts.ConcurrentNodeSyncs, "Number of Nodes of every target cluster initialized concurrently.")
+	fs.DurationVar(&opts.NodeStatusUpdateFrequency, "node-status-update-frequency", opts.NodeStatusUpdateFrequency, "Interval the addresses of the Nodes are updated in.")
+	fs.DurationVar(&opts.NodeMonitorPeriod, "node-monitor-period", opts.NodeMonitorPeriod, "Interval the Nodes are checked for deleted or shut down Machines in.")
+	fs.StringVar(&opts.MetricsBindAddress, "metrics-bind-address", opts.MetricsBindAddress, "Address to serve the metrics on. Empty disables serving the metrics.")
+
+	// the cloud controller manager command prints its own flags only
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n  %s\n\nFlags:\n%s", cmd.UseLine(), cmd.Flags().FlagUsages())
+		return nil
+	})
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n", cmd.Short)
+		_ = cmd.Usage()
+	})
+	return cmd
+}
+
+// RunMultiCluster runs the controllers of all target clusters until the context is done. All target clusters are
+// validated before any controller is started.
+func RunMultiCluster(ctx context.Context, opts MultiClusterOptions) error {
+	cloudConfigData, err := os.ReadFile(opts.CloudConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cloud config: %w", err)
+	}
+	cloudConfig, err := decodeCloudConfig(ctx, cloudConfigData)
+	if err != nil {
+		return err
+	}
+	clustersData, err := os.ReadFile(opts.ClustersPath)
+	if err != nil {
+		return fmt.Errorf("failed to read target clusters: %w", err)
+	}
+	targetClusters := &TargetClusters{}
+	if err := yaml.UnmarshalStrict(clustersData, targetClusters); err != nil {
+		return fmt.Errorf("failed to unmarshal target clusters: %w", err)
+	}
+	if err := targetClusters.Validate(); err != nil {
+		return err
+	}
+	onmetalRestConfig, namespace, err := loadOnmetalRestConfig(opts.OnmetalKubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	clouds := make([]cloudprovider.Interface, 0, len(targetClusters.Clusters))
+	for _, targetCluster := range targetClusters.Clusters {
+		cp, err := NewCloudProvider(Options{
+			CloudConfig:       getTargetClusterCloudConfig(*cloudConfig, targetCluster),
+			OnmetalRestConfig: onmetalRestConfig,
+			Namespace:         namespace,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid cloud config of target cluster %s: %w", targetCluster.Name, err)
+		}
+		clouds = append(clouds, cp)
+	}
+
+	if opts.MetricsBindAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", legacyregistry.Handler())
+		go func() {
+			if err := http.ListenAndServe(opts.MetricsBindAddress, mux); err != nil {
+				klog.ErrorS(err, "Failed to serve metrics", "Address", opts.MetricsBindAddress)
+			}
+		}()
+	}
+
+	for i, targetCluster := range targetClusters.Clusters {
+		if err := startTargetClusterControllers(ctx, opts, targetCluster, clouds[i]); err != nil {
+			return fmt.Errorf("failed to start controllers of target cluster %s: %w", targetCluster.Name, err)
+		}
+		klog.InfoS("Started controllers of target cluster", "Cluster", targetCluster.Name)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Validate returns an error if the target clusters are empty, not uniquely named or miss their kubeconfig.
+func (t *TargetClusters) Validate() error {
+	if len(t.Clusters) == 0 {
+		return fmt.Errorf("no target clusters configured")
+	}
+	var errs []error
+	names := sets.New[string]()
+	for i, targetCluster := range t.Clusters {
+		if msgs := validation.IsDNS1123Label(targetCluster.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("clusters[%d].name %q is invalid: %s", i, targetCluster.Name, msgs[0]))
+		}
+		if names.Has(targetCluster.Name) {
+			errs = append(errs, fmt.Errorf("clusters[%d].name %q is not unique", i, targetCluster.Name))
+		}
+		names.Insert(targetCluster.Name)
+		if targetCluster.Kubeconfig == "" {
+			errs = append(errs, fmt.Errorf("clusters[%d].kubeconfig is required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// getTargetClusterCloudConfig returns the cloud config of the target cluster derived from the shared cloud config.
+// As the target clusters share the onmetal namespace, the cloud config always runs with SharedNamespace.
+func getTargetClusterCloudConfig(cloudConfig CloudConfig, targetCluster TargetCluster) CloudConfig {
+	cloudConfig.ClusterName = targetCluster.Name
+	if targetCluster.NetworkName != "" {
+		cloudConfig.NetworkName = targetCluster.NetworkName
+	}
+	cloudConfig.SharedNamespace = true
+	return cloudConfig
+}
+
+// startTargetClusterControllers initializes the cloud provider of the target cluster and starts its controllers.
+func startTargetClusterControllers(ctx context.Context, opts MultiClusterOptions, targetCluster TargetCluster, cp cloudprovider.Interface) error {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", targetCluster.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	cp.Initialize(clientbuilder.SimpleControllerClientBuilder{ClientConfig: restConfig}, ctx.Done())
+
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	controllerManagerMetrics := controllersmetrics.NewControllerManagerMetrics("cloud-controller-manager-" + targetCluster.Name)
+
+	serviceController, err := servicecontroller.New(
+		cp,
+		kubeClient,
+		informerFactory.Core().V1().Services(),
+		informerFactory.Core().V1().Nodes(),
+		targetCluster.Name,
+		utilfeature.DefaultFeatureGate,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create service controller: %w", err)
+	}
+	nodeController, err := cloudnodecontroller.NewCloudNodeController(
+		informerFactory.Core().V1().Nodes(),
+		kubeClient,
+		cp,
+		opts.NodeStatusUpdateFrequency,
+		opts.ConcurrentNodeSyncs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud node controller: %w", err)
+	}
+	nodeLifecycleController, err := cloudnodelifecyclecontroller.NewCloudNodeLifecycleController(
+		informerFactory.Core().V1().Nodes(),
+		kubeClient,
+		cp,
+		opts.NodeMonitorPeriod,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud node lifecycle controller: %w", err)
+	}
+
+	informerFactory.Start(ctx.Done())
+	go serviceController.Run(ctx, opts.ConcurrentServiceSyncs, controllerManagerMetrics)
+	go nodeController.Run(ctx.Done(), controllerManagerMetrics)
+	go nodeLifecycleController.Run(ctx, controllerManagerMetrics)
+	return nil
+}
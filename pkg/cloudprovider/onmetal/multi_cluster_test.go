@@ -0,0 +1,67 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiCluster", func() {
+	Describe("TargetClusters", func() {
+		It("should accept uniquely named target clusters with kubeconfigs", func() {
+			targetClusters := &TargetClusters{Clusters: []TargetCluster{
+				{Name: "foo", Kubeconfig: "/etc/foo/kubeconfig"},
+				{Name: "bar", Kubeconfig: "/etc/bar/kubeconfig", NetworkName: "bar-network"},
+			}}
+			Expect(targetClusters.Validate()).To(Succeed())
+		})
+
+		It("should reject an empty list of target clusters", func() {
+			Expect((&TargetClusters{}).Validate()).To(MatchError(ContainSubstring("no target clusters configured")))
+		})
+
+		It("should reject duplicate, invalid names and missing kubeconfigs", func() {
+			targetClusters := &TargetClusters{Clusters: []TargetCluster{
+				{Name: "foo", Kubeconfig: "/etc/foo/kubeconfig"},
+				{Name: "foo", Kubeconfig: "/etc/foo/kubeconfig"},
+				{Name: "Not_Valid", Kubeconfig: "/etc/bar/kubeconfig"},
+				{Name: "baz"},
+			}}
+			err := targetClusters.Validate()
+			Expect(err).To(MatchError(ContainSubstring(`clusters[1].name "foo" is not unique`)))
+			Expect(err).To(MatchError(ContainSubstring(`clusters[2].name "Not_Valid" is invalid`)))
+			Expect(err).To(MatchError(ContainSubstring("clusters[3].kubeconfig is required")))
+		})
+	})
+
+	It("should derive the cloud config of a target cluster from the shared cloud config", func() {
+		cloudConfig := CloudConfig{NetworkName: "shared-network", ClusterName: "ignored"}
+
+		Expect(getTargetClusterCloudConfig(cloudConfig, TargetCluster{Name: "foo"})).To(Equal(CloudConfig{
+			NetworkName:     "shared-network",
+			ClusterName:     "foo",
+			SharedNamespace: true,
+		}))
+		Expect(getTargetClusterCloudConfig(cloudConfig, TargetCluster{Name: "bar", NetworkName: "bar-network"})).To(Equal(CloudConfig{
+			NetworkName:     "bar-network",
+			ClusterName:     "bar",
+			SharedNamespace: true,
+		}))
+
+		By("leaving the shared cloud config untouched")
+		Expect(cloudConfig.ClusterName).To(Equal("ignored"))
+	})
+})
@@ -0,0 +1,96 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// NodeAddressResolver resolves the IP addresses of a Node from its Machine. It allows builds of the cloud provider to
+// resolve the addresses from other sources, e.g. a metadata service or a DHCP lease database, without changing
+// InstanceMetadata. The host name and internal DNS name of the cloud config are added to the resolved addresses.
+type NodeAddressResolver interface {
+	// ResolveNodeAddresses returns the addresses of the given Node backed by the given Machine. The given
+	// NetworkInterfaces are the ones whose addresses are reported, by the name of the network interface in the
+	// Machine. An error fails InstanceMetadata.
+	ResolveNodeAddresses(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error)
+}
+
+// NodeAddressResolverFunc is a function implementing NodeAddressResolver.
+type NodeAddressResolverFunc func(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error)
+
+func (f NodeAddressResolverFunc) ResolveNodeAddresses(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error) {
+	return f(ctx, node, machine, networkInterfaces)
+}
+
+var (
+	nodeAddressResolverMu sync.RWMutex
+	nodeAddressResolver   NodeAddressResolver
+)
+
+// RegisterNodeAddressResolver registers a NodeAddressResolver replacing the default resolver, which reports the
+// addresses of the Machine status. Only the resolver registered last is used. It is meant to be called from init
+// functions.
+func RegisterNodeAddressResolver(resolver NodeAddressResolver) {
+	nodeAddressResolverMu.Lock()
+	defer nodeAddressResolverMu.Unlock()
+	nodeAddressResolver = resolver
+}
+
+// getNodeAddressResolver returns the registered NodeAddressResolver or the default resolver for the cloud config.
+func getNodeAddressResolver(cloudConfig CloudConfig) NodeAddressResolver {
+	nodeAddressResolverMu.RLock()
+	defer nodeAddressResolverMu.RUnlock()
+	if nodeAddressResolver != nil {
+		return nodeAddressResolver
+	}
+	return machineStatusAddressResolver{cloudConfig: cloudConfig}
+}
+
+// machineStatusAddressResolver is the default NodeAddressResolver. It reports the IPs of the network interfaces in
+// the Machine status as internal addresses and their VirtualIPs as external addresses, unless VirtualIPs are excluded
+// for the Machine.
+type machineStatusAddressResolver struct {
+	cloudConfig CloudConfig
+}
+
+func (r machineStatusAddressResolver) ResolveNodeAddresses(_ context.Context, _ *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error) {
+	excludeVirtualIPs := r.cloudConfig.isVirtualIPAddressesExcluded(machine)
+	addresses := make([]corev1.NodeAddress, 0)
+	for _, iface := range machine.Status.NetworkInterfaces {
+		if _, ok := networkInterfaces[iface.Name]; !ok {
+			continue
+		}
+		if iface.VirtualIP != nil && !excludeVirtualIPs {
+			addresses = append(addresses, corev1.NodeAddress{
+				Type:    corev1.NodeExternalIP,
+				Address: iface.VirtualIP.String(),
+			})
+		}
+		for _, ip := range iface.IPs {
+			addresses = append(addresses, corev1.NodeAddress{
+				Type:    corev1.NodeInternalIP,
+				Address: ip.String(),
+			})
+		}
+	}
+	return addresses, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("NodeAddressResolver", func() {
+	BeforeEach(func() {
+		nodeAddressResolverMu.Lock()
+		registered := nodeAddressResolver
+		nodeAddressResolver = nil
+		nodeAddressResolverMu.Unlock()
+		DeferCleanup(func() {
+			nodeAddressResolverMu.Lock()
+			nodeAddressResolver = registered
+			nodeAddressResolverMu.Unlock()
+		})
+	})
+
+	machine := &computev1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine"},
+		Spec: computev1alpha1.MachineSpec{
+			MachineClassRef:   corev1.LocalObjectReference{Name: "machine-class"},
+			NetworkInterfaces: []computev1alpha1.NetworkInterface{{Name: "primary"}, {Name: "storage"}},
+		},
+		Status: computev1alpha1.MachineStatus{
+			NetworkInterfaces: []computev1alpha1.NetworkInterfaceStatus{
+				{
+					Name:      "primary",
+					IPs:       []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+					VirtualIP: commonv1alpha1.MustParseNewIP("192.0.2.1"),
+				},
+				{Name: "storage", IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.1.0.1")}},
+			},
+		},
+	}
+	networkInterfaces := map[string]*networkingv1alpha1.NetworkInterface{"primary": {}}
+
+	It("should report the addresses of the machine status by default", func(ctx SpecContext) {
+		resolver := getNodeAddressResolver(CloudConfig{})
+		Expect(resolver.ResolveNodeAddresses(ctx, &corev1.Node{}, machine, networkInterfaces)).To(ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		))
+
+		resolver = getNodeAddressResolver(CloudConfig{ExcludeVirtualIPAddresses: true})
+		Expect(resolver.ResolveNodeAddresses(ctx, &corev1.Node{}, machine, networkInterfaces)).To(ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		))
+	})
+
+	It("should resolve the node addresses with the registered resolver", func(ctx SpecContext) {
+		var resolvedInterfaces []string
+		RegisterNodeAddressResolver(NodeAddressResolverFunc(func(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error) {
+			for name := range networkInterfaces {
+				resolvedInterfaces = append(resolvedInterfaces, name)
+			}
+			return []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.2.0.1"}}, nil
+		}))
+
+		nics := []*networkingv1alpha1.NetworkInterface{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine-primary"},
+				Spec:       networkingv1alpha1.NetworkInterfaceSpec{NetworkRef: corev1.LocalObjectReference{Name: "network"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "machine-storage"},
+				Spec:       networkingv1alpha1.NetworkInterfaceSpec{NetworkRef: corev1.LocalObjectReference{Name: "storage"}},
+			},
+		}
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machine.DeepCopy(), nics[0], nics[1]).Build()
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), onmetalClient, "foo", CloudConfig{
+			ClusterName:    "test",
+			NetworkName:    "network",
+			ReportHostName: true,
+		}, nil, record.NewFakeRecorder(10), nil)
+
+		metadata, err := instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.NodeAddresses).To(ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.2.0.1"},
+			corev1.NodeAddress{Type: corev1.NodeHostName, Address: "machine"},
+		))
+		Expect(resolvedInterfaces).To(ConsistOf("primary"))
+	})
+
+	It("should fail the instance metadata if the resolver fails", func(ctx SpecContext) {
+		RegisterNodeAddressResolver(NodeAddressResolverFunc(func(ctx context.Context, node *corev1.Node, machine *computev1alpha1.Machine, networkInterfaces map[string]*networkingv1alpha1.NetworkInterface) ([]corev1.NodeAddress, error) {
+			return nil, fmt.Errorf("metadata service unavailable")
+		}))
+
+		machineWithoutInterfaces := machine.DeepCopy()
+		machineWithoutInterfaces.Spec.NetworkInterfaces = nil
+		instancesProvider := newOnmetalInstancesV2(fake.NewClientBuilder().Build(), fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(machineWithoutInterfaces).Build(), "foo", CloudConfig{
+			ClusterName: "test",
+			ReadOnly:    true,
+		}, nil, record.NewFakeRecorder(10), nil)
+		_, err := instancesProvider.InstanceMetadata(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "machine"}})
+		Expect(err).To(MatchError(ContainSubstring("metadata service unavailable")))
+	})
+})
@@ -0,0 +1,72 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// Options are the options of a cloud provider constructed by NewCloudProvider.
+type Options struct {
+	// CloudConfig is the cloud config of the cloud provider, as read from the cloud config file by the registered
+	// cloud provider. Its NetworkName and ClusterName are required, its FeatureGates enable experimental behaviors.
+	CloudConfig
+	// OnmetalRestConfig is the rest config of the onmetal API. If nil, it is loaded from OnmetalKubeconfig.
+	OnmetalRestConfig *rest.Config
+	// OnmetalKubeconfig is the path of the kubeconfig of the onmetal API, used if OnmetalRestConfig is nil. Its
+	// credentials are reloaded if OnmetalKubeconfigReloadInterval is set.
+	OnmetalKubeconfig string
+	// Namespace is the onmetal namespace of the cluster. If empty, the namespace of OnmetalKubeconfig is used.
+	Namespace string
+}
+
+// NewCloudProvider returns the onmetal cloud provider for the given options, allowing operators and tests to embed it
+// into their own controller binaries instead of registering it by name. Like the registered cloud provider, it is
+// started by Initialize.
+func NewCloudProvider(opts Options) (cloudprovider.Interface, error) {
+	if err := opts.CloudConfig.Validate(); err != nil {
+		return nil, err
+	}
+	featureGates, err := newFeatureGates(opts.CloudConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig, namespace := opts.OnmetalRestConfig, ""
+	if restConfig == nil {
+		if opts.OnmetalKubeconfig == "" {
+			return nil, fmt.Errorf("either the onmetal rest config or kubeconfig is required")
+		}
+		if restConfig, namespace, err = loadOnmetalRestConfig(opts.OnmetalKubeconfig); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Namespace != "" {
+		namespace = opts.Namespace
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("onmetal namespace is required")
+	}
+
+	return newCloud(&cloudProviderConfig{
+		RestConfig:   restConfig,
+		Namespace:    namespace,
+		cloudConfig:  opts.CloudConfig,
+		featureGates: featureGates,
+	}), nil
+}
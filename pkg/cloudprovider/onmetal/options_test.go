@@ -0,0 +1,76 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var _ = Describe("NewCloudProvider", func() {
+	cloudConfig := CloudConfig{NetworkName: "my-network", ClusterName: "my-cluster"}
+
+	It("should construct the cloud provider from a rest config", func() {
+		restConfig := &rest.Config{Host: "https://onmetal.example.org"}
+		cp, err := NewCloudProvider(Options{CloudConfig: cloudConfig, OnmetalRestConfig: restConfig, Namespace: "foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp).To(BeAssignableToTypeOf(&cloud{}))
+		Expect(cp.(*cloud).onmetalRestConfig).To(BeIdenticalTo(restConfig))
+		Expect(cp.(*cloud).onmetalNamespace).To(Equal("foo"))
+		Expect(cp.(*cloud).cloudConfig).To(Equal(cloudConfig))
+		Expect(cp.ProviderName()).To(Equal(ProviderName))
+
+		By("not supporting any provider interface until it is initialized")
+		_, ok := cp.LoadBalancer()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should take the namespace from the onmetal kubeconfig unless overridden", func() {
+		kubeconfigPath := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+		data, err := clientcmd.Write(clientcmdapi.Config{
+			Clusters:       map[string]*clientcmdapi.Cluster{"onmetal": {Server: "https://onmetal.example.org"}},
+			AuthInfos:      map[string]*clientcmdapi.AuthInfo{"onmetal": {Token: "token"}},
+			Contexts:       map[string]*clientcmdapi.Context{"onmetal": {Cluster: "onmetal", AuthInfo: "onmetal", Namespace: "foo"}},
+			CurrentContext: "onmetal",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(kubeconfigPath, data, 0600)).To(Succeed())
+
+		cp, err := NewCloudProvider(Options{CloudConfig: cloudConfig, OnmetalKubeconfig: kubeconfigPath})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp.(*cloud).onmetalNamespace).To(Equal("foo"))
+
+		cp, err = NewCloudProvider(Options{CloudConfig: cloudConfig, OnmetalKubeconfig: kubeconfigPath, Namespace: "bar"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp.(*cloud).onmetalNamespace).To(Equal("bar"))
+	})
+
+	It("should reject invalid options", func() {
+		_, err := NewCloudProvider(Options{CloudConfig: CloudConfig{ClusterName: "my-cluster"}, OnmetalRestConfig: &rest.Config{}, Namespace: "foo"})
+		Expect(err).To(MatchError(ContainSubstring("networkName missing")))
+
+		_, err = NewCloudProvider(Options{CloudConfig: cloudConfig, Namespace: "foo"})
+		Expect(err).To(MatchError(ContainSubstring("either the onmetal rest config or kubeconfig is required")))
+
+		_, err = NewCloudProvider(Options{CloudConfig: cloudConfig, OnmetalRestConfig: &rest.Config{}})
+		Expect(err).To(MatchError(ContainSubstring("onmetal namespace is required")))
+	})
+})
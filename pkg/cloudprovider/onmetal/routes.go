@@ -30,6 +30,10 @@ import (
 	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
 )
 
+var (
+	routesFieldOwner = client.FieldOwner("cloud-provider.onmetal.de/routes")
+)
+
 type onmetalRoutes struct {
 	targetClient     client.Client
 	onmetalClient    client.Client
@@ -47,7 +51,8 @@ func newOnmetalRoutes(targetClient client.Client, onmetalClient client.Client, n
 }
 
 func (o onmetalRoutes) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
-	klog.V(2).InfoS("List Routes", "Cluster", clusterName)
+	ctx = withLogger(ctx, logModuleRoutes, "Cluster", clusterName)
+	klog.FromContext(ctx).V(2).Info("List Routes")
 
 	networkInterfaces := &networkingv1alpha1.NetworkInterfaceList{}
 	if err := o.onmetalClient.List(ctx, networkInterfaces, client.InNamespace(o.onmetalNamespace), client.MatchingFields{
@@ -80,12 +85,13 @@ func (o onmetalRoutes) ListRoutes(ctx context.Context, clusterName string) ([]*c
 		}
 	}
 
-	klog.V(2).InfoS("Current Routes", "Cluster", clusterName, "Network", o.cloudConfig.NetworkName, "Routes", routes)
+	klog.FromContext(ctx).V(2).Info("Current Routes", "Network", o.cloudConfig.NetworkName, "Routes", routes)
 	return routes, nil
 }
 
 func (o onmetalRoutes) CreateRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route) error {
-	klog.V(2).InfoS("Creating Route", "Cluster", clusterName, "Route", route, "NameHint", nameHint)
+	ctx = withLogger(ctx, logModuleRoutes, "Cluster", clusterName)
+	klog.FromContext(ctx).V(2).Info("Creating Route", "Route", route, "NameHint", nameHint)
 
 	// get the machine object based on the node name
 	nodeName := string(route.TargetNode)
@@ -138,25 +144,26 @@ func (o onmetalRoutes) CreateRoute(ctx context.Context, clusterName string, name
 						}
 						nic.Spec.Prefixes = append(nic.Spec.Prefixes, prefixSource)
 
-						klog.V(2).InfoS("Updating NetworkInterface by adding prefix", "NetworkInterface", client.ObjectKeyFromObject(nic), "Node", nodeName, "Prefix", route.DestinationCIDR)
-						if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase)); err != nil {
+						klog.FromContext(ctx).V(2).Info("Updating NetworkInterface by adding prefix", "NetworkInterface", client.ObjectKeyFromObject(nic), "Node", nodeName, "Prefix", route.DestinationCIDR)
+						if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase), o.cloudConfig.fieldOwnerForRoutes()); err != nil {
 							return fmt.Errorf("failed to patch NetworkInterface %s for Node %s: %w", client.ObjectKeyFromObject(nic), nodeName, err)
 						}
 					} else {
-						klog.V(2).InfoS("NetworkInterface prefix already exists", "NetworkInterface", client.ObjectKeyFromObject(nic), "Node", nodeName, "Prefix", route.DestinationCIDR)
+						klog.FromContext(ctx).V(2).Info("NetworkInterface prefix already exists", "NetworkInterface", client.ObjectKeyFromObject(nic), "Node", nodeName, "Prefix", route.DestinationCIDR)
 					}
 				}
 			}
 		}
 	}
 
-	klog.V(2).InfoS("Created Route", "Cluster", clusterName, "Route", route, "NameHint", nameHint)
+	klog.FromContext(ctx).V(2).Info("Created Route", "Route", route, "NameHint", nameHint)
 
 	return nil
 }
 
 func (o onmetalRoutes) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
-	klog.V(2).InfoS("Deleting Route", "Cluster", clusterName, "Route", route)
+	ctx = withLogger(ctx, logModuleRoutes, "Cluster", clusterName)
+	klog.FromContext(ctx).V(2).Info("Deleting Route", "Route", route)
 
 	// get the machine object based on the node name
 	nodeName := string(route.TargetNode)
@@ -196,9 +203,9 @@ func (o onmetalRoutes) DeleteRoute(ctx context.Context, clusterName string, rout
 						if prefix.Prefix.String() == route.DestinationCIDR {
 							nicBase := nic.DeepCopy()
 							nic.Spec.Prefixes = append(nic.Spec.Prefixes[:i], nic.Spec.Prefixes[i+1:]...)
-							klog.V(2).InfoS("Prefix found and removed", "Prefix", prefix.Prefix.String(), "Prefixes after", nic.Spec.Prefixes)
+							klog.FromContext(ctx).V(2).Info("Prefix found and removed", "Prefix", prefix.Prefix.String(), "Prefixes after", nic.Spec.Prefixes)
 
-							if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase)); err != nil {
+							if err := o.onmetalClient.Patch(ctx, nic, client.MergeFrom(nicBase), o.cloudConfig.fieldOwnerForRoutes()); err != nil {
 								return fmt.Errorf("failed to patch NetworkInterface %s for Node %s: %w", client.ObjectKeyFromObject(nic), nodeName, err)
 							}
 
@@ -209,7 +216,7 @@ func (o onmetalRoutes) DeleteRoute(ctx context.Context, clusterName string, rout
 			}
 		}
 	}
-	klog.V(2).InfoS("Deleted Route", "Cluster", clusterName, "Route", route)
+	klog.FromContext(ctx).V(2).Info("Deleted Route", "Route", route)
 
 	return nil
 }
@@ -0,0 +1,256 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ServiceWebhookName is the name of the webhook validating and defaulting the onmetal annotations of Services.
+	ServiceWebhookName = "onmetal-service"
+	// ServiceWebhookPath is the path the webhook validating and defaulting the onmetal annotations of Services is
+	// served at.
+	ServiceWebhookPath = "/onmetal-service"
+
+	// onmetalServiceAnnotationPrefix is the prefix of all onmetal annotations of Services.
+	onmetalServiceAnnotationPrefix = "service.beta.kubernetes.io/onmetal-"
+)
+
+// serviceAnnotations are the annotations of Services evaluated by the cloud provider.
+var serviceAnnotations = sets.New(
+	InternalLoadBalancerAnnotation,
+	InternalLoadBalancerPrefixLengthAnnotation,
+	LoadBalancerPortRangesAnnotation,
+	FlowLogsAnnotation,
+	FlowLogsDestinationAnnotation,
+	ProxyProtocolAnnotation,
+	PublicPrefixAnnotation,
+	NodePoolsAnnotation,
+	NodePoolWeightsAnnotation,
+	MaxDestinationsAnnotation,
+	DestinationOverflowPolicyAnnotation,
+	EndpointDestinationsAnnotation,
+	ZonesAnnotation,
+	ZoneAffinityAnnotation,
+	EgressSNATAnnotation,
+	ManageRoutingAnnotation,
+)
+
+// NewServiceWebhookConfig returns the config of the webhook validating the onmetal annotations of LoadBalancer
+// Services and defaulting missing ones from the ServiceAnnotationDefaults of the cloud config. The cloud provider is
+// resolved on every request as it is initialized after the webhooks are registered.
+func NewServiceWebhookConfig(getCloud func() cloudprovider.Interface) app.WebhookConfig {
+	return app.WebhookConfig{
+		Path: ServiceWebhookPath,
+		AdmissionHandler: func(request *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+			o, ok := getCloud().(*cloud)
+			if !ok {
+				return nil, fmt.Errorf("cloud provider %s is not initialized", ProviderName)
+			}
+			return admitService(o.cloudConfig, o.featureGates, request)
+		},
+	}
+}
+
+// admitService validates the onmetal annotations of the Service of the request after defaulting them from the cloud
+// config. Services not of type LoadBalancer are admitted unchanged. Annotations are only defaulted on creation, updates
+// are only validated if they change the onmetal annotations or the type of the Service, so Services admitted before
+// can still be updated and deleted.
+func admitService(cloudConfig CloudConfig, featureGates featuregate.FeatureGate, request *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if request.Kind.Kind != "Service" || (request.Operation != admissionv1.Create && request.Operation != admissionv1.Update) {
+		return response, nil
+	}
+
+	service := &corev1.Service{}
+	if err := json.Unmarshal(request.Object.Raw, service); err != nil {
+		return nil, fmt.Errorf("failed to decode Service: %w", err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return response, nil
+	}
+
+	var patch []jsonPatchOperation
+	if request.Operation == admissionv1.Create {
+		patch = defaultServiceAnnotations(service, cloudConfig.ServiceAnnotationDefaults)
+	} else {
+		if !service.DeletionTimestamp.IsZero() {
+			return response, nil
+		}
+		oldService := &corev1.Service{}
+		if err := json.Unmarshal(request.OldObject.Raw, oldService); err != nil {
+			return nil, fmt.Errorf("failed to decode old Service: %w", err)
+		}
+		if oldService.Spec.Type == corev1.ServiceTypeLoadBalancer && equality.Semantic.DeepEqual(getOnmetalServiceAnnotations(oldService), getOnmetalServiceAnnotations(service)) {
+			return response, nil
+		}
+	}
+	if err := validateServiceAnnotations(service, cloudConfig, featureGates); err != nil {
+		klog.V(2).InfoS("Rejecting Service with invalid annotations", "Service", request.Namespace+"/"+request.Name, "Error", err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
+		}
+		return response, nil
+	}
+	if len(patch) > 0 {
+		patchData, err := json.Marshal(patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode patch: %w", err)
+		}
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patchData
+		response.PatchType = &patchType
+	}
+	return response, nil
+}
+
+// getOnmetalServiceAnnotations returns the onmetal annotations of the Service.
+func getOnmetalServiceAnnotations(service *corev1.Service) map[string]string {
+	annotations := make(map[string]string)
+	for key, value := range service.Annotations {
+		if strings.HasPrefix(key, onmetalServiceAnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// jsonPatchOperation is an operation of a JSON patch as defined by RFC 6902.
+type jsonPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// defaultServiceAnnotations sets the given default annotations missing on the Service and returns the JSON patch
+// applying them.
+func defaultServiceAnnotations(service *corev1.Service, defaults map[string]string) []jsonPatchOperation {
+	var patch []jsonPatchOperation
+	for _, key := range sets.List(sets.KeySet(defaults)) {
+		value := defaults[key]
+		if _, ok := service.Annotations[key]; ok {
+			continue
+		}
+		if service.Annotations == nil {
+			service.Annotations = make(map[string]string)
+			patch = append(patch, jsonPatchOperation{Op: "add", Path: "/metadata/annotations", Value: map[string]string{}})
+		}
+		service.Annotations[key] = value
+		patch = append(patch, jsonPatchOperation{Op: "add", Path: "/metadata/annotations/" + escapeJSONPointer(key), Value: value})
+	}
+	return patch
+}
+
+// escapeJSONPointer escapes a reference token of a JSON pointer as defined by RFC 6901.
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// validateServiceAnnotations returns all errors of the onmetal annotations of the Service.
+func validateServiceAnnotations(service *corev1.Service, cloudConfig CloudConfig, featureGates featuregate.FeatureGate) error {
+	var errs []error
+	internal := false
+	if value, ok := service.Annotations[InternalLoadBalancerAnnotation]; ok {
+		if value != "true" && value != "false" {
+			errs = append(errs, fmt.Errorf("annotation %s must be either \"true\" or \"false\"", InternalLoadBalancerAnnotation))
+		}
+		internal = value == "true"
+	}
+	if publicPrefixName, ok := service.Annotations[PublicPrefixAnnotation]; ok {
+		if msgs := validation.IsDNS1123Subdomain(publicPrefixName); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("annotation %s is not a valid Prefix name: %s", PublicPrefixAnnotation, strings.Join(msgs, ", ")))
+		}
+		if internal {
+			errs = append(errs, fmt.Errorf("annotation %s is not supported for internal load balancers", PublicPrefixAnnotation))
+		}
+	}
+	if _, ok := service.Annotations[InternalLoadBalancerPrefixLengthAnnotation]; ok {
+		if _, err := getInternalPrefixLengthsForService(service); err != nil {
+			errs = append(errs, err)
+		}
+		if !internal {
+			errs = append(errs, fmt.Errorf("annotation %s is only supported for internal load balancers", InternalLoadBalancerPrefixLengthAnnotation))
+		}
+	}
+	if _, err := getEgressSNATForService(service, internal); err != nil {
+		errs = append(errs, err)
+	}
+	if service.Spec.LoadBalancerIP != "" {
+		if _, err := netip.ParseAddr(service.Spec.LoadBalancerIP); err != nil {
+			errs = append(errs, fmt.Errorf("loadBalancerIP is not a valid IP: %w", err))
+		}
+	}
+	if _, err := getLoadBalancerPortsForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getFlowLogsDestinationForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getProxyProtocolForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := isRoutingManagedForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getZoneAffinityForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getAppProtocolsForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getHealthChecksForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getNodePoolWeightsForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getDestinationLimitForService(service, cloudConfig); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateEndpointDestinationsForService(service, cloudConfig, featureGates); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateLoadBalancerHostnameForService(service, cloudConfig); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAdoptedLoadBalancerNameForService(service); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getZonesForService(service, nil, cloudConfig); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("Service webhook", func() {
+	newRequest := func(service *corev1.Service) *admissionv1.AdmissionRequest {
+		raw, err := json.Marshal(service)
+		Expect(err).NotTo(HaveOccurred())
+		return &admissionv1.AdmissionRequest{
+			UID:       "request-uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Service"},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+	}
+	newUpdateRequest := func(oldService, service *corev1.Service) *admissionv1.AdmissionRequest {
+		request := newRequest(service)
+		raw, err := json.Marshal(oldService)
+		Expect(err).NotTo(HaveOccurred())
+		request.Operation = admissionv1.Update
+		request.OldObject = runtime.RawExtension{Raw: raw}
+		return request
+	}
+	newService := func(serviceType corev1.ServiceType, annotations map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Type: serviceType},
+		}
+	}
+
+	It("should default missing annotations of load balancer services", func() {
+		cloudConfig := CloudConfig{ServiceAnnotationDefaults: map[string]string{
+			ProxyProtocolAnnotation:        proxyProtocolV2,
+			InternalLoadBalancerAnnotation: "true",
+		}}
+
+		response, err := admitService(cloudConfig, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			InternalLoadBalancerAnnotation: "false",
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.UID).To(BeEquivalentTo("request-uid"))
+		Expect(string(response.Patch)).To(MatchJSON(`[
+			{"op": "add", "path": "/metadata/annotations/service.beta.kubernetes.io~1onmetal-load-balancer-proxy-protocol", "value": "v2"}
+		]`))
+
+		response, err = admitService(cloudConfig, nil, newRequest(newService(corev1.ServiceTypeClusterIP, nil)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patch).To(BeEmpty())
+	})
+
+	It("should create the annotations of services without annotations", func() {
+		cloudConfig := CloudConfig{ServiceAnnotationDefaults: map[string]string{NodePoolsAnnotation: "ingress"}}
+
+		response, err := admitService(cloudConfig, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, nil)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(response.Patch)).To(MatchJSON(`[
+			{"op": "add", "path": "/metadata/annotations", "value": {}},
+			{"op": "add", "path": "/metadata/annotations/service.beta.kubernetes.io~1onmetal-load-balancer-node-pools", "value": "ingress"}
+		]`))
+	})
+
+	It("should reject load balancer services with invalid annotations", func() {
+		service := newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			InternalLoadBalancerAnnotation: "yes",
+			PublicPrefixAnnotation:         "My_Prefix",
+			ProxyProtocolAnnotation:        "v1",
+			MaxDestinationsAnnotation:      "-1",
+		})
+		service.Spec.LoadBalancerIP = "10.0.0.300"
+
+		response, err := admitService(CloudConfig{}, nil, newRequest(service))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(SatisfyAll(
+			ContainSubstring(InternalLoadBalancerAnnotation),
+			ContainSubstring(PublicPrefixAnnotation),
+			ContainSubstring(ProxyProtocolAnnotation),
+			ContainSubstring(MaxDestinationsAnnotation),
+			ContainSubstring("loadBalancerIP"),
+		))
+	})
+
+	It("should reject public prefixes of internal load balancers", func() {
+		response, err := admitService(CloudConfig{}, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			InternalLoadBalancerAnnotation: "true",
+			PublicPrefixAnnotation:         "prefix",
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring("not supported for internal load balancers"))
+	})
+
+	It("should reject egress SNAT of internal load balancers", func() {
+		response, err := admitService(CloudConfig{}, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			InternalLoadBalancerAnnotation: "true",
+			EgressSNATAnnotation:           "true",
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(EgressSNATAnnotation))
+	})
+
+	It("should reject node pool weights of node pools not selected by the service", func() {
+		response, err := admitService(CloudConfig{}, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			NodePoolsAnnotation:       "stable",
+			NodePoolWeightsAnnotation: "stable=9,canary=1",
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring("MachinePool canary"))
+	})
+
+	It("should reject internal prefix lengths of public load balancers and invalid lengths", func() {
+		response, err := admitService(CloudConfig{}, nil, newRequest(newService(corev1.ServiceTypeLoadBalancer, map[string]string{
+			InternalLoadBalancerPrefixLengthAnnotation: "IPv4=33",
+		})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring("must be between 1 and 32"))
+		Expect(response.Result.Message).To(ContainSubstring("only supported for internal load balancers"))
+	})
+
+	It("should only default annotations on creation", func() {
+		cloudConfig := CloudConfig{ServiceAnnotationDefaults: map[string]string{ProxyProtocolAnnotation: proxyProtocolV2}}
+		service := newService(corev1.ServiceTypeLoadBalancer, map[string]string{InternalLoadBalancerAnnotation: "true"})
+
+		response, err := admitService(cloudConfig, nil, newUpdateRequest(service, service))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patch).To(BeEmpty())
+	})
+
+	It("should only validate updates changing the onmetal annotations or the type", func() {
+		oldService := newService(corev1.ServiceTypeLoadBalancer, map[string]string{ProxyProtocolAnnotation: "v1", "foo": "bar"})
+		service := newService(corev1.ServiceTypeLoadBalancer, map[string]string{ProxyProtocolAnnotation: "v1", "foo": "baz"})
+
+		response, err := admitService(CloudConfig{}, nil, newUpdateRequest(oldService, service))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeTrue())
+
+		By("admitting deleted Services")
+		deleted := service.DeepCopy()
+		deleted.DeletionTimestamp = &metav1.Time{Time: time.Unix(1, 0)}
+		deleted.Annotations[InternalLoadBalancerAnnotation] = "yes"
+		response, err = admitService(CloudConfig{}, nil, newUpdateRequest(oldService, deleted))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeTrue())
+
+		By("validating changed onmetal annotations")
+		changed := service.DeepCopy()
+		changed.Annotations[InternalLoadBalancerAnnotation] = "true"
+		response, err = admitService(CloudConfig{}, nil, newUpdateRequest(oldService, changed))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(ProxyProtocolAnnotation))
+
+		By("validating Services changed to type LoadBalancer")
+		oldService.Spec.Type = corev1.ServiceTypeClusterIP
+		response, err = admitService(CloudConfig{}, nil, newUpdateRequest(oldService, service))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Allowed).To(BeFalse())
+	})
+})
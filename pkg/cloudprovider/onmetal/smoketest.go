@@ -0,0 +1,314 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// SmokeTestOptions are the options of the load balancer smoke test.
+type SmokeTestOptions struct {
+	// KubeconfigPath is the path to the kubeconfig of the target cluster.
+	KubeconfigPath string
+	// CloudConfigPath is the path to the cloud config of the cloud provider.
+	CloudConfigPath string
+	// Namespace is the namespace of the target cluster the Service is created in.
+	Namespace string
+	// ClusterName is the cluster name the cloud controller manager of the target cluster is running with.
+	ClusterName string
+	// Port is the port of the Service.
+	Port int32
+	// Selector selects the Pods serving the port of the Service.
+	Selector map[string]string
+	// Probe enables sending an HTTP request to the IP of the load balancer.
+	Probe bool
+	// Timeout is the maximum duration of every step of the smoke test.
+	Timeout time.Duration
+}
+
+// NewSmokeTestCommand returns the command creating a temporary LoadBalancer Service in the target cluster, verifying
+// the IP allocation and routing of its onmetal LoadBalancer, and deleting it again. The onmetal API is accessed with
+// the onmetal kubeconfig of the cloud provider.
+func NewSmokeTestCommand() *cobra.Command {
+	opts := SmokeTestOptions{
+		Namespace:   metav1.NamespaceDefault,
+		ClusterName: "kubernetes",
+		Port:        80,
+		Timeout:     5 * time.Minute,
+	}
+	cmd := &cobra.Command{
+		Use:   "smoke-test",
+		Short: "Create a temporary LoadBalancer Service and verify its onmetal LoadBalancer end to end",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunSmokeTest(cmd.Context(), opts, cmd.OutOrStdout())
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&opts.KubeconfigPath, "kubeconfig", opts.KubeconfigPath, "Path to the kubeconfig of the target cluster.")
+	fs.StringVar(&opts.CloudConfigPath, "cloud-config", opts.CloudConfigPath, "Path to the cloud config of the cloud provider.")
+	fs.StringVar(&opts.Namespace, "namespace", opts.Namespace, "Namespace of the target cluster to create the Service in.")
+	fs.StringVar(&opts.ClusterName, "cluster-name", opts.ClusterName, "Cluster name the cloud controller manager of the target cluster is running with.")
+	fs.Int32Var(&opts.Port, "port", opts.Port, "Port of the Service.")
+	fs.StringToStringVar(&opts.Selector, "selector", opts.Selector, "Labels of the Pods serving the port of the Service.")
+	fs.BoolVar(&opts.Probe, "probe", opts.Probe, "Send an HTTP request to the IP of the load balancer. Requires Pods selected by --selector.")
+	fs.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "Maximum duration of every step.")
+
+	// the cloud controller manager command prints its own flags only
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n  %s\n\nFlags:\n%s", cmd.UseLine(), cmd.Flags().FlagUsages())
+		return nil
+	})
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n", cmd.Short)
+		_ = cmd.Usage()
+	})
+	return cmd
+}
+
+// RunSmokeTest runs the load balancer smoke test and writes its timing report to out.
+func RunSmokeTest(ctx context.Context, opts SmokeTestOptions, out io.Writer) error {
+	targetConfig, err := clientcmd.BuildConfigFromFlags("", opts.KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load target kubeconfig: %w", err)
+	}
+	targetClient, err := client.New(targetConfig, client.Options{Scheme: targetScheme})
+	if err != nil {
+		return fmt.Errorf("unable to create target client: %w", err)
+	}
+
+	cloudConfigFile, err := os.Open(opts.CloudConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to open cloud config: %w", err)
+	}
+	defer cloudConfigFile.Close()
+	cfg, err := LoadCloudProviderConfig(cloudConfigFile)
+	if err != nil {
+		return err
+	}
+	onmetalClient, err := client.New(cfg.RestConfig, client.Options{Scheme: onmetalScheme})
+	if err != nil {
+		return fmt.Errorf("unable to create onmetal client: %w", err)
+	}
+
+	t := &smokeTest{
+		targetClient:     targetClient,
+		onmetalClient:    onmetalClient,
+		onmetalNamespace: cfg.Namespace,
+		cloudConfig:      cfg.cloudConfig,
+		opts:             opts,
+		pollInterval:     2 * time.Second,
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
+	}
+	report, err := t.run(ctx)
+	report.print(out)
+	return err
+}
+
+// smokeTest creates a LoadBalancer Service in the target cluster and waits for the cloud controller manager of the
+// target cluster to reconcile its onmetal LoadBalancer.
+type smokeTest struct {
+	targetClient     client.Client
+	onmetalClient    client.Client
+	onmetalNamespace string
+	cloudConfig      CloudConfig
+	opts             SmokeTestOptions
+	pollInterval     time.Duration
+	httpClient       *http.Client
+}
+
+func (t *smokeTest) run(ctx context.Context) (*smokeTestReport, error) {
+	report := &smokeTestReport{}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    t.opts.Namespace,
+			GenerateName: "onmetal-smoke-test-",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeLoadBalancer,
+			Selector: t.opts.Selector,
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       t.opts.Port,
+				TargetPort: intstr.FromInt32(t.opts.Port),
+			}},
+		},
+	}
+	if err := report.step("create Service", func() error {
+		return t.targetClient.Create(ctx, service)
+	}); err != nil {
+		return report, err
+	}
+
+	err := t.verify(ctx, report, service)
+	return report, errors.Join(err, t.teardown(ctx, report, service))
+}
+
+func (t *smokeTest) verify(ctx context.Context, report *smokeTestReport, service *corev1.Service) error {
+	var ip string
+	if err := report.step("allocate IP", func() error {
+		return t.poll(ctx, func(ctx context.Context) (bool, error) {
+			if err := t.targetClient.Get(ctx, client.ObjectKeyFromObject(service), service); err != nil {
+				return false, err
+			}
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					ip = ingress.IP
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("no IP allocated for Service %s: %w", client.ObjectKeyFromObject(service), err)
+	}
+
+	loadBalancerKey := client.ObjectKey{Namespace: t.onmetalNamespace, Name: t.cloudConfig.loadBalancerNameForService(t.opts.ClusterName, service)}
+	if err := report.step("verify LoadBalancer", func() error {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{}
+		if err := t.onmetalClient.Get(ctx, loadBalancerKey, loadBalancer); err != nil {
+			return err
+		}
+		for _, loadBalancerIP := range loadBalancer.Status.IPs {
+			if loadBalancerIP.String() == ip {
+				return nil
+			}
+		}
+		return fmt.Errorf("IP %s of Service is not an IP of LoadBalancer %s", ip, loadBalancerKey)
+	}); err != nil {
+		return err
+	}
+
+	if err := report.step("verify routing", func() error {
+		return t.poll(ctx, func(ctx context.Context) (bool, error) {
+			loadBalancerRouting := &networkingv1alpha1.LoadBalancerRouting{}
+			if err := t.onmetalClient.Get(ctx, loadBalancerKey, loadBalancerRouting); err != nil {
+				return false, client.IgnoreNotFound(err)
+			}
+			return len(loadBalancerRouting.Destinations) > 0, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("no destinations in LoadBalancerRouting %s: %w", loadBalancerKey, err)
+	}
+
+	if !t.opts.Probe {
+		return nil
+	}
+	url := "http://" + net.JoinHostPort(ip, strconv.Itoa(int(t.opts.Port)))
+	if err := report.step("probe "+url, func() error {
+		return t.poll(ctx, func(ctx context.Context) (bool, error) {
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return false, err
+			}
+			response, err := t.httpClient.Do(request)
+			if err != nil {
+				return false, nil
+			}
+			defer response.Body.Close()
+			return true, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to probe %s: %w", url, err)
+	}
+	return nil
+}
+
+// teardown deletes the Service and waits for its onmetal LoadBalancer to be deleted. It uses a context of its own so
+// the resources are cleaned up even if the smoke test was interrupted.
+func (t *smokeTest) teardown(ctx context.Context, report *smokeTestReport, service *corev1.Service) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*t.opts.Timeout)
+	defer cancel()
+
+	if err := report.step("delete Service", func() error {
+		return client.IgnoreNotFound(t.targetClient.Delete(ctx, service))
+	}); err != nil {
+		return fmt.Errorf("failed to delete Service %s: %w", client.ObjectKeyFromObject(service), err)
+	}
+
+	loadBalancerKey := client.ObjectKey{Namespace: t.onmetalNamespace, Name: t.cloudConfig.loadBalancerNameForService(t.opts.ClusterName, service)}
+	if err := report.step("release LoadBalancer", func() error {
+		return t.poll(ctx, func(ctx context.Context) (bool, error) {
+			err := t.onmetalClient.Get(ctx, loadBalancerKey, &networkingv1alpha1.LoadBalancer{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+	}); err != nil {
+		return fmt.Errorf("LoadBalancer %s was not deleted: %w", loadBalancerKey, err)
+	}
+	return nil
+}
+
+func (t *smokeTest) poll(ctx context.Context, condition wait.ConditionWithContextFunc) error {
+	return wait.PollUntilContextTimeout(ctx, t.pollInterval, t.opts.Timeout, true, condition)
+}
+
+// smokeTestStep is a timed step of the smoke test.
+type smokeTestStep struct {
+	name     string
+	duration time.Duration
+	err      error
+}
+
+// smokeTestReport records the steps of the smoke test.
+type smokeTestReport struct {
+	steps []smokeTestStep
+}
+
+func (r *smokeTestReport) step(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	r.steps = append(r.steps, smokeTestStep{name: name, duration: time.Since(start), err: err})
+	return err
+}
+
+func (r *smokeTestReport) print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tDURATION\tRESULT")
+	var total time.Duration
+	for _, step := range r.steps {
+		result := "ok"
+		if step.err != nil {
+			result = step.err.Error()
+		}
+		total += step.duration
+		fmt.Fprintf(w, "%s\t%s\t%s\n", step.name, step.duration.Round(time.Millisecond), result)
+	}
+	fmt.Fprintf(w, "total\t%s\t\n", total.Round(time.Millisecond))
+	_ = w.Flush()
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("SmokeTest", func() {
+	It("should verify the load balancer of the service and tear it down", func(ctx SpecContext) {
+		targetClient := fake.NewClientBuilder().WithStatusSubresource(&corev1.Service{}).Build()
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).Build()
+		t := &smokeTest{
+			targetClient:     targetClient,
+			onmetalClient:    onmetalClient,
+			onmetalNamespace: "foo",
+			opts:             SmokeTestOptions{Namespace: "default", ClusterName: "test", Port: 80, Timeout: 5 * time.Second},
+			pollInterval:     10 * time.Millisecond,
+		}
+
+		By("simulating the cloud controller manager of the target cluster")
+		ccmCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go wait.UntilWithContext(ccmCtx, func(ctx context.Context) {
+			serviceList := &corev1.ServiceList{}
+			if err := targetClient.List(ctx, serviceList); err != nil || len(serviceList.Items) == 0 {
+				// the service was deleted, hence the load balancer is deleted
+				_ = onmetalClient.DeleteAllOf(ctx, &networkingv1alpha1.LoadBalancer{}, client.InNamespace("foo"))
+				return
+			}
+			service := &serviceList.Items[0]
+			name := getLoadBalancerNameForService("test", service, "")
+			_ = onmetalClient.Create(ctx, &networkingv1alpha1.LoadBalancer{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: name},
+				Status: networkingv1alpha1.LoadBalancerStatus{
+					IPs: []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")},
+				},
+			})
+			_ = onmetalClient.Create(ctx, &networkingv1alpha1.LoadBalancerRouting{
+				ObjectMeta:   metav1.ObjectMeta{Namespace: "foo", Name: name},
+				Destinations: []networkingv1alpha1.LoadBalancerDestination{{IP: commonv1alpha1.MustParseIP("10.0.1.1")}},
+			})
+			service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			_ = targetClient.Status().Update(ctx, service)
+		}, 10*time.Millisecond)
+
+		report, err := t.run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, step := range report.steps {
+			Expect(step.err).NotTo(HaveOccurred())
+			names = append(names, step.name)
+		}
+		Expect(names).To(Equal([]string{
+			"create Service", "allocate IP", "verify LoadBalancer", "verify routing", "delete Service", "release LoadBalancer",
+		}))
+
+		By("checking that the service was deleted")
+		serviceList := &corev1.ServiceList{}
+		Expect(targetClient.List(ctx, serviceList)).To(Succeed())
+		Expect(serviceList.Items).To(BeEmpty())
+
+		By("printing the report")
+		out := &bytes.Buffer{}
+		report.print(out)
+		Expect(out.String()).To(ContainSubstring("allocate IP"))
+		Expect(out.String()).To(ContainSubstring("total"))
+	})
+
+	It("should tear down the service if no IP is allocated", func(ctx SpecContext) {
+		targetClient := fake.NewClientBuilder().Build()
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).Build()
+		t := &smokeTest{
+			targetClient:     targetClient,
+			onmetalClient:    onmetalClient,
+			onmetalNamespace: "foo",
+			opts:             SmokeTestOptions{Namespace: "default", ClusterName: "test", Port: 80, Timeout: 50 * time.Millisecond},
+			pollInterval:     10 * time.Millisecond,
+		}
+
+		report, err := t.run(ctx)
+		Expect(err).To(MatchError(ContainSubstring("no IP allocated")))
+		Expect(report.steps).To(HaveLen(4))
+		Expect(report.steps[1].err).To(HaveOccurred())
+		Expect(report.steps[2].name).To(Equal("delete Service"))
+		Expect(report.steps[2].err).NotTo(HaveOccurred())
+
+		serviceList := &corev1.ServiceList{}
+		Expect(targetClient.List(ctx, serviceList)).To(Succeed())
+		Expect(serviceList.Items).To(BeEmpty())
+	})
+})
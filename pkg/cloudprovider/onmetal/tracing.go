@@ -0,0 +1,97 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const tracerName = "github.com/onmetal/cloud-provider-onmetal/pkg/cloudprovider/onmetal"
+
+// tracer creates the spans of the cloud provider operations. Without a configured tracing endpoint the global no-op
+// tracer provider is used and spans are not recorded.
+var tracer = otel.Tracer(tracerName)
+
+const (
+	attributeKeyClusterName      = attribute.Key("onmetal.cluster.name")
+	attributeKeyServiceName      = attribute.Key("k8s.service.name")
+	attributeKeyServiceNamespace = attribute.Key("k8s.service.namespace")
+	attributeKeyServiceUID       = attribute.Key("k8s.service.uid")
+	attributeKeyNodeName         = attribute.Key("k8s.node.name")
+	attributeKeyMachineName      = attribute.Key("onmetal.machine.name")
+	attributeKeyMachineNamespace = attribute.Key("onmetal.machine.namespace")
+)
+
+// setupTracing exports the spans of the cloud provider to the OTLP gRPC endpoint and returns a function flushing and
+// stopping the export.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	resource, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(eventSourceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(resource))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tracerProvider.Shutdown, nil
+}
+
+// wrapRestConfigWithTracing traces the requests to the onmetal API and propagates the trace context to it.
+func wrapRestConfigWithTracing(cfg *rest.Config) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt)
+	})
+}
+
+// startSpan starts a span of the given operation of the cloud provider.
+func startSpan(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends the span, recording the error of the operation if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func serviceAttributes(clusterName string, service *corev1.Service) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attributeKeyClusterName.String(clusterName),
+		attributeKeyServiceName.String(service.Name),
+		attributeKeyServiceNamespace.String(service.Namespace),
+		attributeKeyServiceUID.String(string(service.UID)),
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Tracing", func() {
+	var spanRecorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		tracerProvider := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		DeferCleanup(func() {
+			otel.SetTracerProvider(tracerProvider)
+		})
+	})
+
+	It("should record a span of a failed load balancer operation with the service attributes", func(ctx SpecContext) {
+		lb := &onmetalLoadBalancer{
+			onmetalClient:    fake.NewClientBuilder().WithScheme(onmetalScheme).Build(),
+			onmetalNamespace: "foo",
+			recorder:         record.NewFakeRecorder(1),
+		}
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		}
+
+		_, err := lb.EnsureLoadBalancer(ctx, "test", service, nil)
+		Expect(err).To(HaveOccurred())
+
+		spans := spanRecorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("EnsureLoadBalancer"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			attributeKeyClusterName.String("test"),
+			attributeKeyServiceName.String("foo"),
+			attributeKeyServiceNamespace.String("default"),
+			attributeKeyServiceUID.String("uid"),
+		))
+	})
+})
@@ -0,0 +1,176 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// The writes of LoadBalancers and LoadBalancerRoutings are computed from the typed objects of the onmetal API version
+// this provider is built against. During a rolling upgrade of the control plane an older provider build may write
+// objects last written by a newer one, e.g. by a newer provider build or onmetal API server. Fields the older build
+// does not know would be dropped by the writes, hence they are carried over from the current object.
+
+// applyPreservingUnknownFields server-side applies the desired object, keeping the fields of the current object which
+// are unknown to the scheme of the client. The apply is not preconditioned on the resource version of the current
+// object, see setCreatorAnnotation.
+func applyPreservingUnknownFields(ctx context.Context, c client.Client, desired client.Object, opts ...client.PatchOption) error {
+	current, err := getUnstructured(ctx, c, desired)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	obj, err := toUnstructuredPreservingUnknownFields(c.Scheme(), desired, current)
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion("")
+	setCreatorAnnotation(obj, current)
+	if err := c.Patch(ctx, obj, client.Apply, opts...); err != nil {
+		return err
+	}
+	return c.Scheme().Convert(obj, desired, nil)
+}
+
+// patchPreservingUnknownFields merge patches the object from base like client.MergeFrom, keeping the fields of the
+// current object which are unknown to the scheme of the client. Lists are otherwise replaced as a whole by merge
+// patches, dropping the unknown fields of their items. The patch is preconditioned on the resource version of base.
+func patchPreservingUnknownFields(ctx context.Context, c client.Client, obj, base client.Object, opts ...client.PatchOption) error {
+	current, err := getUnstructured(ctx, c, obj)
+	if err != nil {
+		return err
+	}
+	baseObj, err := toUnstructuredPreservingUnknownFields(c.Scheme(), base, current)
+	if err != nil {
+		return err
+	}
+	modifiedObj, err := toUnstructuredPreservingUnknownFields(c.Scheme(), obj, current)
+	if err != nil {
+		return err
+	}
+	if err := c.Patch(ctx, modifiedObj, client.MergeFromWithOptions(baseObj, client.MergeFromWithOptimisticLock{}), opts...); err != nil {
+		return err
+	}
+	return c.Scheme().Convert(modifiedObj, obj, nil)
+}
+
+// getUnstructured returns the current state of the object including all fields unknown to the scheme of the client.
+func getUnstructured(ctx context.Context, c client.Client, obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+	return current, nil
+}
+
+// toUnstructuredPreservingUnknownFields converts the typed object into an unstructured one and adds the fields of the
+// current object unknown to the scheme. Metadata and status are not carried over. A nil current object adds no fields.
+func toUnstructuredPreservingUnknownFields(scheme *runtime.Scheme, obj client.Object, current *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s to unstructured: %w", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+	result := &unstructured.Unstructured{Object: content}
+	result.SetGroupVersionKind(gvk)
+	if current == nil {
+		return result, nil
+	}
+
+	// the known fields of the current object are the ones surviving a round trip through the typed object
+	typed, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(current.Object, typed); err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s from unstructured: %w", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+	known, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s to unstructured: %w", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+
+	currentContent := make(map[string]interface{}, len(current.Object))
+	for key, value := range current.Object {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			currentContent[key] = value
+		}
+	}
+	restoreUnknownFields(result.Object, currentContent, known)
+	return result, nil
+}
+
+// restoreUnknownFields adds the values of current missing in known to desired. Maps are traversed by key, items of
+// lists are matched by the equality of their known fields.
+func restoreUnknownFields(desired, current, known interface{}) interface{} {
+	switch current := current.(type) {
+	case map[string]interface{}:
+		knownMap, _ := known.(map[string]interface{})
+		desiredMap, ok := desired.(map[string]interface{})
+		if !ok {
+			return desired
+		}
+		for key, value := range current {
+			knownValue, isKnown := knownMap[key]
+			if !isKnown {
+				if _, ok := desiredMap[key]; !ok {
+					desiredMap[key] = value
+				}
+				continue
+			}
+			if desiredValue, ok := desiredMap[key]; ok {
+				desiredMap[key] = restoreUnknownFields(desiredValue, value, knownValue)
+			}
+		}
+		return desiredMap
+	case []interface{}:
+		knownList, _ := known.([]interface{})
+		desiredList, ok := desired.([]interface{})
+		if !ok || len(knownList) != len(current) {
+			return desired
+		}
+		matched := make([]bool, len(current))
+		for i, desiredItem := range desiredList {
+			for j, knownItem := range knownList {
+				if matched[j] || !equality.Semantic.DeepEqual(desiredItem, knownItem) {
+					continue
+				}
+				matched[j] = true
+				desiredList[i] = restoreUnknownFields(desiredItem, current[j], knownItem)
+				break
+			}
+		}
+		return desiredList
+	default:
+		return desired
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("UnknownFields", func() {
+	current := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": networkingv1alpha1.SchemeGroupVersion.String(),
+			"kind":       "LoadBalancerRouting",
+			"metadata": map[string]interface{}{
+				"namespace": "foo",
+				"name":      "lb",
+				"unknown":   "metadata",
+			},
+			"networkRef": map[string]interface{}{
+				"name":    "network",
+				"unknown": "networkRef",
+			},
+			"destinations": []interface{}{
+				map[string]interface{}{"ip": "10.0.0.1", "weight": int64(1)},
+				map[string]interface{}{"ip": "10.0.0.2", "weight": int64(2)},
+			},
+			"unknown": "routing",
+		}}
+	}
+
+	It("should keep the unknown fields of the current object", func() {
+		desired := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			NetworkRef: commonv1alpha1.LocalUIDReference{Name: "network"},
+			Destinations: []networkingv1alpha1.LoadBalancerDestination{
+				{IP: commonv1alpha1.MustParseIP("10.0.0.3")},
+				{IP: commonv1alpha1.MustParseIP("10.0.0.2")},
+			},
+		}
+
+		obj, err := toUnstructuredPreservingUnknownFields(onmetalScheme, desired, current())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetAPIVersion()).To(Equal(networkingv1alpha1.SchemeGroupVersion.String()))
+		Expect(obj.GetKind()).To(Equal("LoadBalancerRouting"))
+		Expect(obj.Object).To(HaveKeyWithValue("unknown", "routing"))
+		Expect(obj.Object).To(HaveKeyWithValue("networkRef", HaveKeyWithValue("unknown", "networkRef")))
+		Expect(obj.Object).To(HaveKeyWithValue("destinations", ConsistOf(
+			map[string]interface{}{"ip": "10.0.0.3"},
+			map[string]interface{}{"ip": "10.0.0.2", "weight": int64(2)},
+		)))
+		Expect(obj.Object).To(HaveKeyWithValue("metadata", Not(HaveKey("unknown"))))
+	})
+
+	It("should not add fields without a current object", func() {
+		desired := &networkingv1alpha1.LoadBalancerRouting{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			NetworkRef: commonv1alpha1.LocalUIDReference{Name: "network"},
+		}
+
+		obj, err := toUnstructuredPreservingUnknownFields(onmetalScheme, desired, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object).NotTo(HaveKey("unknown"))
+		Expect(obj.Object).To(HaveKeyWithValue("networkRef", Not(HaveKey("unknown"))))
+	})
+})
@@ -0,0 +1,59 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// During a split-brain window of the leader election two replicas may reconcile the same Service. Merge patches of
+// LoadBalancers and LoadBalancerRoutings are preconditioned on the resource version of the object they are computed
+// from, so a patch based on an outdated read fails with a conflict. Applies are computed from the Service and the
+// cache rather than from a single read of the object, and the status of the object is written by onmetal at any time,
+// hence they are not preconditioned and concurrent applies are fenced by the leader lease. The creating replica is
+// recorded on every object to trace objects created during such a window.
+
+// replicaIdentity identifies this replica in the annotations of the objects it creates, in the format of the
+// identities of the leader election lease.
+var replicaIdentity = newReplicaIdentity()
+
+func newReplicaIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "_" + string(uuid.NewUUID())
+}
+
+// setCreatorAnnotation annotates obj with the identity of the creating replica if there is no current object, while
+// the creator of existing objects is kept.
+func setCreatorAnnotation(obj, current *unstructured.Unstructured) {
+	creator := replicaIdentity
+	if current != nil {
+		creator = current.GetAnnotations()[AnnotationKeyCreatedBy]
+	}
+	if creator == "" {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AnnotationKeyCreatedBy] = creator
+	obj.SetAnnotations(annotations)
+}
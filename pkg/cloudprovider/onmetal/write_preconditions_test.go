@@ -0,0 +1,89 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onmetal
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	commonv1alpha1 "github.com/onmetal/onmetal-api/api/common/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+var _ = Describe("WritePreconditions", func() {
+	newObject := func(resourceVersion string, annotations map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetResourceVersion(resourceVersion)
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+
+	It("should annotate created objects with the identity of the replica", func() {
+		obj := newObject("", map[string]string{"foo": "bar"})
+		setCreatorAnnotation(obj, nil)
+		Expect(obj.GetAnnotations()).To(Equal(map[string]string{"foo": "bar", AnnotationKeyCreatedBy: replicaIdentity}))
+	})
+
+	It("should keep the creator of existing objects", func() {
+		obj := newObject("", nil)
+		setCreatorAnnotation(obj, newObject("42", map[string]string{AnnotationKeyCreatedBy: "other-replica"}))
+		Expect(obj.GetAnnotations()).To(Equal(map[string]string{AnnotationKeyCreatedBy: "other-replica"}))
+
+		obj = newObject("", nil)
+		setCreatorAnnotation(obj, newObject("42", nil))
+		Expect(obj.GetAnnotations()).To(BeEmpty())
+	})
+
+	It("should not fail applies if the status is written between the read and the apply", func(ctx SpecContext) {
+		loadBalancer := &networkingv1alpha1.LoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "lb"},
+			Spec:       networkingv1alpha1.LoadBalancerSpec{Type: networkingv1alpha1.LoadBalancerTypePublic},
+		}
+		var applied []string
+		onmetalClient := fake.NewClientBuilder().WithScheme(onmetalScheme).WithObjects(loadBalancer).WithStatusSubresource(loadBalancer).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if patch.Type() != types.ApplyPatchType {
+					return c.Patch(ctx, obj, patch, opts...)
+				}
+				current := &networkingv1alpha1.LoadBalancer{}
+				Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), current)).To(Succeed())
+				current.Status.IPs = []commonv1alpha1.IP{commonv1alpha1.MustParseIP("10.0.0.1")}
+				Expect(c.Status().Update(ctx, current)).To(Succeed())
+
+				// the API server fails writes preconditioned on an outdated resource version
+				if obj.GetResourceVersion() != "" && obj.GetResourceVersion() != current.ResourceVersion {
+					return apierrors.NewConflict(networkingv1alpha1.Resource("loadbalancers"), obj.GetName(), errors.New("the object has been modified"))
+				}
+				applied = append(applied, obj.GetName())
+				return nil
+			},
+		}).Build()
+
+		desired := loadBalancer.DeepCopy()
+		desired.Spec.Ports = []networkingv1alpha1.LoadBalancerPort{{Port: 80}}
+		Expect(applyPreservingUnknownFields(ctx, onmetalClient, desired, loadBalancerFieldOwner, client.ForceOwnership)).To(Succeed())
+		Expect(applied).To(ConsistOf("lb"))
+	})
+})
@@ -0,0 +1,110 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+)
+
+// The e2e specs run against a target cluster whose cloud controller manager is the onmetal cloud provider, and the
+// onmetal API the cloud provider manages the cluster in. They create their resources in a temporary namespace of the
+// target cluster and delete it again, so they can be run against production installations to certify them.
+
+var (
+	targetKubeconfig  = flag.String("target-kubeconfig", "", "Path to the kubeconfig of the target cluster.")
+	onmetalKubeconfig = flag.String("onmetal-kubeconfig", "", "Path to the kubeconfig of the onmetal API the cloud provider uses.")
+	onmetalNamespace  = flag.String("onmetal-namespace", "", "Namespace of the onmetal API the cloud provider manages the cluster in. Defaults to the namespace of the onmetal kubeconfig.")
+	clusterName       = flag.String("cluster-name", "kubernetes", "Cluster name the cloud controller manager of the target cluster is running with.")
+	backendImage      = flag.String("backend-image", "registry.k8s.io/e2e-test-images/agnhost:2.43", "Image of the backends of the load balancers, serving the agnhost netexec HTTP API.")
+	internal          = flag.Bool("internal", false, "Also verify internal load balancers. Requires a prefixName in the cloud config.")
+	connectivity      = flag.Bool("connectivity", true, "Send HTTP requests to the IPs of the load balancers. Requires the test runner to reach them.")
+	timeout           = flag.Duration("timeout", 5*time.Minute, "Maximum duration of every step waiting for the cloud provider.")
+)
+
+const pollingInterval = 2 * time.Second
+
+var (
+	targetScheme  = runtime.NewScheme()
+	onmetalScheme = runtime.NewScheme()
+
+	targetClient  client.Client
+	onmetalClient client.Client
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(targetScheme))
+	utilruntime.Must(clientgoscheme.AddToScheme(onmetalScheme))
+	utilruntime.Must(computev1alpha1.AddToScheme(onmetalScheme))
+	utilruntime.Must(networkingv1alpha1.AddToScheme(onmetalScheme))
+}
+
+func TestE2E(t *testing.T) {
+	SetDefaultEventuallyPollingInterval(pollingInterval)
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Cloud Provider E2E Suite")
+}
+
+var _ = BeforeSuite(func() {
+	Expect(*targetKubeconfig).NotTo(BeEmpty(), "--target-kubeconfig is required")
+	Expect(*onmetalKubeconfig).NotTo(BeEmpty(), "--onmetal-kubeconfig is required")
+	SetDefaultEventuallyTimeout(*timeout)
+
+	targetConfig, err := clientcmd.BuildConfigFromFlags("", *targetKubeconfig)
+	Expect(err).NotTo(HaveOccurred(), "failed to load target kubeconfig")
+	targetClient, err = client.New(targetConfig, client.Options{Scheme: targetScheme})
+	Expect(err).NotTo(HaveOccurred())
+
+	onmetalClientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: *onmetalKubeconfig},
+		&clientcmd.ConfigOverrides{},
+	)
+	onmetalConfig, err := onmetalClientConfig.ClientConfig()
+	Expect(err).NotTo(HaveOccurred(), "failed to load onmetal kubeconfig")
+	if *onmetalNamespace == "" {
+		*onmetalNamespace, _, err = onmetalClientConfig.Namespace()
+		Expect(err).NotTo(HaveOccurred(), "failed to get namespace of onmetal kubeconfig")
+	}
+	onmetalClient, err = client.New(onmetalConfig, client.Options{Scheme: onmetalScheme})
+	Expect(err).NotTo(HaveOccurred())
+})
+
+// createTestNamespace creates a temporary namespace in the target cluster, which is deleted once the spec is done.
+func createTestNamespace(ctx context.Context) *corev1.Namespace {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "onmetal-e2e-"}}
+	Expect(targetClient.Create(ctx, namespace)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		Expect(client.IgnoreNotFound(targetClient.Delete(ctx, namespace))).To(Succeed())
+	})
+	return namespace
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build e2e
+
+package e2e
+
+import (
+	"strings"
+
+	computev1alpha1 "github.com/onmetal/onmetal-api/api/compute/v1alpha1"
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/onmetal/cloud-provider-onmetal/pkg/cloudprovider/onmetal"
+)
+
+var _ = Describe("Instances", func() {
+	It("should initialize every node from its onmetal machine", func(ctx SpecContext) {
+		nodeList := &corev1.NodeList{}
+		Expect(targetClient.List(ctx, nodeList)).To(Succeed())
+		Expect(nodeList.Items).NotTo(BeEmpty())
+
+		for _, node := range nodeList.Items {
+			By("verifying node " + node.Name)
+			Expect(node.Spec.Taints).NotTo(ContainElement(HaveField("Key", "node.cloudprovider.kubernetes.io/uninitialized")),
+				"node %s is not initialized by the cloud provider", node.Name)
+
+			rest, ok := strings.CutPrefix(node.Spec.ProviderID, onmetal.ProviderName+"://")
+			Expect(ok).To(BeTrue(), "node %s has provider ID %q", node.Name, node.Spec.ProviderID)
+			namespace, name, ok := strings.Cut(rest, "/")
+			Expect(ok).To(BeTrue(), "node %s has provider ID %q", node.Name, node.Spec.ProviderID)
+			Expect(namespace).To(Equal(*onmetalNamespace))
+
+			machine := &computev1alpha1.Machine{}
+			Expect(onmetalClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, machine)).To(Succeed())
+			Expect(machine.Status.State).To(Equal(computev1alpha1.MachineStateRunning))
+			Expect(machine.Labels).To(HaveKeyWithValue(onmetal.LabelKeyClusterName, *clusterName),
+				"machine %s of node %s is not labeled with the cluster name", machine.Name, node.Name)
+
+			var nodeIPs []string
+			for _, address := range node.Status.Addresses {
+				if address.Type == corev1.NodeInternalIP {
+					nodeIPs = append(nodeIPs, address.Address)
+				}
+			}
+			Expect(nodeIPs).NotTo(BeEmpty(), "node %s has no internal IPs", node.Name)
+
+			var machineIPs []string
+			for _, nicStatus := range machine.Status.NetworkInterfaces {
+				for _, ip := range nicStatus.IPs {
+					machineIPs = append(machineIPs, ip.String())
+				}
+			}
+			for _, ip := range nodeIPs {
+				Expect(machineIPs).To(ContainElement(ip), "internal IP %s of node %s is no IP of machine %s", ip, node.Name, machine.Name)
+			}
+
+			for _, nic := range machine.Spec.NetworkInterfaces {
+				if nic.NetworkInterfaceRef == nil {
+					continue
+				}
+				networkInterface := &networkingv1alpha1.NetworkInterface{}
+				Expect(onmetalClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: nic.NetworkInterfaceRef.Name}, networkInterface)).To(Succeed())
+				Expect(networkInterface.Labels).To(HaveKeyWithValue(onmetal.LabelKeyClusterName, *clusterName),
+					"network interface %s of node %s is not labeled with the cluster name", networkInterface.Name, node.Name)
+			}
+		}
+	})
+})
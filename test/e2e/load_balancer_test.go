@@ -0,0 +1,216 @@
+// Copyright 2023 OnMetal authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	networkingv1alpha1 "github.com/onmetal/onmetal-api/api/networking/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/onmetal/cloud-provider-onmetal/pkg/cloudprovider/onmetal"
+)
+
+const (
+	backendPort  = 8080
+	servicePort  = 80
+	backendCount = 2
+)
+
+var _ = Describe("LoadBalancer", func() {
+	It("should provision, route and delete a public load balancer", func(ctx SpecContext) {
+		verifyLoadBalancer(ctx, nil)
+	})
+
+	It("should provision, route and delete an internal load balancer", func(ctx SpecContext) {
+		if !*internal {
+			Skip("internal load balancers are not verified, see --internal")
+		}
+		verifyLoadBalancer(ctx, map[string]string{onmetal.InternalLoadBalancerAnnotation: "true"})
+	})
+})
+
+// verifyLoadBalancer creates a Service of type LoadBalancer with the given annotations in front of a Deployment of
+// backends and verifies the cloud provider provisions, routes and deletes its onmetal LoadBalancer.
+func verifyLoadBalancer(ctx context.Context, annotations map[string]string) {
+	namespace := createTestNamespace(ctx)
+
+	By("creating the backends")
+	labels := map[string]string{"app": "onmetal-e2e-backend"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace.Name,
+			Name:      "backend",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(backendCount),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "netexec",
+						Image: *backendImage,
+						Args:  []string{"netexec", "--http-port=" + strconv.Itoa(backendPort)},
+						Ports: []corev1.ContainerPort{{
+							ContainerPort: backendPort,
+							Protocol:      corev1.ProtocolTCP,
+						}},
+					}},
+				},
+			},
+		},
+	}
+	Expect(targetClient.Create(ctx, deployment)).To(Succeed())
+	Eventually(func(g Gomega) {
+		g.Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+		g.Expect(deployment.Status.AvailableReplicas).To(BeEquivalentTo(backendCount))
+	}).WithContext(ctx).Should(Succeed(), "backends did not become available")
+
+	By("creating the service")
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace.Name,
+			Name:        "backend",
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeLoadBalancer,
+			Selector: labels,
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       servicePort,
+				TargetPort: intstr.FromInt(backendPort),
+			}},
+		},
+	}
+	Expect(targetClient.Create(ctx, service)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		Expect(client.IgnoreNotFound(targetClient.Delete(ctx, service))).To(Succeed())
+	})
+
+	By("waiting for the ingress of the service")
+	Eventually(func(g Gomega) {
+		g.Expect(targetClient.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		g.Expect(service.Status.LoadBalancer.Ingress).NotTo(BeEmpty())
+	}).WithContext(ctx).Should(Succeed(), "service did not get an ingress")
+
+	By("verifying the onmetal load balancer")
+	loadBalancer := getLoadBalancerForService(ctx, service)
+	Expect(loadBalancer.Labels).To(HaveKeyWithValue(onmetal.LabelKeyClusterName, *clusterName))
+	Expect(loadBalancer.Spec.Ports).To(ContainElement(HaveField("Port", BeEquivalentTo(servicePort))))
+	if _, ok := annotations[onmetal.InternalLoadBalancerAnnotation]; ok {
+		Expect(loadBalancer.Spec.Type).To(Equal(networkingv1alpha1.LoadBalancerTypeInternal))
+	} else {
+		Expect(loadBalancer.Spec.Type).To(Equal(networkingv1alpha1.LoadBalancerTypePublic))
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP == "" {
+			continue
+		}
+		Expect(loadBalancer.Status.IPs).To(ContainElement(HaveField("String()", ingress.IP)),
+			"ingress IP %s is not an IP of load balancer %s", ingress.IP, loadBalancer.Name)
+	}
+
+	By("verifying the routing of the onmetal load balancer")
+	Eventually(func(g Gomega) {
+		routing := &networkingv1alpha1.LoadBalancerRouting{}
+		g.Expect(onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), routing)).To(Succeed())
+		g.Expect(routing.Destinations).NotTo(BeEmpty())
+	}).WithContext(ctx).Should(Succeed(), "load balancer routing has no destinations")
+
+	if *connectivity {
+		By("verifying the connectivity to the backends")
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			address := ingress.IP
+			if address == "" {
+				address = ingress.Hostname
+			}
+			url := fmt.Sprintf("http://%s/hostname", net.JoinHostPort(address, strconv.Itoa(servicePort)))
+			Eventually(func(g Gomega) {
+				g.Expect(httpGet(ctx, url)).To(HavePrefix(deployment.Name + "-"))
+			}).WithContext(ctx).Should(Succeed(), "backends are not reachable via %s", url)
+		}
+	}
+
+	By("deleting the service")
+	Expect(targetClient.Delete(ctx, service)).To(Succeed())
+	Eventually(func(g Gomega) {
+		err := onmetalClient.Get(ctx, client.ObjectKeyFromObject(loadBalancer), &networkingv1alpha1.LoadBalancer{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "load balancer %s still exists", loadBalancer.Name)
+	}).WithContext(ctx).Should(Succeed(), "load balancer was not deleted")
+}
+
+// getLoadBalancerForService waits for the onmetal LoadBalancer of the given Service, looked up by the name recorded in
+// the Service or, with older cloud provider versions, by the UID label of the Service.
+func getLoadBalancerForService(ctx context.Context, service *corev1.Service) *networkingv1alpha1.LoadBalancer {
+	loadBalancer := &networkingv1alpha1.LoadBalancer{}
+	Eventually(func(g Gomega) {
+		if name := service.Annotations[onmetal.AnnotationKeyLoadBalancerName]; name != "" {
+			g.Expect(onmetalClient.Get(ctx, client.ObjectKey{Namespace: *onmetalNamespace, Name: name}, loadBalancer)).To(Succeed())
+			return
+		}
+
+		loadBalancerList := &networkingv1alpha1.LoadBalancerList{}
+		g.Expect(onmetalClient.List(ctx, loadBalancerList,
+			client.InNamespace(*onmetalNamespace),
+			client.MatchingLabels{onmetal.LabelKeyServiceUID: string(service.UID)},
+		)).To(Succeed())
+		g.Expect(loadBalancerList.Items).To(HaveLen(1))
+		loadBalancerList.Items[0].DeepCopyInto(loadBalancer)
+	}).WithContext(ctx).Should(Succeed(), "onmetal load balancer of service %s/%s not found", service.Namespace, service.Name)
+	return loadBalancer
+}
+
+func httpGet(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+	return string(body), nil
+}